@@ -0,0 +1,48 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package api_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rs/zerolog/log"
+
+	"github.com/penny-vault/pvdata/library"
+)
+
+func TestAPI(t *testing.T) {
+	log.Logger = log.Output(GinkgoWriter)
+
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "API Suite")
+}
+
+// testLibrary opens the library database named by PVDATA_TEST_DB_URL (see
+// pvdata init); specs that need a database are skipped when it is not set
+func testLibrary(ctx context.Context) *library.Library {
+	dbURL := os.Getenv("PVDATA_TEST_DB_URL")
+	if dbURL == "" {
+		Skip("PVDATA_TEST_DB_URL is not set")
+	}
+
+	myLibrary, err := library.NewFromDB(ctx, dbURL)
+	Expect(err).NotTo(HaveOccurred())
+
+	return myLibrary
+}
@@ -0,0 +1,116 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/penny-vault/pvdata/data"
+	"github.com/rs/zerolog/log"
+)
+
+// ArrowStreamContentType is the media type of Arrow IPC streams
+const ArrowStreamContentType = "application/vnd.apache.arrow.stream"
+
+// arrowFilters maps query parameters to the column they filter; each accepts a
+// comma separated list of values
+var arrowFilters = []struct {
+	param  string
+	column string
+	upper  bool
+}{
+	{"ticker", "ticker", true},
+	{"figi", "composite_figi", true},
+	{"series", "series", false},
+	{"dimension", "dimension", false},
+	{"market", "market", false},
+}
+
+// handleArrow streams every row of a data type matching the request's filters
+// as Arrow IPC record batches ordered by the data type's primary key. The
+// response is not paged.
+func (server *Server) handleArrow(w http.ResponseWriter, r *http.Request) {
+	dataTypeName := r.PathValue("dataType")
+	dataType, ok := data.DataTypes[dataTypeName]
+	if !ok {
+		writeError(w, r, fmt.Errorf("%w: unknown data type %s", ErrNotFound, dataTypeName))
+		return
+	}
+
+	table, err := server.sourceTable(r, dataTypeName)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	columns := dataType.Columns()
+	hasColumn := func(name string) bool {
+		return slices.ContainsFunc(columns, func(column *data.Column) bool { return column.Name == name })
+	}
+
+	query := data.NewTableQuery(table, dataType.PrimaryKey...)
+	for _, filter := range arrowFilters {
+		val := r.URL.Query().Get(filter.param)
+		if val == "" {
+			continue
+		}
+
+		if !hasColumn(filter.column) {
+			writeError(w, r, fmt.Errorf("%w: %s cannot be filtered by %s", ErrBadRequest, dataTypeName, filter.param))
+			return
+		}
+
+		if filter.upper {
+			val = strings.ToUpper(val)
+		}
+		query.Where(fmt.Sprintf(`"%s" = ANY($%%d)`, filter.column), strings.Split(val, ","))
+	}
+
+	if r.URL.Query().Has("start") || r.URL.Query().Has("end") {
+		if !hasColumn("event_date") {
+			writeError(w, r, fmt.Errorf("%w: %s does not have dates", ErrBadRequest, dataTypeName))
+			return
+		}
+
+		if err := dateRange(r, query); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+
+	// query errors are reported before the response is committed
+	rows, err := query.QueryArrow(ctx, server.Library.Pool, dataType)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	w.Header().Set("Content-Type", ArrowStreamContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.arrows"`, dataTypeName))
+
+	numRows, err := rows.Write(w, data.DefaultArrowBatchSize)
+	if err != nil {
+		// the status has already been sent; the client sees a truncated stream
+		log.Error().Err(err).Str("DataType", dataTypeName).Int64("Rows", numRows).Msg("arrow stream failed")
+		return
+	}
+
+	log.Debug().Str("DataType", dataTypeName).Int64("Rows", numRows).Msg("streamed arrow records")
+}
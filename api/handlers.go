@@ -0,0 +1,533 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/penny-vault/pvdata/data"
+	"github.com/penny-vault/pvdata/library"
+)
+
+// subscriptionView is the public representation of a subscription; provider
+// configuration and settings are omitted since they hold credentials
+type subscriptionView struct {
+	ID                      string    `json:"id"`
+	Name                    string    `json:"name"`
+	Provider                string    `json:"provider"`
+	Dataset                 string    `json:"dataset"`
+	DataTypes               []string  `json:"data_types"`
+	Schedule                string    `json:"schedule"`
+	Active                  bool      `json:"active"`
+	LastRun                 time.Time `json:"last_run"`
+	LastStatus              string    `json:"last_status"`
+	TotalRecords            int64     `json:"total_records"`
+	NumRecordsLastImport    int64     `json:"num_records_last_import"`
+	TotalSecurities         int64     `json:"total_securities"`
+	NumSecuritiesLastImport int64     `json:"num_securities_last_import"`
+	FirstObsDate            time.Time `json:"first_obs_date"`
+	LastObsDate             time.Time `json:"last_obs_date"`
+	CreatedOn               time.Time `json:"created_on"`
+}
+
+var subscriptionCSVHeader = []string{"id", "name", "provider", "dataset", "data_types", "schedule", "active",
+	"last_run", "last_status", "total_records", "num_records_last_import", "total_securities",
+	"num_securities_last_import", "first_obs_date", "last_obs_date", "created_on"}
+
+func newSubscriptionView(sub *library.Subscription) *subscriptionView {
+	return &subscriptionView{
+		ID:                      sub.ID.String(),
+		Name:                    sub.Name,
+		Provider:                sub.Provider,
+		Dataset:                 sub.Dataset,
+		DataTypes:               sub.DataTypes,
+		Schedule:                sub.Schedule,
+		Active:                  sub.Active,
+		LastRun:                 sub.LastRun,
+		LastStatus:              sub.LastStatus,
+		TotalRecords:            sub.TotalRecords,
+		NumRecordsLastImport:    sub.NumRecordsLastImport,
+		TotalSecurities:         sub.TotalSecurities,
+		NumSecuritiesLastImport: sub.NumSecuritiesLastImport,
+		FirstObsDate:            sub.FirstObsDate,
+		LastObsDate:             sub.LastObsDate,
+		CreatedOn:               sub.CreatedOn,
+	}
+}
+
+func (view *subscriptionView) record() []string {
+	return []string{view.ID, view.Name, view.Provider, view.Dataset, strings.Join(view.DataTypes, " "), view.Schedule,
+		strconv.FormatBool(view.Active), view.LastRun.Format(time.RFC3339), view.LastStatus,
+		strconv.FormatInt(view.TotalRecords, 10), strconv.FormatInt(view.NumRecordsLastImport, 10),
+		strconv.FormatInt(view.TotalSecurities, 10), strconv.FormatInt(view.NumSecuritiesLastImport, 10),
+		view.FirstObsDate.Format("2006-01-02"), view.LastObsDate.Format("2006-01-02"), view.CreatedOn.Format(time.RFC3339)}
+}
+
+type qualityView struct {
+	SubscriptionID string `json:"subscription_id"`
+	Rule           string `json:"rule"`
+	Action         string `json:"action"`
+	Count          int64  `json:"count"`
+}
+
+// libraryView is the data `pvdata info` renders as markdown
+type libraryView struct {
+	Name                  string              `json:"name"`
+	NumSubscriptions      int                 `json:"num_subscriptions"`
+	SecuritiesTracked     int                 `json:"securities_tracked"`
+	TotalRecords          int                 `json:"total_records"`
+	LastUpdated           *time.Time          `json:"last_updated"`
+	Subscriptions         []*subscriptionView `json:"subscriptions"`
+	InactiveSubscriptions []*subscriptionView `json:"inactive_subscriptions"`
+	Quality               []*qualityView      `json:"quality_last_30_days"`
+}
+
+// sortedSubscriptions returns the library's subscriptions oldest first
+func (server *Server) sortedSubscriptions(ctx context.Context) ([]*library.Subscription, error) {
+	subscriptions, err := server.Library.Subscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortStableFunc(subscriptions, func(a, b *library.Subscription) int {
+		return a.CreatedOn.Compare(b.CreatedOn)
+	})
+
+	return subscriptions, nil
+}
+
+func (server *Server) handleLibrary(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	view := &libraryView{
+		Name:                  server.Library.Name,
+		Subscriptions:         make([]*subscriptionView, 0),
+		InactiveSubscriptions: make([]*subscriptionView, 0),
+		Quality:               make([]*qualityView, 0),
+	}
+
+	var err error
+	if view.NumSubscriptions, err = server.Library.NumSubscriptions(ctx); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if view.SecuritiesTracked, err = server.Library.TotalSecurities(ctx); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if view.TotalRecords, err = server.Library.TotalRecords(ctx); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	lastUpdated, err := server.Library.LastUpdated(ctx)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if !lastUpdated.IsZero() {
+		view.LastUpdated = &lastUpdated
+	}
+
+	subscriptions, err := server.sortedSubscriptions(ctx)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	for _, sub := range subscriptions {
+		if sub.Active {
+			view.Subscriptions = append(view.Subscriptions, newSubscriptionView(sub))
+		} else {
+			view.InactiveSubscriptions = append(view.InactiveSubscriptions, newSubscriptionView(sub))
+		}
+	}
+
+	counts, err := server.Library.QualitySummary(ctx, time.Now().AddDate(0, 0, -30))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	for _, count := range counts {
+		view.Quality = append(view.Quality, &qualityView{
+			SubscriptionID: count.SubscriptionID,
+			Rule:           count.Rule,
+			Action:         count.Action,
+			Count:          count.Count,
+		})
+	}
+
+	writeJSON(w, r, view)
+}
+
+func (server *Server) handleSubscriptions(w http.ResponseWriter, r *http.Request) {
+	format, err := requestFormat(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	subscriptions, err := server.sortedSubscriptions(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	views := make([]*subscriptionView, 0, len(subscriptions))
+	for _, sub := range subscriptions {
+		views = append(views, newSubscriptionView(sub))
+	}
+
+	if format == FormatCSV {
+		records := make([][]string, 0, len(views)+1)
+		records = append(records, subscriptionCSVHeader)
+		for _, view := range views {
+			records = append(records, view.record())
+		}
+		writeCSV(w, r, records)
+		return
+	}
+
+	writeJSON(w, r, map[string]any{"data": views})
+}
+
+func (server *Server) handleSubscription(w http.ResponseWriter, r *http.Request) {
+	sub, err := server.Library.SubscriptionFromID(r.Context(), r.PathValue("id"))
+	if pgxscan.NotFound(err) {
+		writeError(w, r, fmt.Errorf("%w: subscription %s", ErrNotFound, r.PathValue("id")))
+		return
+	}
+
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, newSubscriptionView(sub))
+}
+
+func (server *Server) handleAssetSearch(w http.ResponseWriter, r *http.Request) {
+	query := data.NewTableQuery(data.DefaultAssetTable(), "ticker", "composite_figi")
+
+	if q := strings.TrimSpace(r.URL.Query().Get("q")); q != "" {
+		query.Where("(ticker = upper($%[1]d) OR composite_figi = upper($%[1]d) OR name ILIKE '%%' || $%[1]d || '%%')", q)
+	}
+
+	if val := r.URL.Query().Get("active"); val != "" {
+		active, err := strconv.ParseBool(val)
+		if err != nil {
+			writeError(w, r, fmt.Errorf("%w: active must be true or false", ErrBadRequest))
+			return
+		}
+		query.Where("active = $%d", active)
+	}
+
+	if val := r.URL.Query().Get("type"); val != "" {
+		query.Where("asset_type::text = $%d", val)
+	}
+
+	server.serveTable(w, r, query)
+}
+
+// handleAsset looks up an asset by composite FIGI or ticker; tickers prefer the
+// active asset, then the most recently delisted
+func (server *Server) handleAsset(w http.ResponseWriter, r *http.Request) {
+	id := strings.ToUpper(r.PathValue("id"))
+
+	query := data.NewTableQuery(data.DefaultAssetTable(), "active DESC NULLS LAST", "delisted DESC NULLS FIRST")
+	if data.IsFigi(id) {
+		query.Where("composite_figi = $%d", id)
+	} else {
+		query.Where("ticker = $%d", id)
+	}
+	query.Limit = 1
+
+	server.serveOne(w, r, query, fmt.Errorf("%w: asset %s", ErrNotFound, id))
+}
+
+func (server *Server) handleEod(w http.ResponseWriter, r *http.Request) {
+	server.serveSeries(w, r, data.EODKey, r.PathValue("asset"), nil)
+}
+
+func (server *Server) handleFundamentals(w http.ResponseWriter, r *http.Request) {
+	server.serveSeries(w, r, data.FundamentalsKey, r.PathValue("asset"), func(query *data.TableQuery) {
+		if dimension := r.URL.Query().Get("dimension"); dimension != "" {
+			query.Where("dimension = $%d", dimension)
+		}
+	})
+}
+
+func (server *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	server.serveSeries(w, r, data.MetricKey, r.PathValue("asset"), nil)
+}
+
+func (server *Server) handleIndicators(w http.ResponseWriter, r *http.Request) {
+	table, err := server.sourceTable(r, data.EconomicIndicatorKey)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	query := data.NewTableQuery(table, "event_date").Where("series = $%d", r.PathValue("series"))
+	if err := dateRange(r, query); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	server.serveTable(w, r, query)
+}
+
+func (server *Server) handleHolidays(w http.ResponseWriter, r *http.Request) {
+	table, err := server.sourceTable(r, data.MarketHolidaysKey)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	query := data.NewTableQuery(table, "event_date", "market")
+	if market := r.URL.Query().Get("market"); market != "" {
+		query.Where("market = $%d", market)
+	}
+
+	if err := dateRange(r, query); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	server.serveTable(w, r, query)
+}
+
+// serveSeries serves the rows of a per-asset time series; `asset` is a
+// composite FIGI or a ticker
+func (server *Server) serveSeries(w http.ResponseWriter, r *http.Request, dataType, asset string, filter func(*data.TableQuery)) {
+	table, err := server.sourceTable(r, dataType)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	query := data.NewTableQuery(table, data.DataTypes[dataType].PrimaryKey...)
+
+	asset = strings.ToUpper(asset)
+	if data.IsFigi(asset) {
+		query.Where("composite_figi = $%d", asset)
+	} else {
+		query.Where("ticker = $%d", asset)
+	}
+
+	if err := dateRange(r, query); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if filter != nil {
+		filter(query)
+	}
+
+	server.serveTable(w, r, query)
+}
+
+// sourceTable returns the table holding `dataType`. The subscription can be
+// chosen with ?subscription=<id>; otherwise the oldest active one is used.
+func (server *Server) sourceTable(r *http.Request, dataType string) (string, error) {
+	subscriptions, err := server.Library.SubscriptionsWithDataType(r.Context(), dataType)
+	if err != nil {
+		return "", err
+	}
+
+	slices.SortStableFunc(subscriptions, func(a, b *library.Subscription) int {
+		return a.CreatedOn.Compare(b.CreatedOn)
+	})
+
+	requested := r.URL.Query().Get("subscription")
+	for _, sub := range subscriptions {
+		if requested == "" || strings.HasPrefix(sub.ID.String(), requested) {
+			return sub.DataTablesMap[dataType], nil
+		}
+	}
+
+	if requested != "" {
+		return "", fmt.Errorf("%w: no active %s subscription %s", ErrNotFound, dataType, requested)
+	}
+
+	return "", fmt.Errorf("%w: no active %s subscription", ErrNotFound, dataType)
+}
+
+// dateRange filters event_date by ?start= and ?end= (inclusive)
+func dateRange(r *http.Request, query *data.TableQuery) error {
+	for _, param := range []struct {
+		name      string
+		condition string
+	}{{"start", "event_date >= $%d"}, {"end", "event_date <= $%d"}} {
+		val := r.URL.Query().Get(param.name)
+		if val == "" {
+			continue
+		}
+
+		dt, err := time.Parse("2006-01-02", val)
+		if err != nil {
+			return fmt.Errorf("%w: %s must be formatted YYYY-MM-DD", ErrBadRequest, param.name)
+		}
+		query.Where(param.condition, dt)
+	}
+
+	return nil
+}
+
+// serveTable sends a page of the query's rows. JSON responses are wrapped in
+// {"data": [...], "next": "..."}; the next page is also linked in a Link header.
+func (server *Server) serveTable(w http.ResponseWriter, r *http.Request, query *data.TableQuery) {
+	format, err := requestFormat(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	current, err := parsePage(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	// read one more row than requested to learn if there is another page
+	query.Limit = current.Limit + 1
+	query.Offset = current.Offset
+
+	ctx := r.Context()
+	if format == FormatCSV {
+		columns, rows, err := query.Rows(ctx, server.Library.Pool)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		if len(rows) > current.Limit {
+			rows = rows[:current.Limit]
+			setNextLink(w, nextURL(r, current))
+		}
+
+		buf := &bytes.Buffer{}
+		csvWriter, err := data.NewCSVWriter(buf, columns)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		for _, row := range rows {
+			if err := csvWriter.Write(row); err != nil {
+				writeError(w, r, err)
+				return
+			}
+		}
+
+		if err := csvWriter.Close(); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeBody(w, r, FormatCSV, buf.Bytes())
+		return
+	}
+
+	rows, err := query.JSON(ctx, server.Library.Pool)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	next := ""
+	if len(rows) > current.Limit {
+		rows = rows[:current.Limit]
+		next = nextURL(r, current)
+		setNextLink(w, next)
+	}
+
+	response := struct {
+		Data   []json.RawMessage `json:"data"`
+		Limit  int               `json:"limit"`
+		Offset int               `json:"offset"`
+		Next   string            `json:"next,omitempty"`
+	}{
+		Data:   rows,
+		Limit:  current.Limit,
+		Offset: current.Offset,
+		Next:   next,
+	}
+
+	writeJSON(w, r, response)
+}
+
+// serveOne sends the first row of the query or `notFound` if there is none
+func (server *Server) serveOne(w http.ResponseWriter, r *http.Request, query *data.TableQuery, notFound error) {
+	format, err := requestFormat(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if format == FormatCSV {
+		columns, rows, err := query.Rows(r.Context(), server.Library.Pool)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		if len(rows) == 0 {
+			writeError(w, r, notFound)
+			return
+		}
+
+		buf := &bytes.Buffer{}
+		csvWriter, err := data.NewCSVWriter(buf, columns)
+		if err == nil {
+			err = csvWriter.Write(rows[0])
+		}
+		if err == nil {
+			err = csvWriter.Close()
+		}
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeBody(w, r, FormatCSV, buf.Bytes())
+		return
+	}
+
+	rows, err := query.JSON(r.Context(), server.Library.Pool)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if len(rows) == 0 {
+		writeError(w, r, notFound)
+		return
+	}
+
+	writeBody(w, r, FormatJSON, rows[0])
+}
@@ -0,0 +1,221 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/penny-vault/pvdata/library"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultListenAddr is where `pvdata serve` listens; override with serve.listen
+	DefaultListenAddr = ":8080"
+
+	// DefaultPageSize is the number of rows returned when no limit is requested
+	DefaultPageSize = 1000
+
+	// MaxPageSize is the largest limit a request may ask for
+	MaxPageSize = 10000
+)
+
+var (
+	ErrBadRequest = errors.New("bad request")
+	ErrNotFound   = errors.New("not found")
+)
+
+// Format of a response body
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatCSV  Format = "csv"
+)
+
+// Server is a read-only HTTP API over a library
+type Server struct {
+	Library *library.Library
+
+	mux *http.ServeMux
+}
+
+// New creates an API server for `myLibrary`
+func New(myLibrary *library.Library) *Server {
+	server := &Server{
+		Library: myLibrary,
+		mux:     http.NewServeMux(),
+	}
+
+	server.mux.HandleFunc("GET /v1/library", server.handleLibrary)
+	server.mux.HandleFunc("GET /v1/subscriptions", server.handleSubscriptions)
+	server.mux.HandleFunc("GET /v1/subscriptions/{id}", server.handleSubscription)
+	server.mux.HandleFunc("GET /v1/assets", server.handleAssetSearch)
+	server.mux.HandleFunc("GET /v1/assets/{id}", server.handleAsset)
+	server.mux.HandleFunc("GET /v1/eod/{asset}", server.handleEod)
+	server.mux.HandleFunc("GET /v1/fundamentals/{asset}", server.handleFundamentals)
+	server.mux.HandleFunc("GET /v1/metrics/{asset}", server.handleMetrics)
+	server.mux.HandleFunc("GET /v1/indicators/{series}", server.handleIndicators)
+	server.mux.HandleFunc("GET /v1/holidays", server.handleHolidays)
+	server.mux.HandleFunc("GET /v1/arrow/{dataType}", server.handleArrow)
+
+	return server
+}
+
+func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server.mux.ServeHTTP(w, r)
+}
+
+// page is the window of rows requested with ?limit=&offset=
+type page struct {
+	Limit  int
+	Offset int
+}
+
+func parsePage(r *http.Request) (page, error) {
+	result := page{Limit: DefaultPageSize}
+	query := r.URL.Query()
+
+	if val := query.Get("limit"); val != "" {
+		limit, err := strconv.Atoi(val)
+		if err != nil || limit < 1 || limit > MaxPageSize {
+			return result, fmt.Errorf("%w: limit must be between 1 and %d", ErrBadRequest, MaxPageSize)
+		}
+		result.Limit = limit
+	}
+
+	if val := query.Get("offset"); val != "" {
+		offset, err := strconv.Atoi(val)
+		if err != nil || offset < 0 {
+			return result, fmt.Errorf("%w: offset must be a non-negative integer", ErrBadRequest)
+		}
+		result.Offset = offset
+	}
+
+	return result, nil
+}
+
+// nextURL returns the URL of the page after `current`
+func nextURL(r *http.Request, current page) string {
+	next := *r.URL
+	query := next.Query()
+	query.Set("limit", strconv.Itoa(current.Limit))
+	query.Set("offset", strconv.Itoa(current.Offset+current.Limit))
+	next.RawQuery = query.Encode()
+	return next.RequestURI()
+}
+
+// requestFormat returns the format selected by ?format= or the Accept header
+func requestFormat(r *http.Request) (Format, error) {
+	switch strings.ToLower(r.URL.Query().Get("format")) {
+	case "":
+		if strings.Contains(r.Header.Get("Accept"), "text/csv") {
+			return FormatCSV, nil
+		}
+		return FormatJSON, nil
+	case string(FormatJSON):
+		return FormatJSON, nil
+	case string(FormatCSV):
+		return FormatCSV, nil
+	default:
+		return "", fmt.Errorf("%w: format must be json or csv", ErrBadRequest)
+	}
+}
+
+// writeBody sends `body` with an ETag; requests whose If-None-Match matches
+// receive 304 Not Modified
+func writeBody(w http.ResponseWriter, r *http.Request, format Format, body []byte) {
+	digest := sha256.Sum256(body)
+	etag := fmt.Sprintf(`"%s"`, hex.EncodeToString(digest[:16]))
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+
+	for _, match := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		if match = strings.TrimSpace(match); match == etag || match == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	switch format {
+	case FormatCSV:
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	default:
+		w.Header().Set("Content-Type", "application/json")
+	}
+
+	if _, err := w.Write(body); err != nil {
+		log.Warn().Err(err).Str("Path", r.URL.Path).Msg("could not write response")
+	}
+}
+
+// writeJSON marshals `val` and sends it
+func writeJSON(w http.ResponseWriter, r *http.Request, val any) {
+	body, err := json.Marshal(val)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeBody(w, r, FormatJSON, body)
+}
+
+// writeCSV formats `records` as CSV and sends them
+func writeCSV(w http.ResponseWriter, r *http.Request, records [][]string) {
+	buf := &bytes.Buffer{}
+	csvWriter := csv.NewWriter(buf)
+	if err := csvWriter.WriteAll(records); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeBody(w, r, FormatCSV, buf.Bytes())
+}
+
+// writeError sends the error as {"error": "..."} with a status matching its kind
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrBadRequest):
+		status = http.StatusBadRequest
+	case errors.Is(err, ErrNotFound):
+		status = http.StatusNotFound
+	default:
+		log.Error().Err(err).Str("Path", r.URL.Path).Msg("api request failed")
+	}
+
+	msg := err.Error()
+	if status == http.StatusInternalServerError {
+		// don't leak database details to clients
+		msg = http.StatusText(status)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+// setNextLink advertises the next page in a Link header
+func setNextLink(w http.ResponseWriter, next string) {
+	w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next))
+}
@@ -0,0 +1,277 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/viper"
+
+	"github.com/penny-vault/pvdata/api"
+	"github.com/penny-vault/pvdata/data"
+	"github.com/penny-vault/pvdata/library"
+)
+
+// get requests `path` from `server` with the given header name/value pairs
+func get(server *api.Server, path string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for idx := 0; idx+1 < len(headers); idx += 2 {
+		req.Header.Set(headers[idx], headers[idx+1])
+	}
+
+	resp := httptest.NewRecorder()
+	server.ServeHTTP(resp, req)
+	return resp
+}
+
+// tablePage is the JSON body of a paged response
+type tablePage struct {
+	Data   []map[string]any `json:"data"`
+	Limit  int              `json:"limit"`
+	Offset int              `json:"offset"`
+	Next   string           `json:"next"`
+}
+
+func decodePage(resp *httptest.ResponseRecorder) *tablePage {
+	result := &tablePage{}
+	Expect(json.Unmarshal(resp.Body.Bytes(), result)).To(Succeed())
+	return result
+}
+
+var _ = Describe("Server", func() {
+	DescribeTable("rejects bad parameters before querying the library",
+		func(path string) {
+			server := api.New(&library.Library{})
+			resp := get(server, path)
+
+			Expect(resp.Code).To(Equal(http.StatusBadRequest))
+			Expect(resp.Header().Get("Content-Type")).To(Equal("application/json"))
+			Expect(resp.Body.String()).To(ContainSubstring(`"error"`))
+		},
+		Entry("a zero limit", "/v1/assets?limit=0"),
+		Entry("a limit over the maximum", "/v1/assets?limit=10001"),
+		Entry("a negative offset", "/v1/assets?offset=-1"),
+		Entry("an unknown format", "/v1/assets?format=xml"),
+		Entry("a non-boolean active filter", "/v1/assets?active=maybe"),
+	)
+
+	It("returns 404 for an unknown arrow data type", func() {
+		resp := get(api.New(&library.Library{}), "/v1/arrow/nope")
+		Expect(resp.Code).To(Equal(http.StatusNotFound))
+	})
+
+	Context("with a library", Ordered, func() {
+		var (
+			ctx          context.Context
+			myLibrary    *library.Library
+			subscription *library.Subscription
+			server       *api.Server
+			indicators   string
+		)
+
+		BeforeAll(func() {
+			ctx = context.Background()
+			myLibrary = testLibrary(ctx)
+
+			subscription = &library.Subscription{
+				ID:        uuid.New(),
+				Name:      "api test",
+				Provider:  "fred",
+				Dataset:   "Economic Indicators",
+				Config:    map[string]string{},
+				DataTypes: []string{data.EconomicIndicatorKey},
+				Library:   myLibrary,
+			}
+			subscription.ComputeTableNames()
+			Expect(subscription.Save(ctx)).To(Succeed())
+
+			_, err := myLibrary.Pool.Exec(ctx, `INSERT INTO `+subscription.DataTablesMap[data.EconomicIndicatorKey]+
+				` (series, event_date, value) VALUES ('TEST', '2024-01-02', 1), ('TEST', '2024-01-03', 2), ('TEST', '2024-01-04', 3)`)
+			Expect(err).NotTo(HaveOccurred())
+
+			// serve assets from a table of our own to check default.asset_table is respected
+			_, err = myLibrary.Pool.Exec(ctx, `CREATE TABLE api_test_assets (LIKE asset_master INCLUDING ALL);
+INSERT INTO api_test_assets (composite_figi, ticker, name, active) VALUES ('BBG00APITEST', 'APITEST', 'API Test Fund', true);`)
+			Expect(err).NotTo(HaveOccurred())
+			viper.Set("default.asset_table", "api_test_assets")
+
+			server = api.New(myLibrary)
+			indicators = "/v1/indicators/TEST?subscription=" + subscription.ID.String()[:8]
+		})
+
+		AfterAll(func() {
+			if myLibrary == nil {
+				return
+			}
+
+			viper.Set("default.asset_table", "")
+			_, err := myLibrary.Pool.Exec(ctx, "DROP TABLE IF EXISTS api_test_assets")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(subscription.Delete(ctx)).To(Succeed())
+			myLibrary.Close()
+		})
+
+		It("pages rows and links the next page only when one exists", func() {
+			resp := get(server, indicators+"&limit=2")
+			Expect(resp.Code).To(Equal(http.StatusOK))
+
+			first := decodePage(resp)
+			Expect(first.Data).To(HaveLen(2))
+			Expect(first.Data[0]["event_date"]).To(HavePrefix("2024-01-02"))
+			Expect(first.Next).To(ContainSubstring("offset=2"))
+			Expect(first.Next).To(ContainSubstring("subscription="))
+			Expect(resp.Header().Get("Link")).To(Equal(`<` + first.Next + `>; rel="next"`))
+
+			resp = get(server, first.Next)
+			Expect(resp.Code).To(Equal(http.StatusOK))
+
+			second := decodePage(resp)
+			Expect(second.Data).To(HaveLen(1))
+			Expect(second.Data[0]["event_date"]).To(HavePrefix("2024-01-04"))
+			Expect(second.Offset).To(Equal(2))
+			Expect(second.Next).To(BeEmpty())
+			Expect(resp.Header().Get("Link")).To(BeEmpty())
+
+			// a page that exactly fits the remaining rows has no next page
+			resp = get(server, indicators+"&limit=3")
+			Expect(decodePage(resp).Data).To(HaveLen(3))
+			Expect(resp.Header().Get("Link")).To(BeEmpty())
+		})
+
+		It("filters by date and rejects malformed dates", func() {
+			resp := get(server, indicators+"&start=2024-01-03&end=2024-01-03")
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(decodePage(resp).Data).To(HaveLen(1))
+
+			resp = get(server, indicators+"&start=01/03/2024")
+			Expect(resp.Code).To(Equal(http.StatusBadRequest))
+		})
+
+		It("answers a matching If-None-Match with 304 Not Modified", func() {
+			resp := get(server, indicators)
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			etag := resp.Header().Get("ETag")
+			Expect(etag).NotTo(BeEmpty())
+
+			resp = get(server, indicators, "If-None-Match", etag)
+			Expect(resp.Code).To(Equal(http.StatusNotModified))
+			Expect(resp.Body.Len()).To(BeZero())
+
+			resp = get(server, indicators, "If-None-Match", `"stale"`)
+			Expect(resp.Code).To(Equal(http.StatusOK))
+		})
+
+		It("negotiates CSV or JSON from the Accept header and ?format=", func() {
+			resp := get(server, indicators, "Accept", "text/csv")
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(resp.Header().Get("Content-Type")).To(HavePrefix("text/csv"))
+			lines := strings.Split(strings.TrimSpace(resp.Body.String()), "\n")
+			Expect(lines).To(HaveLen(4))
+			Expect(lines[0]).To(Equal("series,event_date,value"))
+
+			resp = get(server, indicators+"&format=csv")
+			Expect(resp.Header().Get("Content-Type")).To(HavePrefix("text/csv"))
+
+			// an explicit format wins over the Accept header
+			resp = get(server, indicators+"&format=json", "Accept", "text/csv")
+			Expect(resp.Header().Get("Content-Type")).To(Equal("application/json"))
+			Expect(decodePage(resp).Data).To(HaveLen(3))
+		})
+
+		It("looks up assets in the configured asset table", func() {
+			resp := get(server, "/v1/assets/apitest")
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(resp.Body.String()).To(ContainSubstring("BBG00APITEST"))
+
+			resp = get(server, "/v1/assets?q=API")
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(decodePage(resp).Data).To(HaveLen(1))
+		})
+
+		It("streams filtered rows as Arrow IPC record batches", func() {
+			arrowPath := "/v1/arrow/" + data.EconomicIndicatorKey + "?subscription=" + subscription.ID.String()[:8]
+
+			resp := get(server, arrowPath+"&series=TEST&start=2024-01-03")
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(resp.Header().Get("Content-Type")).To(Equal(api.ArrowStreamContentType))
+
+			reader, err := ipc.NewReader(resp.Body)
+			Expect(err).NotTo(HaveOccurred())
+			defer reader.Release()
+
+			Expect(reader.Schema().Field(0).Name).To(Equal("series"))
+
+			values := make([]float64, 0)
+			for reader.Next() {
+				rec := reader.Record()
+				col := rec.Column(2).(*array.Float64)
+				for idx := 0; idx < col.Len(); idx++ {
+					values = append(values, col.Value(idx))
+				}
+			}
+			Expect(reader.Err()).NotTo(HaveOccurred())
+			Expect(values).To(Equal([]float64{2, 3}))
+
+			// economic indicators have no ticker column
+			resp = get(server, arrowPath+"&ticker=SPY")
+			Expect(resp.Code).To(Equal(http.StatusBadRequest))
+		})
+
+		It("keeps the declared Arrow schema and reports query errors before streaming", func() {
+			arrowPath := "/v1/arrow/" + data.EconomicIndicatorKey + "?subscription=" + subscription.ID.String()[:8]
+			table := subscription.DataTablesMap[data.EconomicIndicatorKey]
+
+			_, err := myLibrary.Pool.Exec(ctx, `ALTER TABLE `+table+` ADD COLUMN drift TEXT`)
+			Expect(err).NotTo(HaveOccurred())
+
+			resp := get(server, arrowPath)
+			Expect(resp.Code).To(Equal(http.StatusOK))
+
+			reader, err := ipc.NewReader(resp.Body)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reader.Schema().Fields()).To(HaveLen(3))
+			reader.Release()
+
+			_, err = myLibrary.Pool.Exec(ctx, `ALTER TABLE `+table+` DROP COLUMN drift; ALTER TABLE `+table+` RENAME COLUMN value TO val`)
+			Expect(err).NotTo(HaveOccurred())
+			defer func() {
+				_, err := myLibrary.Pool.Exec(ctx, `ALTER TABLE `+table+` RENAME COLUMN val TO value`)
+				Expect(err).NotTo(HaveOccurred())
+			}()
+
+			resp = get(server, arrowPath)
+			Expect(resp.Code).To(Equal(http.StatusInternalServerError))
+			Expect(resp.Header().Get("Content-Type")).To(Equal("application/json"))
+		})
+
+		It("returns 404 for an unknown ticker", func() {
+			resp := get(server, "/v1/assets/NOSUCHTICKER")
+			Expect(resp.Code).To(Equal(http.StatusNotFound))
+			Expect(resp.Body.String()).To(ContainSubstring("NOSUCHTICKER"))
+
+			resp = get(server, "/v1/assets/NOSUCHTICKER?format=csv")
+			Expect(resp.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+})
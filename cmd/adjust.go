@@ -0,0 +1,63 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"context"
+
+	"github.com/penny-vault/pvdata/data"
+	"github.com/penny-vault/pvdata/library"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	adjustFull        bool
+	adjustTotalReturn bool
+)
+
+// adjustCmd represents the adjust command
+var adjustCmd = &cobra.Command{
+	Use:   "adjust <subscription-id...>",
+	Short: "Apply splits and dividends to the adjusted close of EOD tables",
+	Long: `The adjust sub-command updates the adjusted close of each subscription's EOD table
+with any splits and dividends that have not yet been applied. Adjustments are normally applied
+at the end of each run; use --full to discard all previously applied adjustments and recompute
+the entire history.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+
+		myLibrary, err := library.NewFromDB(ctx, viper.GetString("db.url"))
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not load library info")
+		}
+
+		for _, id := range args {
+			sub, err := myLibrary.SubscriptionFromID(ctx, id)
+			if err != nil {
+				log.Fatal().Err(err).Str("ID", id).Msg("could not get subscription for ID")
+			}
+
+			if err := sub.MigrateTables(ctx); err != nil {
+				log.Fatal().Err(err).Msg("could not migrate subscription tables")
+			}
+
+			if _, err := sub.AdjustPrices(ctx, data.AdjustOptions{
+				Full:        adjustFull,
+				TotalReturn: adjustTotalReturn || viper.GetBool("eod.total_return"),
+			}); err != nil {
+				log.Fatal().Err(err).Msg("could not adjust prices")
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(adjustCmd)
+
+	adjustCmd.Flags().BoolVar(&adjustFull, "full", false, "recompute the adjusted close for the entire history")
+	adjustCmd.Flags().BoolVar(&adjustTotalReturn, "total-return", false, "also compute the total return index")
+}
@@ -0,0 +1,261 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/penny-vault/pvdata/db"
+	"github.com/penny-vault/pvdata/healthcheck"
+	"github.com/penny-vault/pvdata/library"
+	"github.com/penny-vault/pvdata/monitor"
+	"github.com/penny-vault/pvdata/spec"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	applyFile   string
+	applyDryRun bool
+	applyPrune  bool
+)
+
+// applyCmd represents the apply command
+var applyCmd = &cobra.Command{
+	Use:   "apply -f <spec>",
+	Short: "Create and update subscriptions to match a library spec",
+	Long: `Apply reads a YAML or TOML library spec and creates, updates, activates or
+deactivates subscriptions until the library matches it. The database schema is created
+or upgraded first, so apply can initialize a new library without running pvdata init.
+
+Subscriptions are matched by id (or id prefix) if given, otherwise by name, provider
+and dataset. Subscriptions missing from the spec are left alone unless --prune is
+passed, which deactivates them. Settings not listed in the spec are left as-is.
+Credentials may be given as env:VAR_NAME or file:/path references.
+
+Example spec:
+
+    library:
+      name: The Jeffersonian
+      owner: Thomas Jefferson
+    subscriptions:
+      - name: Tiingo EOD
+        provider: tiingo
+        dataset: EOD
+        schedule: "30 18 * * 1-5"
+        config:
+          apiKey: env:TIINGO_API_KEY
+          rateLimit: 1000
+        settings:
+          universe: recent
+        monitor:
+          kind: webhook
+          target: https://hooks.example.com/pvdata
+
+Pass --dry-run to print the plan without changing the library.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+
+		librarySpec, err := spec.Load(applyFile)
+		if err != nil {
+			log.Fatal().Err(err).Str("FileName", applyFile).Msg("could not load spec")
+		}
+
+		if err := librarySpec.Validate(); err != nil {
+			log.Fatal().Err(err).Str("FileName", applyFile).Msg("spec is invalid")
+		}
+
+		dbURL := viper.GetString("db.url")
+		if !applyDryRun {
+			if err := db.Migrate(strings.Replace(dbURL, "postgres://", "pgx5://", -1)); err != nil {
+				log.Fatal().Err(err).Msg("error running database migration")
+			}
+		}
+
+		myLibrary, initialized, err := loadLibrary(ctx, dbURL)
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not connect to library")
+		}
+		defer myLibrary.Close()
+
+		var current []*library.Subscription
+		if initialized {
+			if current, err = myLibrary.Subscriptions(ctx); err != nil {
+				log.Fatal().Err(err).Msg("could not load subscriptions")
+			}
+		}
+
+		actions, err := spec.Plan(myLibrary, librarySpec, current, applyPrune)
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not plan changes")
+		}
+
+		// print the plan
+		builder := strings.Builder{}
+		libraryChanged := !initialized ||
+			(librarySpec.Library.Name != "" && librarySpec.Library.Name != myLibrary.Name) ||
+			(librarySpec.Library.Owner != "" && librarySpec.Library.Owner != myLibrary.Owner)
+
+		if libraryChanged {
+			verb := "~ update    "
+			if !initialized {
+				verb = "+ create    "
+			}
+			fmt.Fprintf(&builder, "%s library %q owned by %q\n", verb, librarySpec.Library.Name, librarySpec.Library.Owner)
+		}
+
+		for _, action := range actions {
+			builder.WriteString(action.String())
+		}
+
+		fmt.Print(builder.String())
+
+		if applyDryRun {
+			return
+		}
+
+		if libraryChanged {
+			if librarySpec.Library.Name != "" {
+				myLibrary.Name = librarySpec.Library.Name
+			}
+
+			if librarySpec.Library.Owner != "" {
+				myLibrary.Owner = librarySpec.Library.Owner
+			}
+
+			if !initialized {
+				err = myLibrary.SaveDB(ctx)
+			} else {
+				err = myLibrary.UpdateDB(ctx)
+			}
+
+			if err != nil {
+				log.Fatal().Err(err).Msg("error saving library settings to database")
+			}
+		}
+
+		for _, action := range actions {
+			if err := applyAction(ctx, action); err != nil {
+				log.Fatal().Err(err).Str("Subscription", action.Target.Name).Msg("could not apply change")
+			}
+		}
+
+		log.Info().Int("NumSubscriptions", len(actions)).Msg("library matches spec")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(applyCmd)
+
+	applyCmd.Flags().StringVarP(&applyFile, "file", "f", "", "library spec to apply (.yaml, .yml or .toml)")
+	applyCmd.Flags().BoolVar(&applyDryRun, "dry-run", false, "print the plan without changing the library")
+	applyCmd.Flags().BoolVar(&applyPrune, "prune", false, "deactivate subscriptions that are not in the spec")
+
+	if err := applyCmd.MarkFlagRequired("file"); err != nil {
+		log.Panic().Err(err).Msg("MarkFlagRequired for file failed")
+	}
+}
+
+// loadLibrary connects to the library at `dbURL`. The returned bool is false if
+// the library has not been initialized.
+func loadLibrary(ctx context.Context, dbURL string) (*library.Library, bool, error) {
+	myLibrary := &library.Library{DBUrl: dbURL}
+	if err := myLibrary.Connect(ctx); err != nil {
+		return nil, false, err
+	}
+
+	err := myLibrary.Pool.QueryRow(ctx, "SELECT name, owner FROM library").Scan(&myLibrary.Name, &myLibrary.Owner)
+	if err == nil {
+		return myLibrary, true, nil
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.Is(err, pgx.ErrNoRows) || (errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UndefinedTable) {
+		return myLibrary, false, nil
+	}
+
+	myLibrary.Close()
+	return nil, false, err
+}
+
+// applyAction saves the action's target subscription
+func applyAction(ctx context.Context, action *spec.Action) error {
+	target := action.Target
+	needsHealthCheck := target.Settings[monitor.KindSetting] == monitor.KindHealthchecks && target.HealthCheckID == ""
+
+	switch action.Kind {
+	case spec.ActionCreate:
+		if needsHealthCheck {
+			if err := createHealthCheck(target); err != nil {
+				return err
+			}
+		}
+
+		if err := target.Save(ctx); err != nil {
+			return err
+		}
+
+		log.Info().Str("SubscriptionID", target.ID.String()).Str("Name", target.Name).Msg("created subscription")
+
+		if !target.Active {
+			return target.Deactivate(ctx)
+		}
+	case spec.ActionUpdate:
+		if action.NeedsUpdate() {
+			if needsHealthCheck {
+				if err := createHealthCheck(target); err != nil {
+					return err
+				}
+			}
+
+			// health checks are removed once the subscription is saved without them
+			staleHealthCheck := ""
+			for _, change := range action.Changes {
+				if change.Field == spec.HealthCheckField && change.To == "" {
+					staleHealthCheck = change.From
+				}
+			}
+
+			if err := target.Update(ctx); err != nil {
+				return err
+			}
+
+			if staleHealthCheck != "" {
+				if err := healthcheck.Delete(staleHealthCheck); err != nil {
+					log.Error().Err(err).Str("HealthCheckID", staleHealthCheck).Msg("could not delete health check")
+				}
+			}
+
+			log.Info().Str("SubscriptionID", target.ID.String()).Str("Name", target.Name).Msg("updated subscription")
+		}
+
+		if action.ActiveChanged() {
+			if target.Active {
+				return target.Activate(ctx)
+			}
+			return target.Deactivate(ctx)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,193 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/penny-vault/pvdata/library"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	archiveOlderThan  int
+	archiveSavePolicy bool
+	archiveDryRun     bool
+	archiveList       bool
+)
+
+// archiveCmd represents the archive command
+var archiveCmd = &cobra.Command{
+	Use:   "archive <subscription-id> [partition...]",
+	Short: "Move old partitions to Parquet files",
+	Long: `Archive exports partitions of a subscription's partitioned tables to Parquet
+files in archive.filer (e.g. file:///srv/pvdata/archive), verifies the file
+against the partition's row count and checksum, and then detaches and drops the
+partition. Every archived partition is recorded in the archived_partitions
+catalog and can be brought back with 'pvdata restore'.
+
+Without partition names the subscription's archive policy selects partitions
+whose data ended more than --older-than years ago. Pass --save-policy to store
+the policy so the daemon applies it automatically.
+
+Example:
+
+    pvdata archive 1a2b3c --older-than 10 --dry-run`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		myLibrary, err := library.NewFromDB(ctx, viper.GetString("db.url"))
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not load library info")
+		}
+
+		sub, err := myLibrary.SubscriptionFromID(ctx, args[0])
+		if err != nil {
+			log.Fatal().Err(err).Str("ID", args[0]).Msg("could not get subscription for ID")
+		}
+
+		if archiveList {
+			printArchives(ctx, sub)
+			return
+		}
+
+		if archiveOlderThan > 0 && archiveSavePolicy {
+			if sub.Settings == nil {
+				sub.Settings = make(map[string]string)
+			}
+
+			sub.Settings[library.ArchiveAfterSetting] = strconv.Itoa(archiveOlderThan)
+			if err := sub.SaveSettings(ctx); err != nil {
+				log.Fatal().Err(err).Msg("could not save subscription settings")
+			}
+		}
+
+		partitions := args[1:]
+		if len(partitions) == 0 {
+			years := archiveOlderThan
+			if years == 0 {
+				policy, ok := sub.ArchivePolicy()
+				if !ok {
+					log.Fatal().Msg("pass partition names or --older-than; the subscription has no archive policy")
+				}
+				years = policy
+			}
+
+			candidates, err := sub.ArchiveCandidates(ctx, years)
+			if err != nil {
+				log.Fatal().Err(err).Msg("could not list partitions to archive")
+			}
+
+			for _, partition := range candidates {
+				partitions = append(partitions, partition.Name)
+			}
+		}
+
+		if len(partitions) == 0 {
+			log.Info().Msg("no partitions to archive")
+			return
+		}
+
+		for _, partition := range partitions {
+			if archiveDryRun {
+				log.Info().Str("Partition", partition).Msg("would archive partition")
+				continue
+			}
+
+			if _, err := sub.ArchivePartition(ctx, partition); err != nil {
+				log.Fatal().Err(err).Str("Partition", partition).Msg("could not archive partition")
+			}
+		}
+	},
+}
+
+// restoreCmd represents the restore command
+var restoreCmd = &cobra.Command{
+	Use:   "restore <subscription-id> <partition>...",
+	Short: "Bring archived partitions back into the database",
+	Long: `Restore reads archived partitions from Parquet, verifies them against the
+checksums recorded when they were archived and re-attaches them to their table.`,
+	Args: cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		myLibrary, err := library.NewFromDB(ctx, viper.GetString("db.url"))
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not load library info")
+		}
+
+		sub, err := myLibrary.SubscriptionFromID(ctx, args[0])
+		if err != nil {
+			log.Fatal().Err(err).Str("ID", args[0]).Msg("could not get subscription for ID")
+		}
+
+		for _, partition := range args[1:] {
+			if err := sub.RestorePartition(ctx, partition); err != nil {
+				log.Fatal().Err(err).Str("Partition", partition).Msg("could not restore partition")
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(archiveCmd)
+	rootCmd.AddCommand(restoreCmd)
+
+	archiveCmd.Flags().IntVar(&archiveOlderThan, "older-than", 0, "archive partitions whose data ended more than this many years ago")
+	archiveCmd.Flags().BoolVar(&archiveSavePolicy, "save-policy", false, "save --older-than as the subscription's archive policy")
+	archiveCmd.Flags().BoolVar(&archiveDryRun, "dry-run", false, "list the partitions that would be archived")
+	archiveCmd.Flags().BoolVar(&archiveList, "list", false, "list the subscription's archived partitions")
+}
+
+// printArchives lists the archived partitions of the subscription
+func printArchives(ctx context.Context, sub *library.Subscription) {
+	archives, err := sub.ArchivedPartitions(ctx)
+	if err != nil {
+		log.Fatal().Err(err).Msg("could not load archived partitions")
+	}
+
+	builder := strings.Builder{}
+	builder.WriteString(fmt.Sprintf("# Archived partitions of %s %s [%s]\n\n", sub.Provider, sub.Dataset, sub.ID.String()[:6]))
+	if len(archives) == 0 {
+		builder.WriteString("None\n")
+	} else {
+		builder.WriteString("| Partition | From | To | Rows | Location | Archived |\n|---|---|---|---|---|---|\n")
+	}
+
+	for _, archive := range archives {
+		builder.WriteString(fmt.Sprintf("| %s | %s | %s | %d | %s/%s | %s |\n", archive.PartitionName,
+			archive.RangeStart.Format("2006-01-02"), archive.RangeEnd.Format("2006-01-02"), archive.RowCount,
+			strings.TrimSuffix(archive.Location, "/"), archive.FileName, archive.ArchivedOn.Format("2006-01-02")))
+	}
+
+	renderMarkdown(builder.String())
+}
+
+// applyArchivePolicy archives old partitions of subscriptions that have an archive policy
+func applyArchivePolicy(ctx context.Context, sub *library.Subscription) {
+	if _, ok := sub.ArchivePolicy(); !ok {
+		return
+	}
+
+	if count, err := sub.ApplyArchivePolicy(ctx); err != nil {
+		log.Error().Err(err).Str("SubscriptionID", sub.ID.String()).Msg("could not apply archive policy")
+	} else if count > 0 {
+		log.Info().Str("SubscriptionID", sub.ID.String()).Int("NumArchived", count).Msg("archived partitions")
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/penny-vault/pvdata/library"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// assetMasterCmd represents the asset-master command
+var assetMasterCmd = &cobra.Command{
+	Use:   "asset-master",
+	Short: "Show which sources the asset master's fields come from",
+	Long: `The asset master holds one record per composite FIGI merged from the asset
+descriptions of every subscription. Each field is taken from the first source
+that has a value for it. Sources are named after their subscription and ordered
+by asset_master.precedence, which lists subscription or provider names; a
+provider covers all of its subscriptions. Individual fields may be ordered
+differently; sources a field does not list follow asset_master.precedence:
+
+    [asset_master]
+    precedence = ["polygon", "tiingo", "sharadar"]
+
+    [asset_master.fields]
+    sector = ["sharadar"]
+    logo = ["polygon-logos"]
+
+The asset master is rebuilt after every run of an asset subscription. When
+default.asset_table is not set fetchers read assets from the asset master.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		myLibrary, err := library.NewFromDB(ctx, viper.GetString("db.url"))
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not load library info")
+		}
+
+		printAssetMaster(ctx, myLibrary)
+	},
+}
+
+// assetMasterMergeCmd represents the asset-master merge command
+var assetMasterMergeCmd = &cobra.Command{
+	Use:   "merge",
+	Short: "Rebuild the asset master from every asset subscription",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		myLibrary, err := library.NewFromDB(ctx, viper.GetString("db.url"))
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not load library info")
+		}
+
+		count, err := myLibrary.MergeAssetMaster(ctx)
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not merge asset master")
+		}
+
+		log.Info().Int("NumAssets", count).Msg("merged asset master")
+		printAssetMaster(ctx, myLibrary)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(assetMasterCmd)
+	assetMasterCmd.AddCommand(assetMasterMergeCmd)
+}
+
+// printAssetMaster prints the number of fields taken from each source
+func printAssetMaster(ctx context.Context, myLibrary *library.Library) {
+	provenance, err := myLibrary.AssetMasterProvenance(ctx)
+	if err != nil {
+		log.Fatal().Err(err).Msg("could not load asset master provenance")
+	}
+
+	fields := make([]string, 0, len(provenance))
+	for field := range provenance {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	builder := strings.Builder{}
+	builder.WriteString("# Asset Master\n\n")
+	for _, field := range fields {
+		sources := make([]string, 0, len(provenance[field]))
+		for source, count := range provenance[field] {
+			sources = append(sources, fmt.Sprintf("%s: %d", source, count))
+		}
+		sort.Strings(sources)
+
+		builder.WriteString(fmt.Sprintf("  * **%s** %s\n", field, strings.Join(sources, ", ")))
+	}
+
+	renderMarkdown(builder.String())
+}
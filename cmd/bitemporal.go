@@ -0,0 +1,81 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"context"
+
+	"github.com/penny-vault/pvdata/data"
+	"github.com/penny-vault/pvdata/library"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var bitemporalDisable bool
+
+// bitemporalCmd represents the bitemporal command
+var bitemporalCmd = &cobra.Command{
+	Use:   "bitemporal <subscription-id...>",
+	Short: "Keep every version of records that providers restate",
+	Long: `Normally a restated record (e.g. a fundamental that a provider revises) overwrites
+the previous values. In bitemporal mode every version is kept in a <table>_history table
+along with the range of dates it was valid and the range of time it was recorded in the
+library. Point-in-time queries are answered by the <table>_as_of(valid_at, recorded_at)
+SQL function.
+
+Supported data types: fundamental, metric.
+
+Use --disable to stop recording new versions; the history is kept.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+
+		myLibrary, err := library.NewFromDB(ctx, viper.GetString("db.url"))
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not load library info")
+		}
+
+		for _, id := range args {
+			sub, err := myLibrary.SubscriptionFromID(ctx, id)
+			if err != nil {
+				log.Fatal().Err(err).Str("ID", id).Msg("could not get subscription for ID")
+			}
+
+			if bitemporalDisable {
+				if err := sub.DisableBitemporal(ctx); err != nil {
+					log.Fatal().Err(err).Msg("could not disable bitemporal storage")
+				}
+
+				log.Info().Str("ID", id).Msg("bitemporal storage disabled")
+				continue
+			}
+
+			if err := sub.EnableBitemporal(ctx); err != nil {
+				log.Fatal().Err(err).Msg("could not enable bitemporal storage")
+			}
+
+			for _, tbl := range sub.BitemporalTables() {
+				log.Info().Str("ID", id).Str("HistoryTable", data.HistoryTable(tbl)).Msg("bitemporal storage enabled")
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(bitemporalCmd)
+
+	bitemporalCmd.Flags().BoolVar(&bitemporalDisable, "disable", false, "stop recording new versions")
+}
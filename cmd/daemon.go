@@ -0,0 +1,219 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/google/uuid"
+	"github.com/penny-vault/pvdata/library"
+	"github.com/penny-vault/pvdata/metrics"
+	"github.com/robfig/cron/v3"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+const (
+	defaultPartitionSchedule = "30 1 * * *"
+	defaultReloadSchedule    = "*/5 * * * *"
+)
+
+// scheduledSubscription is the cron entry that runs a subscription
+type scheduledSubscription struct {
+	entryID  cron.EntryID
+	schedule string
+}
+
+// subscriptionScheduler keeps the scheduler's entries in step with the
+// subscriptions table so that edits take effect without a restart
+type subscriptionScheduler struct {
+	library   *library.Library
+	scheduler *cron.Cron
+
+	mu        sync.Mutex
+	scheduled map[uuid.UUID]scheduledSubscription
+	running   sync.Map
+}
+
+// reconcile schedules new active subscriptions, reschedules subscriptions
+// whose schedule changed and removes those that were deleted or deactivated
+func (s *subscriptionScheduler) reconcile(ctx context.Context) {
+	subscriptions, err := s.library.Subscriptions(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("could not load subscriptions")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	active := make(map[uuid.UUID]bool, len(subscriptions))
+	for _, subscription := range subscriptions {
+		if !subscription.Active {
+			continue
+		}
+
+		active[subscription.ID] = true
+
+		current, ok := s.scheduled[subscription.ID]
+		if ok && current.schedule == subscription.Schedule {
+			continue
+		}
+
+		if ok {
+			s.scheduler.Remove(current.entryID)
+			delete(s.scheduled, subscription.ID)
+		}
+
+		id := subscription.ID
+		entryID, err := s.scheduler.AddFunc(subscription.Schedule, func() { s.run(ctx, id) })
+		if err != nil {
+			log.Error().Err(err).Str("SubscriptionID", id.String()).Str("Schedule", subscription.Schedule).
+				Msg("could not schedule subscription")
+			continue
+		}
+
+		s.scheduled[id] = scheduledSubscription{entryID: entryID, schedule: subscription.Schedule}
+		log.Info().Str("SubscriptionID", id.String()).Str("Schedule", subscription.Schedule).Msg("scheduled subscription")
+	}
+
+	for id, current := range s.scheduled {
+		if !active[id] {
+			s.scheduler.Remove(current.entryID)
+			delete(s.scheduled, id)
+			log.Info().Str("SubscriptionID", id.String()).Msg("unscheduled subscription")
+		}
+	}
+}
+
+// run reloads the subscription so that each run uses its current settings and
+// credentials; a subscription that is still running is skipped
+func (s *subscriptionScheduler) run(ctx context.Context, id uuid.UUID) {
+	lock, _ := s.running.LoadOrStore(id, &sync.Mutex{})
+	if !lock.(*sync.Mutex).TryLock() {
+		log.Warn().Str("SubscriptionID", id.String()).Msg("subscription is still running; skipping")
+		return
+	}
+	defer lock.(*sync.Mutex).Unlock()
+
+	subscription, err := s.library.SubscriptionFromID(ctx, id.String())
+	if err != nil {
+		log.Error().Err(err).Str("SubscriptionID", id.String()).Msg("could not load subscription")
+		return
+	}
+
+	if !subscription.Active {
+		log.Info().Str("SubscriptionID", id.String()).Msg("subscription is inactive; skipping")
+		return
+	}
+
+	if _, err := runSubscription(ctx, subscription); err != nil {
+		log.Error().Err(err).Str("SubscriptionID", id.String()).Msg("subscription run failed")
+	}
+}
+
+// runDaemon runs every active subscription on its schedule and keeps
+// partitions created ahead of time until the process is interrupted
+func runDaemon(ctx context.Context, myLibrary *library.Library) error {
+	// a job that is still running when it is next scheduled is skipped
+	scheduler := cron.New(cron.WithChain(cron.SkipIfStillRunning(cron.DefaultLogger)))
+
+	subscriptions := &subscriptionScheduler{
+		library:   myLibrary,
+		scheduler: scheduler,
+		scheduled: make(map[uuid.UUID]scheduledSubscription),
+	}
+
+	subscriptions.reconcile(ctx)
+
+	reloadSchedule := viper.GetString("daemon.reload_schedule")
+	if reloadSchedule == "" {
+		reloadSchedule = defaultReloadSchedule
+	}
+
+	if _, err := scheduler.AddFunc(reloadSchedule, func() { subscriptions.reconcile(ctx) }); err != nil {
+		return err
+	}
+
+	partitionSchedule := viper.GetString("partitions.schedule")
+	if partitionSchedule == "" {
+		partitionSchedule = defaultPartitionSchedule
+	}
+
+	// subscriptions are reloaded so that jobs never share a subscription object
+	maintainPartitions := func() {
+		current, err := myLibrary.Subscriptions(ctx)
+		if err != nil {
+			log.Error().Err(err).Msg("could not load subscriptions")
+			return
+		}
+
+		for _, subscription := range current {
+			if err := subscription.ManagePartitions(ctx); err != nil {
+				log.Error().Err(err).Str("SubscriptionID", subscription.ID.String()).Msg("could not create partitions")
+			}
+
+			applyArchivePolicy(ctx, subscription)
+		}
+	}
+
+	if _, err := scheduler.AddFunc(partitionSchedule, maintainPartitions); err != nil {
+		return err
+	}
+
+	maintainPartitions()
+
+	// expose metrics for scraping; set metrics.listen to "" to disable
+	listenAddr := metrics.DefaultListenAddr
+	if viper.IsSet("metrics.listen") {
+		listenAddr = viper.GetString("metrics.listen")
+	}
+
+	var metricsServer *http.Server
+	if listenAddr != "" {
+		metricsServer = metrics.NewServer(listenAddr)
+		go func() {
+			if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Error().Err(err).Str("Addr", listenAddr).Msg("metrics server failed")
+			}
+		}()
+		log.Info().Str("Addr", listenAddr).Msg("serving metrics")
+	}
+
+	scheduler.Start()
+	log.Info().Int("NumJobs", len(scheduler.Entries())).Msg("pvdata daemon started")
+
+	// run until interrupted
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	<-sig
+
+	log.Info().Msg("stopping pvdata daemon; waiting for running jobs to finish")
+	<-scheduler.Stop().Done()
+
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(ctx); err != nil {
+			log.Error().Err(err).Msg("could not stop metrics server")
+		}
+	}
+
+	return nil
+}
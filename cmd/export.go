@@ -0,0 +1,181 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/penny-vault/pvdata/data"
+	"github.com/penny-vault/pvdata/library"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	exportOut     string
+	exportFormat  string
+	exportSplit   string
+	exportTypes   []string
+	exportStart   string
+	exportEnd     string
+	exportTickers []string
+)
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export <subscription-id | data-type>...",
+	Short: "Export subscription data to Parquet or CSV files",
+	Long: `Export writes the tables of subscriptions to Parquet or CSV files that can be used
+without access to the database. Each table is written to a directory named after the
+table along with a manifest.json describing the schema, row counts, date coverage,
+source subscription and a hash of the exported files.
+
+Arguments are subscription IDs or data types; a data type exports the table of every
+active subscription that provides it. Use --type to limit which of a subscription's
+tables are exported.
+
+Files are split with --split:
+
+    none       a single file per table
+    year       one file per calendar year
+    partition  one file per partition of a partitioned table
+
+Example:
+
+    pvdata export eod --out /srv/snapshots --split year --start 2020-01-01 --tickers AAPL,MSFT`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+
+		opts := data.ExportOptions{
+			Tickers: exportTickers,
+		}
+
+		var err error
+		if opts.Format, err = data.ParseExportFormat(exportFormat); err != nil {
+			log.Fatal().Err(err).Msg("invalid --format")
+		}
+
+		if opts.Split, err = data.ParseExportSplit(exportSplit); err != nil {
+			log.Fatal().Err(err).Msg("invalid --split")
+		}
+
+		if exportStart != "" {
+			if opts.Start, err = time.Parse("2006-01-02", exportStart); err != nil {
+				log.Fatal().Err(err).Str("Start", exportStart).Msg("could not parse start date")
+			}
+		}
+
+		if exportEnd != "" {
+			if opts.End, err = time.Parse("2006-01-02", exportEnd); err != nil {
+				log.Fatal().Err(err).Str("End", exportEnd).Msg("could not parse end date")
+			}
+		}
+
+		spec := exportOut
+		if !strings.Contains(spec, "://") {
+			spec = "file://" + spec
+		}
+
+		filer, err := data.NewFilerFromString(spec)
+		if err != nil {
+			log.Fatal().Err(err).Str("Out", exportOut).Msg("unsupported output location")
+		}
+
+		myLibrary, err := library.NewFromDB(ctx, viper.GetString("db.url"))
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not load library info")
+		}
+
+		builder := strings.Builder{}
+		builder.WriteString("# Export\n\n| Table | Files | Rows | From | To |\n|---|---|---|---|---|\n")
+
+		for _, arg := range args {
+			for _, target := range exportTargets(ctx, myLibrary, arg) {
+				manifest, err := target.sub.Export(ctx, target.dataType, opts, filer)
+				if err != nil {
+					log.Fatal().Err(err).Str("SubscriptionID", target.sub.ID.String()).Str("DataType", target.dataType).Msg("could not export table")
+				}
+
+				builder.WriteString(fmt.Sprintf("| %s | %d | %d | %s | %s |\n", manifest.Source.Table,
+					len(manifest.Files), manifest.Rows, manifest.FirstDate, manifest.LastDate))
+			}
+		}
+
+		renderMarkdown(builder.String())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+
+	exportCmd.Flags().StringVarP(&exportOut, "out", "o", ".", "directory or filer location (e.g. file:///srv/snapshots) to write to")
+	exportCmd.Flags().StringVar(&exportFormat, "format", string(data.ExportParquet), "file format: parquet or csv")
+	exportCmd.Flags().StringVar(&exportSplit, "split", string(data.SplitNone), "split files by none, year or partition")
+	exportCmd.Flags().StringSliceVar(&exportTypes, "type", []string{}, "data types of a subscription to export (default all)")
+	exportCmd.Flags().StringVar(&exportStart, "start", "", "first event date to export (YYYY-MM-DD)")
+	exportCmd.Flags().StringVar(&exportEnd, "end", "", "last event date to export (YYYY-MM-DD)")
+	exportCmd.Flags().StringSliceVar(&exportTickers, "tickers", []string{}, "only export these tickers")
+}
+
+// exportTarget is a table of a subscription to export
+type exportTarget struct {
+	sub      *library.Subscription
+	dataType string
+}
+
+// exportTargets returns the tables named by `arg`: either a data type or a subscription ID
+func exportTargets(ctx context.Context, myLibrary *library.Library, arg string) []exportTarget {
+	targets := make([]exportTarget, 0)
+
+	if _, ok := data.DataTypes[arg]; ok {
+		subscriptions, err := myLibrary.SubscriptionsWithDataType(ctx, arg)
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not load subscriptions")
+		}
+
+		if len(subscriptions) == 0 {
+			log.Fatal().Str("DataType", arg).Msg("no active subscription provides data type")
+		}
+
+		for _, sub := range subscriptions {
+			targets = append(targets, exportTarget{sub: sub, dataType: arg})
+		}
+
+		return targets
+	}
+
+	sub, err := myLibrary.SubscriptionFromID(ctx, arg)
+	if err != nil {
+		log.Fatal().Err(err).Str("ID", arg).Msg("could not get subscription for ID")
+	}
+
+	for _, dataType := range sub.DataTypes {
+		if len(exportTypes) == 0 || slices.Contains(exportTypes, dataType) {
+			targets = append(targets, exportTarget{sub: sub, dataType: dataType})
+		}
+	}
+
+	if len(targets) == 0 {
+		log.Fatal().Str("ID", arg).Strs("Types", exportTypes).Msg("subscription does not provide the requested data types")
+	}
+
+	return targets
+}
@@ -0,0 +1,118 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/penny-vault/pvdata/figi"
+	"github.com/penny-vault/pvdata/library"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var figiIdType string
+
+// figiCmd represents the figi command
+var figiCmd = &cobra.Command{
+	Use:   "figi",
+	Short: "Work with Financial Instrument Global Identifiers",
+}
+
+// figiResolveCmd represents the figi resolve command
+var figiResolveCmd = &cobra.Command{
+	Use:   "resolve <id>",
+	Short: "Resolve a ticker, CUSIP, ISIN, CIK or FIGI to a composite FIGI",
+	Long: `Resolve looks up the composite FIGI of an identifier. The type of identifier is
+guessed from its format unless --type is given. CIKs are resolved from the
+library's asset table, all other identifiers with OpenFIGI. Results are cached
+in the library when a database is configured.
+
+Example:
+
+    pvdata figi resolve US9229087104`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+
+		// the library is optional; without it lookups are not cached
+		if myLibrary, err := library.NewFromDB(ctx, viper.GetString("db.url")); err == nil {
+			figi.UseDatabase(myLibrary.Pool)
+		} else {
+			log.Warn().Err(err).Msg("could not connect to library, figi cache is disabled")
+		}
+
+		idType := figiIdType
+		switch strings.ToLower(idType) {
+		case "":
+			idType = figi.IdentifierType(args[0])
+		case "ticker":
+			idType = figi.IdTicker
+		case "cusip":
+			idType = figi.IdCusip
+		case "isin":
+			idType = figi.IdIsin
+		case "cik":
+			idType = figi.IdCik
+		case "figi":
+			idType = figi.IdFigi
+		default:
+			log.Fatal().Str("Type", figiIdType).Msg("type must be one of ticker, cusip, isin, cik or figi")
+		}
+
+		resolution, err := figi.Resolve(ctx, idType, args[0])
+		if err != nil {
+			log.Fatal().Err(err).Str("IdType", idType).Str("Id", args[0]).Msg("could not resolve identifier")
+		}
+
+		asset := resolution.Asset
+		builder := strings.Builder{}
+		builder.WriteString(fmt.Sprintf("# %s\n\n", resolution.Query.IdValue))
+		builder.WriteString(fmt.Sprintf("  * Identifier type: %s\n", resolution.Query.IdType))
+		builder.WriteString(fmt.Sprintf("  * Composite FIGI: %s\n", asset.CompositeFIGI))
+
+		if asset.ShareClassFIGI != "" {
+			builder.WriteString(fmt.Sprintf("  * Share class FIGI: %s\n", asset.ShareClassFIGI))
+		}
+
+		if asset.Ticker != "" {
+			builder.WriteString(fmt.Sprintf("  * Ticker: %s (%s)\n", asset.Ticker, asset.ExchangeCode))
+		}
+
+		if asset.Name != "" {
+			builder.WriteString(fmt.Sprintf("  * Name: %s\n", asset.Name))
+		}
+
+		if asset.SecurityType != "" {
+			builder.WriteString(fmt.Sprintf("  * Security type: %s / %s\n", asset.SecurityType, asset.SecurityType2))
+		}
+
+		if resolution.Conflict() {
+			builder.WriteString(fmt.Sprintf("\n**Conflict:** identifier maps to %s\n", strings.Join(resolution.Candidates, ", ")))
+		}
+
+		renderMarkdown(builder.String())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(figiCmd)
+	figiCmd.AddCommand(figiResolveCmd)
+
+	figiResolveCmd.Flags().StringVar(&figiIdType, "type", "", "identifier type: ticker, cusip, isin, cik or figi")
+}
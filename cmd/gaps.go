@@ -0,0 +1,135 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/penny-vault/pvdata/data"
+	"github.com/penny-vault/pvdata/library"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	gapsStart  string
+	gapsEnd    string
+	gapsRepair bool
+)
+
+var (
+	ErrDatasetNotScoped = errors.New("dataset does not support targeted fetches")
+)
+
+// gapsCmd represents the gaps command
+var gapsCmd = &cobra.Command{
+	Use:   "gaps <subscription-id>",
+	Short: "List trading days missing from a subscription's EOD table",
+	Long: `The gaps sub-command compares the EOD table of a subscription against the trading
+calendar and lists every (asset, date) pair without a quote. Only dates within each asset's
+listed/delisted window are considered. Market holidays are read from the table configured
+in default.market_holidays_table, or else from the library's market holidays subscription;
+gaps are not checked or recorded when no holiday calendar is available.
+
+With --repair the missing tickers and dates are re-fetched from the provider.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+
+		start, err := time.Parse("2006-01-02", gapsStart)
+		if err != nil {
+			log.Fatal().Err(err).Str("Start", gapsStart).Msg("could not parse start date")
+		}
+
+		end, err := time.Parse("2006-01-02", gapsEnd)
+		if err != nil {
+			log.Fatal().Err(err).Str("End", gapsEnd).Msg("could not parse end date")
+		}
+
+		myLibrary, err := library.NewFromDB(ctx, viper.GetString("db.url"))
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not load library info")
+		}
+
+		sub, err := myLibrary.SubscriptionFromID(ctx, args[0])
+		if err != nil {
+			log.Fatal().Err(err).Str("ID", args[0]).Msg("could not get subscription for ID")
+		}
+
+		gaps, err := checkGaps(ctx, sub, start, end)
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not check subscription for gaps")
+		}
+
+		for _, gap := range gaps {
+			fmt.Printf("%s\t%s\t%s\n", gap.EventDate.Format("2006-01-02"), gap.CompositeFigi, gap.Ticker)
+		}
+
+		if gapsRepair && len(gaps) > 0 {
+			if err := repairGaps(ctx, sub, gaps); err != nil {
+				log.Fatal().Err(err).Msg("could not repair gaps")
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(gapsCmd)
+
+	gapsCmd.Flags().StringVar(&gapsStart, "start", time.Now().AddDate(-1, 0, 0).Format("2006-01-02"), "first date to check (YYYY-MM-DD)")
+	gapsCmd.Flags().StringVar(&gapsEnd, "end", time.Now().AddDate(0, 0, -1).Format("2006-01-02"), "last date to check (YYYY-MM-DD)")
+	gapsCmd.Flags().BoolVar(&gapsRepair, "repair", false, "re-fetch missing quotes from the provider")
+}
+
+// checkGaps finds and records the gaps of the subscription between start and end
+func checkGaps(ctx context.Context, subscription *library.Subscription, start, end time.Time) ([]*data.Gap, error) {
+	gaps, err := subscription.FindGaps(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := subscription.RecordGaps(ctx, gaps, start, end); err != nil {
+		return nil, err
+	}
+
+	log.Info().Str("SubscriptionID", subscription.ID.String()).Int("NumGaps", len(gaps)).
+		Time("Start", start).Time("End", end).Msg("checked subscription for gaps")
+
+	return gaps, nil
+}
+
+// repairGaps re-runs the subscription for just the assets and dates that are missing
+func repairGaps(ctx context.Context, subscription *library.Subscription, gaps []*data.Gap) error {
+	dataset, err := subscriptionDataset(subscription)
+	if err != nil {
+		return err
+	}
+
+	if !dataset.Scoped {
+		log.Error().Str("Provider", subscription.Provider).Str("Dataset", subscription.Dataset).Msg("gaps cannot be repaired for dataset")
+		return ErrDatasetNotScoped
+	}
+
+	requests := data.GapRequests(gaps)
+	log.Info().Int("NumGaps", len(gaps)).Int("NumRequests", len(requests)).Msg("repairing gaps")
+
+	ctx = data.WithFetchScope(ctx, &data.FetchScope{Requests: requests})
+	_, err = runSubscription(ctx, subscription)
+	return err
+}
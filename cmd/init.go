@@ -25,18 +25,27 @@ import (
 	"github.com/pelletier/go-toml/v2"
 	"github.com/penny-vault/pvdata/db"
 	"github.com/penny-vault/pvdata/library"
+	"github.com/penny-vault/pvdata/secret"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 // initCmd represents the init command
 var initCmd = &cobra.Command{
 	Use:   "init",
 	Short: "Gather database configuration and setup schema",
+	Long: `Init walks you through naming the library and connecting it to a PostgreSQL
+database, creates the database schema and saves the connection to ~/.pvdata.toml.
+Pass --yes with --name, --owner and --db-url to initialize without prompting.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		ctx := context.Background()
 
-		myLibrary := &library.Library{}
+		myLibrary := &library.Library{
+			Name:  initName,
+			Owner: initOwner,
+			DBUrl: initDBUrl,
+		}
 
 		form := huh.NewForm(
 			// Gather details about the library and who owns it
@@ -62,8 +71,16 @@ var initCmd = &cobra.Command{
 			),
 		)
 
-		err := form.Run()
-		if err != nil {
+		if initYes {
+			// an empty URL would silently connect to the default database
+			if myLibrary.Name == "" || myLibrary.Owner == "" || myLibrary.DBUrl == "" {
+				log.Fatal().Msg("--name, --owner and --db-url are required with --yes")
+			}
+
+			if _, err := pgx.ParseConfig(myLibrary.DBUrl); err != nil {
+				log.Fatal().Err(err).Msg("invalid database URL")
+			}
+		} else if err := form.Run(); err != nil {
 			log.Fatal().Err(err).Msg("error gathering database settings")
 		}
 
@@ -71,7 +88,7 @@ var initCmd = &cobra.Command{
 
 		// run migration
 		dbURL := strings.Replace(myLibrary.DBUrl, "postgres://", "pgx5://", -1)
-		err = db.Migrate(dbURL)
+		err := db.Migrate(dbURL)
 		if err != nil {
 			log.Fatal().Err(err).Msg("error running database migration")
 		}
@@ -103,25 +120,50 @@ var initCmd = &cobra.Command{
 			log.Fatal().Err(err).Msg("could not marshal configuration data")
 		}
 
-		err = os.WriteFile(configFN, configData, 0644)
+		// keep an existing library key so previously encrypted credentials can be read
+		secretKey := viper.GetString("secrets.key")
+		if secretKey == "" && viper.GetString("secrets.key_file") == "" {
+			if secretKey, err = secret.GenerateKey(); err != nil {
+				log.Fatal().Err(err).Msg("could not generate library key")
+			}
+		}
+
+		if secretKey != "" {
+			secretsData, err := toml.Marshal(map[string]any{
+				"secrets": map[string]string{"key": secretKey},
+			})
+			if err != nil {
+				log.Fatal().Err(err).Msg("could not marshal configuration data")
+			}
+			configData = append(configData, secretsData...)
+		}
+
+		// the config file holds database credentials and the library key
+		err = os.WriteFile(configFN, configData, 0600)
 		if err != nil {
 			log.Fatal().Err(err).Str("FileName", configFN).Msg("could not save configuration to file")
 		}
 
+		if err := os.Chmod(configFN, 0600); err != nil {
+			log.Fatal().Err(err).Str("FileName", configFN).Msg("could not restrict configuration file permissions")
+		}
+
 		log.Info().Msg("Your data library has been initialized")
 	},
 }
 
+var (
+	initName  string
+	initOwner string
+	initDBUrl string
+	initYes   bool
+)
+
 func init() {
 	rootCmd.AddCommand(initCmd)
 
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// initCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// initCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	initCmd.Flags().StringVar(&initName, "name", "", "library name")
+	initCmd.Flags().StringVar(&initOwner, "owner", "", "library owner")
+	initCmd.Flags().StringVar(&initDBUrl, "db-url", "", "PostgreSQL connection string")
+	initCmd.Flags().BoolVarP(&initYes, "yes", "y", false, "initialize from flags without prompting")
 }
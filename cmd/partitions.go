@@ -0,0 +1,156 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/penny-vault/pvdata/data"
+	"github.com/penny-vault/pvdata/library"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	partitionsRepair bool
+	partitionsLayout string
+)
+
+// partitionsCmd represents the partitions command
+var partitionsCmd = &cobra.Command{
+	Use:   "partitions [subscription-id...]",
+	Short: "Inspect and repair the partitions of subscription tables",
+	Long: `Partitions lists the partitions attached to each partitioned table along with
+any partitions that are missing. Partitions are created partitions.months_ahead
+(default 12) months ahead of time; pass --repair to create missing partitions now.
+
+New partitions are sized by the data type's layout unless the subscription sets
+its own with --layout (monthly, yearly or 5-year). Existing partitions are never
+resized; new partitions fill the dates they leave uncovered.
+
+Example:
+
+    pvdata partitions 1a2b3c --layout yearly --repair`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		myLibrary, err := library.NewFromDB(ctx, viper.GetString("db.url"))
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not load library info")
+		}
+
+		var subscriptions []*library.Subscription
+		if len(args) == 0 {
+			if partitionsLayout != "" {
+				log.Fatal().Msg("--layout requires a subscription ID")
+			}
+
+			subscriptions, err = myLibrary.Subscriptions(ctx)
+			if err != nil {
+				log.Fatal().Err(err).Msg("could not load subscriptions")
+			}
+		}
+
+		for _, id := range args {
+			sub, err := myLibrary.SubscriptionFromID(ctx, id)
+			if err != nil {
+				log.Fatal().Err(err).Str("ID", id).Msg("could not get subscription for ID")
+			}
+			subscriptions = append(subscriptions, sub)
+		}
+
+		builder := strings.Builder{}
+		for _, sub := range subscriptions {
+			if partitionsLayout != "" {
+				layout, err := data.ParsePartitionLayout(partitionsLayout)
+				if err != nil {
+					log.Fatal().Err(err).Msg("invalid partition layout")
+				}
+
+				if sub.Settings == nil {
+					sub.Settings = make(map[string]string)
+				}
+
+				sub.Settings[data.PartitionLayoutSetting] = string(layout)
+				if err := sub.SaveSettings(ctx); err != nil {
+					log.Fatal().Err(err).Msg("could not save subscription settings")
+				}
+			}
+
+			if partitionsRepair {
+				if err := sub.ManagePartitions(ctx); err != nil {
+					log.Fatal().Err(err).Str("SubscriptionID", sub.ID.String()).Msg("could not create partitions")
+				}
+			}
+
+			statuses, err := sub.PartitionStatus(ctx)
+			if err != nil {
+				log.Fatal().Err(err).Str("SubscriptionID", sub.ID.String()).Msg("could not inspect partitions")
+			}
+
+			for _, status := range statuses {
+				builder.WriteString(partitionSummary(sub, status))
+			}
+		}
+
+		if builder.Len() == 0 {
+			builder.WriteString("No partitioned tables\n")
+		}
+
+		renderMarkdown(builder.String())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(partitionsCmd)
+
+	partitionsCmd.Flags().BoolVar(&partitionsRepair, "repair", false, "create missing partitions")
+	partitionsCmd.Flags().StringVar(&partitionsLayout, "layout", "", "partition layout for new partitions: monthly, yearly or 5-year")
+}
+
+// partitionSummary describes the partitions of a table in markdown
+func partitionSummary(sub *library.Subscription, status *library.PartitionStatus) string {
+	builder := strings.Builder{}
+	builder.WriteString(fmt.Sprintf("# %s\n\n", status.Table))
+	builder.WriteString(fmt.Sprintf("%s %s [%s], %s, %s layout\n\n", sub.Provider, sub.Dataset, sub.ID.String()[:6],
+		status.DataType, status.Layout))
+
+	builder.WriteString("| Partition | From | To | Rows (est.) |\n|---|---|---|---|\n")
+	for _, partition := range status.Existing {
+		builder.WriteString(fmt.Sprintf("| %s | %s | %s | %d |\n", partition.Name,
+			partition.Start.Format("2006-01-02"), partition.End.Format("2006-01-02"), partition.Rows))
+	}
+
+	if len(status.Archived) > 0 {
+		builder.WriteString("\n**Archived:**\n\n")
+		for _, partition := range status.Archived {
+			builder.WriteString(fmt.Sprintf("  * %s (%s to %s, %d rows)\n", partition.Name,
+				partition.Start.Format("2006-01-02"), partition.End.Format("2006-01-02"), partition.Rows))
+		}
+	}
+
+	if len(status.Missing) > 0 {
+		builder.WriteString("\n**Missing:**\n\n")
+		for _, partition := range status.Missing {
+			builder.WriteString(fmt.Sprintf("  * %s (%s to %s)\n", partition.Name,
+				partition.Start.Format("2006-01-02"), partition.End.Format("2006-01-02")))
+		}
+	}
+
+	builder.WriteString("\n")
+	return builder.String()
+}
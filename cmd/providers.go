@@ -48,6 +48,20 @@ var providersCmd = &cobra.Command{
 					start, end := dataset.DateRange()
 					builder.WriteString(fmt.Sprintf("- %s (%s to %s): %s\n", dataset.Name, start.Format("2006-01-02"), end.Format("2006-01-02"), dataset.Description))
 				}
+
+				builder.WriteString("\n## Configuration\n\n| Key | Type | Required | Default | Description |\n|---|---|---|---|---|\n")
+				for _, field := range provider.ConfigSchema() {
+					fieldType := string(field.Type)
+					if len(field.Options) > 0 {
+						fieldType = strings.Join(field.Options, " \\| ")
+					}
+
+					if field.Secret {
+						fieldType += " (secret)"
+					}
+
+					builder.WriteString(fmt.Sprintf("| %s | %s | %t | %s | %s |\n", field.Key, fieldType, field.Required, field.Default, field.Title))
+				}
 			}
 		} else {
 			builder.WriteString("# Available Providers\n")
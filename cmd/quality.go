@@ -0,0 +1,223 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/glamour"
+	"github.com/penny-vault/pvdata/data"
+	"github.com/penny-vault/pvdata/library"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// qualityCmd represents the quality command
+var qualityCmd = &cobra.Command{
+	Use:   "quality [subscription-id] [rule=action...]",
+	Short: "List data quality rules or configure them for a subscription",
+	Long: `Data quality rules are applied to every observation before it is saved. When a rule
+is broken the configured action is taken:
+
+    reject      the observation is discarded
+    quarantine  the observation is kept in the quality_issues table instead of being saved;
+                save it later with pvdata quality release
+    warn        the observation is saved and the issue is recorded
+    off         the rule is not checked
+
+Without arguments the built-in rules are listed. With a subscription ID the actions in effect
+for the subscription are shown; append rule=action pairs to change them. The outlier threshold
+is set with outlier_threshold=<ratio>.
+
+Example:
+
+    pvdata quality 1a2b3c eod-outlier=warn outlier_threshold=10`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		builder := strings.Builder{}
+
+		if len(args) == 0 {
+			builder.WriteString("# Data Quality Rules\n\n")
+			for _, rule := range data.QualityRules {
+				builder.WriteString(fmt.Sprintf("- **%s** [%s] (default: %s): %s\n", rule.Name,
+					strings.Join(rule.DataTypes, ", "), rule.DefaultAction, rule.Description))
+			}
+			renderMarkdown(builder.String())
+			return
+		}
+
+		myLibrary, err := library.NewFromDB(ctx, viper.GetString("db.url"))
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not load library info")
+		}
+
+		sub, err := myLibrary.SubscriptionFromID(ctx, args[0])
+		if err != nil {
+			log.Fatal().Err(err).Str("ID", args[0]).Msg("could not get subscription for ID")
+		}
+
+		if len(args) > 1 {
+			if sub.Settings == nil {
+				sub.Settings = make(map[string]string)
+			}
+
+			for _, assignment := range args[1:] {
+				key, val, found := strings.Cut(assignment, "=")
+				if !found {
+					log.Fatal().Str("Argument", assignment).Msg("expected rule=action")
+				}
+
+				if key == "outlier_threshold" {
+					if threshold, err := strconv.ParseFloat(val, 64); err != nil || threshold <= 1 {
+						log.Fatal().Str("Value", val).Msg("outlier threshold must be a number greater than 1")
+					}
+					sub.Settings[data.OutlierThresholdSetting] = val
+					continue
+				}
+
+				if _, err := data.QualityRuleFromName(key); err != nil {
+					log.Fatal().Err(err).Msg("could not update quality rule")
+				}
+
+				action, err := data.ParseQualityAction(val)
+				if err != nil {
+					log.Fatal().Err(err).Msg("could not update quality rule")
+				}
+
+				sub.Settings[data.QualitySettingPrefix+key] = string(action)
+			}
+
+			if err := sub.SaveSettings(ctx); err != nil {
+				log.Fatal().Err(err).Msg("could not save subscription settings")
+			}
+		}
+
+		validator := data.NewValidator(sub.Settings)
+		builder.WriteString(fmt.Sprintf("# %s %s [%s]\n\n", sub.Provider, sub.Dataset, sub.ID.String()[:6]))
+		for _, rule := range data.QualityRules {
+			builder.WriteString(fmt.Sprintf("- **%s**: %s\n", rule.Name, validator.Actions[rule.Name]))
+		}
+		builder.WriteString(fmt.Sprintf("\nOutlier threshold: %.2fx\n", validator.OutlierThreshold))
+		renderMarkdown(builder.String())
+	},
+}
+
+var (
+	qualityReleaseRule   string
+	qualityReleaseDryRun bool
+)
+
+var qualityReleaseCmd = &cobra.Command{
+	Use:   "release <subscription-id> [issue-id...]",
+	Short: "Save quarantined observations to the subscription's tables",
+	Long: `Release saves observations that were quarantined by a quality rule to the
+subscription's tables as-is; they are not checked again. Without issue IDs every
+quarantined observation of the subscription is released, or only those found by
+--rule. Pass --dry-run to list them without saving. Run pvdata adjust afterwards
+if released EOD quotes carry splits or dividends.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+
+		ids := make([]int64, 0, len(args)-1)
+		for _, arg := range args[1:] {
+			id, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil {
+				log.Fatal().Err(err).Str("IssueID", arg).Msg("issue ids must be numbers")
+			}
+			ids = append(ids, id)
+		}
+
+		if qualityReleaseRule != "" {
+			if _, err := data.QualityRuleFromName(qualityReleaseRule); err != nil {
+				log.Fatal().Err(err).Msg("invalid --rule")
+			}
+		}
+
+		myLibrary, err := library.NewFromDB(ctx, viper.GetString("db.url"))
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not load library info")
+		}
+
+		sub, err := myLibrary.SubscriptionFromID(ctx, args[0])
+		if err != nil {
+			log.Fatal().Err(err).Str("ID", args[0]).Msg("could not get subscription for ID")
+		}
+
+		issues, err := sub.Quarantined(ctx, qualityReleaseRule, ids)
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not load quarantined observations")
+		}
+
+		builder := strings.Builder{}
+		builder.WriteString(fmt.Sprintf("# Quarantined observations of %s %s [%s]\n\n", sub.Provider, sub.Dataset, sub.ID.String()[:6]))
+		if len(issues) == 0 {
+			builder.WriteString("Nothing is quarantined.\n")
+			renderMarkdown(builder.String())
+			return
+		}
+
+		builder.WriteString("| Issue | Rule | Data type | Ticker | Event date | Message |\n|---|---|---|---|---|---|\n")
+		for _, issue := range issues {
+			eventDate := ""
+			if !issue.EventDate.IsZero() {
+				eventDate = issue.EventDate.Format("2006-01-02")
+			}
+			builder.WriteString(fmt.Sprintf("| %d | %s | %s | %s | %s | %s |\n", issue.ID, issue.Rule, issue.DataType,
+				issue.Ticker, eventDate, issue.Message))
+		}
+		renderMarkdown(builder.String())
+
+		if qualityReleaseDryRun {
+			return
+		}
+
+		released, err := sub.ReleaseQuarantined(ctx, issues)
+		if err != nil {
+			log.Fatal().Err(err).Int("NumReleased", released).Msg("could not release quarantined observations")
+		}
+
+		log.Info().Int("NumReleased", released).Msg("released quarantined observations")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(qualityCmd)
+	qualityCmd.AddCommand(qualityReleaseCmd)
+
+	qualityReleaseCmd.Flags().StringVar(&qualityReleaseRule, "rule", "", "only release observations quarantined by this rule")
+	qualityReleaseCmd.Flags().BoolVar(&qualityReleaseDryRun, "dry-run", false, "list the observations without releasing them")
+}
+
+// renderMarkdown prints the markdown document to the terminal
+func renderMarkdown(doc string) {
+	r, _ := glamour.NewTermRenderer(
+		// detect background color and pick either the default dark or light theme
+		glamour.WithAutoStyle(),
+		// wrap output at specific width (default is 80)
+		glamour.WithWordWrap(80),
+	)
+
+	out, err := r.Render(doc)
+	if err != nil {
+		log.Fatal().Err(err).Msg("could not render document")
+	}
+
+	fmt.Print(out)
+}
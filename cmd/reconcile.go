@@ -0,0 +1,201 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/penny-vault/pvdata/data"
+	"github.com/penny-vault/pvdata/library"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	reconcileType          string
+	reconcileSubscriptions []string
+	reconcileStart         string
+	reconcileEnd           string
+	reconcileTolerance     float64
+	reconcileCSV           string
+	reconcileFail          bool
+)
+
+// reconcileCmd represents the reconcile command
+var reconcileCmd = &cobra.Command{
+	Use:   "reconcile",
+	Short: "Compare the data of subscriptions that produce the same data type",
+	Long: `The reconcile sub-command joins the tables of two or more subscriptions on composite
+FIGI (and date) and reports rows missing from either side, numeric values that differ by more
+than the tolerance and conflicting identifiers. The first subscription is the reference that
+every other subscription is compared against.
+
+Supported data types: eod, metric, asset-description.
+
+Example:
+
+    pvdata reconcile --type eod --subscriptions 1a2b3c,4d5e6f --csv discrepancies.csv`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+
+		if len(reconcileSubscriptions) < 2 {
+			log.Fatal().Msg("at least two subscriptions are required")
+		}
+
+		start, err := time.Parse("2006-01-02", reconcileStart)
+		if err != nil {
+			log.Fatal().Err(err).Str("Start", reconcileStart).Msg("could not parse start date")
+		}
+
+		end, err := time.Parse("2006-01-02", reconcileEnd)
+		if err != nil {
+			log.Fatal().Err(err).Str("End", reconcileEnd).Msg("could not parse end date")
+		}
+
+		myLibrary, err := library.NewFromDB(ctx, viper.GetString("db.url"))
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not load library info")
+		}
+
+		// resolve the table of each subscription
+		subscriptions := make([]*library.Subscription, len(reconcileSubscriptions))
+		for idx, id := range reconcileSubscriptions {
+			sub, err := myLibrary.SubscriptionFromID(ctx, id)
+			if err != nil {
+				log.Fatal().Err(err).Str("ID", id).Msg("could not get subscription for ID")
+			}
+
+			if _, ok := sub.DataTablesMap[reconcileType]; !ok {
+				log.Fatal().Str("ID", id).Str("DataType", reconcileType).Msg("subscription does not produce data type")
+			}
+
+			subscriptions[idx] = sub
+		}
+
+		var writer *csv.Writer
+		if reconcileCSV != "" {
+			fh, err := os.Create(reconcileCSV)
+			if err != nil {
+				log.Fatal().Err(err).Str("FileName", reconcileCSV).Msg("could not create csv file")
+			}
+			defer fh.Close()
+
+			writer = csv.NewWriter(fh)
+			defer writer.Flush()
+
+			if err := writer.Write([]string{"left_subscription", "right_subscription", "kind", "composite_figi",
+				"ticker", "event_date", "column", "left", "right", "relative_diff"}); err != nil {
+				log.Fatal().Err(err).Msg("could not write csv header")
+			}
+		}
+
+		conn, err := myLibrary.Pool.Acquire(ctx)
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not acquire database connection")
+		}
+		defer conn.Release()
+
+		opts := data.ReconcileOptions{
+			Start:     start,
+			End:       end,
+			Tolerance: reconcileTolerance,
+		}
+
+		reference := subscriptions[0]
+		builder := strings.Builder{}
+		builder.WriteString(fmt.Sprintf("# Reconciliation: %s\n\n", reconcileType))
+		builder.WriteString(fmt.Sprintf("Dates: %s to %s, tolerance: %g\n", reconcileStart, reconcileEnd, reconcileTolerance))
+
+		numDiscrepancies := 0
+		for _, other := range subscriptions[1:] {
+			report, err := data.Reconcile(ctx, conn, reconcileType,
+				reference.DataTablesMap[reconcileType], other.DataTablesMap[reconcileType], opts,
+				func(discrepancy *data.Discrepancy) error {
+					if writer == nil {
+						return nil
+					}
+
+					eventDate := ""
+					if !discrepancy.EventDate.IsZero() {
+						eventDate = discrepancy.EventDate.Format("2006-01-02")
+					}
+
+					return writer.Write([]string{reference.ID.String()[:6], other.ID.String()[:6],
+						discrepancy.Kind, discrepancy.CompositeFigi, discrepancy.Ticker, eventDate, discrepancy.Column,
+						discrepancy.Left, discrepancy.Right, fmt.Sprintf("%g", discrepancy.RelativeDiff)})
+				})
+			if err != nil {
+				log.Fatal().Err(err).Msg("reconciliation failed")
+			}
+
+			numDiscrepancies += report.NumDiscrepancies()
+			builder.WriteString(reconcileSummary(reference, other, report))
+		}
+
+		renderMarkdown(builder.String())
+
+		if reconcileFail && numDiscrepancies > 0 {
+			if writer != nil {
+				writer.Flush()
+			}
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reconcileCmd)
+
+	reconcileCmd.Flags().StringVar(&reconcileType, "type", data.EODKey, "data type to compare")
+	reconcileCmd.Flags().StringSliceVar(&reconcileSubscriptions, "subscriptions", []string{}, "comma separated list of subscription IDs; the first is the reference")
+	reconcileCmd.Flags().StringVar(&reconcileStart, "start", time.Now().AddDate(0, 0, -7).Format("2006-01-02"), "first date to compare (YYYY-MM-DD)")
+	reconcileCmd.Flags().StringVar(&reconcileEnd, "end", time.Now().Format("2006-01-02"), "last date to compare (YYYY-MM-DD)")
+	reconcileCmd.Flags().Float64Var(&reconcileTolerance, "tolerance", 0.001, "largest relative difference between numeric values that is not reported")
+	reconcileCmd.Flags().StringVar(&reconcileCSV, "csv", "", "write discrepancies to this CSV file")
+	reconcileCmd.Flags().BoolVar(&reconcileFail, "fail", false, "exit with status 1 if any discrepancy is found")
+}
+
+// reconcileSummary describes a reconciliation report in markdown
+func reconcileSummary(left, right *library.Subscription, report *data.ReconcileReport) string {
+	builder := strings.Builder{}
+	builder.WriteString(fmt.Sprintf("\n## %s %s [%s] vs %s %s [%s]\n\n", left.Provider, left.Dataset, left.ID.String()[:6],
+		right.Provider, right.Dataset, right.ID.String()[:6]))
+	builder.WriteString(fmt.Sprintf("  * Rows compared: %d\n", report.RowsCompared))
+	builder.WriteString(fmt.Sprintf("  * Missing from %s: %d\n", left.ID.String()[:6], report.MissingLeft))
+	builder.WriteString(fmt.Sprintf("  * Missing from %s: %d\n", right.ID.String()[:6], report.MissingRight))
+
+	columns := make([]string, 0, len(report.Mismatches))
+	for col := range report.Mismatches {
+		columns = append(columns, col)
+	}
+	sort.Strings(columns)
+
+	for _, col := range columns {
+		if maxDiff, ok := report.MaxRelative[col]; ok {
+			builder.WriteString(fmt.Sprintf("  * %s mismatches: %d (max difference %.2f%%)\n", col, report.Mismatches[col], maxDiff*100))
+		} else {
+			builder.WriteString(fmt.Sprintf("  * %s mismatches: %d\n", col, report.Mismatches[col]))
+		}
+	}
+
+	return builder.String()
+}
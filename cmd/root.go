@@ -58,10 +58,17 @@ func Execute() {
 	}
 }
 
+// consoleWriter formats log messages for the terminal
+var consoleWriter = zerolog.ConsoleWriter{Out: os.Stderr}
+
 func init() {
 	cobra.OnInitialize(initConfig)
 
-	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+	log.Logger = log.Output(consoleWriter)
+
+	// library and provider code logs to the logger in its ctx; fall back to the
+	// global logger when a command did not attach one
+	zerolog.DefaultContextLogger = &log.Logger
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.pvdata.toml)")
 	infoCmd.PersistentFlags().String("dbUrl", "", "database connection string")
@@ -91,5 +98,11 @@ func initConfig() {
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
 		log.Info().Str("ConfigFN", viper.ConfigFileUsed()).Msg("Using config file")
+
+		// the config file holds database credentials and the library key
+		if info, err := os.Stat(viper.ConfigFileUsed()); err == nil && info.Mode().Perm()&0077 != 0 {
+			log.Warn().Str("ConfigFN", viper.ConfigFileUsed()).Str("Mode", info.Mode().Perm().String()).
+				Msg("config file is readable by other users; restrict it with chmod 600")
+		}
 	}
 }
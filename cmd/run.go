@@ -5,12 +5,26 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/penny-vault/pvdata/data"
+	"github.com/penny-vault/pvdata/figi"
+	"github.com/penny-vault/pvdata/healthcheck"
 	"github.com/penny-vault/pvdata/library"
+	"github.com/penny-vault/pvdata/metrics"
+	"github.com/penny-vault/pvdata/monitor"
 	"github.com/penny-vault/pvdata/provider"
+	"github.com/penny-vault/pvdata/secret"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -23,7 +37,17 @@ var runCmd = &cobra.Command{
 	Long: `The run sub-command executes subscriptions and saves the data they generate. If no
 arguments are provided then run will execute as a daemon and execute each subscription at the
 scheduled times. If subscription IDs are provided then each subscription will execute
-sequentially (ignoring any set schedule).`,
+sequentially (ignoring any set schedule).
+
+Price subscriptions can be backfilled by passing --start and --end; combine with
+--universe all to include assets that have since been delisted.
+
+Pass --dry-run to fetch the subscription's data without saving it. The observations
+are counted by data type, a sample of each is printed and they are compared with the
+rows already in the subscription's tables; --preview-file writes every observation to
+a JSON lines file for review:
+
+    pvdata run --dry-run --start 2024-06-01 --preview-file preview.jsonl 5f2c`,
 	Run: func(cmd *cobra.Command, args []string) {
 		ctx := context.Background()
 
@@ -34,18 +58,54 @@ sequentially (ignoring any set schedule).`,
 		}
 
 		// check if we are running in daemon mode
+		if len(args) == 0 && runDryRun {
+			log.Fatal().Msg("--dry-run requires at least one subscription id")
+		}
+
 		if len(args) == 0 {
 			// no args provided -- run as a daemon
-			// TODO
-			os.Exit(0)
+			if err := runDaemon(ctx, myLibrary); err != nil {
+				log.Fatal().Err(err).Msg("daemon exited with an error")
+			}
+			return
+		}
+
+		// limit the run to the requested date range
+		scope := &data.FetchScope{}
+		if runStart != "" {
+			if scope.Start, err = time.Parse("2006-01-02", runStart); err != nil {
+				log.Fatal().Err(err).Str("Start", runStart).Msg("could not parse start date")
+			}
+		}
+
+		if runEnd != "" {
+			if scope.End, err = time.Parse("2006-01-02", runEnd); err != nil {
+				log.Fatal().Err(err).Str("End", runEnd).Msg("could not parse end date")
+			}
+		}
+
+		if !scope.Start.IsZero() || !scope.End.IsZero() {
+			ctx = data.WithFetchScope(ctx, scope)
+		}
+
+		var universe data.UniversePolicy
+		if runUniverse != "" {
+			if universe, err = data.ParseUniversePolicy(runUniverse); err != nil {
+				log.Fatal().Err(err).Msg("invalid universe")
+			}
 		}
 
-		outChan := make(chan *data.Observation, 1000)
-		exitChan := make(chan data.RunSummary, 5)
+		var previewFile *os.File
+		if runPreviewFile != "" {
+			if !runDryRun {
+				log.Fatal().Msg("--preview-file requires --dry-run")
+			}
 
-		var wg sync.WaitGroup
-		wg.Add(1)
-		go myLibrary.SaveObservations(outChan, &wg)
+			if previewFile, err = os.Create(runPreviewFile); err != nil {
+				log.Fatal().Err(err).Str("FileName", runPreviewFile).Msg("could not create preview file")
+			}
+			defer previewFile.Close()
+		}
 
 		// not daemon mode, execute each subscription individually
 		for _, subscriptionID := range args {
@@ -54,45 +114,409 @@ sequentially (ignoring any set schedule).`,
 				log.Fatal().Err(err).Str("SubscriptionID", subscriptionID).Msg("could not load subscription")
 			}
 
-			var (
-				subProvider provider.Provider
-				subDataset  provider.Dataset
-				ok          bool
-			)
-
-			// create any needed partitions
-			err = subscription.ManagePartitions(ctx)
-			if err != nil {
-				log.Error().Err(err).Msg("ManagePartitions returned an error")
+			// override the subscription's universe for this run only
+			if universe != "" {
+				if subscription.Settings == nil {
+					subscription.Settings = make(map[string]string)
+				}
+				subscription.Settings[data.UniverseSetting] = string(universe)
 			}
 
-			if subProvider, ok = provider.Map[subscription.Provider]; !ok {
-				log.Fatal().Str("ProviderKey", subscription.Provider).Msg("subscription is mis-configured, provider not found")
+			if runDryRun {
+				var out io.Writer
+				if previewFile != nil {
+					out = previewFile
+				}
+
+				collector := data.NewCollector(runSample, out)
+				summary, diffs, err := previewSubscription(ctx, subscription, collector)
+				if err != nil {
+					log.Fatal().Err(err).Str("SubscriptionID", subscriptionID).Msg("could not preview subscription")
+				}
+
+				renderMarkdown(previewReport(subscription, summary, collector, diffs))
+				continue
 			}
 
-			if subDataset, ok = subProvider.Datasets()[subscription.Dataset]; !ok {
-				log.Fatal().Str("ProviderKey", subscription.Provider).Str("DatasetKey", subscription.Dataset).
-					Msg("subscription is mis-configured, dataset not found")
+			if _, err := runSubscription(ctx, subscription); err != nil {
+				log.Fatal().Err(err).Str("SubscriptionID", subscriptionID).Msg("could not run subscription")
 			}
+		}
+
+		if previewFile != nil {
+			log.Info().Str("FileName", runPreviewFile).Msg("wrote preview")
+		}
+	},
+}
+
+var (
+	runStart       string
+	runEnd         string
+	runUniverse    string
+	runDryRun      bool
+	runSample      int
+	runPreviewFile string
+)
+
+var (
+	ErrSubscriptionMisconfigured = errors.New("subscription is mis-configured")
+)
+
+func init() {
+	rootCmd.AddCommand(runCmd)
+
+	runCmd.Flags().StringVar(&runStart, "start", "", "fetch data starting on this date (YYYY-MM-DD)")
+	runCmd.Flags().StringVar(&runEnd, "end", "", "fetch data through this date (YYYY-MM-DD)")
+	runCmd.Flags().StringVar(&runUniverse, "universe", "", "assets to fetch for price subscriptions: active, recent or all")
+	runCmd.Flags().BoolVar(&runDryRun, "dry-run", false, "fetch and compare data without saving it")
+	runCmd.Flags().IntVar(&runSample, "sample", 5, "number of records of each data type printed by --dry-run")
+	runCmd.Flags().StringVar(&runPreviewFile, "preview-file", "", "write the observations fetched by --dry-run to this JSON lines file")
+}
 
-			fetchLogger := log.With().Str("SubscriptionID", subscriptionID).Logger()
-			ctx = fetchLogger.WithContext(ctx)
+// runSubscription imports the subscription and notifies its monitor when the
+// run starts and when it ends. Failures, runs that import nothing and recoveries
+// are alerted on with the tail of the run's log.
+func runSubscription(ctx context.Context, subscription *library.Subscription) (data.RunSummary, error) {
+	// resolve secrets up front so they can be masked in the run's log
+	config, resolveErr := subscription.ResolvedConfig()
 
-			subDataset.Fetch(ctx, subscription, outChan, exitChan)
+	tail := healthcheck.NewLogTail(healthcheck.DefaultLogTailSize)
+	logWriter := secret.NewRedactor(zerolog.MultiLevelWriter(consoleWriter, zerolog.ConsoleWriter{Out: tail, NoColor: true}),
+		secretValues(subscription, config)...)
+	subLogger := log.Output(logWriter).With().Str("SubscriptionID", subscription.ID.String()).Logger()
+	ctx = subLogger.WithContext(ctx)
 
-			// read the exit message from exitChan
-			summaryMsg := <-exitChan
-			fetchLogger.Info().Time("StartTime", summaryMsg.StartTime).Time("EndTime", summaryMsg.EndTime).Str("RunTime", summaryMsg.EndTime.Sub(summaryMsg.StartTime).String()).Msg("finished running subscription")
+	subMonitor, err := monitor.New(subscription.Settings[monitor.KindSetting], subscription.Settings[monitor.TargetSetting],
+		subscription.HealthCheckID)
+	if err != nil {
+		subLogger.Error().Err(err).Msg("could not create monitor; subscription will run unmonitored")
+	}
+
+	notify := func(event *monitor.Event) {
+		if subMonitor == nil {
+			return
+		}
+
+		if err := subMonitor.Notify(ctx, event); err != nil {
+			subLogger.Warn().Err(err).Str("Monitor", subMonitor.Name()).Str("Event", string(event.Kind)).Msg("could not notify monitor")
 		}
+	}
 
-		// close the output channel
-		close(outChan)
+	notify(&monitor.Event{
+		Kind: monitor.EventStart,
+		Summary: data.RunSummary{
+			StartTime:        time.Now(),
+			SubscriptionID:   subscription.ID,
+			SubscriptionName: subscription.Name,
+		},
+	})
 
-		// wait for library SaveObservations to finish
-		wg.Wait()
-	},
+	var summary data.RunSummary
+	err = resolveErr
+	if err == nil {
+		summary, err = importSubscription(ctx, subscription, config)
+	}
+
+	if summary.SubscriptionID == uuid.Nil {
+		summary.SubscriptionID = subscription.ID
+		summary.SubscriptionName = subscription.Name
+	}
+
+	event := &monitor.Event{
+		Kind:    monitor.Classify(summary, err, monitor.EventKind(subscription.LastStatus)),
+		Summary: summary,
+		Log:     string(tail.Bytes()),
+	}
+
+	if err != nil {
+		event.Error = err.Error()
+	}
+
+	metrics.RunFinished(subscription.Provider, summary, string(event.Kind))
+
+	if event.Kind == monitor.EventNoData {
+		subLogger.Warn().Msg("subscription run did not import any observations")
+	}
+
+	notify(event)
+
+	if recordErr := subscription.RecordRun(ctx, time.Now(), string(event.Kind)); recordErr != nil {
+		subLogger.Error().Err(recordErr).Msg("could not record subscription run")
+	}
+
+	return summary, err
 }
 
-func init() {
-	rootCmd.AddCommand(runCmd)
+// importSubscription fetches the subscription's data, saves it to the library and
+// performs any post-processing the saved data requires. The provider is passed
+// a copy of the subscription with `config`, the resolved config.
+func importSubscription(ctx context.Context, subscription *library.Subscription, config map[string]string) (data.RunSummary, error) {
+	logger := zerolog.Ctx(ctx)
+
+	subDataset, err := subscriptionDataset(subscription)
+	if err != nil {
+		return data.RunSummary{}, err
+	}
+
+	// catch configuration errors before the provider starts fetching
+	schema := provider.Map[subscription.Provider].ConfigSchema()
+	config = schema.WithDefaults(config)
+	if err := schema.Validate(config); err != nil {
+		return data.RunSummary{}, fmt.Errorf("%w: %w", ErrSubscriptionMisconfigured, err)
+	}
+
+	// every provider request goes through the fetch subscription's client and limiter
+	fetchSubscription, err := subscription.ForFetch(config)
+	if err != nil {
+		return data.RunSummary{}, fmt.Errorf("%w: %w", ErrSubscriptionMisconfigured, err)
+	}
+	ctx = metrics.WithProvider(ctx, subscription.Provider)
+
+	// create tables for data types added to the dataset after the subscription was created
+	missing := make([]string, 0)
+	for _, dataType := range subDataset.DataTypes {
+		if _, ok := subscription.DataTablesMap[dataType.Name]; !ok {
+			missing = append(missing, dataType.Name)
+		}
+	}
+
+	if err := subscription.AddDataTypes(ctx, missing...); err != nil {
+		return data.RunSummary{}, err
+	}
+
+	// bring tables up-to-date with the current schema
+	if err := subscription.MigrateTables(ctx); err != nil {
+		return data.RunSummary{}, err
+	}
+
+	// create any needed partitions
+	if err := subscription.ManagePartitions(ctx); err != nil {
+		logger.Error().Err(err).Msg("ManagePartitions returned an error")
+	}
+
+	// remember OpenFIGI lookups across runs
+	figi.UseDatabase(subscription.Library.Pool)
+
+	outChan := make(chan *data.Observation, 1000)
+	exitChan := make(chan data.RunSummary, 5)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go subscription.Library.SaveObservations(ctx, outChan, &wg)
+
+	subDataset.Fetch(ctx, fetchSubscription, outChan, exitChan)
+
+	// read the exit message from exitChan
+	summaryMsg := <-exitChan
+
+	// wait for library SaveObservations to finish
+	close(outChan)
+	wg.Wait()
+
+	logger.Info().Time("StartTime", summaryMsg.StartTime).Time("EndTime", summaryMsg.EndTime).Str("RunTime", summaryMsg.EndTime.Sub(summaryMsg.StartTime).String()).Msg("finished running subscription")
+
+	// fold new asset descriptions into the asset master
+	if _, ok := subscription.DataTablesMap[data.AssetKey]; ok {
+		if _, err := subscription.Library.MergeAssetMaster(ctx); err != nil {
+			logger.Error().Err(err).Msg("could not merge asset master")
+		}
+	}
+
+	// apply any new splits and dividends now that all observations are saved
+	if _, err := subscription.AdjustPrices(ctx, data.AdjustOptions{
+		TotalReturn: viper.GetBool("eod.total_return"),
+	}); err != nil {
+		return summaryMsg, err
+	}
+
+	// check recent history for missing trading days; runs targeting specific
+	// assets skip the check since they are themselves repairing gaps
+	if scope, scoped := data.FetchScopeFromContext(ctx); !scoped || len(scope.Requests) == 0 {
+		if err := postRunGapCheck(ctx, subscription); err != nil {
+			logger.Error().Err(err).Msg("gap check failed")
+		}
+	}
+
+	return summaryMsg, nil
+}
+
+// previewSubscription fetches the subscription's data into `collector` and
+// compares it with the rows already saved. Nothing is written to the
+// subscription's tables and its monitor is not notified.
+func previewSubscription(ctx context.Context, subscription *library.Subscription, collector *data.Collector) (data.RunSummary, []*data.PreviewDiff, error) {
+	config, err := subscription.ResolvedConfig()
+	if err != nil {
+		return data.RunSummary{}, nil, err
+	}
+
+	logWriter := secret.NewRedactor(consoleWriter, secretValues(subscription, config)...)
+	logger := log.Output(logWriter).With().Str("SubscriptionID", subscription.ID.String()).Bool("DryRun", true).Logger()
+	ctx = data.WithDryRun(logger.WithContext(ctx))
+
+	subDataset, err := subscriptionDataset(subscription)
+	if err != nil {
+		return data.RunSummary{}, nil, err
+	}
+
+	schema := provider.Map[subscription.Provider].ConfigSchema()
+	config = schema.WithDefaults(config)
+	if err := schema.Validate(config); err != nil {
+		return data.RunSummary{}, nil, fmt.Errorf("%w: %w", ErrSubscriptionMisconfigured, err)
+	}
+
+	fetchSubscription, err := subscription.ForFetch(config)
+	if err != nil {
+		return data.RunSummary{}, nil, fmt.Errorf("%w: %w", ErrSubscriptionMisconfigured, err)
+	}
+	ctx = metrics.WithProvider(ctx, subscription.Provider)
+
+	if subscription.SchemaVersion < subscription.TargetSchemaVersion() {
+		logger.Warn().Msg("subscription tables have not been migrated to the current schema; new columns are not compared")
+	}
+
+	// use cached OpenFIGI lookups but don't save new ones
+	figi.UseDatabaseReadOnly(subscription.Library.Pool)
+
+	preview, err := subscription.NewPreview(ctx, collector)
+	if err != nil {
+		return data.RunSummary{}, nil, err
+	}
+	defer preview.Close(ctx)
+
+	outChan := make(chan *data.Observation, 1000)
+	exitChan := make(chan data.RunSummary, 5)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go preview.Collect(ctx, outChan, &wg)
+
+	subDataset.Fetch(ctx, fetchSubscription, outChan, exitChan)
+
+	summary := <-exitChan
+	close(outChan)
+	wg.Wait()
+
+	logger.Info().Time("StartTime", summary.StartTime).Time("EndTime", summary.EndTime).Str("RunTime", summary.EndTime.Sub(summary.StartTime).String()).Msg("finished previewing subscription")
+
+	diffs, err := preview.Diff(ctx)
+	return summary, diffs, err
+}
+
+// previewReport describes a dry run in markdown
+func previewReport(subscription *library.Subscription, summary data.RunSummary, collector *data.Collector, diffs []*data.PreviewDiff) string {
+	builder := strings.Builder{}
+	builder.WriteString(fmt.Sprintf("# Preview of %s\n\n", subscription.Name))
+	builder.WriteString(fmt.Sprintf("%s %s [%s], fetched in %s; nothing was saved.\n\n", subscription.Provider,
+		subscription.Dataset, subscription.ID.String()[:6], summary.EndTime.Sub(summary.StartTime).Round(time.Millisecond)))
+
+	if len(diffs) == 0 {
+		builder.WriteString("No observations were fetched.\n")
+		return builder.String()
+	}
+
+	builder.WriteString("| Data type | Observations | Rejected | New | Changed | Unchanged |\n|---|---|---|---|---|---|\n")
+	for _, diff := range diffs {
+		builder.WriteString(fmt.Sprintf("| %s | %d | %d | %d | %d | %d |\n", diff.DataType, collector.Counts[diff.DataType],
+			collector.Rejected[diff.DataType], diff.New, diff.Changed, diff.Unchanged))
+	}
+
+	for _, diff := range diffs {
+		if len(diff.Columns) == 0 {
+			continue
+		}
+
+		columns := make([]string, 0, len(diff.Columns))
+		for column := range diff.Columns {
+			columns = append(columns, column)
+		}
+		slices.Sort(columns)
+
+		builder.WriteString(fmt.Sprintf("\n**Changed columns (%s):**\n\n", diff.DataType))
+		for _, column := range columns {
+			builder.WriteString(fmt.Sprintf("  * %s: %d rows\n", column, diff.Columns[column]))
+		}
+	}
+
+	for _, dataType := range collector.DataTypes() {
+		samples := collector.Samples[dataType]
+		if len(samples) == 0 {
+			continue
+		}
+
+		builder.WriteString(fmt.Sprintf("\n## Sample %s records\n\n```json\n", dataType))
+		for _, obs := range samples {
+			_, payload := obs.Payload()
+			record, err := json.Marshal(payload)
+			if err != nil {
+				continue
+			}
+			builder.Write(record)
+			builder.WriteString("\n")
+		}
+		builder.WriteString("```\n")
+	}
+
+	return builder.String()
+}
+
+// secretValues returns the plaintext of the subscription's secrets from its
+// resolved config
+func secretValues(subscription *library.Subscription, config map[string]string) []string {
+	fields := provider.SecretFields(subscription.Provider)
+	values := make([]string, 0, len(fields))
+	for field, val := range subscription.Config {
+		if slices.Contains(fields, field) || secret.IsSealed(val) {
+			values = append(values, config[field])
+		}
+	}
+	return values
+}
+
+// subscriptionDataset returns the provider dataset the subscription imports
+func subscriptionDataset(subscription *library.Subscription) (provider.Dataset, error) {
+	subProvider, ok := provider.Map[subscription.Provider]
+	if !ok {
+		log.Error().Str("ProviderKey", subscription.Provider).Msg("subscription is mis-configured, provider not found")
+		return provider.Dataset{}, ErrSubscriptionMisconfigured
+	}
+
+	subDataset, ok := subProvider.Datasets()[subscription.Dataset]
+	if !ok {
+		log.Error().Str("ProviderKey", subscription.Provider).Str("DatasetKey", subscription.Dataset).
+			Msg("subscription is mis-configured, dataset not found")
+		return provider.Dataset{}, ErrSubscriptionMisconfigured
+	}
+
+	return subDataset, nil
+}
+
+// postRunGapCheck looks for gaps in the last gaps.lookback_days (default 10) days of the
+// subscription's EOD table and, if gaps.repair is set, re-fetches them
+func postRunGapCheck(ctx context.Context, subscription *library.Subscription) error {
+	if _, ok := subscription.DataTablesMap[data.EODKey]; !ok {
+		return nil
+	}
+
+	lookback := 10
+	if viper.IsSet("gaps.lookback_days") {
+		lookback = viper.GetInt("gaps.lookback_days")
+	}
+
+	if lookback <= 0 {
+		return nil
+	}
+
+	end := time.Now().AddDate(0, 0, -1)
+	start := end.AddDate(0, 0, -lookback)
+
+	gaps, err := checkGaps(ctx, subscription, start, end)
+	if err != nil {
+		return err
+	}
+
+	if len(gaps) > 0 && viper.GetBool("gaps.repair") {
+		return repairGaps(ctx, subscription, gaps)
+	}
+
+	return nil
 }
@@ -0,0 +1,115 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/penny-vault/pvdata/library"
+	"github.com/penny-vault/pvdata/provider"
+	"github.com/penny-vault/pvdata/secret"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// secretsCmd represents the secrets command
+var secretsCmd = &cobra.Command{
+	Use:   "secrets",
+	Short: "Manage the library key used to encrypt provider credentials",
+	Long: `Provider credentials, such as API keys and passwords, are encrypted in the library
+with the library key. The key is read from the PVDATA_SECRETS_KEY environment variable,
+the secrets.key setting or the file named by secrets.key_file; pvdata init generates one.
+
+Instead of storing a credential in the library it may be given as a reference that
+is resolved when the subscription runs:
+
+    env:TIINGO_API_KEY      read from an environment variable
+    file:/run/secrets/key   read from a file`,
+}
+
+// secretsKeygenCmd represents the secrets keygen command
+var secretsKeygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "Print a new library key",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		key, err := secret.GenerateKey()
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not generate library key")
+		}
+		fmt.Println(key)
+	},
+}
+
+// secretsSealCmd represents the secrets seal command
+var secretsSealCmd = &cobra.Command{
+	Use:   "seal [subscription-id...]",
+	Short: "Encrypt plaintext credentials saved in subscriptions",
+	Long: `Seal encrypts credentials that were saved in plaintext, e.g. by earlier versions
+of pvdata, with the library key. If no subscription IDs are given every subscription
+is sealed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		myLibrary, err := library.NewFromDB(ctx, viper.GetString("db.url"))
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not load library info")
+		}
+
+		var subscriptions []*library.Subscription
+		if len(args) == 0 {
+			subscriptions, err = myLibrary.Subscriptions(ctx)
+			if err != nil {
+				log.Fatal().Err(err).Msg("could not load subscriptions")
+			}
+		}
+
+		for _, id := range args {
+			sub, err := myLibrary.SubscriptionFromID(ctx, id)
+			if err != nil {
+				log.Fatal().Err(err).Str("ID", id).Msg("could not get subscription for ID")
+			}
+			subscriptions = append(subscriptions, sub)
+		}
+
+		for _, sub := range subscriptions {
+			sub.SecretFields = provider.SecretFields(sub.Provider)
+
+			sealed := true
+			for _, field := range sub.SecretFields {
+				if val := sub.Config[field]; val != "" && !secret.IsSealed(val) {
+					sealed = false
+				}
+			}
+
+			if sealed {
+				continue
+			}
+
+			if err := sub.SaveConfig(ctx); err != nil {
+				log.Fatal().Err(err).Str("SubscriptionID", sub.ID.String()).Msg("could not seal subscription config")
+			}
+
+			log.Info().Str("SubscriptionID", sub.ID.String()).Msg("encrypted subscription credentials")
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(secretsCmd)
+	secretsCmd.AddCommand(secretsKeygenCmd)
+	secretsCmd.AddCommand(secretsSealCmd)
+}
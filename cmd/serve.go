@@ -0,0 +1,109 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/penny-vault/pvdata/api"
+	"github.com/penny-vault/pvdata/library"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve a read-only HTTP API over the library",
+	Long: `Serve exposes the library as a read-only REST API so that clients don't need to
+know how tables are named. Every endpoint returns JSON; add ?format=csv (or send
+Accept: text/csv) for CSV. Lists are paged with ?limit= and ?offset= and every
+response carries an ETag.
+
+    GET /v1/library                     library summary
+    GET /v1/subscriptions[/{id}]        subscriptions and their status
+    GET /v1/assets?q=&active=&type=     search the asset master
+    GET /v1/assets/{figi-or-ticker}     look up an asset
+    GET /v1/eod/{figi-or-ticker}        end-of-day prices
+    GET /v1/fundamentals/{figi-or-ticker}?dimension=
+    GET /v1/metrics/{figi-or-ticker}
+    GET /v1/indicators/{series}         economic indicators
+    GET /v1/holidays?market=            market holidays
+    GET /v1/arrow/{data-type}           bulk reads as an Arrow IPC stream
+
+Time series accept ?start= and ?end= (YYYY-MM-DD, inclusive) and ?subscription=
+to choose between subscriptions providing the same data type.
+
+The Arrow endpoint streams every matching row (it is not paged) as record
+batches typed from the data type's columns. Filter it with comma separated
+?ticker=, ?figi=, ?series=, ?dimension= or ?market= plus ?start= and ?end=.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+
+		myLibrary, err := library.NewFromDB(ctx, viper.GetString("db.url"))
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not connect to library")
+		}
+
+		listenAddr := api.DefaultListenAddr
+		if viper.IsSet("serve.listen") {
+			listenAddr = viper.GetString("serve.listen")
+		}
+
+		if serveListen != "" {
+			listenAddr = serveListen
+		}
+
+		server := &http.Server{
+			Addr:              listenAddr,
+			Handler:           api.New(myLibrary),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		go func() {
+			sig := make(chan os.Signal, 1)
+			signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+			<-sig
+
+			log.Info().Msg("stopping api server")
+			if err := server.Shutdown(ctx); err != nil {
+				log.Error().Err(err).Msg("could not stop api server")
+			}
+		}()
+
+		log.Info().Str("Addr", listenAddr).Msg("serving library api")
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal().Err(err).Msg("api server failed")
+		}
+	},
+}
+
+var (
+	serveListen string
+)
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().StringVar(&serveListen, "listen", "", "address to listen on (default serve.listen or :8080)")
+}
@@ -19,15 +19,21 @@ import (
 	"fmt"
 	"math/rand"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 	"unicode"
 
 	"github.com/charmbracelet/huh"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/gosimple/slug"
+	"github.com/penny-vault/pvdata/data"
 	"github.com/penny-vault/pvdata/healthcheck"
 	"github.com/penny-vault/pvdata/library"
+	"github.com/penny-vault/pvdata/metrics"
+	"github.com/penny-vault/pvdata/monitor"
 	"github.com/penny-vault/pvdata/provider"
+	"github.com/robfig/cron/v3"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -40,11 +46,17 @@ var subscribeCmd = &cobra.Command{
 	Long: `Subscriptions are the primary mechanism pv-data uses to import
 data. To create a new subscription select the data provider desired and
 the wizard will walk you through the rest of the process to setup a new
-subscription.
+subscription. Any value may be given with flags instead; pass --yes to skip
+the wizard and create the subscription from flags alone:
+
+    pvdata subscribe tiingo --yes --dataset EOD --config apiKey=env:TIINGO_API_KEY \
+        --schedule "30 18 * * 1-5" --monitor webhook --monitor-target https://hooks.example.com
 
 When creating a subscription a couple of things happen:
 
-    1. Configuration, like authentication details, are saved in the library
+    1. Configuration, like authentication details, are saved in the library;
+       credentials are encrypted with the library key (secrets.key) or may
+       be given as env:VAR_NAME or file:/path references
     2. Database tables are initialized
     3. A regular import schedule is defined
 
@@ -55,7 +67,9 @@ Also see: subscriptions, unsubscribe`,
 			dataProvider provider.Provider
 			ok           bool
 			confirmed    bool
-			monitored    bool
+
+			monitorKind   string
+			monitorTarget string
 
 			subName     string
 			subDataset  string
@@ -79,10 +93,20 @@ Also see: subscriptions, unsubscribe`,
 
 		r := []rune(providerName)
 		subName = string(append([]rune{unicode.ToUpper(r[0])}, r[1:]...))
+		if subscribeName != "" {
+			subName = subscribeName
+		}
 
 		minuteChoice := rand.Intn(12) * 5
 		hourChoice := rand.Intn(9)
 		subSchedule = fmt.Sprintf("%d %d * * 1-5", minuteChoice, hourChoice)
+		if subscribeSchedule != "" {
+			subSchedule = subscribeSchedule
+		}
+
+		subDataset = subscribeDataset
+		monitorKind = subscribeMonitor
+		monitorTarget = subscribeMonitorTarget
 
 		// build a dataset selection field
 		datasetOptions := make([]huh.Option[string], 0, len(dataProvider.Datasets()))
@@ -91,59 +115,81 @@ Also see: subscriptions, unsubscribe`,
 		}
 
 		// create a new field group for configuring the provider
-		configFields := make([]huh.Field, 0, len(dataProvider.ConfigDescription()))
-		config := make(map[string]*string, len(dataProvider.ConfigDescription()))
-		for k, v := range dataProvider.ConfigDescription() {
-			val := ""
-			config[k] = &val
-			configFields = append(configFields, huh.NewInput().Title(v).Value(config[k]))
+		schema := dataProvider.ConfigSchema()
+		configFields := make([]huh.Field, 0, len(schema))
+		config := make(map[string]*string, len(schema))
+		for key := range subscribeConfig {
+			if !slices.ContainsFunc(schema, func(field *provider.ConfigField) bool { return field.Key == key }) {
+				log.Fatal().Str("Key", key).Str("Provider", providerName).Msg("provider does not have config key")
+			}
+		}
+
+		for _, field := range schema {
+			val := field.Default
+			if flagVal, ok := subscribeConfig[field.Key]; ok {
+				val = flagVal
+			}
+			config[field.Key] = &val
+			configFields = append(configFields, configInput(field, config[field.Key]))
 		}
 
 		// walk user through settings required for subscription
-		var form *huh.Form
+		groups := []*huh.Group{
+			huh.NewGroup(
+				huh.NewInput().
+					Title("What should the subscription be named?").
+					Value(&subName),
+				huh.NewSelect[string]().
+					Title("Which dataset do you want to subscribe to?").
+					Options(datasetOptions...).
+					Value(&subDataset),
+				huh.NewInput().
+					Title("What schedule should the subscription run on?").
+					Validate(func(val string) error {
+						_, err := cron.ParseStandard(val)
+						return err
+					}).
+					Value(&subSchedule),
+				huh.NewSelect[string]().
+					Title("How should the subscription be monitored?").
+					Options(
+						huh.NewOption("Not monitored", monitor.KindNone),
+						huh.NewOption("healthchecks.io check", monitor.KindHealthchecks),
+						huh.NewOption("Webhook", monitor.KindWebhook),
+						huh.NewOption("Email", monitor.KindEmail),
+						huh.NewOption("Run a command", monitor.KindExec),
+					).
+					Value(&monitorKind),
+			),
+			huh.NewGroup(
+				huh.NewInput().
+					Title("Where should alerts be sent? (webhook URL, email addresses or command)").
+					Validate(func(val string) error {
+						return monitor.Validate(monitorKind, val)
+					}).
+					Value(&monitorTarget),
+			).WithHideFunc(func() bool {
+				return monitorKind == monitor.KindNone || monitorKind == monitor.KindHealthchecks
+			}),
+		}
 
 		if len(configFields) > 0 {
-			form = huh.NewForm(
-				huh.NewGroup(
-					huh.NewInput().
-						Title("What should the subscription be named?").
-						Value(&subName),
-					huh.NewSelect[string]().
-						Title("Which dataset do you want to subscribe to?").
-						Options(datasetOptions...).
-						Value(&subDataset),
-					huh.NewInput().
-						Title("What schedule should the subscription run on?").
-						Value(&subSchedule),
-					huh.NewConfirm().
-						Title("Should a healthcheck.io monitor be created for the subscription?").
-						Value(&monitored),
-				),
-				huh.NewGroup(configFields...),
-			)
+			groups = append(groups, huh.NewGroup(configFields...))
+		}
+
+		if subscribeYes {
+			if err := monitor.Validate(monitorKind, monitorTarget); err != nil {
+				log.Fatal().Err(err).Msg("invalid monitor")
+			}
 		} else {
-			form = huh.NewForm(
-				huh.NewGroup(
-					huh.NewInput().
-						Title("What should the subscription be named?").
-						Value(&subName),
-					huh.NewSelect[string]().
-						Title("Which dataset do you want to subscribe to?").
-						Options(datasetOptions...).
-						Value(&subDataset),
-					huh.NewInput().
-						Title("What schedule should the subscription run on?").
-						Value(&subSchedule),
-					huh.NewConfirm().
-						Title("Should a healthcheck.io monitor be created for the subscription?").
-						Value(&monitored),
-				),
-			)
+			form := huh.NewForm(groups...)
+			if err := form.Run(); err != nil {
+				log.Fatal().Err(err).Msg("failed to create wizard")
+			}
 		}
 
-		err = form.Run()
-		if err != nil {
-			log.Fatal().Err(err).Msg("failed to create wizard")
+		if _, err := cron.ParseStandard(subSchedule); err != nil {
+			log.Fatal().Err(err).Str("Schedule", subSchedule).Msg("invalid schedule")
 		}
 
 		// build configuration map
@@ -152,16 +198,74 @@ Also see: subscriptions, unsubscribe`,
 			subConfig[k] = *v
 		}
 
+		// --yes skips the form's field checks
+		if err := schema.Validate(schema.WithDefaults(subConfig)); err != nil {
+			log.Fatal().Err(err).Str("Provider", providerName).Msg("invalid provider configuration")
+		}
+
 		// create a new subscription
 		subscription, err := provider.NewSubscription(providerName, subDataset, subConfig, myLibrary)
 		if err != nil {
-			log.Fatal().Err(err).Msg("unexpected error occurred when creating subscription")
+			log.Fatal().Err(err).Msg("could not create subscription")
 		}
 
 		subscription.Name = subName
 		subscription.Schedule = subSchedule
 		subscription.Dataset = subDataset
 
+		// price subscriptions choose which assets are fetched
+		if _, ok := subscription.DataTablesMap[data.EODKey]; ok {
+			universe := string(data.UniverseActive)
+			if subscribeUniverse != "" {
+				policy, err := data.ParseUniversePolicy(subscribeUniverse)
+				if err != nil {
+					log.Fatal().Err(err).Msg("invalid universe")
+				}
+				universe = string(policy)
+			}
+
+			recentDays := strconv.Itoa(subscribeRecentDays)
+
+			universeForm := huh.NewForm(
+				huh.NewGroup(
+					huh.NewSelect[string]().
+						Title("Which assets should prices be fetched for?").
+						Options(
+							huh.NewOption("Active assets", string(data.UniverseActive)),
+							huh.NewOption("Active and recently delisted assets", string(data.UniverseRecent)),
+							huh.NewOption("All assets listed during the fetched range", string(data.UniverseAll)),
+						).
+						Value(&universe),
+				),
+				huh.NewGroup(
+					huh.NewInput().
+						Title("Include assets delisted within how many days?").
+						Validate(func(val string) error {
+							_, err := strconv.Atoi(val)
+							return err
+						}).
+						Value(&recentDays),
+				).WithHideFunc(func() bool {
+					return universe != string(data.UniverseRecent)
+				}),
+			)
+
+			if !subscribeYes {
+				if err := universeForm.Run(); err != nil {
+					log.Fatal().Err(err).Msg("failed to create wizard")
+				}
+			}
+
+			if subscription.Settings == nil {
+				subscription.Settings = make(map[string]string)
+			}
+			subscription.Settings[data.UniverseSetting] = universe
+
+			if universe == string(data.UniverseRecent) {
+				subscription.Settings[data.UniverseRecentDaysSetting] = recentDays
+			}
+		}
+
 		// Print subscription summary
 		{
 			var sb strings.Builder
@@ -170,8 +274,8 @@ Also see: subscriptions, unsubscribe`,
 			}
 
 			isMonitored := "no"
-			if monitored {
-				isMonitored = "yes"
+			if monitorKind != monitor.KindNone {
+				isMonitored = monitorKind
 			}
 
 			fmt.Fprintf(&sb,
@@ -186,7 +290,7 @@ Also see: subscriptions, unsubscribe`,
 			)
 
 			fmt.Fprintln(&sb, lipgloss.NewStyle().Bold(true).Render("Provider Configuration"))
-			for k, v := range subscription.Config {
+			for k, v := range subscription.MaskedConfig() {
 				fmt.Fprintf(&sb, "\n%s: %s", k, keyword(v))
 			}
 
@@ -200,32 +304,55 @@ Also see: subscriptions, unsubscribe`,
 			)
 		}
 
+		confirmTitle := "Create subscription?"
+		if tester, ok := dataProvider.(provider.ConnectionTester); ok {
+			log.Info().Str("Provider", providerName).Msg("testing connection")
+			resolved, err := subscription.ResolvedConfig()
+			if err == nil {
+				err = tester.TestConnection(metrics.WithProvider(ctx, providerName), resolved)
+			}
+
+			if err != nil {
+				if subscribeYes {
+					log.Fatal().Err(err).Msg("connection test failed")
+				}
+
+				log.Error().Err(err).Msg("connection test failed")
+				confirmTitle = "The connection test failed. Create subscription anyway?"
+			} else {
+				log.Info().Msg("connection test succeeded")
+			}
+		}
+
 		confirmForm := huh.NewForm(
 			huh.NewGroup(
 				huh.NewConfirm().
-					Title("Create subscription?").
+					Title(confirmTitle).
 					Value(&confirmed),
 			),
 		)
 
-		err = confirmForm.Run()
-		if err != nil {
+		if subscribeYes {
+			confirmed = true
+		} else if err := confirmForm.Run(); err != nil {
 			log.Fatal().Err(err).Msg("failed to create wizard")
 		}
 
 		if confirmed {
-			if monitored {
-				checkSlug := slug.Make(fmt.Sprintf("%s %s %s %s", subscription.Name, subscription.Provider, subscription.Dataset, subscription.ID.String()[:5]))
-				checkID, err := healthcheck.Create(
-					fmt.Sprintf("%s %s (%s)", subscription.Name, subscription.Dataset, subscription.ID.String()[:5]),
-					checkSlug,
-					subscription.DataTypes,
-					subscription.Schedule,
-				)
-				if err != nil {
+			if monitorKind != monitor.KindNone {
+				if subscription.Settings == nil {
+					subscription.Settings = make(map[string]string)
+				}
+				subscription.Settings[monitor.KindSetting] = monitorKind
+				if monitorTarget != "" {
+					subscription.Settings[monitor.TargetSetting] = monitorTarget
+				}
+			}
+
+			if monitorKind == monitor.KindHealthchecks {
+				if err := createHealthCheck(subscription); err != nil {
 					log.Fatal().Err(err).Msg("creating healthcheck failed")
 				}
-				subscription.HealthCheckID = checkID
 			}
 
 			if err := subscription.Save(ctx); err != nil {
@@ -239,16 +366,68 @@ Also see: subscriptions, unsubscribe`,
 	},
 }
 
+var (
+	subscribeName          string
+	subscribeDataset       string
+	subscribeSchedule      string
+	subscribeMonitor       string
+	subscribeMonitorTarget string
+	subscribeConfig        map[string]string
+	subscribeUniverse      string
+	subscribeRecentDays    int
+	subscribeYes           bool
+)
+
 func init() {
 	rootCmd.AddCommand(subscribeCmd)
 
-	// Here you will define your flags and configuration settings.
+	subscribeCmd.Flags().StringVar(&subscribeName, "name", "", "subscription name")
+	subscribeCmd.Flags().StringVar(&subscribeDataset, "dataset", "", "dataset to subscribe to")
+	subscribeCmd.Flags().StringVar(&subscribeSchedule, "schedule", "", "cron schedule the subscription runs on (default random time on weekdays)")
+	subscribeCmd.Flags().StringVar(&subscribeMonitor, "monitor", "", "monitor: healthchecks, webhook, email or exec")
+	subscribeCmd.Flags().StringVar(&subscribeMonitorTarget, "monitor-target", "", "webhook URL, email addresses or command alerts are sent to")
+	subscribeCmd.Flags().StringToStringVar(&subscribeConfig, "config", nil, "provider config as key=value (see pvdata providers <name>)")
+	subscribeCmd.Flags().StringVar(&subscribeUniverse, "universe", "", "assets to fetch for price subscriptions: active, recent or all")
+	subscribeCmd.Flags().IntVar(&subscribeRecentDays, "universe-recent-days", data.DefaultUniverseRecentDays, "include assets delisted within this many days with --universe recent")
+	subscribeCmd.Flags().BoolVarP(&subscribeYes, "yes", "y", false, "create the subscription from flags without prompting")
+}
 
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// subscribeCmd.PersistentFlags().String("foo", "", "A help for foo")
+// configInput returns a wizard field that sets `value` for a provider config field
+func configInput(field *provider.ConfigField, value *string) huh.Field {
+	options := field.Options
+	if len(options) == 0 && field.Type == provider.ConfigBool {
+		options = []string{"true", "false"}
+	}
+
+	if len(options) > 0 {
+		return huh.NewSelect[string]().
+			Title(field.Title).
+			Description(field.Description).
+			Options(huh.NewOptions(options...)...).
+			Value(value)
+	}
+
+	return huh.NewInput().
+		Title(field.Title).
+		Description(field.Description).
+		Password(field.Secret).
+		Validate(field.Check).
+		Value(value)
+}
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// subscribeCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+// createHealthCheck creates a healthchecks.io check for the subscription
+func createHealthCheck(subscription *library.Subscription) error {
+	checkSlug := slug.Make(fmt.Sprintf("%s %s %s %s", subscription.Name, subscription.Provider, subscription.Dataset, subscription.ID.String()[:5]))
+	checkID, err := healthcheck.Create(
+		subscription.HealthCheckName(),
+		checkSlug,
+		subscription.DataTypes,
+		subscription.Schedule,
+	)
+	if err != nil {
+		return err
+	}
+
+	subscription.HealthCheckID = checkID
+	return nil
 }
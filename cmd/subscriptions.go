@@ -0,0 +1,482 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/charmbracelet/huh"
+	"github.com/penny-vault/pvdata/healthcheck"
+	"github.com/penny-vault/pvdata/library"
+	"github.com/penny-vault/pvdata/monitor"
+	"github.com/penny-vault/pvdata/provider"
+	"github.com/robfig/cron/v3"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	subscriptionsFormat string
+
+	editName          string
+	editSchedule      string
+	editMonitor       string
+	editMonitorTarget string
+	editConfig        map[string]string
+	editSettings      map[string]string
+	editYes           bool
+)
+
+// subscriptionsCmd represents the subscriptions command
+var subscriptionsCmd = &cobra.Command{
+	Use:   "subscriptions",
+	Short: "List, edit and review the history of subscriptions",
+}
+
+var subscriptionsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the library's subscriptions",
+	Long: `List prints every subscription in the library as a table, or as JSON with
+--format json. Provider configuration is never included since it holds credentials.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+
+		myLibrary, err := library.NewFromDB(ctx, viper.GetString("db.url"))
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not connect to library")
+		}
+
+		subscriptions, err := myLibrary.Subscriptions(ctx)
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not load subscriptions")
+		}
+
+		slices.SortFunc(subscriptions, func(a, b *library.Subscription) int {
+			return strings.Compare(a.Name, b.Name)
+		})
+
+		switch subscriptionsFormat {
+		case "json":
+			rows := make([]*subscriptionRow, len(subscriptions))
+			for idx, sub := range subscriptions {
+				rows[idx] = newSubscriptionRow(sub)
+			}
+
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(rows); err != nil {
+				log.Fatal().Err(err).Msg("could not encode subscriptions")
+			}
+		case "table":
+			writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(writer, "ID\tNAME\tPROVIDER\tDATASET\tSCHEDULE\tACTIVE\tMONITOR\tLAST RUN\tSTATUS\tRECORDS")
+			for _, sub := range subscriptions {
+				row := newSubscriptionRow(sub)
+				lastRun := "never"
+				if row.LastRun != nil {
+					lastRun = row.LastRun.Local().Format("2006-01-02 15:04")
+				}
+
+				fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%t\t%s\t%s\t%s\t%d\n", row.ID[:8], row.Name, row.Provider,
+					row.Dataset, row.Schedule, row.Active, row.Monitor, lastRun, row.LastStatus, row.TotalRecords)
+			}
+
+			if err := writer.Flush(); err != nil {
+				log.Fatal().Err(err).Msg("could not write subscriptions")
+			}
+		default:
+			log.Fatal().Str("Format", subscriptionsFormat).Msg("--format must be table or json")
+		}
+	},
+}
+
+var subscriptionsEditCmd = &cobra.Command{
+	Use:   "edit <subscription-id>",
+	Short: "Change a subscription's name, schedule, monitor, config or settings",
+	Long: `Edit walks through the subscription's name, schedule, monitor and provider
+configuration with the current values filled in. Secret fields are left blank;
+leave them blank to keep the saved credential. Any value may be given with flags
+instead; pass --yes to skip the wizard and apply the flags alone:
+
+    pvdata subscriptions edit 5f2c --yes --schedule "30 18 * * 1-5" --config rateLimit=1000
+
+Settings are changed with --setting key=value; an empty value removes the setting.
+A healthchecks.io check is renamed and rescheduled along with the subscription,
+created if the monitor is changed to healthchecks and deleted if it is changed to
+anything else. Every change is recorded with the user who made it; see
+pvdata subscriptions history.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+
+		myLibrary, err := library.NewFromDB(ctx, viper.GetString("db.url"))
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not connect to library")
+		}
+
+		subscription, err := myLibrary.SubscriptionFromID(ctx, args[0])
+		if err != nil {
+			log.Fatal().Err(err).Str("ID", args[0]).Msg("could not get subscription for ID")
+		}
+
+		dataProvider, ok := provider.Map[subscription.Provider]
+		if !ok {
+			log.Fatal().Str("Provider", subscription.Provider).Msg("unknown provider")
+		}
+
+		schema := dataProvider.ConfigSchema()
+		subscription.SecretFields = schema.SecretFields()
+		for key := range editConfig {
+			if !slices.ContainsFunc(schema, func(field *provider.ConfigField) bool { return field.Key == key }) {
+				log.Fatal().Str("Key", key).Str("Provider", subscription.Provider).Msg("provider does not have config key")
+			}
+		}
+
+		before := *subscription
+		before.Config = maps.Clone(subscription.Config)
+		before.Settings = maps.Clone(subscription.Settings)
+
+		// subscriptions that predate the monitor setting are monitored by their health check
+		currentMonitor := subscription.Settings[monitor.KindSetting]
+		if currentMonitor == monitor.KindNone && subscription.HealthCheckID != "" {
+			currentMonitor = monitor.KindHealthchecks
+		}
+
+		subName := stringOr(editName, subscription.Name)
+		subSchedule := stringOr(editSchedule, subscription.Schedule)
+		monitorKind := currentMonitor
+		if cmd.Flags().Changed("monitor") {
+			monitorKind = editMonitor
+		}
+		monitorTarget := stringOr(editMonitorTarget, subscription.Settings[monitor.TargetSetting])
+
+		// secrets start blank so they are not revealed; blank keeps the saved value
+		config := make(map[string]*string, len(schema))
+		configFields := make([]huh.Field, 0, len(schema))
+		for _, field := range schema {
+			val := subscription.Config[field.Key]
+			if field.Secret {
+				val = ""
+				keepField := *field
+				keepField.Required = false
+				keepField.Description = strings.TrimSpace(field.Description + " Leave blank to keep the current value.")
+				field = &keepField
+			}
+
+			if flagVal, ok := editConfig[field.Key]; ok {
+				val = flagVal
+			}
+
+			config[field.Key] = &val
+			configFields = append(configFields, configInput(field, config[field.Key]))
+		}
+
+		if !editYes {
+			groups := []*huh.Group{
+				huh.NewGroup(
+					huh.NewInput().
+						Title("What should the subscription be named?").
+						Value(&subName),
+					huh.NewInput().
+						Title("What schedule should the subscription run on?").
+						Validate(func(val string) error {
+							_, err := cron.ParseStandard(val)
+							return err
+						}).
+						Value(&subSchedule),
+					huh.NewSelect[string]().
+						Title("How should the subscription be monitored?").
+						Options(
+							huh.NewOption("Not monitored", monitor.KindNone),
+							huh.NewOption("healthchecks.io check", monitor.KindHealthchecks),
+							huh.NewOption("Webhook", monitor.KindWebhook),
+							huh.NewOption("Email", monitor.KindEmail),
+							huh.NewOption("Run a command", monitor.KindExec),
+						).
+						Value(&monitorKind),
+				),
+				huh.NewGroup(
+					huh.NewInput().
+						Title("Where should alerts be sent? (webhook URL, email addresses or command)").
+						Validate(func(val string) error {
+							return monitor.Validate(monitorKind, val)
+						}).
+						Value(&monitorTarget),
+				).WithHideFunc(func() bool {
+					return monitorKind == monitor.KindNone || monitorKind == monitor.KindHealthchecks
+				}),
+			}
+
+			if len(configFields) > 0 {
+				groups = append(groups, huh.NewGroup(configFields...))
+			}
+
+			if err := huh.NewForm(groups...).Run(); err != nil {
+				log.Fatal().Err(err).Msg("failed to create wizard")
+			}
+		}
+
+		if _, err := cron.ParseStandard(subSchedule); err != nil {
+			log.Fatal().Err(err).Str("Schedule", subSchedule).Msg("invalid schedule")
+		}
+
+		if monitorKind == monitor.KindNone || monitorKind == monitor.KindHealthchecks {
+			monitorTarget = ""
+		}
+
+		if err := monitor.Validate(monitorKind, monitorTarget); err != nil {
+			log.Fatal().Err(err).Msg("invalid monitor")
+		}
+
+		subscription.Name = subName
+		subscription.Schedule = subSchedule
+
+		for _, field := range schema {
+			val := *config[field.Key]
+			switch {
+			case field.Secret && val == "":
+				// keep the saved credential
+			case val == "":
+				delete(subscription.Config, field.Key)
+			default:
+				subscription.Config[field.Key] = val
+			}
+		}
+
+		if err := schema.Validate(schema.WithDefaults(subscription.Config)); err != nil {
+			log.Fatal().Err(err).Msg("invalid provider configuration")
+		}
+
+		if subscription.Settings == nil {
+			subscription.Settings = make(map[string]string)
+		}
+
+		for key, val := range editSettings {
+			if val == "" {
+				delete(subscription.Settings, key)
+			} else {
+				subscription.Settings[key] = val
+			}
+		}
+
+		if monitorKind != currentMonitor {
+			delete(subscription.Settings, monitor.KindSetting)
+			if monitorKind != monitor.KindNone {
+				subscription.Settings[monitor.KindSetting] = monitorKind
+			}
+		}
+
+		delete(subscription.Settings, monitor.TargetSetting)
+		if monitorTarget != "" {
+			subscription.Settings[monitor.TargetSetting] = monitorTarget
+		}
+
+		// health checks are removed once the subscription is saved without them
+		staleHealthCheck := ""
+		if monitorKind != monitor.KindHealthchecks && subscription.HealthCheckID != "" {
+			staleHealthCheck = subscription.HealthCheckID
+			subscription.HealthCheckID = ""
+		}
+
+		changes := library.DiffSubscriptions(&before, subscription)
+		needsHealthCheck := monitorKind == monitor.KindHealthchecks && subscription.HealthCheckID == ""
+		if len(changes) == 0 && !needsHealthCheck {
+			log.Info().Msg("no changes")
+			return
+		}
+
+		builder := strings.Builder{}
+		fmt.Fprintf(&builder, "~ update     %s [%s]\n", subscription.Name, subscription.ID.String()[:6])
+		for _, change := range changes {
+			fmt.Fprintf(&builder, "      %s: %q -> %q\n", change.Field, change.OldValue, change.NewValue)
+		}
+
+		if needsHealthCheck {
+			builder.WriteString("      + healthchecks.io check\n")
+		}
+
+		fmt.Print(builder.String())
+
+		confirmed := editYes
+		if !editYes {
+			if err := huh.NewForm(huh.NewGroup(
+				huh.NewConfirm().
+					Title("Save changes?").
+					Value(&confirmed),
+			)).Run(); err != nil {
+				log.Fatal().Err(err).Msg("failed to create wizard")
+			}
+		}
+
+		if !confirmed {
+			log.Info().Msg("Not saving subscription")
+			return
+		}
+
+		if needsHealthCheck {
+			if err := createHealthCheck(subscription); err != nil {
+				log.Fatal().Err(err).Msg("creating healthcheck failed")
+			}
+		}
+
+		if err := subscription.Update(ctx); err != nil {
+			log.Fatal().Err(err).Msg("failed saving subscription")
+		}
+
+		if staleHealthCheck != "" {
+			if err := healthcheck.Delete(staleHealthCheck); err != nil {
+				log.Error().Err(err).Str("HealthCheckID", staleHealthCheck).Msg("could not delete health check")
+			}
+		}
+
+		log.Info().Str("SubscriptionID", subscription.ID.String()).Msg("subscription updated")
+	},
+}
+
+var subscriptionsHistoryCmd = &cobra.Command{
+	Use:   "history <subscription-id>",
+	Short: "Show who changed a subscription and when",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+
+		myLibrary, err := library.NewFromDB(ctx, viper.GetString("db.url"))
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not connect to library")
+		}
+
+		subscription, err := myLibrary.SubscriptionFromID(ctx, args[0])
+		if err != nil {
+			log.Fatal().Err(err).Str("ID", args[0]).Msg("could not get subscription for ID")
+		}
+
+		changes, err := subscription.Changes(ctx)
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not load subscription history")
+		}
+
+		switch subscriptionsFormat {
+		case "json":
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(changes); err != nil {
+				log.Fatal().Err(err).Msg("could not encode subscription history")
+			}
+		case "table":
+			fmt.Printf("%s (%s/%s) created %s by %s\n\n", subscription.Name, subscription.Provider, subscription.Dataset,
+				subscription.CreatedOn.Format("2006-01-02 15:04"), subscription.CreatedBy)
+
+			writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(writer, "CHANGED ON\tCHANGED BY\tFIELD\tFROM\tTO")
+			for _, change := range changes {
+				fmt.Fprintf(writer, "%s\t%s\t%s\t%q\t%q\n", change.ChangedOn.Format("2006-01-02 15:04"), change.ChangedBy,
+					change.Field, change.OldValue, change.NewValue)
+			}
+
+			if err := writer.Flush(); err != nil {
+				log.Fatal().Err(err).Msg("could not write subscription history")
+			}
+		default:
+			log.Fatal().Str("Format", subscriptionsFormat).Msg("--format must be table or json")
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(subscriptionsCmd)
+	subscriptionsCmd.AddCommand(subscriptionsListCmd)
+	subscriptionsCmd.AddCommand(subscriptionsEditCmd)
+	subscriptionsCmd.AddCommand(subscriptionsHistoryCmd)
+
+	subscriptionsCmd.PersistentFlags().StringVar(&subscriptionsFormat, "format", "table", "output format: table or json")
+
+	subscriptionsEditCmd.Flags().StringVar(&editName, "name", "", "subscription name")
+	subscriptionsEditCmd.Flags().StringVar(&editSchedule, "schedule", "", "cron schedule the subscription runs on")
+	subscriptionsEditCmd.Flags().StringVar(&editMonitor, "monitor", "", "monitor: healthchecks, webhook, email, exec or '' for none")
+	subscriptionsEditCmd.Flags().StringVar(&editMonitorTarget, "monitor-target", "", "webhook URL, email addresses or command alerts are sent to")
+	subscriptionsEditCmd.Flags().StringToStringVar(&editConfig, "config", nil, "provider config as key=value (see pvdata providers <name>)")
+	subscriptionsEditCmd.Flags().StringToStringVar(&editSettings, "setting", nil, "subscription setting as key=value; an empty value removes it")
+	subscriptionsEditCmd.Flags().BoolVarP(&editYes, "yes", "y", false, "apply the flags without prompting")
+}
+
+// subscriptionRow is how `subscriptions list` prints a subscription; config
+// and settings are omitted since they may hold credentials
+type subscriptionRow struct {
+	ID              string     `json:"id"`
+	Name            string     `json:"name"`
+	Provider        string     `json:"provider"`
+	Dataset         string     `json:"dataset"`
+	DataTypes       []string   `json:"data_types"`
+	Schedule        string     `json:"schedule"`
+	Active          bool       `json:"active"`
+	Monitor         string     `json:"monitor"`
+	LastRun         *time.Time `json:"last_run"`
+	LastStatus      string     `json:"last_status"`
+	TotalRecords    int64      `json:"total_records"`
+	TotalSecurities int64      `json:"total_securities"`
+	CreatedOn       time.Time  `json:"created_on"`
+	CreatedBy       string     `json:"created_by"`
+}
+
+func newSubscriptionRow(sub *library.Subscription) *subscriptionRow {
+	row := &subscriptionRow{
+		ID:              sub.ID.String(),
+		Name:            sub.Name,
+		Provider:        sub.Provider,
+		Dataset:         sub.Dataset,
+		DataTypes:       sub.DataTypes,
+		Schedule:        sub.Schedule,
+		Active:          sub.Active,
+		Monitor:         sub.Settings[monitor.KindSetting],
+		LastStatus:      sub.LastStatus,
+		TotalRecords:    sub.TotalRecords,
+		TotalSecurities: sub.TotalSecurities,
+		CreatedOn:       sub.CreatedOn,
+		CreatedBy:       sub.CreatedBy,
+	}
+
+	if row.Monitor == monitor.KindNone && sub.HealthCheckID != "" {
+		row.Monitor = monitor.KindHealthchecks
+	}
+
+	if row.Monitor == monitor.KindNone {
+		row.Monitor = "none"
+	}
+
+	if !sub.LastRun.IsZero() {
+		lastRun := sub.LastRun
+		row.LastRun = &lastRun
+	}
+
+	return row
+}
+
+// stringOr returns `val` unless it is empty
+func stringOr(val, fallback string) string {
+	if val == "" {
+		return fallback
+	}
+	return val
+}
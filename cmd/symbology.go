@@ -0,0 +1,119 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/penny-vault/pvdata/data"
+	"github.com/penny-vault/pvdata/library"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	symbologyType string
+	symbologyDate string
+)
+
+// symbologyCmd represents the symbology command
+var symbologyCmd = &cobra.Command{
+	Use:   "symbology",
+	Short: "Look up the tickers, CUSIPs and ISINs assets held over time",
+	Long: `Subscriptions with a symbology table record every ticker, CUSIP and ISIN held by a
+composite FIGI along with the dates it was held. Use resolve to find the asset an identifier
+referred to on a date and symbols to list the identifiers an asset held on a date.
+
+Example:
+
+    pvdata symbology resolve 1a2b3c FB --date 2020-01-02`,
+}
+
+var symbologyResolveCmd = &cobra.Command{
+	Use:   "resolve <subscription-id> <identifier>",
+	Short: "Print the composite FIGI that held an identifier on a date",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		sub, date := symbologySubscription(ctx, args[0])
+
+		figi, err := sub.ResolveFigi(ctx, symbologyType, args[1], date)
+		if err != nil {
+			log.Fatal().Err(err).Str("Type", symbologyType).Str("Identifier", args[1]).Time("Date", date).Msg("could not resolve identifier")
+		}
+
+		fmt.Println(figi)
+	},
+}
+
+var symbologySymbolsCmd = &cobra.Command{
+	Use:   "symbols <subscription-id> <composite-figi>",
+	Short: "Print the identifiers held by a composite FIGI on a date",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		sub, date := symbologySubscription(ctx, args[0])
+
+		symbols, err := sub.SymbolsOf(ctx, args[1], symbologyType, date)
+		if err != nil {
+			log.Fatal().Err(err).Str("CompositeFigi", args[1]).Time("Date", date).Msg("could not lookup symbols")
+		}
+
+		for _, symbol := range symbols {
+			fmt.Println(symbol)
+		}
+	},
+}
+
+// symbologySubscription loads the subscription and parses the --type and --date flags
+func symbologySubscription(ctx context.Context, id string) (*library.Subscription, time.Time) {
+	switch symbologyType {
+	case data.TickerID, data.CusipID, data.IsinID:
+	default:
+		log.Fatal().Str("Type", symbologyType).Msg("--type must be one of ticker, cusip or isin")
+	}
+
+	date := time.Now()
+	if symbologyDate != "" {
+		var err error
+		if date, err = time.Parse("2006-01-02", symbologyDate); err != nil {
+			log.Fatal().Err(err).Str("Date", symbologyDate).Msg("could not parse --date")
+		}
+	}
+
+	myLibrary, err := library.NewFromDB(ctx, viper.GetString("db.url"))
+	if err != nil {
+		log.Fatal().Err(err).Msg("could not load library info")
+	}
+
+	sub, err := myLibrary.SubscriptionFromID(ctx, id)
+	if err != nil {
+		log.Fatal().Err(err).Str("ID", id).Msg("could not get subscription for ID")
+	}
+
+	return sub, date
+}
+
+func init() {
+	rootCmd.AddCommand(symbologyCmd)
+	symbologyCmd.AddCommand(symbologyResolveCmd)
+	symbologyCmd.AddCommand(symbologySymbolsCmd)
+
+	symbologyCmd.PersistentFlags().StringVar(&symbologyType, "type", data.TickerID, "identifier type: ticker, cusip or isin")
+	symbologyCmd.PersistentFlags().StringVar(&symbologyDate, "date", "", "date to look up (YYYY-MM-DD); defaults to today")
+}
@@ -0,0 +1,117 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/penny-vault/pvdata/db"
+	"github.com/penny-vault/pvdata/library"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	syncFrom          string
+	syncTo            string
+	syncSubscriptions []string
+	syncTypes         []string
+	syncFull          bool
+)
+
+// syncCmd represents the sync command
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Copy subscriptions and their data to another library",
+	Long: `Sync copies the library and subscription records of one database to another and
+then copies the rows of each subscription's tables. The target database is migrated
+and missing subscriptions are created with their tables and partitions. Configuration
+values are redacted so provider credentials never leave the source library. Created
+subscriptions are inactive and have no monitor; set credentials with pvdata subscriptions
+edit and activate them with pvdata enable to fetch data in the target library.
+
+Syncs are incremental: only rows on or after the latest event date already in the
+target are copied, replacing rows with the same primary key. Use --full to copy every
+row. Rows deleted from the source are not removed from the target.
+
+Example:
+
+    pvdata sync --from postgres://prod/pvdata --to postgres://localhost/pvdata --types eod,asset-description`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+
+		if syncFrom == "" {
+			syncFrom = viper.GetString("db.url")
+		}
+
+		if syncTo == "" {
+			log.Fatal().Msg("--to is required")
+		}
+
+		if syncFrom == syncTo {
+			log.Fatal().Msg("--from and --to must be different databases")
+		}
+
+		source, err := library.NewFromDB(ctx, syncFrom)
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not load source library")
+		}
+		defer source.Close()
+
+		if err := db.Migrate(strings.Replace(syncTo, "postgres://", "pgx5://", 1)); err != nil {
+			log.Fatal().Err(err).Msg("could not migrate target database")
+		}
+
+		target := &library.Library{DBUrl: syncTo}
+		if err := target.Connect(ctx); err != nil {
+			log.Fatal().Err(err).Msg("could not connect to target database")
+		}
+		defer target.Close()
+
+		results, err := source.SyncTo(ctx, target, library.SyncOptions{
+			Subscriptions: syncSubscriptions,
+			DataTypes:     syncTypes,
+			Full:          syncFull,
+		})
+		if err != nil {
+			log.Fatal().Err(err).Msg("sync failed")
+		}
+
+		builder := strings.Builder{}
+		builder.WriteString("# Sync\n\n| Subscription | Data Type | Table | Rows Copied |\n|---|---|---|---|\n")
+		for _, result := range results {
+			subscriptionID := result.SubscriptionID[:6]
+			if result.Created {
+				subscriptionID += " (new)"
+			}
+			builder.WriteString(fmt.Sprintf("| %s | %s | %s | %d |\n", subscriptionID, result.DataType, result.Table, result.Rows))
+		}
+
+		renderMarkdown(builder.String())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(syncCmd)
+
+	syncCmd.Flags().StringVar(&syncFrom, "from", "", "URL of the database to copy from (default db.url)")
+	syncCmd.Flags().StringVar(&syncTo, "to", "", "URL of the database to copy to")
+	syncCmd.Flags().StringSliceVar(&syncSubscriptions, "subscriptions", []string{}, "IDs of subscriptions to sync (default all)")
+	syncCmd.Flags().StringSliceVar(&syncTypes, "types", []string{}, "data types to sync (default all)")
+	syncCmd.Flags().BoolVar(&syncFull, "full", false, "copy every row instead of only new rows")
+}
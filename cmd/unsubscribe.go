@@ -14,7 +14,10 @@ import (
 	"github.com/spf13/viper"
 )
 
-var deleteSubscription bool
+var (
+	deleteSubscription bool
+	unsubscribeYes     bool
+)
 
 // unsubscribeCmd represents the unsubscribe command
 var unsubscribeCmd = &cobra.Command{
@@ -40,7 +43,7 @@ var unsubscribeCmd = &cobra.Command{
 				log.Fatal().Err(err).Str("ID", id).Msg("could not get subscription for ID")
 			}
 
-			confirmed := false
+			confirmed := unsubscribeYes
 			confirmForm := huh.NewForm(
 				huh.NewGroup(
 					huh.NewConfirm().
@@ -49,9 +52,10 @@ var unsubscribeCmd = &cobra.Command{
 				),
 			)
 
-			err = confirmForm.Run()
-			if err != nil {
-				log.Fatal().Err(err).Msg("failed to create wizard")
+			if !unsubscribeYes {
+				if err := confirmForm.Run(); err != nil {
+					log.Fatal().Err(err).Msg("failed to create wizard")
+				}
 			}
 
 			if confirmed {
@@ -75,5 +79,6 @@ var unsubscribeCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(unsubscribeCmd)
+	unsubscribeCmd.Flags().BoolVarP(&unsubscribeYes, "yes", "y", false, "do not ask for confirmation")
 	unsubscribeCmd.Flags().BoolVarP(&deleteSubscription, "delete", "d", false, "delete subscription; warning this will delete the subscription and tables associated with said description")
 }
@@ -0,0 +1,130 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/rs/zerolog"
+)
+
+// copyNull marks NULL values when rows are copied into a table as CSV
+const copyNull = `\N`
+
+// RowChecksum returns the number of rows in `table` and an order independent
+// checksum of their contents
+func RowChecksum(ctx context.Context, dbConn Querier, table string) (int64, string, error) {
+	sql := fmt.Sprintf(`SELECT count(*),
+	coalesce(sum(('x' || substr(md5(t::text), 1, 15))::bit(60)::bigint::numeric), 0)::text
+	FROM %s t`, table)
+
+	rows, err := dbConn.Query(ctx, sql)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Str("SQL", sql).Msg("could not compute row checksum")
+		return 0, "", err
+	}
+	defer rows.Close()
+
+	var count int64
+	var checksum string
+	for rows.Next() {
+		if err := rows.Scan(&count, &checksum); err != nil {
+			return 0, "", err
+		}
+	}
+
+	return count, checksum, rows.Err()
+}
+
+// WriteTableParquet writes every row of `table` matching `where` (if not
+// empty) to `w` as Parquet. Returns the number of rows written.
+func WriteTableParquet(ctx context.Context, dbConn Querier, table string, columns []*Column, w io.Writer, where string, args ...any) (int64, error) {
+	sql := fmt.Sprintf("SELECT %s FROM %s", SelectColumns(columns), table)
+	if where != "" {
+		sql = fmt.Sprintf("%s WHERE %s", sql, where)
+	}
+
+	rows, err := dbConn.Query(ctx, sql, args...)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Str("SQL", sql).Msg("could not read table")
+		return 0, err
+	}
+	defer rows.Close()
+
+	pw, err := NewParquetWriter(w, columns)
+	if err != nil {
+		return 0, err
+	}
+
+	for rows.Next() {
+		vals, err := rows.Values()
+		if err != nil {
+			return pw.Rows(), err
+		}
+
+		if err := pw.Write(vals); err != nil {
+			return pw.Rows(), err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return pw.Rows(), err
+	}
+
+	return pw.Rows(), pw.Close()
+}
+
+// CopyParquet loads the rows of the Parquet file at `fileName`, written by
+// WriteTableParquet, into `table`. Returns the number of rows copied.
+func CopyParquet(ctx context.Context, pgConn *pgconn.PgConn, table string, columns []*Column, fileName string) (int64, error) {
+	reader, writer := io.Pipe()
+
+	go func() {
+		csvWriter := csv.NewWriter(writer)
+		_, err := ReadParquet(fileName, columns, func(row []any) error {
+			record := make([]string, len(row))
+			for idx, val := range row {
+				if text, ok := columns[idx].Text(val); ok {
+					record[idx] = text
+				} else {
+					record[idx] = copyNull
+				}
+			}
+			return csvWriter.Write(record)
+		})
+
+		if err == nil {
+			csvWriter.Flush()
+			err = csvWriter.Error()
+		}
+
+		writer.CloseWithError(err)
+	}()
+
+	sql := fmt.Sprintf(`COPY %s (%s) FROM STDIN WITH (FORMAT csv, NULL '%s')`, table, ColumnNames(columns), copyNull)
+	tag, err := pgConn.CopyFrom(ctx, reader, sql)
+	if err != nil {
+		// unblock the goroutine if COPY stopped reading early
+		reader.CloseWithError(err)
+		zerolog.Ctx(ctx).Error().Err(err).Str("SQL", sql).Msg("could not copy rows")
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
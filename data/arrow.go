@@ -0,0 +1,284 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog"
+)
+
+// DefaultArrowBatchSize is the number of rows in each Arrow record batch
+const DefaultArrowBatchSize = 65536
+
+var (
+	ErrArrowType = errors.New("value does not match arrow type")
+)
+
+// ArrowType returns the Arrow type a column is read as. Numerics become
+// float64 so they load directly into pandas and polars; arrays, JSON and enums
+// are strings in PostgreSQL's text representation.
+func (column *Column) ArrowType() arrow.DataType {
+	switch {
+	case column.Kind == IntColumn:
+		return arrow.PrimitiveTypes.Int64
+	case column.Kind == FloatColumn, strings.HasPrefix(column.SQLType, "numeric"):
+		return arrow.PrimitiveTypes.Float64
+	case column.Kind == BoolColumn:
+		return arrow.FixedWidthTypes.Boolean
+	case column.Kind == DateColumn:
+		return arrow.FixedWidthTypes.Date32
+	case column.Kind == TimestampColumn:
+		return &arrow.TimestampType{Unit: arrow.Microsecond}
+	default:
+		return arrow.BinaryTypes.String
+	}
+}
+
+// arrowSelectExpr reads the column as the Go type appended to its Arrow builder
+func (column *Column) arrowSelectExpr() string {
+	if column.Kind == TextColumn && strings.HasPrefix(column.SQLType, "numeric") {
+		return fmt.Sprintf(`"%s"::float8`, column.Name)
+	}
+	return column.SelectExpr()
+}
+
+// ArrowSchema returns the Arrow schema of a table of `dataType` with `columns`.
+// The data type and its primary key are recorded in the schema's metadata.
+func ArrowSchema(dataType string, columns []*Column) *arrow.Schema {
+	fields := make([]arrow.Field, len(columns))
+	for idx, column := range columns {
+		fields[idx] = arrow.Field{
+			Name:     column.Name,
+			Type:     column.ArrowType(),
+			Nullable: true,
+		}
+	}
+
+	keys := []string{"pvdata.data_type"}
+	values := []string{dataType}
+	if dt, ok := DataTypes[dataType]; ok {
+		keys = append(keys, "pvdata.primary_key")
+		values = append(values, strings.Join(dt.PrimaryKey, ","))
+	}
+
+	metadata := arrow.NewMetadata(keys, values)
+	return arrow.NewSchema(fields, &metadata)
+}
+
+// appendArrow adds a value read with arrowSelectExpr to the builder
+func appendArrow(builder array.Builder, val any) error {
+	if val == nil {
+		builder.AppendNull()
+		return nil
+	}
+
+	switch b := builder.(type) {
+	case *array.Int64Builder:
+		v, ok := val.(int64)
+		if !ok {
+			return fmt.Errorf("%w: %T is not an int64", ErrArrowType, val)
+		}
+		b.Append(v)
+	case *array.Float64Builder:
+		v, ok := val.(float64)
+		if !ok {
+			return fmt.Errorf("%w: %T is not a float64", ErrArrowType, val)
+		}
+		b.Append(v)
+	case *array.BooleanBuilder:
+		v, ok := val.(bool)
+		if !ok {
+			return fmt.Errorf("%w: %T is not a bool", ErrArrowType, val)
+		}
+		b.Append(v)
+	case *array.Date32Builder:
+		v, ok := val.(time.Time)
+		if !ok {
+			return fmt.Errorf("%w: %T is not a date", ErrArrowType, val)
+		}
+		b.Append(arrow.Date32(v.Unix() / 86400))
+	case *array.TimestampBuilder:
+		v, ok := val.(time.Time)
+		if !ok {
+			return fmt.Errorf("%w: %T is not a timestamp", ErrArrowType, val)
+		}
+		b.Append(arrow.Timestamp(v.UnixMicro()))
+	case *array.StringBuilder:
+		if v, ok := val.(string); ok {
+			b.Append(v)
+		} else {
+			b.Append(fmt.Sprintf("%v", val))
+		}
+	default:
+		return fmt.Errorf("%w: unsupported builder %T", ErrArrowType, builder)
+	}
+
+	return nil
+}
+
+// ArrowWriter writes rows as Arrow IPC stream record batches
+type ArrowWriter struct {
+	BatchSize int
+
+	builder *array.RecordBuilder
+	writer  *ipc.Writer
+	pending int
+	rows    int64
+}
+
+// NewArrowWriter creates a writer of record batches with `schema` to w
+func NewArrowWriter(w io.Writer, schema *arrow.Schema, batchSize int) *ArrowWriter {
+	mem := memory.NewGoAllocator()
+	return &ArrowWriter{
+		BatchSize: batchSize,
+		builder:   array.NewRecordBuilder(mem, schema),
+		writer:    ipc.NewWriter(w, ipc.WithSchema(schema), ipc.WithAllocator(mem)),
+	}
+}
+
+// Write adds a row; a record batch is written every BatchSize rows
+func (aw *ArrowWriter) Write(row []any) error {
+	for idx, val := range row {
+		if err := appendArrow(aw.builder.Field(idx), val); err != nil {
+			return fmt.Errorf("column %d: %w", idx, err)
+		}
+	}
+
+	aw.pending++
+	aw.rows++
+	if aw.pending >= aw.BatchSize {
+		return aw.flush()
+	}
+
+	return nil
+}
+
+// Rows returns the number of rows written
+func (aw *ArrowWriter) Rows() int64 {
+	return aw.rows
+}
+
+func (aw *ArrowWriter) flush() error {
+	if aw.pending == 0 {
+		return nil
+	}
+
+	rec := aw.builder.NewRecord()
+	defer rec.Release()
+
+	aw.pending = 0
+	return aw.writer.Write(rec)
+}
+
+// Close writes any buffered rows and ends the stream; the underlying writer
+// is not closed
+func (aw *ArrowWriter) Close() error {
+	defer aw.builder.Release()
+
+	if err := aw.flush(); err != nil {
+		return err
+	}
+	return aw.writer.Close()
+}
+
+// ArrowRows are the rows of a query ready to be written as Arrow record batches
+type ArrowRows struct {
+	Schema *arrow.Schema
+
+	rows  pgx.Rows
+	first []any
+}
+
+// QueryArrow runs the query and reads its first row so that errors raised by
+// the query are returned before anything is written. The columns and schema
+// come from the data type's declaration rather than the table so that the
+// stream's schema does not change with the table. The rows must be closed.
+func (query *TableQuery) QueryArrow(ctx context.Context, dbConn Querier, dataType *DataType) (*ArrowRows, error) {
+	columns := dataType.Columns()
+	exprs := make([]string, len(columns))
+	for idx, column := range columns {
+		exprs[idx] = column.arrowSelectExpr()
+	}
+
+	sql, args := query.Statement(strings.Join(exprs, ", "))
+	rows, err := dbConn.Query(ctx, sql, args...)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Str("SQL", sql).Msg("could not query table")
+		return nil, err
+	}
+
+	arrowRows := &ArrowRows{
+		Schema: ArrowSchema(dataType.Name, columns),
+		rows:   rows,
+	}
+
+	if rows.Next() {
+		arrowRows.first, err = rows.Values()
+	} else {
+		err = rows.Err()
+	}
+
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Str("SQL", sql).Msg("could not read table")
+		rows.Close()
+		return nil, err
+	}
+
+	return arrowRows, nil
+}
+
+// Write streams the rows to w as Arrow IPC record batches of `batchSize` rows.
+// Rows are read and written a batch at a time.
+func (arrowRows *ArrowRows) Write(w io.Writer, batchSize int) (int64, error) {
+	arrowWriter := NewArrowWriter(w, arrowRows.Schema, batchSize)
+	if arrowRows.first != nil {
+		if err := arrowWriter.Write(arrowRows.first); err != nil {
+			return arrowWriter.Rows(), err
+		}
+	}
+
+	for arrowRows.rows.Next() {
+		vals, err := arrowRows.rows.Values()
+		if err != nil {
+			return arrowWriter.Rows(), err
+		}
+
+		if err := arrowWriter.Write(vals); err != nil {
+			return arrowWriter.Rows(), err
+		}
+	}
+
+	if err := arrowRows.rows.Err(); err != nil {
+		return arrowWriter.Rows(), err
+	}
+
+	return arrowWriter.Rows(), arrowWriter.Close()
+}
+
+// Close releases the query's rows
+func (arrowRows *ArrowRows) Close() {
+	arrowRows.rows.Close()
+}
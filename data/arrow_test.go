@@ -0,0 +1,155 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data_test
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/penny-vault/pvdata/data"
+)
+
+var _ = Describe("Arrow", func() {
+	var columns []*data.Column
+
+	BeforeEach(func() {
+		columns = make([]*data.Column, 0)
+		for _, col := range [][]string{
+			{"ticker", "character varying(10)"},
+			{"event_date", "date"},
+			{"close", "numeric(12,4)"},
+			{"volume", "bigint"},
+			{"total_return", "double precision"},
+			{"active", "boolean"},
+			{"last_updated", "timestamp without time zone"},
+		} {
+			columns = append(columns, &data.Column{Name: col[0], SQLType: col[1], Kind: data.ColumnKindOf(col[1])})
+		}
+	})
+
+	It("derives typed schemas", func() {
+		schema := data.ArrowSchema(data.EODKey, columns)
+
+		types := make([]arrow.DataType, 0, len(schema.Fields()))
+		for _, field := range schema.Fields() {
+			types = append(types, field.Type)
+		}
+
+		Expect(types).To(Equal([]arrow.DataType{
+			arrow.BinaryTypes.String,
+			arrow.FixedWidthTypes.Date32,
+			arrow.PrimitiveTypes.Float64,
+			arrow.PrimitiveTypes.Int64,
+			arrow.PrimitiveTypes.Float64,
+			arrow.FixedWidthTypes.Boolean,
+			&arrow.TimestampType{Unit: arrow.Microsecond},
+		}))
+
+		metadata := schema.Metadata()
+		idx := metadata.FindKey("pvdata.primary_key")
+		Expect(idx).To(BeNumerically(">=", 0))
+		Expect(metadata.Values()[idx]).To(Equal("composite_figi,event_date"))
+	})
+
+	It("derives schemas from the data type's declared columns", func() {
+		eod := data.DataTypes[data.EODKey].Columns()
+		Expect(eod[0]).To(Equal(&data.Column{Name: "ticker", SQLType: "character varying(10)", Kind: data.TextColumn}))
+		Expect(eod[3]).To(Equal(&data.Column{Name: "open", SQLType: "numeric(12,4)", Kind: data.TextColumn}))
+		Expect(eod[len(eod)-1]).To(Equal(&data.Column{Name: "total_return", SQLType: "double precision", Kind: data.FloatColumn}))
+
+		metric := data.ArrowSchema(data.MetricKey, data.DataTypes[data.MetricKey].Columns())
+		Expect(metric.NumFields()).To(Equal(11))
+		Expect(metric.Field(5).Type).To(Equal(arrow.PrimitiveTypes.Float64))
+		Expect(metric.Field(10).Type).To(Equal(arrow.FixedWidthTypes.Boolean))
+
+		for name, dataType := range data.DataTypes {
+			names := make([]string, 0)
+			for _, column := range dataType.Columns() {
+				names = append(names, column.Name)
+			}
+			Expect(names).To(ContainElements(dataType.PrimaryKey), name)
+			Expect(names).NotTo(ContainElement("primary"), name)
+			Expect(names).NotTo(ContainElement("check"), name)
+		}
+	})
+
+	It("writes record batches that read back", func() {
+		updated := time.Date(2024, 6, 3, 21, 15, 0, 0, time.UTC)
+		rows := [][]any{
+			{"SPY", time.Date(1993, 1, 29, 0, 0, 0, 0, time.UTC), 43.9375, int64(1003200), 0.01, true, updated},
+			{"SPY", time.Date(1993, 2, 1, 0, 0, 0, 0, time.UTC), 44.25, int64(480500), nil, true, nil},
+			{"IBM", time.Date(1962, 1, 2, 0, 0, 0, 0, time.UTC), 7.2938, int64(407940), nil, nil, updated},
+		}
+
+		buf := &bytes.Buffer{}
+		writer := data.NewArrowWriter(buf, data.ArrowSchema(data.EODKey, columns), 2)
+		for _, row := range rows {
+			Expect(writer.Write(row)).To(Succeed())
+		}
+		Expect(writer.Close()).To(Succeed())
+		Expect(writer.Rows()).To(Equal(int64(3)))
+
+		reader, err := ipc.NewReader(buf)
+		Expect(err).ToNot(HaveOccurred())
+		defer reader.Release()
+
+		batches := make([]int64, 0)
+		tickers := make([]string, 0)
+		dates := make([]arrow.Date32, 0)
+		var nullReturns int
+		for reader.Next() {
+			rec := reader.Record()
+			batches = append(batches, rec.NumRows())
+
+			tickerCol := rec.Column(0).(*array.String)
+			dateCol := rec.Column(1).(*array.Date32)
+			for idx := 0; idx < int(rec.NumRows()); idx++ {
+				tickers = append(tickers, tickerCol.Value(idx))
+				dates = append(dates, dateCol.Value(idx))
+			}
+			nullReturns += rec.Column(4).NullN()
+		}
+
+		Expect(batches).To(Equal([]int64{2, 1}))
+		Expect(tickers).To(Equal([]string{"SPY", "SPY", "IBM"}))
+		Expect(dates).To(Equal([]arrow.Date32{8429, 8432, -2921}))
+		Expect(nullReturns).To(Equal(2))
+	})
+
+	It("writes the schema when there are no rows", func() {
+		buf := &bytes.Buffer{}
+		writer := data.NewArrowWriter(buf, data.ArrowSchema(data.EODKey, columns), data.DefaultArrowBatchSize)
+		Expect(writer.Close()).To(Succeed())
+
+		reader, err := ipc.NewReader(buf)
+		Expect(err).ToNot(HaveOccurred())
+		defer reader.Release()
+
+		Expect(reader.Schema().Fields()).To(HaveLen(len(columns)))
+		Expect(reader.Next()).To(BeFalse())
+	})
+
+	It("rejects values that don't match the schema", func() {
+		writer := data.NewArrowWriter(&bytes.Buffer{}, data.ArrowSchema(data.EODKey, columns), 10)
+		err := writer.Write([]any{"SPY", "1993-01-29", 43.9375, int64(1), nil, nil, nil})
+		Expect(err).To(MatchError(data.ErrArrowType))
+	})
+})
@@ -21,10 +21,9 @@ import (
 	"time"
 
 	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/log"
-	"github.com/spf13/viper"
 )
 
 type AssetType string
@@ -85,18 +84,36 @@ type Asset struct {
 	LastUpdated          time.Time `json:"last_updated" parquet:"name=last_updated, type=INT64"`
 }
 
+// ActiveAssets returns the active assets in the first of `tables`. If no table
+// is given DefaultAssetTable is used.
 func ActiveAssets(ctx context.Context, dbConn *pgxpool.Conn, tables ...string) []*Asset {
-	var assetTable string
-	if len(tables) == 0 {
-		assetTable = viper.GetString("default.asset_table")
-		if assetTable == "" {
-			log.Panic().Msg("default.asset_table not set list of active assets is not possible")
-			return nil
-		}
-	} else {
+	assetTable := DefaultAssetTable()
+	if len(tables) > 0 {
 		assetTable = tables[0]
 	}
 
+	return selectAssets(ctx, dbConn, assetTable, "active=true")
+}
+
+// selectAssets returns the assets in `assetTable` matching the where clause
+func selectAssets(ctx context.Context, dbConn *pgxpool.Conn, assetTable string, where string, args ...any) []*Asset {
+	return queryAssets(ctx, dbConn, "", assetTable, where, args...)
+}
+
+// selectAssetsWithMedia is selectAssets including the asset's headquarters,
+// icon and logo
+func selectAssetsWithMedia(ctx context.Context, dbConn *pgxpool.Conn, assetTable string, where string, args ...any) []*Asset {
+	return queryAssets(ctx, dbConn, `,
+		coalesce(headquarters_location, '') AS headquarters_location,
+		icon,
+		coalesce(icon_mime_type, '') AS icon_mime_type,
+		logo,
+		coalesce(logo_mime_type, '') AS logo_mime_type`, assetTable, where, args...)
+}
+
+func queryAssets(ctx context.Context, dbConn *pgxpool.Conn, extraColumns, assetTable string, where string, args ...any) []*Asset {
+	logger := zerolog.Ctx(ctx)
+
 	sql := fmt.Sprintf(`SELECT
 		ticker,
 		composite_figi,
@@ -118,23 +135,49 @@ func ActiveAssets(ctx context.Context, dbConn *pgxpool.Conn, tables ...string) [
 		tags,
 		coalesce(to_char(listed, 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"'), '') as listed,
 		coalesce(to_char(delisted, 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"'), '') as delisted,
-		last_updated
+		last_updated%s
 	FROM %s
-	WHERE active=true`, assetTable)
+	WHERE %s`, extraColumns, assetTable, where)
 
-	rows, err := dbConn.Query(ctx, sql)
+	rows, err := dbConn.Query(ctx, sql, args...)
 	if err != nil {
-		log.Error().Err(err).Str("SQL", sql).Msg("save asset to DB failed")
+		logger.Error().Err(err).Str("SQL", sql).Msg("select assets from DB failed")
 		return nil
 	}
 
-	var dbActiveAssets []*Asset
-	err = pgxscan.ScanAll(&dbActiveAssets, rows)
+	var dbAssets []*Asset
+	err = pgxscan.ScanAll(&dbAssets, rows)
 	if err != nil {
-		log.Error().Err(err).Msg("error when scanning values into dbActiveAssets")
+		logger.Error().Err(err).Msg("error when scanning values into dbAssets")
 	}
 
-	return dbActiveAssets
+	return dbAssets
+}
+
+// ListedOn returns the date the asset was listed, if known
+func (asset *Asset) ListedOn() (time.Time, bool) {
+	return parseAssetDate(asset.ListingDate)
+}
+
+// DelistedOn returns the date the asset was delisted, if known
+func (asset *Asset) DelistedOn() (time.Time, bool) {
+	return parseAssetDate(asset.DelistingDate)
+}
+
+// parseAssetDate parses listing and delisting dates as stored in the database or
+// returned by providers
+func parseAssetDate(val string) (time.Time, bool) {
+	if val == "" {
+		return time.Time{}, false
+	}
+
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02"} {
+		if dt, err := time.Parse(layout, val); err == nil {
+			return dt, true
+		}
+	}
+
+	return time.Time{}, false
 }
 
 func (asset *Asset) ID() string {
@@ -142,6 +185,8 @@ func (asset *Asset) ID() string {
 }
 
 func (asset *Asset) SaveFiles(ctx context.Context, filer Filer) error {
+	logger := zerolog.Ctx(ctx)
+
 	type File struct {
 		Name     string
 		MimeType string
@@ -162,22 +207,22 @@ func (asset *Asset) SaveFiles(ctx context.Context, filer Filer) error {
 		switch ff.MimeType {
 		case "image/jpeg":
 			if _, err := filer.CreateFile(ff.Name+".jpg", ff.Data); err != nil {
-				log.Error().Err(err).Str("Name", ff.Name).Msg("error saving jpg")
+				logger.Error().Err(err).Str("Name", ff.Name).Msg("error saving jpg")
 			}
 		case "image/png":
 			if _, err := filer.CreateFile(ff.Name+".png", ff.Data); err != nil {
-				log.Error().Err(err).Str("Name", ff.Name).Msg("error saving png")
+				logger.Error().Err(err).Str("Name", ff.Name).Msg("error saving png")
 			}
 		case "image/svg+xml":
 			fallthrough
 		case "image/svg":
 			if _, err := filer.CreateFile(ff.Name+".svg", ff.Data); err != nil {
-				log.Error().Err(err).Str("Name", ff.Name).Msg("error saving svg")
+				logger.Error().Err(err).Str("Name", ff.Name).Msg("error saving svg")
 			}
 		case "":
 			// do nothing
 		default:
-			log.Error().Str("MimeType", ff.MimeType).Msg("unknown image mimetype")
+			logger.Error().Str("MimeType", ff.MimeType).Msg("unknown image mimetype")
 			return errors.New("unknown mimetype")
 		}
 	}
@@ -185,7 +230,11 @@ func (asset *Asset) SaveFiles(ctx context.Context, filer Filer) error {
 	return nil
 }
 
+// SaveDB upserts the asset into `tbl`. When `ctx` carries a symbology table
+// (see WithSymbology) changes to the asset's identifiers are recorded in it.
 func (asset *Asset) SaveDB(ctx context.Context, tbl string, dbConn *pgxpool.Conn) error {
+	logger := zerolog.Ctx(ctx)
+
 	if asset.CompositeFigi == "" {
 		return nil
 	}
@@ -197,7 +246,7 @@ func (asset *Asset) SaveDB(ctx context.Context, tbl string, dbConn *pgxpool.Conn
 
 	defer func() {
 		if err := tx.Commit(ctx); err != nil {
-			log.Error().Err(err).Msg("error committing asset transaction to database")
+			logger.Error().Err(err).Msg("error committing asset transaction to database")
 		}
 	}()
 
@@ -212,7 +261,7 @@ func (asset *Asset) SaveDB(ctx context.Context, tbl string, dbConn *pgxpool.Conn
 		delistingDate = nil
 	}
 
-	log.Debug().Object("Asset", asset).Msg("Saving asset to database")
+	logger.Debug().Object("Asset", asset).Msg("Saving asset to database")
 
 	sql := fmt.Sprintf(`INSERT INTO %[1]s (
 		"ticker",
@@ -235,10 +284,16 @@ func (asset *Asset) SaveDB(ctx context.Context, tbl string, dbConn *pgxpool.Conn
 		"tags",
 		"listed",
 		"delisted",
+		"headquarters_location",
+		"icon",
+		"icon_mime_type",
+		"logo",
+		"logo_mime_type",
 		"last_updated"
 	) VALUES (
 		$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12,
-		$13, $14, $15, $16, $17, $18, $19, $20, $21
+		$13, $14, $15, $16, $17, $18, $19, $20, $21, $22,
+		$23, $24, $25, $26
 	) ON CONFLICT ON CONSTRAINT %[1]s_pkey DO UPDATE SET
 		primary_exchange = EXCLUDED.primary_exchange,
 		active = EXCLUDED.active,
@@ -256,19 +311,52 @@ func (asset *Asset) SaveDB(ctx context.Context, tbl string, dbConn *pgxpool.Conn
 		tags = EXCLUDED.tags,
 		listed = EXCLUDED.listed,
 		delisted = EXCLUDED.delisted,
+		headquarters_location = coalesce(nullif(EXCLUDED.headquarters_location, ''), %[1]s.headquarters_location),
+		icon = coalesce(EXCLUDED.icon, %[1]s.icon),
+		icon_mime_type = coalesce(nullif(EXCLUDED.icon_mime_type, ''), %[1]s.icon_mime_type),
+		logo = coalesce(EXCLUDED.logo, %[1]s.logo),
+		logo_mime_type = coalesce(nullif(EXCLUDED.logo_mime_type, ''), %[1]s.logo_mime_type),
 		last_updated = EXCLUDED.last_updated`, tbl)
 
 	_, err = tx.Exec(ctx, sql, asset.Ticker, asset.CompositeFigi, asset.ShareClassFigi,
 		asset.PrimaryExchange, asset.AssetType, asset.Active, asset.Name, asset.Description,
 		asset.CorporateUrl, asset.Sector, asset.Industry, asset.SIC, asset.CIK,
 		asset.CUSIP, asset.ISIN, asset.OtherIdentifiers, asset.SimilarTickers, asset.Tags,
-		listingDate, delistingDate, asset.LastUpdated)
+		listingDate, delistingDate, asset.HeadquartersLocation, asset.Icon, asset.IconMimeType,
+		asset.Logo, asset.LogoMimeType, asset.LastUpdated)
 
 	if err != nil {
-		log.Error().Err(err).Str("SQL", sql).Msg("save asset to DB failed")
+		logger.Error().Err(err).Str("SQL", sql).Msg("save asset to DB failed")
 		return err
 	}
 
+	// a renamed listing keeps its composite FIGI, share class and exchange;
+	// retire rows left over from its earlier tickers. Other share classes and
+	// listings on other exchanges are left alone.
+	retired := make([]string, 0)
+	if asset.Active {
+		sql = fmt.Sprintf(`UPDATE %s SET active = false
+		WHERE composite_figi = $1 AND ticker <> $2 AND active
+			AND share_class_figi IS NOT DISTINCT FROM $3 AND primary_exchange IS NOT DISTINCT FROM $4
+		RETURNING ticker`, tbl)
+		rows, err := tx.Query(ctx, sql, asset.CompositeFigi, asset.Ticker, asset.ShareClassFigi, asset.PrimaryExchange)
+		if err != nil {
+			logger.Error().Err(err).Str("SQL", sql).Msg("deactivate previous tickers failed")
+			return err
+		}
+
+		if retired, err = pgx.CollectRows(rows, pgx.RowTo[string]); err != nil {
+			logger.Error().Err(err).Str("SQL", sql).Msg("deactivate previous tickers failed")
+			return err
+		}
+	}
+
+	if target, ok := symbologyFromContext(ctx); ok {
+		if err := asset.updateSymbology(ctx, tx, target.table, target.asOf, retired); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -0,0 +1,302 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+// AssetMasterTable holds one record per composite FIGI merged from every asset subscription
+const AssetMasterTable = "asset_master"
+
+// AssetSource is an asset table merged into the asset master
+type AssetSource struct {
+	// Name identifies the source in precedence lists and provenance; e.g. the
+	// name of the subscription the table belongs to
+	Name     string
+	Provider string
+	Table    string
+}
+
+// AssetPrecedence orders sources from most to least trusted. Entries name a
+// source or a provider, which covers every source of that provider. Fields
+// lists overrides for individual fields; sources a field override does not
+// list follow the default order. Sources that are not listed are used last.
+type AssetPrecedence struct {
+	Default []string
+	Fields  map[string][]string
+}
+
+// assetField is a field of the asset master
+type assetField struct {
+	Name  string
+	Empty func(*Asset) bool
+	Copy  func(dst, src *Asset)
+}
+
+// assetFields are the merged fields; names match the asset table columns
+var assetFields = []*assetField{
+	{"ticker", func(a *Asset) bool { return a.Ticker == "" }, func(d, s *Asset) { d.Ticker = s.Ticker }},
+	{"share_class_figi", func(a *Asset) bool { return a.ShareClassFigi == "" }, func(d, s *Asset) { d.ShareClassFigi = s.ShareClassFigi }},
+	{"primary_exchange", func(a *Asset) bool { return a.PrimaryExchange == "" || a.PrimaryExchange == UnknownExchange }, func(d, s *Asset) { d.PrimaryExchange = s.PrimaryExchange }},
+	{"asset_type", func(a *Asset) bool { return a.AssetType == "" || a.AssetType == UnknownAsset }, func(d, s *Asset) { d.AssetType = s.AssetType }},
+	{"active", func(a *Asset) bool { return false }, func(d, s *Asset) { d.Active = s.Active }},
+	{"name", func(a *Asset) bool { return a.Name == "" }, func(d, s *Asset) { d.Name = s.Name }},
+	{"description", func(a *Asset) bool { return a.Description == "" }, func(d, s *Asset) { d.Description = s.Description }},
+	{"corporate_url", func(a *Asset) bool { return a.CorporateUrl == "" }, func(d, s *Asset) { d.CorporateUrl = s.CorporateUrl }},
+	{"sector", func(a *Asset) bool { return a.Sector == "" }, func(d, s *Asset) { d.Sector = s.Sector }},
+	{"industry", func(a *Asset) bool { return a.Industry == "" }, func(d, s *Asset) { d.Industry = s.Industry }},
+	{"sic_code", func(a *Asset) bool { return a.SIC == 0 }, func(d, s *Asset) { d.SIC = s.SIC }},
+	{"cik", func(a *Asset) bool { return a.CIK == "" }, func(d, s *Asset) { d.CIK = s.CIK }},
+	{"cusips", func(a *Asset) bool { return len(a.CUSIP) == 0 }, func(d, s *Asset) { d.CUSIP = s.CUSIP }},
+	{"isins", func(a *Asset) bool { return len(a.ISIN) == 0 }, func(d, s *Asset) { d.ISIN = s.ISIN }},
+	{"other_identifiers", func(a *Asset) bool { return len(a.OtherIdentifiers) == 0 }, func(d, s *Asset) { d.OtherIdentifiers = s.OtherIdentifiers }},
+	{"similar_tickers", func(a *Asset) bool { return len(a.SimilarTickers) == 0 }, func(d, s *Asset) { d.SimilarTickers = s.SimilarTickers }},
+	{"tags", func(a *Asset) bool { return len(a.Tags) == 0 }, func(d, s *Asset) { d.Tags = s.Tags }},
+	{"listed", func(a *Asset) bool { return a.ListingDate == "" }, func(d, s *Asset) { d.ListingDate = s.ListingDate }},
+	{"delisted", func(a *Asset) bool { return a.DelistingDate == "" }, func(d, s *Asset) { d.DelistingDate = s.DelistingDate }},
+	{"headquarters_location", func(a *Asset) bool { return a.HeadquartersLocation == "" }, func(d, s *Asset) { d.HeadquartersLocation = s.HeadquartersLocation }},
+	{"icon", func(a *Asset) bool { return len(a.Icon) == 0 }, func(d, s *Asset) { d.Icon, d.IconMimeType = s.Icon, s.IconMimeType }},
+	{"logo", func(a *Asset) bool { return len(a.Logo) == 0 }, func(d, s *Asset) { d.Logo, d.LogoMimeType = s.Logo, s.LogoMimeType }},
+}
+
+var (
+	ErrNoAssetSources = errors.New("no asset sources to merge")
+)
+
+// DefaultAssetTable returns the table assets are read from when no table is
+// given: default.asset_table if set, otherwise the asset master
+func DefaultAssetTable() string {
+	if assetTable := viper.GetString("default.asset_table"); assetTable != "" {
+		return assetTable
+	}
+	return AssetMasterTable
+}
+
+// AssetPrecedenceFromConfig reads the source precedence from
+// asset_master.precedence and asset_master.fields.<field>
+func AssetPrecedenceFromConfig() AssetPrecedence {
+	return AssetPrecedence{
+		Default: viper.GetStringSlice("asset_master.precedence"),
+		Fields:  viper.GetStringMapStringSlice("asset_master.fields"),
+	}
+}
+
+// Order returns the sources in the order they are consulted for `field`
+func (precedence AssetPrecedence) Order(field string, sources []*AssetSource) []*AssetSource {
+	preferred := append(append([]string{}, precedence.Fields[field]...), precedence.Default...)
+
+	sorted := slices.Clone(sources)
+	slices.SortFunc(sorted, func(a, b *AssetSource) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	order := make([]*AssetSource, 0, len(sources))
+	for _, name := range preferred {
+		for _, source := range sorted {
+			if (source.Name == name || source.Provider == name) && !slices.Contains(order, source) {
+				order = append(order, source)
+			}
+		}
+	}
+
+	for _, source := range sorted {
+		if !slices.Contains(order, source) {
+			order = append(order, source)
+		}
+	}
+
+	return order
+}
+
+// MergeAssets combines the records each source has for one composite FIGI.
+// Each field is taken from the first source in precedence order that has a
+// value for it. The returned provenance maps field names to source names.
+func MergeAssets(records map[*AssetSource]*Asset, precedence AssetPrecedence) (*Asset, map[string]string) {
+	sources := make([]*AssetSource, 0, len(records))
+	for source := range records {
+		sources = append(sources, source)
+	}
+
+	merged := &Asset{}
+	provenance := make(map[string]string, len(assetFields))
+
+	for _, field := range assetFields {
+		for _, source := range precedence.Order(field.Name, sources) {
+			record := records[source]
+			if field.Empty(record) {
+				continue
+			}
+
+			field.Copy(merged, record)
+			provenance[field.Name] = source.Name
+			break
+		}
+	}
+
+	for _, record := range records {
+		if merged.CompositeFigi == "" {
+			merged.CompositeFigi = record.CompositeFigi
+		}
+
+		if record.LastUpdated.After(merged.LastUpdated) {
+			merged.LastUpdated = record.LastUpdated
+		}
+	}
+
+	return merged, provenance
+}
+
+// MergeAssetMaster rebuilds the asset master from `sources`. Records for a
+// composite FIGI that no source has anymore are removed. Returns the number
+// of records in the asset master.
+func MergeAssetMaster(ctx context.Context, dbConn *pgxpool.Conn, sources []*AssetSource, precedence AssetPrecedence) (int, error) {
+	logger := zerolog.Ctx(ctx)
+
+	if len(sources) == 0 {
+		return 0, ErrNoAssetSources
+	}
+
+	// collect each source's record for every composite FIGI; when a source has
+	// several records for a FIGI the active, most recently updated one is used
+	byFigi := make(map[string]map[*AssetSource]*Asset)
+	for _, source := range sources {
+		for _, asset := range selectAssetsWithMedia(ctx, dbConn, source.Table, "composite_figi IS NOT NULL AND composite_figi <> ''") {
+			records, ok := byFigi[asset.CompositeFigi]
+			if !ok {
+				records = make(map[*AssetSource]*Asset, len(sources))
+				byFigi[asset.CompositeFigi] = records
+			}
+
+			if current, ok := records[source]; ok {
+				if current.Active && !asset.Active {
+					continue
+				}
+
+				if current.Active == asset.Active && current.LastUpdated.After(asset.LastUpdated) {
+					continue
+				}
+			}
+
+			records[source] = asset
+		}
+	}
+
+	// nothing was read; leave the asset master as it is rather than emptying it
+	if len(byFigi) == 0 {
+		logger.Warn().Msg("asset sources are empty, asset master not updated")
+		return 0, nil
+	}
+
+	tx, err := dbConn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			logger.Error().Err(err).Msg("error rolling back asset master transaction")
+		}
+	}()
+
+	sql := `INSERT INTO asset_master (
+		"composite_figi", "ticker", "share_class_figi", "primary_exchange", "asset_type", "active",
+		"name", "description", "corporate_url", "sector", "industry", "sic_code", "cik", "cusips",
+		"isins", "other_identifiers", "similar_tickers", "tags", "listed", "delisted",
+		"headquarters_location", "icon", "icon_mime_type", "logo", "logo_mime_type",
+		"last_updated", "provenance", "merged_on"
+	) VALUES (
+		$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18,
+		$19, $20, $21, $22, $23, $24, $25, $26, $27, $28
+	) ON CONFLICT ON CONSTRAINT asset_master_pkey DO UPDATE SET
+		ticker = EXCLUDED.ticker,
+		share_class_figi = EXCLUDED.share_class_figi,
+		primary_exchange = EXCLUDED.primary_exchange,
+		asset_type = EXCLUDED.asset_type,
+		active = EXCLUDED.active,
+		name = EXCLUDED.name,
+		description = EXCLUDED.description,
+		corporate_url = EXCLUDED.corporate_url,
+		sector = EXCLUDED.sector,
+		industry = EXCLUDED.industry,
+		sic_code = EXCLUDED.sic_code,
+		cik = EXCLUDED.cik,
+		cusips = EXCLUDED.cusips,
+		isins = EXCLUDED.isins,
+		other_identifiers = EXCLUDED.other_identifiers,
+		similar_tickers = EXCLUDED.similar_tickers,
+		tags = EXCLUDED.tags,
+		listed = EXCLUDED.listed,
+		delisted = EXCLUDED.delisted,
+		headquarters_location = EXCLUDED.headquarters_location,
+		icon = EXCLUDED.icon,
+		icon_mime_type = EXCLUDED.icon_mime_type,
+		logo = EXCLUDED.logo,
+		logo_mime_type = EXCLUDED.logo_mime_type,
+		last_updated = EXCLUDED.last_updated,
+		provenance = EXCLUDED.provenance,
+		merged_on = EXCLUDED.merged_on`
+
+	now := time.Now()
+	batch := &pgx.Batch{}
+	figis := make([]string, 0, len(byFigi))
+	for compositeFigi, records := range byFigi {
+		asset, provenance := MergeAssets(records, precedence)
+		figis = append(figis, compositeFigi)
+
+		var listingDate, delistingDate *string
+		if asset.ListingDate != "" {
+			listingDate = &asset.ListingDate
+		}
+
+		if asset.DelistingDate != "" {
+			delistingDate = &asset.DelistingDate
+		}
+
+		var assetType *AssetType
+		if asset.AssetType != "" {
+			assetType = &asset.AssetType
+		}
+
+		batch.Queue(sql, asset.CompositeFigi, asset.Ticker, asset.ShareClassFigi, asset.PrimaryExchange,
+			assetType, asset.Active, asset.Name, asset.Description, asset.CorporateUrl, asset.Sector,
+			asset.Industry, asset.SIC, asset.CIK, asset.CUSIP, asset.ISIN, asset.OtherIdentifiers,
+			asset.SimilarTickers, asset.Tags, listingDate, delistingDate, asset.HeadquartersLocation,
+			asset.Icon, asset.IconMimeType, asset.Logo, asset.LogoMimeType, asset.LastUpdated,
+			provenance, now)
+	}
+
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		logger.Error().Err(err).Str("SQL", sql).Msg("could not save asset master")
+		return 0, err
+	}
+
+	removeSQL := "DELETE FROM asset_master WHERE NOT (composite_figi = ANY($1))"
+	if _, err := tx.Exec(ctx, removeSQL, figis); err != nil {
+		logger.Error().Err(err).Str("SQL", removeSQL).Msg("could not remove stale asset master records")
+		return 0, err
+	}
+
+	return len(figis), tx.Commit(ctx)
+}
@@ -0,0 +1,127 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/penny-vault/pvdata/data"
+)
+
+var _ = Describe("AssetMaster", func() {
+	var (
+		precedence data.AssetPrecedence
+		records    map[*data.AssetSource]*data.Asset
+		polygon    = &data.AssetSource{Name: "polygon", Provider: "polygon"}
+		tiingo     = &data.AssetSource{Name: "tiingo", Provider: "tiingo"}
+		sharadar   = &data.AssetSource{Name: "sharadar", Provider: "sharadar"}
+	)
+
+	BeforeEach(func() {
+		precedence = data.AssetPrecedence{
+			Default: []string{"polygon", "tiingo"},
+			Fields:  map[string][]string{"sector": {"sharadar"}},
+		}
+
+		records = map[*data.AssetSource]*data.Asset{
+			polygon: {
+				Ticker:        "AAPL",
+				CompositeFigi: "BBG000B9XRY4",
+				Name:          "Apple Inc.",
+				Sector:        "Technology",
+				AssetType:     data.CommonStock,
+				Active:        true,
+				LastUpdated:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			},
+			tiingo: {
+				Ticker:        "AAPL",
+				CompositeFigi: "BBG000B9XRY4",
+				Name:          "Apple",
+				Description:   "Makes phones",
+				AssetType:     data.UnknownAsset,
+				LastUpdated:   time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+			},
+			sharadar: {
+				Ticker:        "AAPL",
+				CompositeFigi: "BBG000B9XRY4",
+				Sector:        "Information Technology",
+				CIK:           "320193",
+				SIC:           3571,
+			},
+		}
+	})
+
+	It("orders sources by field precedence", func() {
+		sources := []*data.AssetSource{sharadar, tiingo, polygon}
+		Expect(precedence.Order("name", sources)).To(Equal([]*data.AssetSource{polygon, tiingo, sharadar}))
+		Expect(precedence.Order("sector", sources)).To(Equal([]*data.AssetSource{sharadar, polygon, tiingo}))
+	})
+
+	It("matches precedence entries to subscription and provider names", func() {
+		logos := &data.AssetSource{Name: "polygon logos", Provider: "polygon"}
+		daily := &data.AssetSource{Name: "polygon daily", Provider: "polygon"}
+		precedence.Fields["logo"] = []string{"polygon logos"}
+
+		sources := []*data.AssetSource{tiingo, daily, logos}
+		Expect(precedence.Order("logo", sources)).To(Equal([]*data.AssetSource{logos, daily, tiingo}))
+		Expect(precedence.Order("name", sources)).To(Equal([]*data.AssetSource{daily, logos, tiingo}))
+	})
+
+	It("keeps subscriptions of the same provider apart", func() {
+		delete(records, tiingo)
+		delete(records, sharadar)
+		other := &data.AssetSource{Name: "polygon logos", Provider: "polygon"}
+		records[other] = &data.Asset{
+			CompositeFigi: "BBG000B9XRY4",
+			Logo:          []byte("<svg/>"),
+			LogoMimeType:  "image/svg+xml",
+		}
+
+		asset, provenance := data.MergeAssets(records, precedence)
+		Expect(asset.Name).To(Equal("Apple Inc."))
+		Expect(asset.Logo).To(Equal([]byte("<svg/>")))
+		Expect(asset.LogoMimeType).To(Equal("image/svg+xml"))
+		Expect(provenance).To(HaveKeyWithValue("name", "polygon"))
+		Expect(provenance).To(HaveKeyWithValue("logo", "polygon logos"))
+	})
+
+	It("takes each field from the first source with a value", func() {
+		asset, provenance := data.MergeAssets(records, precedence)
+		Expect(asset.CompositeFigi).To(Equal("BBG000B9XRY4"))
+		Expect(asset.Name).To(Equal("Apple Inc."))
+		Expect(asset.Description).To(Equal("Makes phones"))
+		Expect(asset.Sector).To(Equal("Information Technology"))
+		Expect(asset.CIK).To(Equal("320193"))
+		Expect(asset.AssetType).To(Equal(data.CommonStock))
+		Expect(asset.Active).To(BeTrue())
+		Expect(asset.LastUpdated).To(Equal(time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)))
+
+		Expect(provenance).To(HaveKeyWithValue("name", "polygon"))
+		Expect(provenance).To(HaveKeyWithValue("description", "tiingo"))
+		Expect(provenance).To(HaveKeyWithValue("sector", "sharadar"))
+		Expect(provenance).To(HaveKeyWithValue("sic_code", "sharadar"))
+		Expect(provenance).ToNot(HaveKey("corporate_url"))
+	})
+
+	It("skips unknown asset types", func() {
+		delete(records, polygon)
+		asset, provenance := data.MergeAssets(records, precedence)
+		Expect(asset.AssetType).To(BeEmpty())
+		Expect(provenance).ToNot(HaveKey("asset_type"))
+	})
+})
@@ -0,0 +1,189 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrNotBitemporal = errors.New("data type does not support bitemporal storage")
+)
+
+// HistoryTable returns the name of the table holding every version of the records in `tableName`
+func HistoryTable(tableName string) string {
+	return tableName + "_history"
+}
+
+// SupportsBitemporal returns true if the data type can keep a history of every version of its records
+func (dt *DataType) SupportsBitemporal() bool {
+	return dt.ValidFrom != "" && len(dt.PrimaryKey) > 0
+}
+
+// BitemporalSchema returns SQL that keeps every version of the records in
+// `tableName` in its history table. Each version has a valid range, when the
+// version took effect according to ValidFrom until it was superseded, and a
+// recorded range, when the version was stored until it was replaced. Existing
+// records are copied to the history table the first time the SQL is run.
+// Versions are copied by column name so columns added to the table by a
+// migration don't break writes before BitemporalSyncColumns adds them to the
+// history table.
+func (dt *DataType) BitemporalSchema(tableName string) (string, error) {
+	if !dt.SupportsBitemporal() {
+		return "", fmt.Errorf("%w: %s", ErrNotBitemporal, dt.Name)
+	}
+
+	historyTable := HistoryTable(tableName)
+
+	keyMatch := func(row string) string {
+		conditions := make([]string, len(dt.PrimaryKey))
+		for idx, col := range dt.PrimaryKey {
+			conditions[idx] = fmt.Sprintf("h.%[1]s = %[2]s.%[1]s", col, row)
+		}
+		return strings.Join(conditions, " AND ")
+	}
+
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %[2]s (
+	LIKE %[1]s INCLUDING DEFAULTS,
+	valid_from DATE NOT NULL,
+	valid_to DATE,
+	recorded_from TIMESTAMPTZ NOT NULL DEFAULT now(),
+	recorded_to TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS %[2]s_key_idx ON %[2]s(%[3]s, valid_from);
+
+%[8]s
+
+CREATE OR REPLACE FUNCTION %[1]s_history_fn() RETURNS trigger
+LANGUAGE plpgsql AS $func$
+DECLARE
+	new_valid_from DATE;
+	prev %[2]s%%ROWTYPE;
+BEGIN
+	IF TG_OP = 'DELETE' THEN
+		UPDATE %[2]s h SET recorded_to = now() WHERE %[4]s AND h.recorded_to IS NULL;
+		RETURN NULL;
+	END IF;
+
+	IF TG_OP = 'UPDATE' AND NEW IS NOT DISTINCT FROM OLD THEN
+		RETURN NULL;
+	END IF;
+
+	new_valid_from := %[6]s;
+
+	-- retire current versions; a version that took effect earlier is
+	-- re-recorded with its validity ending when the new version starts
+	FOR prev IN UPDATE %[2]s h SET recorded_to = now()
+		WHERE %[5]s AND h.recorded_to IS NULL AND (h.valid_to IS NULL OR h.valid_to > new_valid_from)
+		RETURNING h.*
+	LOOP
+		IF prev.valid_from < new_valid_from THEN
+			prev.valid_to := new_valid_from;
+			prev.recorded_from := now();
+			prev.recorded_to := NULL;
+			INSERT INTO %[2]s SELECT prev.*;
+		END IF;
+	END LOOP;
+
+	INSERT INTO %[2]s SELECT * FROM jsonb_populate_record(NULL::%[2]s, to_jsonb(NEW) ||
+		jsonb_build_object('valid_from', new_valid_from, 'recorded_from', now()));
+	RETURN NULL;
+END
+$func$;
+
+DROP TRIGGER IF EXISTS %[1]s_history_trg ON %[1]s;
+CREATE TRIGGER %[1]s_history_trg
+AFTER INSERT OR UPDATE OR DELETE ON %[1]s
+FOR EACH ROW EXECUTE FUNCTION %[1]s_history_fn();
+
+CREATE OR REPLACE FUNCTION %[1]s_as_of(valid_at DATE, recorded_at TIMESTAMPTZ DEFAULT now())
+RETURNS SETOF %[2]s
+LANGUAGE SQL STABLE AS $func$
+	SELECT * FROM %[2]s
+	WHERE valid_from <= valid_at AND (valid_to IS NULL OR valid_to > valid_at)
+		AND recorded_from <= recorded_at AND (recorded_to IS NULL OR recorded_to > recorded_at)
+$func$;
+
+INSERT INTO %[2]s SELECT version.* FROM %[1]s t,
+	jsonb_populate_record(NULL::%[2]s, to_jsonb(t) || jsonb_build_object('valid_from', %[7]s, 'recorded_from', now())) version
+WHERE NOT EXISTS (SELECT 1 FROM %[2]s);`,
+		tableName, historyTable, strings.Join(dt.PrimaryKey, ", "), keyMatch("OLD"), keyMatch("NEW"),
+		fmt.Sprintf(dt.ValidFrom, "NEW"), fmt.Sprintf(dt.ValidFrom, "t"), BitemporalSyncColumns(tableName)), nil
+}
+
+// BitemporalSyncColumns returns SQL that adds columns of `tableName` missing
+// from its history table, e.g. after a data type migration. It does nothing if
+// the table has no history.
+func BitemporalSyncColumns(tableName string) string {
+	return fmt.Sprintf(`DO $sync$
+DECLARE
+	col RECORD;
+BEGIN
+	IF to_regclass('%[2]s') IS NULL THEN
+		RETURN;
+	END IF;
+
+	FOR col IN SELECT a.attname, format_type(a.atttypid, a.atttypmod) AS coltype
+		FROM pg_attribute a
+		WHERE a.attrelid = '%[1]s'::regclass AND a.attnum > 0 AND NOT a.attisdropped
+			AND NOT EXISTS (SELECT 1 FROM pg_attribute h
+				WHERE h.attrelid = '%[2]s'::regclass AND h.attname = a.attname AND NOT h.attisdropped)
+		ORDER BY a.attnum
+	LOOP
+		EXECUTE format('ALTER TABLE %[2]s ADD COLUMN %%I %%s', col.attname, col.coltype);
+	END LOOP;
+END
+$sync$;`, tableName, HistoryTable(tableName))
+}
+
+// BitemporalPause returns SQL that stops recording versions of the records in
+// `tableName`; the history recorded so far is kept
+func BitemporalPause(tableName string) string {
+	return fmt.Sprintf("DROP TRIGGER IF EXISTS %[1]s_history_trg ON %[1]s;", tableName)
+}
+
+// BitemporalTeardown returns SQL that removes the history table of `tableName` and its functions
+func BitemporalTeardown(tableName string) string {
+	return fmt.Sprintf(`DROP FUNCTION IF EXISTS %[1]s_as_of(DATE, TIMESTAMPTZ);
+DROP FUNCTION IF EXISTS %[1]s_history_fn() CASCADE;
+DROP TABLE IF EXISTS %[2]s;`, tableName, HistoryTable(tableName))
+}
+
+// AsOf returns the versions of the records in `tableName` that were valid on
+// `validAt` as they were recorded at `recordedAt`. A zero recordedAt uses the
+// latest recorded versions. Results can be limited to specific assets.
+func AsOf(ctx context.Context, dbConn *pgxpool.Conn, tableName string, validAt, recordedAt time.Time, compositeFigis ...string) (pgx.Rows, error) {
+	if recordedAt.IsZero() {
+		recordedAt = time.Now()
+	}
+
+	sql := fmt.Sprintf("SELECT * FROM %s_as_of($1, $2)", tableName)
+	args := []any{validAt, recordedAt}
+
+	if len(compositeFigis) > 0 {
+		sql += " WHERE composite_figi = ANY($3)"
+		args = append(args, compositeFigis)
+	}
+
+	return dbConn.Query(ctx, sql, args...)
+}
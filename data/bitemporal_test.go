@@ -0,0 +1,140 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/penny-vault/pvdata/data"
+)
+
+var _ = Describe("Bitemporal", func() {
+	It("is only supported by data types that restate", func() {
+		Expect(data.DataTypes[data.FundamentalsKey].SupportsBitemporal()).To(BeTrue())
+		Expect(data.DataTypes[data.MetricKey].SupportsBitemporal()).To(BeTrue())
+
+		_, err := data.DataTypes[data.EODKey].BitemporalSchema("eod_tbl")
+		Expect(err).To(MatchError(data.ErrNotBitemporal))
+	})
+
+	It("matches versions on the primary key and uses the data type's valid from", func() {
+		sql, err := data.DataTypes[data.FundamentalsKey].BitemporalSchema("fund_tbl")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(sql).To(ContainSubstring("CREATE TABLE IF NOT EXISTS fund_tbl_history"))
+		Expect(sql).To(ContainSubstring("h.composite_figi = NEW.composite_figi AND h.dimension = NEW.dimension AND h.event_date = NEW.event_date"))
+		Expect(sql).To(ContainSubstring("new_valid_from := coalesce(NEW.date_key, NEW.report_period, NEW.event_date);"))
+		Expect(sql).To(ContainSubstring("prev fund_tbl_history%ROWTYPE;"))
+		Expect(sql).To(ContainSubstring("CREATE OR REPLACE FUNCTION fund_tbl_as_of"))
+		Expect(sql).To(ContainSubstring(data.BitemporalSyncColumns("fund_tbl")))
+	})
+
+	Describe("as-of queries", Ordered, func() {
+		var (
+			ctx   context.Context
+			pool  *pgxpool.Pool
+			conn  *pgxpool.Conn
+			tbl   string
+			figi  = "BBG000BPH459"
+			total = func(validAt, recordedAt time.Time) []int64 {
+				rows, err := data.AsOf(ctx, conn, tbl, validAt, recordedAt, figi)
+				Expect(err).NotTo(HaveOccurred())
+				records, err := pgx.CollectRows(rows, pgx.RowToMap)
+				Expect(err).NotTo(HaveOccurred())
+
+				totals := make([]int64, len(records))
+				for idx, record := range records {
+					totals[idx] = record["total_assets"].(int64)
+				}
+				return totals
+			}
+		)
+
+		BeforeAll(func() {
+			ctx = context.Background()
+			pool, conn = testDB(ctx)
+
+			tbl = fmt.Sprintf("fundamentals_as_of_%d", time.Now().UnixNano())
+			dt := data.DataTypes[data.FundamentalsKey]
+			_, err := conn.Exec(ctx, fmt.Sprintf(dt.Schema, tbl))
+			Expect(err).NotTo(HaveOccurred())
+
+			sql, err := dt.BitemporalSchema(tbl)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = conn.Exec(ctx, sql)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterAll(func() {
+			if conn == nil {
+				return
+			}
+			_, err := conn.Exec(ctx, data.BitemporalTeardown(tbl)+fmt.Sprintf("DROP TABLE IF EXISTS %s;", tbl))
+			Expect(err).NotTo(HaveOccurred())
+			conn.Release()
+			pool.Close()
+		})
+
+		It("answers with the figures that were filed and known at the time", func() {
+			_, err := conn.Exec(ctx, fmt.Sprintf(`INSERT INTO %s
+				(event_date, ticker, composite_figi, dimension, date_key, report_period, last_updated, total_assets)
+				VALUES ('2023-12-31', 'AAPL', $1, 'ARQ', '2024-02-01', '2023-12-31', '2024-02-02', 100)`, tbl), figi)
+			Expect(err).NotTo(HaveOccurred())
+
+			var beforeRestatement time.Time
+			Expect(conn.QueryRow(ctx, "SELECT clock_timestamp()").Scan(&beforeRestatement)).To(Succeed())
+
+			// a restatement filed in May that the provider refreshed in June
+			_, err = conn.Exec(ctx, fmt.Sprintf(`UPDATE %s SET total_assets = 120, date_key = '2024-05-01', last_updated = '2024-06-15'
+				WHERE composite_figi = $1`, tbl), figi)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(total(time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC), time.Time{})).To(BeEmpty())
+			Expect(total(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), time.Time{})).To(Equal([]int64{100}))
+			Expect(total(time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC), time.Time{})).To(Equal([]int64{120}))
+			Expect(total(time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC), beforeRestatement)).To(Equal([]int64{100}))
+		})
+
+		It("keeps recording versions after the table gains a column", func() {
+			_, err := conn.Exec(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS pv_test_metric BIGINT", tbl))
+			Expect(err).NotTo(HaveOccurred())
+
+			// writes succeed before the history table is migrated
+			_, err = conn.Exec(ctx, fmt.Sprintf(`INSERT INTO %s
+				(event_date, ticker, composite_figi, dimension, date_key, report_period, total_assets, pv_test_metric)
+				VALUES ('2024-03-31', 'AAPL', $1, 'ARQ', '2024-05-02', '2024-03-31', 130, 7)`, tbl), figi)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(total(time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC), time.Time{})).To(ConsistOf(int64(120), int64(130)))
+
+			// once it is, the new column is recorded too
+			_, err = conn.Exec(ctx, data.BitemporalSyncColumns(tbl))
+			Expect(err).NotTo(HaveOccurred())
+			_, err = conn.Exec(ctx, fmt.Sprintf(`UPDATE %s SET pv_test_metric = 8 WHERE event_date = '2024-03-31'`, tbl))
+			Expect(err).NotTo(HaveOccurred())
+
+			var metric int64
+			Expect(conn.QueryRow(ctx, fmt.Sprintf(`SELECT pv_test_metric FROM %s
+				WHERE event_date = '2024-03-31' AND recorded_to IS NULL`, data.HistoryTable(tbl))).Scan(&metric)).To(Succeed())
+			Expect(metric).To(Equal(int64(8)))
+		})
+	})
+})
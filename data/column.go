@@ -0,0 +1,249 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog"
+)
+
+// ColumnKind is how the values of a column are represented outside of the database
+type ColumnKind string
+
+const (
+	// TextColumn holds the PostgreSQL text representation of any type not
+	// listed below (text, numeric, arrays, json, enums, ...) so values
+	// round-trip exactly
+	TextColumn      ColumnKind = "text"
+	IntColumn       ColumnKind = "int"
+	FloatColumn     ColumnKind = "float"
+	BoolColumn      ColumnKind = "bool"
+	DateColumn      ColumnKind = "date"
+	TimestampColumn ColumnKind = "timestamp"
+)
+
+// Column describes a column of a table
+type Column struct {
+	Name    string     `json:"name"`
+	SQLType string     `json:"sql_type"`
+	Kind    ColumnKind `json:"kind"`
+}
+
+// ColumnKindOf returns the kind used for a PostgreSQL type as formatted by format_type
+func ColumnKindOf(sqlType string) ColumnKind {
+	switch sqlType {
+	case "smallint", "integer", "bigint":
+		return IntColumn
+	case "real", "double precision":
+		return FloatColumn
+	case "boolean":
+		return BoolColumn
+	case "date":
+		return DateColumn
+	case "timestamp without time zone":
+		return TimestampColumn
+	default:
+		return TextColumn
+	}
+}
+
+// TableColumns returns the stored (not generated) columns of `table` in order
+func TableColumns(ctx context.Context, dbConn Querier, table string) ([]*Column, error) {
+	sql := `SELECT attname, format_type(atttypid, atttypmod)
+	FROM pg_attribute
+	WHERE attrelid = $1::regclass AND attnum > 0 AND NOT attisdropped AND attgenerated = ''
+	ORDER BY attnum`
+
+	rows, err := dbConn.Query(ctx, sql, table)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Str("SQL", sql).Str("Table", table).Msg("could not list table columns")
+		return nil, err
+	}
+
+	columns, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*Column, error) {
+		column := &Column{}
+		err := row.Scan(&column.Name, &column.SQLType)
+		column.Kind = ColumnKindOf(column.SQLType)
+		return column, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return columns, nil
+}
+
+// sqlTypeAliases maps the type names used in schemas to the names format_type
+// reports for them
+var sqlTypeAliases = map[string]string{
+	"int":       "integer",
+	"int4":      "integer",
+	"int8":      "bigint",
+	"int2":      "smallint",
+	"float4":    "real",
+	"float8":    "double precision",
+	"bool":      "boolean",
+	"timestamp": "timestamp without time zone",
+	"time":      "time without time zone",
+}
+
+// columnConstraints are the words that end a column's type in a column definition
+var columnConstraints = []string{"NOT", "NULL", "DEFAULT", "PRIMARY", "REFERENCES", "CHECK", "UNIQUE", "GENERATED", "CONSTRAINT", "COLLATE"}
+
+// tableConstraints are the words that start a table constraint in a column list
+var tableConstraints = []string{"PRIMARY", "CONSTRAINT", "UNIQUE", "CHECK", "FOREIGN", "EXCLUDE"}
+
+// Columns returns the columns declared by the data type's CREATE TABLE statement
+// in order. Generated columns added after the table is created are not included.
+func (dt *DataType) Columns() []*Column {
+	start := strings.Index(dt.Schema, "(")
+	if start < 0 {
+		return nil
+	}
+
+	columns := make([]*Column, 0)
+	depth := 0
+	item := strings.Builder{}
+	for _, ch := range dt.Schema[start+1:] {
+		switch {
+		case ch == '(':
+			depth++
+		case ch == ')' && depth == 0, ch == ',' && depth == 0:
+			if column := parseColumnDefinition(item.String()); column != nil {
+				columns = append(columns, column)
+			}
+			item.Reset()
+
+			if ch == ')' {
+				return columns
+			}
+			continue
+		case ch == ')':
+			depth--
+		}
+		item.WriteRune(ch)
+	}
+
+	return columns
+}
+
+// parseColumnDefinition returns the column defined by `def` or nil if it is a
+// table constraint
+func parseColumnDefinition(def string) *Column {
+	words := strings.Fields(def)
+	if len(words) < 2 || slices.Contains(tableConstraints, strings.ToUpper(words[0])) {
+		return nil
+	}
+
+	typeWords := make([]string, 0, len(words)-1)
+	for _, word := range words[1:] {
+		if slices.Contains(columnConstraints, strings.ToUpper(word)) {
+			break
+		}
+		typeWords = append(typeWords, strings.ToLower(word))
+	}
+
+	sqlType := strings.ReplaceAll(strings.Join(typeWords, " "), ", ", ",")
+	if alias, ok := sqlTypeAliases[sqlType]; ok {
+		sqlType = alias
+	}
+
+	return &Column{
+		Name:    strings.ToLower(words[0]),
+		SQLType: sqlType,
+		Kind:    ColumnKindOf(sqlType),
+	}
+}
+
+// SelectExpr returns the SQL expression that reads the column as its kind
+func (column *Column) SelectExpr() string {
+	switch column.Kind {
+	case IntColumn:
+		return fmt.Sprintf(`"%s"::bigint`, column.Name)
+	case FloatColumn:
+		return fmt.Sprintf(`"%s"::float8`, column.Name)
+	case TextColumn:
+		return fmt.Sprintf(`"%s"::text`, column.Name)
+	default:
+		return fmt.Sprintf(`"%s"`, column.Name)
+	}
+}
+
+// SelectColumns returns a select list that reads every column as its kind
+func SelectColumns(columns []*Column) string {
+	exprs := make([]string, len(columns))
+	for idx, column := range columns {
+		exprs[idx] = column.SelectExpr()
+	}
+	return strings.Join(exprs, ", ")
+}
+
+// ColumnNames returns the quoted names of the columns separated by commas
+func ColumnNames(columns []*Column) string {
+	names := make([]string, len(columns))
+	for idx, column := range columns {
+		names[idx] = fmt.Sprintf(`"%s"`, column.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// Text formats a value read with SelectExpr, or from a Parquet file, in
+// PostgreSQL's text representation. Nil values return false.
+func (column *Column) Text(val any) (string, bool) {
+	switch v := val.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	case bool:
+		if v {
+			return "t", true
+		}
+		return "f", true
+	case int32:
+		if column.Kind == DateColumn {
+			return time.Unix(int64(v)*86400, 0).UTC().Format("2006-01-02"), true
+		}
+		return strconv.FormatInt(int64(v), 10), true
+	case int64:
+		if column.Kind == TimestampColumn {
+			return time.UnixMicro(v).UTC().Format("2006-01-02 15:04:05.999999"), true
+		}
+		return strconv.FormatInt(v, 10), true
+	case float64:
+		switch {
+		case math.IsInf(v, 1):
+			return "Infinity", true
+		case math.IsInf(v, -1):
+			return "-Infinity", true
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64), true
+	case time.Time:
+		if column.Kind == DateColumn {
+			return v.Format("2006-01-02"), true
+		}
+		return v.Format("2006-01-02 15:04:05.999999"), true
+	default:
+		return fmt.Sprintf("%v", v), true
+	}
+}
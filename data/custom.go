@@ -20,7 +20,7 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/rs/zerolog/log"
+	"github.com/rs/zerolog"
 )
 
 type Custom struct {
@@ -32,6 +32,8 @@ type Custom struct {
 }
 
 func (custom *Custom) SaveDB(ctx context.Context, tbl string, dbConn *pgxpool.Conn) error {
+	logger := zerolog.Ctx(ctx)
+
 	if custom.CompositeFigi == "" {
 		return nil
 	}
@@ -43,7 +45,7 @@ func (custom *Custom) SaveDB(ctx context.Context, tbl string, dbConn *pgxpool.Co
 
 	defer func() {
 		if err := tx.Commit(ctx); err != nil {
-			log.Error().Err(err).Msg("error committing asset transaction to database")
+			logger.Error().Err(err).Msg("error committing asset transaction to database")
 		}
 	}()
 
@@ -61,9 +63,9 @@ func (custom *Custom) SaveDB(ctx context.Context, tbl string, dbConn *pgxpool.Co
 	_, err = tx.Exec(ctx, sql, custom.Ticker, custom.CompositeFigi, custom.EventDate, custom.Key, custom.Value)
 
 	if err != nil {
-		log.Error().Err(err).Str("SQL", sql).Msg("save custom data to DB failed")
+		logger.Error().Err(err).Str("SQL", sql).Msg("save custom data to DB failed")
 		if err2 := tx.Rollback(ctx); err2 != nil {
-			log.Error().Err(err).Msg("error rollingback tx")
+			logger.Error().Err(err).Msg("error rollingback tx")
 		}
 	}
 
@@ -15,8 +15,11 @@
 package data_test
 
 import (
+	"context"
+	"os"
 	"testing"
 
+	"github.com/jackc/pgx/v5/pgxpool"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/rs/zerolog/log"
@@ -28,3 +31,19 @@ func TestData(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Data Suite")
 }
+
+// testDB connects to the library database named by PVDATA_TEST_DB_URL (see
+// pvdata init); specs that need a database are skipped when it is not set
+func testDB(ctx context.Context) (*pgxpool.Pool, *pgxpool.Conn) {
+	dbURL := os.Getenv("PVDATA_TEST_DB_URL")
+	if dbURL == "" {
+		Skip("PVDATA_TEST_DB_URL is not set")
+	}
+
+	pool, err := pgxpool.New(ctx, dbURL)
+	Expect(err).NotTo(HaveOccurred())
+	conn, err := pool.Acquire(ctx)
+	Expect(err).NotTo(HaveOccurred())
+
+	return pool, conn
+}
@@ -29,6 +29,22 @@ const (
 	RunSuccess
 )
 
+func (status StatusType) String() string {
+	switch status {
+	case RunFailed:
+		return "failed"
+	case RunSuccess:
+		return "success"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText renders the status by name in JSON payloads
+func (status StatusType) MarshalText() ([]byte, error) {
+	return []byte(status.String()), nil
+}
+
 type RunSummary struct {
 	StartTime        time.Time
 	EndTime          time.Time
@@ -53,12 +69,76 @@ type Observation struct {
 	SubscriptionName string
 }
 
+// Payload returns the data type key and the object carried by the observation
+func (obs *Observation) Payload() (string, any) {
+	switch {
+	case obs.AssetObject != nil:
+		return AssetKey, obs.AssetObject
+	case obs.CustomObject != nil:
+		return CustomKey, obs.CustomObject
+	case obs.EconomicIndicator != nil:
+		return EconomicIndicatorKey, obs.EconomicIndicator
+	case obs.EodQuote != nil:
+		return EODKey, obs.EodQuote
+	case obs.Fundamental != nil:
+		return FundamentalsKey, obs.Fundamental
+	case obs.MarketHoliday != nil:
+		return MarketHolidaysKey, obs.MarketHoliday
+	case obs.Metric != nil:
+		return MetricKey, obs.Metric
+	case obs.Rating != nil:
+		return RatingKey, obs.Rating
+	default:
+		return "", nil
+	}
+}
+
+// Identity returns the ticker, composite figi and event date of the observation
+func (obs *Observation) Identity() (ticker string, compositeFigi string, eventDate time.Time) {
+	switch {
+	case obs.AssetObject != nil:
+		return obs.AssetObject.Ticker, obs.AssetObject.CompositeFigi, time.Time{}
+	case obs.CustomObject != nil:
+		return obs.CustomObject.Ticker, obs.CustomObject.CompositeFigi, obs.CustomObject.EventDate
+	case obs.EconomicIndicator != nil:
+		return obs.EconomicIndicator.Series, "", obs.EconomicIndicator.EventDate
+	case obs.EodQuote != nil:
+		return obs.EodQuote.Ticker, obs.EodQuote.CompositeFigi, obs.EodQuote.Date
+	case obs.Fundamental != nil:
+		return obs.Fundamental.Ticker, obs.Fundamental.CompositeFigi, obs.Fundamental.EventDate
+	case obs.MarketHoliday != nil:
+		return "", "", obs.MarketHoliday.EventDate
+	case obs.Metric != nil:
+		return obs.Metric.Ticker, obs.Metric.CompositeFigi, obs.Metric.EventDate
+	case obs.Rating != nil:
+		return obs.Rating.Ticker, obs.Rating.CompositeFigi, obs.Rating.EventDate
+	default:
+		return "", "", time.Time{}
+	}
+}
+
 type DataType struct {
-	Name          string
-	Schema        string
+	Name   string
+	Schema string
+
+	// PrimaryKey lists the columns that identify a record
+	PrimaryKey []string
+
+	// ValidFrom is a SQL expression giving the date a version of a record
+	// took effect. It is a format string that receives the name of the row
+	// variable. Data types with a ValidFrom can be stored bitemporally.
+	ValidFrom string
+
+	// Migrations are applied, in order, to tables created with an earlier
+	// version of Schema. Each migration is a format string that receives the
+	// table name and must be safe to run more than once. Version is the
+	// number of migrations.
 	Migrations    []string
 	Version       int
 	IsPartitioned bool
+
+	// PartitionLayout is the default size of partitions of partitioned tables
+	PartitionLayout PartitionLayout
 }
 
 const (
@@ -70,6 +150,7 @@ const (
 	MarketHolidaysKey    = "market-holidays"
 	MetricKey            = "metric"
 	RatingKey            = "rating"
+	SymbologyKey         = "symbology"
 )
 
 var DataTypes = map[string]*DataType{
@@ -96,6 +177,11 @@ similar_tickers TEXT[],
 tags TEXT[],
 listed timestamp,
 delisted timestamp,
+headquarters_location TEXT,
+icon BYTEA,
+icon_mime_type TEXT,
+logo BYTEA,
+logo_mime_type TEXT,
 last_updated timestamp,
 PRIMARY KEY (ticker, composite_figi)
 );
@@ -111,8 +197,15 @@ ADD COLUMN search tsvector
 ) STORED;
 
 CREATE INDEX %[1]s_search_idx ON %[1]s USING GIN (search);`,
-		Migrations:    []string{},
-		Version:       0,
+		PrimaryKey: []string{"ticker", "composite_figi"},
+		Migrations: []string{
+			`ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS headquarters_location TEXT,
+ADD COLUMN IF NOT EXISTS icon BYTEA,
+ADD COLUMN IF NOT EXISTS icon_mime_type TEXT,
+ADD COLUMN IF NOT EXISTS logo BYTEA,
+ADD COLUMN IF NOT EXISTS logo_mime_type TEXT;`,
+		},
+		Version:       1,
 		IsPartitioned: false,
 	},
 	CustomKey: {
@@ -127,6 +220,7 @@ CREATE INDEX %[1]s_search_idx ON %[1]s USING GIN (search);`,
 );
 
 CREATE INDEX %[1]s_key_ticker_event_date_idx ON %[1]s(key, ticker, event_date DESC)`,
+		PrimaryKey:    []string{"key", "composite_figi", "event_date"},
 		Migrations:    []string{},
 		Version:       0,
 		IsPartitioned: false,
@@ -139,6 +233,7 @@ CREATE INDEX %[1]s_key_ticker_event_date_idx ON %[1]s(key, ticker, event_date DE
 			value      REAL NOT NULL,
 			PRIMARY KEY (series, event_date)
 		);`,
+		PrimaryKey:    []string{"series", "event_date"},
 		Migrations:    []string{},
 		Version:       0,
 		IsPartitioned: false,
@@ -157,20 +252,28 @@ adj_close      NUMERIC(12, 4)        NOT NULL DEFAULT 0.0,
 volume         BIGINT                NOT NULL DEFAULT 0.0,
 dividend       NUMERIC(12, 4)        NOT NULL DEFAULT 0.0,
 split_factor   NUMERIC(9, 6)         NOT NULL DEFAULT 1.0,
+total_return   DOUBLE PRECISION,
 PRIMARY KEY (composite_figi, event_date)
 ) PARTITION BY RANGE (event_date);
 
 CREATE INDEX %[1]s_event_date_idx ON %[1]s(event_date);
 CREATE INDEX %[1]s_ticker_idx ON %[1]s(ticker);
+CREATE INDEX %[1]s_actions_idx ON %[1]s(composite_figi, event_date) WHERE dividend <> 0 OR split_factor <> 1;
 
 CREATE TRIGGER %[1]s_adj_close_default
 BEFORE INSERT ON %[1]s
 FOR EACH ROW
 WHEN (NEW.adj_close IS NULL AND NEW.close IS NOT NULL)
 EXECUTE PROCEDURE adj_close_default();`,
-		Migrations:    []string{},
-		Version:       0,
-		IsPartitioned: true,
+		PrimaryKey: []string{"composite_figi", "event_date"},
+		Migrations: []string{
+			`ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS total_return DOUBLE PRECISION;
+CREATE INDEX IF NOT EXISTS %[1]s_actions_idx ON %[1]s(composite_figi, event_date) WHERE dividend <> 0 OR split_factor <> 1;
+UPDATE %[1]s SET adj_close = close WHERE adj_close = 0;`,
+		},
+		Version:         1,
+		IsPartitioned:   true,
+		PartitionLayout: FiveYearPartitions,
 	},
 	FundamentalsKey: {
 		Name: FundamentalsKey,
@@ -286,6 +389,8 @@ EXECUTE PROCEDURE adj_close_default();`,
 
 CREATE INDEX %[1]s_ticker_idx ON %[1]s(ticker, dimension);
 CREATE INDEX %[1]s_event_date_idx ON %[1]s(event_date, dimension);`,
+		PrimaryKey:    []string{"composite_figi", "dimension", "event_date"},
+		ValidFrom:     "coalesce(%[1]s.date_key, %[1]s.report_period, %[1]s.event_date)",
 		Migrations:    []string{},
 		Version:       0,
 		IsPartitioned: false,
@@ -300,6 +405,7 @@ early_close BOOLEAN NOT NULL DEFAULT false,
 close_time TIME NOT NULL DEFAULT '16:00:00',
 PRIMARY KEY (event_date, market)
 );`,
+		PrimaryKey:    []string{"event_date", "market"},
 		Migrations:    []string{},
 		Version:       0,
 		IsPartitioned: false,
@@ -324,9 +430,12 @@ PRIMARY KEY (composite_figi, event_date)
 
 CREATE INDEX %[1]s_event_date_idx ON %[1]s(event_date);
 CREATE INDEX %[1]s_ticker_idx ON %[1]s(ticker);`,
-		Migrations:    []string{},
-		Version:       0,
-		IsPartitioned: true,
+		PrimaryKey:      []string{"composite_figi", "event_date"},
+		ValidFrom:       "%[1]s.event_date",
+		Migrations:      []string{},
+		Version:         0,
+		IsPartitioned:   true,
+		PartitionLayout: FiveYearPartitions,
 	},
 	RatingKey: {
 		Name: RatingKey,
@@ -340,6 +449,24 @@ CREATE INDEX %[1]s_ticker_idx ON %[1]s(ticker);`,
 );
 
 CREATE INDEX %[1]s_ticker_event_date_idx ON %[1]s(ticker, event_date DESC)`,
+		PrimaryKey:    []string{"analyst", "composite_figi", "event_date"},
+		Migrations:    []string{},
+		Version:       0,
+		IsPartitioned: false,
+	},
+	SymbologyKey: {
+		Name: SymbologyKey,
+		Schema: `CREATE TABLE %[1]s (
+	composite_figi CHARACTER(12) NOT NULL,
+	id_type        TEXT          NOT NULL,
+	value          TEXT          NOT NULL,
+	valid_from     DATE          NOT NULL,
+	valid_to       DATE,
+	PRIMARY KEY (composite_figi, id_type, value, valid_from)
+);
+
+CREATE INDEX %[1]s_value_idx ON %[1]s(id_type, value, valid_from DESC);`,
+		PrimaryKey:    []string{"composite_figi", "id_type", "value", "valid_from"},
 		Migrations:    []string{},
 		Version:       0,
 		IsPartitioned: false,
@@ -350,3 +477,12 @@ CREATE INDEX %[1]s_ticker_event_date_idx ON %[1]s(ticker, event_date DESC)`,
 func (dt *DataType) ExpandedSchema(tableName string) string {
 	return fmt.Sprintf(dt.Schema, tableName)
 }
+
+// ExpandedMigrations returns the migrations of the data type with the table name filled in
+func (dt *DataType) ExpandedMigrations(tableName string) []string {
+	migrations := make([]string, len(dt.Migrations))
+	for idx, migration := range dt.Migrations {
+		migrations[idx] = fmt.Sprintf(migration, tableName)
+	}
+	return migrations
+}
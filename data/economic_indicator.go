@@ -20,7 +20,7 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/rs/zerolog/log"
+	"github.com/rs/zerolog"
 )
 
 type EconomicIndicator struct {
@@ -30,6 +30,8 @@ type EconomicIndicator struct {
 }
 
 func (ind *EconomicIndicator) SaveDB(ctx context.Context, tbl string, dbConn *pgxpool.Conn) error {
+	logger := zerolog.Ctx(ctx)
+
 	if ind.Series == "" {
 		return nil
 	}
@@ -41,7 +43,7 @@ func (ind *EconomicIndicator) SaveDB(ctx context.Context, tbl string, dbConn *pg
 
 	defer func() {
 		if err := tx.Commit(ctx); err != nil {
-			log.Error().Err(err).Msg("error committing asset transaction to database")
+			logger.Error().Err(err).Msg("error committing asset transaction to database")
 		}
 	}()
 
@@ -57,9 +59,9 @@ func (ind *EconomicIndicator) SaveDB(ctx context.Context, tbl string, dbConn *pg
 	_, err = tx.Exec(ctx, sql, ind.Series, ind.EventDate, ind.Value)
 
 	if err != nil {
-		log.Error().Err(err).Str("SQL", sql).Msg("save economic indicator to DB failed")
+		logger.Error().Err(err).Str("SQL", sql).Msg("save economic indicator to DB failed")
 		if err2 := tx.Rollback(ctx); err2 != nil {
-			log.Error().Err(err).Msg("error rollingback tx")
+			logger.Error().Err(err).Msg("error rollingback tx")
 		}
 	}
 
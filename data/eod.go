@@ -20,7 +20,7 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/rs/zerolog/log"
+	"github.com/rs/zerolog"
 )
 
 type Eod struct {
@@ -37,6 +37,8 @@ type Eod struct {
 }
 
 func (eod *Eod) SaveDB(ctx context.Context, tbl string, dbConn *pgxpool.Conn) error {
+	logger := zerolog.Ctx(ctx)
+
 	tx, err := dbConn.Begin(ctx)
 	if err != nil {
 		return err
@@ -44,10 +46,12 @@ func (eod *Eod) SaveDB(ctx context.Context, tbl string, dbConn *pgxpool.Conn) er
 
 	defer func() {
 		if err := tx.Commit(ctx); err != nil {
-			log.Error().Err(err).Msg("error committing eod transaction to database")
+			logger.Error().Err(err).Msg("error committing eod transaction to database")
 		}
 	}()
 
+	// adj_close is the close scaled by every corporate action already applied
+	// to the asset after this date; see AdjustEod
 	sql := fmt.Sprintf(`INSERT INTO %[1]s (
 		"ticker",
 		"composite_figi",
@@ -56,6 +60,7 @@ func (eod *Eod) SaveDB(ctx context.Context, tbl string, dbConn *pgxpool.Conn) er
 		"high",
 		"low",
 		"close",
+		"adj_close",
 		"volume",
 		"dividend",
 		"split_factor"
@@ -67,6 +72,8 @@ func (eod *Eod) SaveDB(ctx context.Context, tbl string, dbConn *pgxpool.Conn) er
 		$5,
 		$6,
 		$7,
+		$7 * coalesce((SELECT exp(sum(ln(factor))) FROM eod_adjustments
+			WHERE table_name = '%[1]s' AND composite_figi = $2 AND event_date > $3), 1),
 		$8,
 		$9,
 		$10
@@ -76,15 +83,21 @@ func (eod *Eod) SaveDB(ctx context.Context, tbl string, dbConn *pgxpool.Conn) er
 		high = EXCLUDED.high,
 		low = EXCLUDED.low,
 		close = EXCLUDED.close,
+		adj_close = EXCLUDED.adj_close,
 		volume = EXCLUDED.volume,
 		dividend = EXCLUDED.dividend,
-		split_factor = EXCLUDED.split_factor;`, tbl)
+		split_factor = EXCLUDED.split_factor,
+		total_return = CASE
+			WHEN (%[1]s.close, %[1]s.dividend, %[1]s.split_factor) IS DISTINCT FROM
+				(EXCLUDED.close, EXCLUDED.dividend, EXCLUDED.split_factor) THEN NULL
+			ELSE %[1]s.total_return
+		END;`, tbl)
 
 	_, err = tx.Exec(ctx, sql, eod.Ticker, eod.CompositeFigi, eod.Date,
 		eod.Open, eod.High, eod.Low, eod.Close, eod.Volume, eod.Dividend,
 		eod.Split)
 	if err != nil {
-		log.Error().Err(err).Str("SQL", sql).Msg("error saving EOD quote to database")
+		logger.Error().Err(err).Str("SQL", sql).Msg("error saving EOD quote to database")
 	}
 
 	return nil
@@ -0,0 +1,379 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
+)
+
+// AdjustOptions control how corporate actions are applied to an EOD table
+type AdjustOptions struct {
+	// Full discards all previously applied actions and recomputes the
+	// adjusted close from scratch
+	Full bool
+
+	// TotalReturn maintains the total_return index in addition to adj_close
+	TotalReturn bool
+
+	// CompositeFigis limits the adjustment to the listed assets; when empty
+	// every asset in the table is considered
+	CompositeFigis []string
+}
+
+type corporateAction struct {
+	CompositeFigi string
+	EventDate     time.Time
+	Dividend      float64
+	SplitFactor   float64
+	PrevClose     float64
+}
+
+// AdjustmentFactor returns the multiplier applied to every price before the
+// ex-date of a corporate action. Dividends are adjusted relative to the close
+// on the prior trading day and splits by the inverse of the split factor.
+func AdjustmentFactor(prevClose, dividend, splitFactor float64) float64 {
+	factor := 1.0
+	if dividend != 0 && prevClose > 0 {
+		factor = 1.0 - dividend/prevClose
+	}
+
+	if splitFactor > 0 {
+		factor /= splitFactor
+	}
+
+	return factor
+}
+
+// TotalReturnFactor returns the growth of a position held from the prior
+// close through today's close with dividends reinvested
+func TotalReturnFactor(prevClose, close, dividend, splitFactor float64) float64 {
+	if prevClose <= 0 {
+		return 1.0
+	}
+
+	if splitFactor <= 0 {
+		splitFactor = 1.0
+	}
+
+	return (close + dividend) * splitFactor / prevClose
+}
+
+// AdjustEod applies any splits and dividends in the EOD table `tbl` that have
+// not yet been accounted for in adj_close. Only rows preceding a newly
+// applied action of the affected asset are rewritten. Applied actions are
+// tracked in the eod_adjustments table; if a previously applied action
+// changes the asset is recomputed from scratch. Returns the number of actions
+// applied.
+func AdjustEod(ctx context.Context, tbl string, dbConn *pgxpool.Conn, opts AdjustOptions) (int, error) {
+	if opts.Full {
+		if err := resetAdjustments(ctx, tbl, dbConn, opts.CompositeFigis); err != nil {
+			return 0, err
+		}
+	} else {
+		changed, err := changedAdjustments(ctx, tbl, dbConn)
+		if err != nil {
+			return 0, err
+		}
+
+		if len(changed) > 0 {
+			zerolog.Ctx(ctx).Info().Str("Table", tbl).Int("NumAssets", len(changed)).Msg("corporate actions changed; recomputing adjusted close")
+			if err := resetAdjustments(ctx, tbl, dbConn, changed); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	actions, err := pendingActions(ctx, tbl, dbConn, opts.CompositeFigis)
+	if err != nil {
+		return 0, err
+	}
+
+	// group actions by asset so that each asset's history is rewritten once
+	byFigi := make(map[string][]*corporateAction)
+	for _, action := range actions {
+		byFigi[action.CompositeFigi] = append(byFigi[action.CompositeFigi], action)
+	}
+
+	for figi, assetActions := range byFigi {
+		if err := applyActions(ctx, tbl, dbConn, figi, assetActions); err != nil {
+			return 0, err
+		}
+	}
+
+	if opts.TotalReturn {
+		if err := updateTotalReturn(ctx, tbl, dbConn, opts.CompositeFigis); err != nil {
+			return len(actions), err
+		}
+	}
+
+	return len(actions), nil
+}
+
+// changedAdjustments returns the assets with applied actions that no longer
+// match the values in the EOD table
+func changedAdjustments(ctx context.Context, tbl string, dbConn *pgxpool.Conn) ([]string, error) {
+	logger := zerolog.Ctx(ctx)
+
+	sql := fmt.Sprintf(`SELECT DISTINCT a.composite_figi
+	FROM eod_adjustments a
+	LEFT JOIN %[1]s t ON t.composite_figi = a.composite_figi AND t.event_date = a.event_date
+	WHERE a.table_name = $1 AND (
+		t.composite_figi IS NULL OR
+		t.dividend <> a.dividend OR
+		t.split_factor <> a.split_factor
+	)`, tbl)
+
+	rows, err := dbConn.Query(ctx, sql, tbl)
+	if err != nil {
+		logger.Error().Err(err).Str("SQL", sql).Msg("could not query changed corporate actions")
+		return nil, err
+	}
+
+	figis, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		logger.Error().Err(err).Msg("could not scan changed corporate actions")
+		return nil, err
+	}
+
+	return figis, nil
+}
+
+// resetAdjustments sets adj_close back to close and forgets all applied
+// actions for the given assets (or the entire table if figis is empty)
+func resetAdjustments(ctx context.Context, tbl string, dbConn *pgxpool.Conn, figis []string) error {
+	tx, err := dbConn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			zerolog.Ctx(ctx).Error().Err(err).Msg("error rolling back reset adjustments transaction")
+		}
+	}()
+
+	if len(figis) == 0 {
+		if _, err := tx.Exec(ctx, fmt.Sprintf("UPDATE %s SET adj_close = close, total_return = NULL", tbl)); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, "DELETE FROM eod_adjustments WHERE table_name = $1", tbl); err != nil {
+			return err
+		}
+	} else {
+		if _, err := tx.Exec(ctx, fmt.Sprintf("UPDATE %s SET adj_close = close, total_return = NULL WHERE composite_figi = ANY($1)", tbl), figis); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, "DELETE FROM eod_adjustments WHERE table_name = $1 AND composite_figi = ANY($2)", tbl, figis); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// pendingActions returns splits and dividends that have not been applied
+func pendingActions(ctx context.Context, tbl string, dbConn *pgxpool.Conn, figis []string) ([]*corporateAction, error) {
+	logger := zerolog.Ctx(ctx)
+
+	sql := fmt.Sprintf(`SELECT
+		t.composite_figi,
+		t.event_date,
+		t.dividend::float8,
+		t.split_factor::float8,
+		coalesce((SELECT p.close::float8 FROM %[1]s p
+			WHERE p.composite_figi = t.composite_figi AND p.event_date < t.event_date
+			ORDER BY p.event_date DESC LIMIT 1), 0) AS prev_close
+	FROM %[1]s t
+	LEFT JOIN eod_adjustments a ON a.table_name = $1 AND a.composite_figi = t.composite_figi AND a.event_date = t.event_date
+	WHERE (t.dividend <> 0 OR t.split_factor <> 1) AND a.composite_figi IS NULL AND
+		(cardinality($2::text[]) = 0 OR t.composite_figi = ANY($2))
+	ORDER BY t.composite_figi, t.event_date`, tbl)
+
+	if figis == nil {
+		figis = []string{}
+	}
+
+	rows, err := dbConn.Query(ctx, sql, tbl, figis)
+	if err != nil {
+		logger.Error().Err(err).Str("SQL", sql).Msg("could not query pending corporate actions")
+		return nil, err
+	}
+
+	actions, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*corporateAction, error) {
+		action := &corporateAction{}
+		err := row.Scan(&action.CompositeFigi, &action.EventDate, &action.Dividend, &action.SplitFactor, &action.PrevClose)
+		return action, err
+	})
+	if err != nil {
+		logger.Error().Err(err).Msg("could not scan pending corporate actions")
+		return nil, err
+	}
+
+	return actions, nil
+}
+
+// applyActions records the actions of a single asset and scales adj_close of
+// every row preceding them by the new actions' factors. Rows already carry the
+// factors of previously applied actions so they are not recomputed.
+func applyActions(ctx context.Context, tbl string, dbConn *pgxpool.Conn, figi string, actions []*corporateAction) error {
+	logger := zerolog.Ctx(ctx)
+
+	tx, err := dbConn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			logger.Error().Err(err).Msg("error rolling back apply actions transaction")
+		}
+	}()
+
+	latest := actions[0].EventDate
+	applied := make([]time.Time, 0, len(actions))
+	for _, action := range actions {
+		factor := AdjustmentFactor(action.PrevClose, action.Dividend, action.SplitFactor)
+		if factor <= 0 {
+			logger.Warn().Str("CompositeFigi", figi).Time("EventDate", action.EventDate).
+				Float64("Dividend", action.Dividend).Float64("PrevClose", action.PrevClose).
+				Float64("SplitFactor", action.SplitFactor).Msg("ignoring corporate action with a non-positive adjustment factor")
+			factor = 1.0
+		}
+
+		if _, err := tx.Exec(ctx, `INSERT INTO eod_adjustments
+			("table_name", "composite_figi", "event_date", "dividend", "split_factor", "factor")
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			tbl, figi, action.EventDate, action.Dividend, action.SplitFactor, factor); err != nil {
+			return err
+		}
+
+		applied = append(applied, action.EventDate)
+		if action.EventDate.After(latest) {
+			latest = action.EventDate
+		}
+	}
+
+	sql := fmt.Sprintf(`UPDATE %[1]s t SET adj_close = t.adj_close * coalesce((
+		SELECT exp(sum(ln(a.factor))) FROM eod_adjustments a
+		WHERE a.table_name = $1 AND a.composite_figi = t.composite_figi AND a.event_date > t.event_date
+			AND a.event_date = ANY($4)), 1)
+	WHERE t.composite_figi = $2 AND t.event_date < $3`, tbl)
+
+	if _, err := tx.Exec(ctx, sql, tbl, figi, latest, applied); err != nil {
+		logger.Error().Err(err).Str("SQL", sql).Str("CompositeFigi", figi).Msg("could not update adjusted close")
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// updateTotalReturn computes the total return index for rows that do not have
+// one yet. Each asset is recomputed from the day before its earliest missing
+// value so that back-filled history is handled correctly.
+func updateTotalReturn(ctx context.Context, tbl string, dbConn *pgxpool.Conn, figis []string) error {
+	if figis == nil {
+		figis = []string{}
+	}
+
+	sql := fmt.Sprintf(`SELECT composite_figi, min(event_date) FROM %s
+	WHERE total_return IS NULL AND (cardinality($1::text[]) = 0 OR composite_figi = ANY($1))
+	GROUP BY composite_figi`, tbl)
+
+	rows, err := dbConn.Query(ctx, sql, figis)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Str("SQL", sql).Msg("could not query assets missing total return")
+		return err
+	}
+
+	type missing struct {
+		CompositeFigi string
+		Since         time.Time
+	}
+
+	todo, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (missing, error) {
+		var m missing
+		err := row.Scan(&m.CompositeFigi, &m.Since)
+		return m, err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, item := range todo {
+		if err := updateAssetTotalReturn(ctx, tbl, dbConn, item.CompositeFigi, item.Since); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func updateAssetTotalReturn(ctx context.Context, tbl string, dbConn *pgxpool.Conn, figi string, since time.Time) error {
+	var (
+		prevClose float64
+		index     float64
+	)
+
+	// anchor the index on the last known value
+	err := dbConn.QueryRow(ctx, fmt.Sprintf(`SELECT close::float8, total_return FROM %s
+	WHERE composite_figi = $1 AND event_date < $2 AND total_return IS NOT NULL
+	ORDER BY event_date DESC LIMIT 1`, tbl), figi, since).Scan(&prevClose, &index)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	rows, err := dbConn.Query(ctx, fmt.Sprintf(`SELECT event_date, close::float8, dividend::float8, split_factor::float8
+	FROM %s WHERE composite_figi = $1 AND event_date >= $2 ORDER BY event_date`, tbl), figi, since)
+	if err != nil {
+		return err
+	}
+
+	type quote struct {
+		EventDate   time.Time
+		Close       float64
+		Dividend    float64
+		SplitFactor float64
+	}
+
+	quotes, err := pgx.CollectRows(rows, pgx.RowToStructByPos[quote])
+	if err != nil {
+		return err
+	}
+
+	batch := &pgx.Batch{}
+	sql := fmt.Sprintf("UPDATE %s SET total_return = $1 WHERE composite_figi = $2 AND event_date = $3", tbl)
+	for _, q := range quotes {
+		if index == 0 {
+			// the index starts at the first close of the asset
+			index = q.Close
+		} else {
+			index *= TotalReturnFactor(prevClose, q.Close, q.Dividend, q.SplitFactor)
+		}
+
+		prevClose = q.Close
+		batch.Queue(sql, index, figi, q.EventDate)
+	}
+
+	return dbConn.SendBatch(ctx, batch).Close()
+}
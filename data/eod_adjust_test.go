@@ -0,0 +1,60 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/penny-vault/pvdata/data"
+)
+
+var _ = Describe("EOD adjustments", func() {
+	Describe("AdjustmentFactor", func() {
+		It("is 1 when there is no corporate action", func() {
+			Expect(data.AdjustmentFactor(100, 0, 1)).To(BeNumerically("~", 1.0, 1e-12))
+		})
+
+		It("scales prices by the inverse of the split factor", func() {
+			Expect(data.AdjustmentFactor(100, 0, 4)).To(BeNumerically("~", 0.25, 1e-12))
+		})
+
+		It("reduces prices by the dividend yield", func() {
+			Expect(data.AdjustmentFactor(50, 1, 1)).To(BeNumerically("~", 0.98, 1e-12))
+		})
+
+		It("combines a split and dividend on the same day", func() {
+			Expect(data.AdjustmentFactor(50, 1, 2)).To(BeNumerically("~", 0.49, 1e-12))
+		})
+
+		It("ignores dividends without a prior close", func() {
+			Expect(data.AdjustmentFactor(0, 1, 1)).To(BeNumerically("~", 1.0, 1e-12))
+		})
+	})
+
+	Describe("TotalReturnFactor", func() {
+		It("is the price return when there is no corporate action", func() {
+			Expect(data.TotalReturnFactor(100, 110, 0, 1)).To(BeNumerically("~", 1.1, 1e-12))
+		})
+
+		It("reinvests dividends", func() {
+			Expect(data.TotalReturnFactor(50, 49, 1, 1)).To(BeNumerically("~", 1.0, 1e-12))
+		})
+
+		It("is neutral across a split", func() {
+			Expect(data.TotalReturnFactor(100, 50, 0, 2)).To(BeNumerically("~", 1.0, 1e-12))
+		})
+	})
+})
@@ -0,0 +1,506 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// ExportManifestVersion is incremented when the layout of the manifest changes
+const ExportManifestVersion = 1
+
+// ExportManifestFile is the name of the manifest written next to the exported files
+const ExportManifestFile = "manifest.json"
+
+type ExportFormat string
+
+const (
+	ExportParquet ExportFormat = "parquet"
+	ExportCSV     ExportFormat = "csv"
+)
+
+// ExportSplit controls how exported rows are divided into files
+type ExportSplit string
+
+const (
+	SplitNone      ExportSplit = "none"
+	SplitYear      ExportSplit = "year"
+	SplitPartition ExportSplit = "partition"
+)
+
+var (
+	ErrUnknownExportFormat = errors.New("unknown export format")
+	ErrUnknownExportSplit  = errors.New("unknown export split")
+	ErrNoDateColumn        = errors.New("table does not have an event_date column")
+	ErrNoTickerColumn      = errors.New("table does not have a ticker column")
+	ErrNotPartitioned      = errors.New("table is not partitioned")
+)
+
+// RowWriter writes rows read with SelectColumns to a file
+type RowWriter interface {
+	Write(row []any) error
+	Rows() int64
+	Close() error
+}
+
+// CSVWriter writes rows of any table as CSV with a header. Values use
+// PostgreSQL's text representation and NULLs are empty.
+type CSVWriter struct {
+	columns []*Column
+	writer  *csv.Writer
+	rows    int64
+}
+
+// ExportOptions select the rows that are exported and how they are written
+type ExportOptions struct {
+	Format ExportFormat
+	Split  ExportSplit
+
+	// Start and End (inclusive) limit the event dates exported; zero values are unbounded
+	Start time.Time
+	End   time.Time
+
+	Tickers []string
+}
+
+// ExportSource identifies where exported data came from
+type ExportSource struct {
+	SubscriptionID string `json:"subscription_id"`
+	Subscription   string `json:"subscription"`
+	Provider       string `json:"provider"`
+	Dataset        string `json:"dataset"`
+	DataType       string `json:"data_type"`
+	Table          string `json:"table"`
+}
+
+type ExportFilters struct {
+	Start   string   `json:"start,omitempty"`
+	End     string   `json:"end,omitempty"`
+	Tickers []string `json:"tickers,omitempty"`
+}
+
+// ExportFile describes one file of an export
+type ExportFile struct {
+	Name      string `json:"name"`
+	Rows      int64  `json:"rows"`
+	Size      int64  `json:"size"`
+	SHA256    string `json:"sha256"`
+	FirstDate string `json:"first_date,omitempty"`
+	LastDate  string `json:"last_date,omitempty"`
+}
+
+// ExportManifest describes the schema, coverage and contents of an export
+type ExportManifest struct {
+	Version     int           `json:"version"`
+	Created     time.Time     `json:"created"`
+	Source      ExportSource  `json:"source"`
+	Format      ExportFormat  `json:"format"`
+	Split       ExportSplit   `json:"split"`
+	Filters     ExportFilters `json:"filters"`
+	Columns     []*Column     `json:"columns"`
+	Files       []*ExportFile `json:"files"`
+	Rows        int64         `json:"rows"`
+	FirstDate   string        `json:"first_date,omitempty"`
+	LastDate    string        `json:"last_date,omitempty"`
+	ContentHash string        `json:"content_hash"`
+}
+
+// ParseExportFormat returns the export format named by `val`
+func ParseExportFormat(val string) (ExportFormat, error) {
+	format := ExportFormat(strings.ToLower(val))
+	switch format {
+	case ExportParquet, ExportCSV:
+		return format, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnknownExportFormat, val)
+	}
+}
+
+// ParseExportSplit returns the export split named by `val`
+func ParseExportSplit(val string) (ExportSplit, error) {
+	split := ExportSplit(strings.ToLower(val))
+	switch split {
+	case SplitNone, SplitYear, SplitPartition:
+		return split, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnknownExportSplit, val)
+	}
+}
+
+// NewCSVWriter creates a CSV writer for rows of `columns` and writes the header
+func NewCSVWriter(w io.Writer, columns []*Column) (*CSVWriter, error) {
+	cw := &CSVWriter{
+		columns: columns,
+		writer:  csv.NewWriter(w),
+	}
+
+	header := make([]string, len(columns))
+	for idx, column := range columns {
+		header[idx] = column.Name
+	}
+
+	return cw, cw.writer.Write(header)
+}
+
+// Write adds a row; values are in column order as read with SelectColumns
+func (cw *CSVWriter) Write(row []any) error {
+	record := make([]string, len(row))
+	for idx, val := range row {
+		record[idx], _ = cw.columns[idx].Text(val)
+	}
+
+	cw.rows++
+	return cw.writer.Write(record)
+}
+
+// Rows returns the number of rows written
+func (cw *CSVWriter) Rows() int64 {
+	return cw.rows
+}
+
+// Close flushes buffered rows; the underlying writer is not closed
+func (cw *CSVWriter) Close() error {
+	cw.writer.Flush()
+	return cw.writer.Error()
+}
+
+// NewRowWriter creates a writer for the export format
+func NewRowWriter(format ExportFormat, w io.Writer, columns []*Column) (RowWriter, error) {
+	switch format {
+	case ExportParquet:
+		return NewParquetWriter(w, columns)
+	case ExportCSV:
+		return NewCSVWriter(w, columns)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownExportFormat, format)
+	}
+}
+
+// YearRanges returns a range for every calendar year from `first` through `last`
+func YearRanges(table string, first, last time.Time) []*Partition {
+	ranges := make([]*Partition, 0)
+	for year := first.Year(); year <= last.Year(); year++ {
+		ranges = append(ranges, &Partition{
+			Name:  fmt.Sprintf("%s_%d", table, year),
+			Start: time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC),
+			End:   time.Date(year+1, 1, 1, 0, 0, 0, 0, time.UTC),
+		})
+	}
+	return ranges
+}
+
+// ComputeHash returns a hash of the names and hashes of the manifest's files
+func (manifest *ExportManifest) ComputeHash() string {
+	files := make([]string, len(manifest.Files))
+	for idx, file := range manifest.Files {
+		files[idx] = fmt.Sprintf("%s  %s\n", file.SHA256, file.Name)
+	}
+	sort.Strings(files)
+
+	digest := sha256.Sum256([]byte(strings.Join(files, "")))
+	return hex.EncodeToString(digest[:])
+}
+
+// exportQuery builds the where clause selecting rows matching `opts`
+type exportQuery struct {
+	columns    []*Column
+	dateIdx    int
+	conditions []string
+	args       []any
+}
+
+func (query *exportQuery) add(condition string, arg any) {
+	query.args = append(query.args, arg)
+	query.conditions = append(query.conditions, fmt.Sprintf(condition, len(query.args)))
+}
+
+func (query *exportQuery) where(extra ...string) string {
+	conditions := append(slices.Clone(query.conditions), extra...)
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// Export writes the rows of `table` selected by `opts` to `dir` of `filer`
+// followed by a manifest describing them
+func Export(ctx context.Context, dbConn Querier, table string, source ExportSource, opts ExportOptions, filer Filer, dir string) (*ExportManifest, error) {
+	logger := zerolog.Ctx(ctx)
+
+	columns, err := TableColumns(ctx, dbConn, table)
+	if err != nil {
+		return nil, err
+	}
+
+	query := &exportQuery{
+		columns: columns,
+		dateIdx: slices.IndexFunc(columns, func(column *Column) bool { return column.Name == "event_date" }),
+	}
+
+	manifest := &ExportManifest{
+		Version: ExportManifestVersion,
+		Created: time.Now().UTC(),
+		Source:  source,
+		Format:  opts.Format,
+		Split:   opts.Split,
+		Columns: columns,
+		Files:   make([]*ExportFile, 0),
+		Filters: ExportFilters{Tickers: opts.Tickers},
+	}
+
+	if !opts.Start.IsZero() || !opts.End.IsZero() || opts.Split == SplitYear {
+		if query.dateIdx < 0 {
+			return nil, fmt.Errorf("%w: %s", ErrNoDateColumn, table)
+		}
+	}
+
+	if !opts.Start.IsZero() {
+		query.add("event_date >= $%d", opts.Start)
+		manifest.Filters.Start = opts.Start.Format("2006-01-02")
+	}
+
+	if !opts.End.IsZero() {
+		query.add("event_date <= $%d", opts.End)
+		manifest.Filters.End = opts.End.Format("2006-01-02")
+	}
+
+	if len(opts.Tickers) > 0 {
+		if !slices.ContainsFunc(columns, func(column *Column) bool { return column.Name == "ticker" }) {
+			return nil, fmt.Errorf("%w: %s", ErrNoTickerColumn, table)
+		}
+		query.add("ticker = ANY($%d)", opts.Tickers)
+	}
+
+	var ranges []*Partition
+	switch opts.Split {
+	case SplitYear:
+		first, last, err := query.dateRange(ctx, dbConn, table)
+		if err != nil {
+			return nil, err
+		}
+
+		if !first.IsZero() {
+			ranges = YearRanges(table, first, last)
+		}
+	case SplitPartition:
+		ranges, err = ListPartitions(ctx, dbConn, table)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(ranges) == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrNotPartitioned, table)
+		}
+	default:
+		ranges = []*Partition{{Name: table}}
+	}
+
+	for _, slice := range ranges {
+		// skip slices entirely outside of the requested dates
+		if !slice.End.IsZero() && !opts.Start.IsZero() && !slice.End.After(opts.Start) {
+			continue
+		}
+
+		if !slice.Start.IsZero() && !opts.End.IsZero() && slice.Start.After(opts.End) {
+			continue
+		}
+
+		// split exports leave out empty years and partitions
+		file, err := query.save(ctx, dbConn, table, source.DataType, slice, opts.Format, filer, dir, opts.Split == SplitNone)
+		if err != nil {
+			return nil, err
+		}
+
+		if file == nil {
+			continue
+		}
+
+		manifest.Files = append(manifest.Files, file)
+		manifest.Rows += file.Rows
+		if file.FirstDate != "" && (manifest.FirstDate == "" || file.FirstDate < manifest.FirstDate) {
+			manifest.FirstDate = file.FirstDate
+		}
+		if file.LastDate > manifest.LastDate {
+			manifest.LastDate = file.LastDate
+		}
+	}
+
+	manifest.ContentHash = manifest.ComputeHash()
+
+	contents, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := filer.CreateFile(path.Join(dir, ExportManifestFile), contents); err != nil {
+		logger.Error().Err(err).Msg("could not save export manifest")
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// dateRange returns the first and last event date of rows matching the query
+func (query *exportQuery) dateRange(ctx context.Context, dbConn Querier, table string) (time.Time, time.Time, error) {
+	sql := fmt.Sprintf("SELECT min(event_date), max(event_date) FROM %s%s", table, query.where())
+	rows, err := dbConn.Query(ctx, sql, query.args...)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Str("SQL", sql).Msg("could not get date range of export")
+		return time.Time{}, time.Time{}, err
+	}
+	defer rows.Close()
+
+	var first, last *time.Time
+	for rows.Next() {
+		if err := rows.Scan(&first, &last); err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+	}
+
+	if first == nil || last == nil {
+		return time.Time{}, time.Time{}, rows.Err()
+	}
+
+	return *first, *last, rows.Err()
+}
+
+// save exports the rows of `slice` to a temporary file and then saves it to
+// `dir` of `filer` so that large exports are never held in memory. Slices
+// without rows are not saved, and nil is returned, unless `keepEmpty` is set.
+func (query *exportQuery) save(ctx context.Context, dbConn Querier, table, dataType string, slice *Partition, format ExportFormat,
+	filer Filer, dir string, keepEmpty bool) (*ExportFile, error) {
+	tmp, err := os.CreateTemp("", "pvdata-export-*."+string(format))
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	file, err := query.write(ctx, dbConn, table, dataType, slice, format, tmp)
+	if err != nil {
+		return nil, err
+	}
+
+	if file.Rows == 0 && !keepEmpty {
+		return nil, nil
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	if _, err := filer.SaveFile(path.Join(dir, file.Name), tmp, file.Size); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Str("File", file.Name).Msg("could not save export file")
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// write exports the rows of `slice` into `out`
+func (query *exportQuery) write(ctx context.Context, dbConn Querier, table, dataType string, slice *Partition, format ExportFormat, out *os.File) (*ExportFile, error) {
+	extra := make([]string, 0, 2)
+	args := slices.Clone(query.args)
+	if !slice.Start.IsZero() {
+		args = append(args, slice.Start)
+		extra = append(extra, fmt.Sprintf("event_date >= $%d", len(args)))
+	}
+	if !slice.End.IsZero() {
+		args = append(args, slice.End)
+		extra = append(extra, fmt.Sprintf("event_date < $%d", len(args)))
+	}
+
+	sql := fmt.Sprintf("SELECT %s FROM %s%s", SelectColumns(query.columns), table, query.where(extra...))
+	if dt, ok := DataTypes[dataType]; ok && len(dt.PrimaryKey) > 0 {
+		// a stable order makes exports of unchanged data byte-for-byte identical
+		sql = fmt.Sprintf("%s ORDER BY %s", sql, strings.Join(dt.PrimaryKey, ", "))
+	}
+
+	rows, err := dbConn.Query(ctx, sql, args...)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Str("SQL", sql).Msg("could not read rows to export")
+		return nil, err
+	}
+	defer rows.Close()
+
+	hash := sha256.New()
+	rowWriter, err := NewRowWriter(format, io.MultiWriter(out, hash), query.columns)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &ExportFile{
+		Name: fmt.Sprintf("%s.%s", slice.Name, format),
+	}
+
+	var first, last time.Time
+	for rows.Next() {
+		vals, err := rows.Values()
+		if err != nil {
+			return nil, err
+		}
+
+		if query.dateIdx >= 0 {
+			if dt, ok := vals[query.dateIdx].(time.Time); ok {
+				if first.IsZero() || dt.Before(first) {
+					first = dt
+				}
+				if dt.After(last) {
+					last = dt
+				}
+			}
+		}
+
+		if err := rowWriter.Write(vals); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := rowWriter.Close(); err != nil {
+		return nil, err
+	}
+
+	if file.Size, err = out.Seek(0, io.SeekCurrent); err != nil {
+		return nil, err
+	}
+
+	file.Rows = rowWriter.Rows()
+	file.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	if !first.IsZero() {
+		file.FirstDate = first.Format("2006-01-02")
+		file.LastDate = last.Format("2006-01-02")
+	}
+
+	return file, nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data_test
+
+import (
+	"bytes"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/penny-vault/pvdata/data"
+)
+
+var _ = Describe("Export", func() {
+	It("parses formats and splits", func() {
+		format, err := data.ParseExportFormat("CSV")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(format).To(Equal(data.ExportCSV))
+
+		_, err = data.ParseExportFormat("xlsx")
+		Expect(err).To(MatchError(data.ErrUnknownExportFormat))
+
+		split, err := data.ParseExportSplit("year")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(split).To(Equal(data.SplitYear))
+
+		_, err = data.ParseExportSplit("month")
+		Expect(err).To(MatchError(data.ErrUnknownExportSplit))
+	})
+
+	It("writes CSV with a header and empty NULLs", func() {
+		columns := []*data.Column{
+			{Name: "ticker", Kind: data.TextColumn},
+			{Name: "event_date", Kind: data.DateColumn},
+			{Name: "close", Kind: data.TextColumn},
+			{Name: "volume", Kind: data.IntColumn},
+		}
+
+		buf := &bytes.Buffer{}
+		cw, err := data.NewCSVWriter(buf, columns)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cw.Write([]any{"SPY", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), "512.8500", int64(76844800)})).To(Succeed())
+		Expect(cw.Write([]any{"VFIAX", time.Date(1999, 12, 31, 0, 0, 0, 0, time.UTC), nil, nil})).To(Succeed())
+		Expect(cw.Close()).To(Succeed())
+
+		Expect(cw.Rows()).To(Equal(int64(2)))
+		Expect(buf.String()).To(Equal("ticker,event_date,close,volume\nSPY,2024-03-01,512.8500,76844800\nVFIAX,1999-12-31,,\n"))
+	})
+
+	It("splits date ranges into calendar years", func() {
+		ranges := data.YearRanges("eod", time.Date(2022, 6, 30, 0, 0, 0, 0, time.UTC), time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC))
+		Expect(partitionNames(ranges)).To(Equal([]string{"eod_2022", "eod_2023", "eod_2024"}))
+		Expect(ranges[1].Start).To(Equal(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)))
+		Expect(ranges[1].End).To(Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)))
+	})
+
+	It("hashes the manifest's files independent of their order", func() {
+		a := &data.ExportFile{Name: "eod_2023.parquet", SHA256: "aa"}
+		b := &data.ExportFile{Name: "eod_2024.parquet", SHA256: "bb"}
+
+		first := &data.ExportManifest{Files: []*data.ExportFile{a, b}}
+		second := &data.ExportManifest{Files: []*data.ExportFile{b, a}}
+		Expect(first.ComputeHash()).To(Equal(second.ComputeHash()))
+
+		changed := &data.ExportManifest{Files: []*data.ExportFile{a, {Name: "eod_2024.parquet", SHA256: "cc"}}}
+		Expect(changed.ComputeHash()).ToNot(Equal(first.ComputeHash()))
+	})
+})
@@ -15,31 +15,221 @@
 package data
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
 	"os"
 	"path"
+	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 )
 
+// Filer stores files such as asset logos and partition archives. Names are
+// slash separated paths relative to the filer's location.
 type Filer interface {
+	// CreateFile saves the file, replacing any existing file, and returns its full location
 	CreateFile(name string, data []byte) (string, error)
+
+	// SaveFile saves `size` bytes read from r, replacing any existing file, and
+	// returns its full location. The contents are streamed rather than held in
+	// memory so it suits large files such as partition archives.
+	SaveFile(name string, r io.Reader, size int64) (string, error)
+
+	// ReadFile returns the contents of the file; missing files return an error wrapping fs.ErrNotExist
+	ReadFile(name string) ([]byte, error)
+
+	// OpenFile returns a reader of the file's contents that must be closed;
+	// missing files return an error wrapping fs.ErrNotExist
+	OpenFile(name string) (io.ReadCloser, error)
+
+	// ListFiles returns the sorted names of files starting with `prefix`
+	ListFiles(prefix string) ([]string, error)
+
+	// DeleteFile removes the file
+	DeleteFile(name string) error
+}
+
+// FilerFactory creates a filer for a location such as s3://bucket/prefix
+type FilerFactory func(location *url.URL) (Filer, error)
+
+var (
+	ErrInvalidFilerSpec   = errors.New("invalid filer location")
+	ErrUnknownFilerScheme = errors.New("unknown filer scheme")
+)
+
+var (
+	filerFactories = make(map[string]FilerFactory)
+	filerMu        sync.RWMutex
+)
+
+func init() {
+	RegisterFiler("file", newFSFiler)
+	RegisterFiler("mem", newMemFiler)
+	RegisterFiler("s3", newS3Filer)
+	RegisterFiler("b2", newB2Filer)
+}
+
+// RegisterFiler makes filers for `scheme` available to NewFilerFromString
+func RegisterFiler(scheme string, factory FilerFactory) {
+	filerMu.Lock()
+	defer filerMu.Unlock()
+	filerFactories[scheme] = factory
+}
+
+// FilerSchemes returns the sorted schemes of every registered filer
+func FilerSchemes() []string {
+	filerMu.RLock()
+	defer filerMu.RUnlock()
+
+	schemes := make([]string, 0, len(filerFactories))
+	for scheme := range filerFactories {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// parseFilerSpec parses the location and finds the factory for its scheme
+func parseFilerSpec(spec string) (*url.URL, FilerFactory, error) {
+	location, err := url.Parse(spec)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s: %w", ErrInvalidFilerSpec, spec, err)
+	}
+
+	if location.Scheme == "" {
+		return nil, nil, fmt.Errorf("%w: %s: missing scheme (e.g. file:///path/)", ErrInvalidFilerSpec, spec)
+	}
+
+	filerMu.RLock()
+	factory, ok := filerFactories[location.Scheme]
+	filerMu.RUnlock()
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %s (supported: %s)", ErrUnknownFilerScheme, location.Scheme, strings.Join(FilerSchemes(), ", "))
+	}
+
+	return location, factory, nil
+}
+
+// ValidateFilerSpec checks that the location is well formed and its scheme is
+// registered without connecting to it
+func ValidateFilerSpec(spec string) error {
+	_, _, err := parseFilerSpec(spec)
+	return err
+}
+
+// NewFilerFromString creates the filer for a location such as file:///path/
+func NewFilerFromString(spec string) (Filer, error) {
+	location, factory, err := parseFilerSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	return factory(location)
+}
+
+// splitBucket returns the bucket and key prefix of locations like s3://bucket/prefix
+func splitBucket(location *url.URL) (string, string, error) {
+	if location.Host == "" {
+		return "", "", fmt.Errorf("%w: %s: missing bucket", ErrInvalidFilerSpec, location.Redacted())
+	}
+
+	prefix := strings.Trim(location.Path, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	return location.Host, prefix, nil
 }
 
 type FSFiler struct {
 	BasePath string
 }
 
+func newFSFiler(location *url.URL) (Filer, error) {
+	// file://relative/path puts the first path element in the host
+	return &FSFiler{
+		BasePath: location.Host + location.Path,
+	}, nil
+}
+
 func (fs *FSFiler) CreateFile(name string, data []byte) (string, error) {
 	filePath := path.Join(fs.BasePath, name)
+	if err := os.MkdirAll(path.Dir(filePath), 0755); err != nil {
+		return filePath, err
+	}
+
 	err := os.WriteFile(filePath, data, 0644)
 	return filePath, err
 }
 
-func NewFilerFromString(spec string) Filer {
-	switch {
-	case strings.HasPrefix(spec, "file://"):
-		return &FSFiler{
-			BasePath: strings.TrimPrefix(spec, "file://"),
+func (fs *FSFiler) SaveFile(name string, r io.Reader, size int64) (string, error) {
+	filePath := path.Join(fs.BasePath, name)
+	if err := os.MkdirAll(path.Dir(filePath), 0755); err != nil {
+		return filePath, err
+	}
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		return filePath, err
+	}
+
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return filePath, err
+	}
+
+	return filePath, file.Close()
+}
+
+func (fs *FSFiler) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(path.Join(fs.BasePath, name))
+}
+
+func (fs *FSFiler) OpenFile(name string) (io.ReadCloser, error) {
+	return os.Open(path.Join(fs.BasePath, name))
+}
+
+func (fs *FSFiler) ListFiles(prefix string) ([]string, error) {
+	names := make([]string, 0)
+	err := filepath.WalkDir(fs.BasePath, func(filePath string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
 		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		name, err := filepath.Rel(fs.BasePath, filePath)
+		if err != nil {
+			return err
+		}
+
+		name = filepath.ToSlash(name)
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+
+		return nil
+	})
+
+	if errors.Is(err, os.ErrNotExist) {
+		return names, nil
 	}
-	return nil
+
+	sort.Strings(names)
+	return names, err
+}
+
+func (fs *FSFiler) DeleteFile(name string) error {
+	return os.Remove(path.Join(fs.BasePath, name))
+}
+
+// notFound wraps fs.ErrNotExist for a missing file
+func notFound(name string) error {
+	return fmt.Errorf("%w: %s", fs.ErrNotExist, name)
 }
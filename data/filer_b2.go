@@ -0,0 +1,168 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/kothar/go-backblaze"
+	"github.com/spf13/viper"
+)
+
+var (
+	ErrNoBackblazeCredentials = errors.New("backblaze credentials are not configured; set backblaze.application_id and backblaze.application_key")
+	ErrBucketNotFound         = errors.New("bucket not found")
+)
+
+// b2ListPageSize is the number of file names requested per page when listing
+const b2ListPageSize = 1000
+
+// B2Filer stores files in a Backblaze B2 bucket
+type B2Filer struct {
+	Prefix string
+
+	bucket *backblaze.Bucket
+}
+
+// newB2Filer creates a filer for b2://bucket/prefix using the backblaze.*
+// credentials also used to upload Zacks data
+func newB2Filer(location *url.URL) (Filer, error) {
+	bucketName, prefix, err := splitBucket(location)
+	if err != nil {
+		return nil, err
+	}
+
+	if viper.GetString("backblaze.application_id") == "" {
+		return nil, ErrNoBackblazeCredentials
+	}
+
+	b2, err := backblaze.NewB2(backblaze.Credentials{
+		KeyID:          viper.GetString("backblaze.application_id"),
+		ApplicationKey: viper.GetString("backblaze.application_key"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	bucket, err := b2.Bucket(bucketName)
+	if err != nil {
+		return nil, err
+	}
+
+	if bucket == nil {
+		return nil, fmt.Errorf("%w: %s", ErrBucketNotFound, bucketName)
+	}
+
+	return &B2Filer{
+		Prefix: prefix,
+		bucket: bucket,
+	}, nil
+}
+
+func (b2 *B2Filer) CreateFile(name string, data []byte) (string, error) {
+	key := b2.Prefix + name
+	_, err := b2.bucket.UploadTypedFile(key, mime.TypeByExtension(path.Ext(name)), map[string]string{}, bytes.NewReader(data))
+	return fmt.Sprintf("b2://%s/%s", b2.bucket.Name, key), err
+}
+
+// SaveFile streams seekable readers, such as files, without buffering them;
+// other readers are buffered in memory to compute the upload's checksum
+func (b2 *B2Filer) SaveFile(name string, r io.Reader, size int64) (string, error) {
+	key := b2.Prefix + name
+	_, err := b2.bucket.UploadTypedFile(key, mime.TypeByExtension(path.Ext(name)), map[string]string{}, r)
+	return fmt.Sprintf("b2://%s/%s", b2.bucket.Name, key), err
+}
+
+func (b2 *B2Filer) OpenFile(name string) (io.ReadCloser, error) {
+	_, reader, err := b2.bucket.DownloadFileByName(b2.Prefix + name)
+	if err != nil {
+		return nil, b2.wrapError(name, err)
+	}
+
+	return reader, nil
+}
+
+func (b2 *B2Filer) ReadFile(name string) ([]byte, error) {
+	_, reader, err := b2.bucket.DownloadFileByName(b2.Prefix + name)
+	if err != nil {
+		return nil, b2.wrapError(name, err)
+	}
+	defer reader.Close()
+
+	return io.ReadAll(reader)
+}
+
+func (b2 *B2Filer) ListFiles(prefix string) ([]string, error) {
+	names := make([]string, 0)
+	start := ""
+	for {
+		resp, err := b2.bucket.ListFileNamesWithPrefix(start, b2ListPageSize, b2.Prefix+prefix, "")
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range resp.Files {
+			names = append(names, strings.TrimPrefix(file.Name, b2.Prefix))
+		}
+
+		if resp.NextFileName == "" {
+			return names, nil
+		}
+		start = resp.NextFileName
+	}
+}
+
+// DeleteFile removes every version of the file
+func (b2 *B2Filer) DeleteFile(name string) error {
+	key := b2.Prefix + name
+	resp, err := b2.bucket.ListFileVersions(key, "", b2ListPageSize)
+	if err != nil {
+		return err
+	}
+
+	deleted := false
+	for _, file := range resp.Files {
+		if file.Name != key {
+			continue
+		}
+
+		if _, err := b2.bucket.DeleteFileVersion(file.Name, file.ID); err != nil {
+			return err
+		}
+		deleted = true
+	}
+
+	if !deleted {
+		return notFound(name)
+	}
+
+	return nil
+}
+
+// wrapError maps missing files to fs.ErrNotExist
+func (b2 *B2Filer) wrapError(name string, err error) error {
+	var b2Err *backblaze.B2Error
+	if errors.As(err, &b2Err) && b2Err.Status == 404 {
+		return notFound(name)
+	}
+	return err
+}
@@ -0,0 +1,123 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemFiler keeps files in memory. Every mem://<name> location in the process
+// shares the same files so they can be read back by another filer.
+type MemFiler struct {
+	Name string
+
+	files map[string][]byte
+	mu    sync.RWMutex
+}
+
+var (
+	memFilers   = make(map[string]*MemFiler)
+	memFilersMu sync.Mutex
+)
+
+func newMemFiler(location *url.URL) (Filer, error) {
+	return NewMemFiler(location.Host + location.Path), nil
+}
+
+// NewMemFiler returns the in-memory filer named `name`
+func NewMemFiler(name string) *MemFiler {
+	memFilersMu.Lock()
+	defer memFilersMu.Unlock()
+
+	if filer, ok := memFilers[name]; ok {
+		return filer
+	}
+
+	filer := &MemFiler{
+		Name:  name,
+		files: make(map[string][]byte),
+	}
+	memFilers[name] = filer
+	return filer
+}
+
+func (mem *MemFiler) CreateFile(name string, data []byte) (string, error) {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	mem.files[name] = slices.Clone(data)
+	return fmt.Sprintf("mem://%s/%s", strings.TrimSuffix(mem.Name, "/"), name), nil
+}
+
+func (mem *MemFiler) SaveFile(name string, r io.Reader, size int64) (string, error) {
+	contents, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+
+	return mem.CreateFile(name, contents)
+}
+
+func (mem *MemFiler) OpenFile(name string) (io.ReadCloser, error) {
+	contents, err := mem.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.NopCloser(bytes.NewReader(contents)), nil
+}
+
+func (mem *MemFiler) ReadFile(name string) ([]byte, error) {
+	mem.mu.RLock()
+	defer mem.mu.RUnlock()
+
+	data, ok := mem.files[name]
+	if !ok {
+		return nil, notFound(name)
+	}
+	return slices.Clone(data), nil
+}
+
+func (mem *MemFiler) ListFiles(prefix string) ([]string, error) {
+	mem.mu.RLock()
+	defer mem.mu.RUnlock()
+
+	names := make([]string, 0)
+	for name := range mem.files {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (mem *MemFiler) DeleteFile(name string) error {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	if _, ok := mem.files[name]; !ok {
+		return notFound(name)
+	}
+	delete(mem.files, name)
+	return nil
+}
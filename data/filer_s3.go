@@ -0,0 +1,161 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/spf13/viper"
+)
+
+// DefaultS3Endpoint is used when neither the location nor s3.endpoint name an endpoint
+const DefaultS3Endpoint = "s3.amazonaws.com"
+
+// S3Filer stores files in an S3 compatible bucket (AWS, MinIO, Wasabi, ...)
+type S3Filer struct {
+	Bucket string
+	Prefix string
+
+	client *minio.Client
+}
+
+// newS3Filer creates a filer for s3://bucket/prefix. The endpoint, region and
+// whether TLS is used come from the location's query parameters (endpoint,
+// region, secure) or the s3.* settings. Credentials are s3.access_key and
+// s3.secret_key, or the standard AWS environment variables.
+func newS3Filer(location *url.URL) (Filer, error) {
+	bucket, prefix, err := splitBucket(location)
+	if err != nil {
+		return nil, err
+	}
+
+	query := location.Query()
+	setting := func(key, defaultVal string) string {
+		if val := query.Get(key); val != "" {
+			return val
+		}
+		if viper.IsSet("s3." + key) {
+			return viper.GetString("s3." + key)
+		}
+		return defaultVal
+	}
+
+	secure, err := strconv.ParseBool(setting("secure", "true"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: secure must be true or false", ErrInvalidFilerSpec, location.Redacted())
+	}
+
+	creds := credentials.NewEnvAWS()
+	if viper.IsSet("s3.access_key") {
+		creds = credentials.NewStaticV4(viper.GetString("s3.access_key"), viper.GetString("s3.secret_key"), "")
+	}
+
+	client, err := minio.New(setting("endpoint", DefaultS3Endpoint), &minio.Options{
+		Creds:  creds,
+		Secure: secure,
+		Region: setting("region", ""),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3Filer{
+		Bucket: bucket,
+		Prefix: prefix,
+		client: client,
+	}, nil
+}
+
+func (s3 *S3Filer) CreateFile(name string, data []byte) (string, error) {
+	key := s3.Prefix + name
+	_, err := s3.client.PutObject(context.Background(), s3.Bucket, key, bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{ContentType: mime.TypeByExtension(path.Ext(name))})
+	return fmt.Sprintf("s3://%s/%s", s3.Bucket, key), err
+}
+
+// SaveFile uploads the file in parts when it is too large for a single request
+func (s3 *S3Filer) SaveFile(name string, r io.Reader, size int64) (string, error) {
+	key := s3.Prefix + name
+	_, err := s3.client.PutObject(context.Background(), s3.Bucket, key, r, size,
+		minio.PutObjectOptions{ContentType: mime.TypeByExtension(path.Ext(name))})
+	return fmt.Sprintf("s3://%s/%s", s3.Bucket, key), err
+}
+
+func (s3 *S3Filer) OpenFile(name string) (io.ReadCloser, error) {
+	obj, err := s3.client.GetObject(context.Background(), s3.Bucket, s3.Prefix+name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s3.wrapError(name, err)
+	}
+
+	// objects are fetched lazily; stat it so missing files are reported now
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		return nil, s3.wrapError(name, err)
+	}
+
+	return obj, nil
+}
+
+func (s3 *S3Filer) ReadFile(name string) ([]byte, error) {
+	obj, err := s3.client.GetObject(context.Background(), s3.Bucket, s3.Prefix+name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s3.wrapError(name, err)
+	}
+	defer obj.Close()
+
+	data, err := io.ReadAll(obj)
+	if err != nil {
+		return nil, s3.wrapError(name, err)
+	}
+	return data, nil
+}
+
+func (s3 *S3Filer) ListFiles(prefix string) ([]string, error) {
+	names := make([]string, 0)
+	for obj := range s3.client.ListObjects(context.Background(), s3.Bucket, minio.ListObjectsOptions{
+		Prefix:    s3.Prefix + prefix,
+		Recursive: true,
+	}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		names = append(names, strings.TrimPrefix(obj.Key, s3.Prefix))
+	}
+
+	// S3 lists keys in lexicographic order
+	return names, nil
+}
+
+func (s3 *S3Filer) DeleteFile(name string) error {
+	return s3.client.RemoveObject(context.Background(), s3.Bucket, s3.Prefix+name, minio.RemoveObjectOptions{})
+}
+
+// wrapError maps missing keys to fs.ErrNotExist
+func (s3 *S3Filer) wrapError(name string, err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return notFound(name)
+	}
+	return err
+}
@@ -0,0 +1,270 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data_test
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/viper"
+
+	"github.com/penny-vault/pvdata/data"
+)
+
+// fakeS3 is a stand-in for an S3 compatible server (like MinIO) that supports
+// the path-style object operations used by S3Filer
+type fakeS3 struct {
+	objects map[string][]byte
+	mu      sync.Mutex
+}
+
+type fakeS3Contents struct {
+	Key          string
+	Size         int
+	ETag         string
+	LastModified string
+}
+
+type fakeS3ListResult struct {
+	XMLName     xml.Name `xml:"ListBucketResult"`
+	Name        string
+	Prefix      string
+	KeyCount    int
+	MaxKeys     int
+	IsTruncated bool
+	Contents    []fakeS3Contents
+}
+
+// readAwsChunked decodes a body sent with a streaming (aws-chunked) signature
+func readAwsChunked(body io.Reader) ([]byte, error) {
+	reader := bufio.NewReader(body)
+	data := make([]byte, 0)
+	for {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		size, _, _ := strings.Cut(strings.TrimSpace(header), ";")
+		n, err := strconv.ParseInt(size, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		if n == 0 {
+			return data, nil
+		}
+
+		chunk := make([]byte, n+2)
+		if _, err := io.ReadFull(reader, chunk); err != nil {
+			return nil, err
+		}
+		data = append(data, chunk[:n]...)
+	}
+}
+
+func (s3 *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s3.mu.Lock()
+	defer s3.mu.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	objectKey := bucket + "/" + key
+
+	switch {
+	case r.Method == http.MethodPut:
+		var body []byte
+		var err error
+		if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+			body, err = readAwsChunked(r.Body)
+		} else {
+			body, err = io.ReadAll(r.Body)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		s3.objects[objectKey] = body
+		w.Header().Set("ETag", `"fake"`)
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodGet && key == "":
+		prefix := r.URL.Query().Get("prefix")
+		result := fakeS3ListResult{Name: bucket, Prefix: prefix, MaxKeys: 1000}
+		for name, body := range s3.objects {
+			if objKey, ok := strings.CutPrefix(name, bucket+"/"); ok && strings.HasPrefix(objKey, prefix) {
+				result.Contents = append(result.Contents, fakeS3Contents{
+					Key: objKey, Size: len(body), ETag: `"fake"`, LastModified: "2024-01-02T03:04:05.000Z",
+				})
+			}
+		}
+		sort.Slice(result.Contents, func(i, j int) bool { return result.Contents[i].Key < result.Contents[j].Key })
+		result.KeyCount = len(result.Contents)
+
+		w.Header().Set("Content-Type", "application/xml")
+		Expect(xml.NewEncoder(w).Encode(result)).To(Succeed())
+	case r.Method == http.MethodGet, r.Method == http.MethodHead:
+		body, ok := s3.objects[objectKey]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message><Key>%s</Key></Error>`, key)
+			return
+		}
+
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Header().Set("ETag", `"fake"`)
+		w.Header().Set("Last-Modified", "Tue, 02 Jan 2024 03:04:05 GMT")
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(body)
+		}
+	case r.Method == http.MethodDelete:
+		delete(s3.objects, objectKey)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+// exerciseFiler runs the operations every filer supports
+func exerciseFiler(filer data.Filer) {
+	_, err := filer.CreateFile("logos/BBG000BHTMY2-logo.svg", []byte("<svg/>"))
+	Expect(err).ToNot(HaveOccurred())
+	_, err = filer.CreateFile("logos/BBG000B9XRY4-logo.png", []byte("png"))
+	Expect(err).ToNot(HaveOccurred())
+	_, err = filer.CreateFile("eod_2000_2005.parquet", []byte("parquet"))
+	Expect(err).ToNot(HaveOccurred())
+
+	contents, err := filer.ReadFile("logos/BBG000BHTMY2-logo.svg")
+	Expect(err).ToNot(HaveOccurred())
+	Expect(string(contents)).To(Equal("<svg/>"))
+
+	names, err := filer.ListFiles("logos/")
+	Expect(err).ToNot(HaveOccurred())
+	Expect(names).To(Equal([]string{"logos/BBG000B9XRY4-logo.png", "logos/BBG000BHTMY2-logo.svg"}))
+
+	Expect(filer.DeleteFile("logos/BBG000B9XRY4-logo.png")).To(Succeed())
+	names, err = filer.ListFiles("")
+	Expect(err).ToNot(HaveOccurred())
+	Expect(names).To(Equal([]string{"eod_2000_2005.parquet", "logos/BBG000BHTMY2-logo.svg"}))
+
+	_, err = filer.ReadFile("logos/BBG000B9XRY4-logo.png")
+	Expect(err).To(MatchError(fs.ErrNotExist))
+
+	_, err = filer.SaveFile("archive/eod_2005_2010.parquet", strings.NewReader("streamed"), int64(len("streamed")))
+	Expect(err).ToNot(HaveOccurred())
+
+	reader, err := filer.OpenFile("archive/eod_2005_2010.parquet")
+	Expect(err).ToNot(HaveOccurred())
+	contents, err = io.ReadAll(reader)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(reader.Close()).To(Succeed())
+	Expect(string(contents)).To(Equal("streamed"))
+
+	_, err = filer.OpenFile("archive/missing.parquet")
+	Expect(err).To(MatchError(fs.ErrNotExist))
+}
+
+var _ = Describe("Filer", func() {
+	It("rejects unknown schemes", func() {
+		Expect(data.ValidateFilerSpec("ftp://example.com/logos")).To(MatchError(data.ErrUnknownFilerScheme))
+		Expect(data.ValidateFilerSpec("/srv/logos")).To(MatchError(data.ErrInvalidFilerSpec))
+
+		_, err := data.NewFilerFromString("ftp://example.com/logos")
+		Expect(err).To(MatchError(data.ErrUnknownFilerScheme))
+	})
+
+	It("validates built-in schemes without connecting", func() {
+		for _, spec := range []string{"file:///srv/logos", "mem://test", "s3://bucket/prefix", "b2://bucket"} {
+			Expect(data.ValidateFilerSpec(spec)).To(Succeed(), spec)
+		}
+	})
+
+	It("creates filers for registered schemes", func() {
+		data.RegisterFiler("test-filer", func(location *url.URL) (data.Filer, error) {
+			return data.NewMemFiler("registered-" + location.Host), nil
+		})
+
+		Expect(data.FilerSchemes()).To(ContainElement("test-filer"))
+
+		filer, err := data.NewFilerFromString("test-filer://logos")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(filer.(*data.MemFiler).Name).To(Equal("registered-logos"))
+	})
+
+	It("stores files on the local filesystem", func() {
+		filer, err := data.NewFilerFromString("file://" + GinkgoT().TempDir())
+		Expect(err).ToNot(HaveOccurred())
+		exerciseFiler(filer)
+	})
+
+	It("stores files in memory shared by location", func() {
+		filer, err := data.NewFilerFromString("mem://filer-test")
+		Expect(err).ToNot(HaveOccurred())
+		exerciseFiler(filer)
+
+		other, err := data.NewFilerFromString("mem://filer-test")
+		Expect(err).ToNot(HaveOccurred())
+		contents, err := other.ReadFile("eod_2000_2005.parquet")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(contents)).To(Equal("parquet"))
+	})
+
+	Context("S3", func() {
+		var (
+			server  *httptest.Server
+			backend *fakeS3
+		)
+
+		BeforeEach(func() {
+			backend = &fakeS3{objects: make(map[string][]byte)}
+			server = httptest.NewServer(backend)
+
+			viper.Set("s3.access_key", "pvdata")
+			viper.Set("s3.secret_key", "pvdata-secret")
+		})
+
+		AfterEach(func() {
+			server.Close()
+			viper.Set("s3.access_key", nil)
+			viper.Set("s3.secret_key", nil)
+		})
+
+		It("stores files under the bucket prefix", func() {
+			endpoint := strings.TrimPrefix(server.URL, "http://")
+			filer, err := data.NewFilerFromString(fmt.Sprintf("s3://pvdata/archive?endpoint=%s&secure=false&region=us-east-1", endpoint))
+			Expect(err).ToNot(HaveOccurred())
+
+			location, err := filer.CreateFile("README", []byte("archive"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(location).To(Equal("s3://pvdata/archive/README"))
+			Expect(backend.objects).To(HaveKeyWithValue("pvdata/archive/README", []byte("archive")))
+			Expect(filer.DeleteFile("README")).To(Succeed())
+
+			exerciseFiler(filer)
+		})
+	})
+})
@@ -20,7 +20,7 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/rs/zerolog/log"
+	"github.com/rs/zerolog"
 )
 
 type Fundamental struct {
@@ -631,6 +631,8 @@ type Fundamental struct {
 }
 
 func (fundamental *Fundamental) SaveDB(ctx context.Context, tbl string, dbConn *pgxpool.Conn) error {
+	logger := zerolog.Ctx(ctx)
+
 	if fundamental.CompositeFigi == "" {
 		return nil
 	}
@@ -642,7 +644,7 @@ func (fundamental *Fundamental) SaveDB(ctx context.Context, tbl string, dbConn *
 
 	defer func() {
 		if err := tx.Commit(ctx); err != nil {
-			log.Error().Err(err).Msg("error committing asset transaction to database")
+			logger.Error().Err(err).Msg("error committing asset transaction to database")
 		}
 	}()
 
@@ -852,7 +854,7 @@ func (fundamental *Fundamental) SaveDB(ctx context.Context, tbl string, dbConn *
 		receivables = EXCLUDED.receivables,
 		accumulated_retained_earnings_deficit = EXCLUDED.accumulated_retained_earnings_deficit,
 		revenues = EXCLUDED.revenues,
-		rand_dexpenses = EXCLUDED.rand_dexpenses,
+		r_and_d_expenses = EXCLUDED.r_and_d_expenses,
 		roa = EXCLUDED.roa,
 		roe = EXCLUDED.roe,
 		roic = EXCLUDED.roic,
@@ -979,9 +981,9 @@ func (fundamental *Fundamental) SaveDB(ctx context.Context, tbl string, dbConn *
 	)
 
 	if err != nil {
-		log.Error().Err(err).Str("SQL", sql).Msg("save fundamental to DB failed")
+		logger.Error().Err(err).Str("SQL", sql).Msg("save fundamental to DB failed")
 		if err2 := tx.Rollback(ctx); err2 != nil {
-			log.Error().Err(err).Msg("error rollingback tx")
+			logger.Error().Err(err).Msg("error rollingback tx")
 		}
 	}
 
@@ -0,0 +1,105 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
+)
+
+// maxGapSpread is the largest distance between two missing days of an asset
+// that are still re-fetched with a single request
+const maxGapSpread = 7 * 24 * time.Hour
+
+var (
+	ErrNoMarketCalendar = errors.New("no market holiday calendar is available")
+)
+
+// Gap is a trading day with no EOD quote for an asset
+type Gap struct {
+	Ticker        string    `db:"ticker"`
+	CompositeFigi string    `db:"composite_figi"`
+	EventDate     time.Time `db:"event_date"`
+}
+
+// FindGaps lists the trading days between start and end (inclusive) that are
+// missing from the EOD table `eodTable` for each asset in `assetTable` that
+// was listed at the time. Trading days are weekdays that are not a full-day
+// NYSE holiday in `holidayTable`, which is required so that holidays are never
+// reported as gaps.
+func FindGaps(ctx context.Context, dbConn *pgxpool.Conn, eodTable, assetTable, holidayTable string, start, end time.Time) ([]*Gap, error) {
+	if holidayTable == "" {
+		return nil, ErrNoMarketCalendar
+	}
+
+	sql := fmt.Sprintf(`WITH windows AS (
+		SELECT DISTINCT ON (composite_figi)
+			ticker,
+			composite_figi,
+			greatest($1::date, coalesce(listed::date, $1::date)) AS start_date,
+			least($2::date, coalesce(delisted::date, $2::date)) AS end_date
+		FROM %[2]s
+		WHERE (active = true OR delisted >= $1) AND coalesce(composite_figi, '') <> ''
+		ORDER BY composite_figi, active DESC
+	)
+	SELECT w.ticker, w.composite_figi, d::date AS event_date
+	FROM windows w
+	CROSS JOIN LATERAL generate_series(w.start_date, w.end_date, interval '1 day') AS d
+	WHERE extract(isodow FROM d) < 6
+		AND d::date NOT IN (SELECT event_date FROM %[3]s WHERE market = 'NYSE' AND NOT early_close)
+		AND NOT EXISTS (SELECT 1 FROM %[1]s e WHERE e.composite_figi = w.composite_figi AND e.event_date = d::date)
+	ORDER BY w.composite_figi, event_date`, eodTable, assetTable, holidayTable)
+
+	var gaps []*Gap
+	if err := pgxscan.Select(ctx, dbConn, &gaps, sql, start, end); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Str("SQL", sql).Msg("could not find gaps in EOD table")
+		return nil, err
+	}
+
+	return gaps, nil
+}
+
+// GapRequests groups gaps, sorted by composite figi and date, into fetch
+// requests. Gaps of the same asset that are close together are combined into
+// a single request.
+func GapRequests(gaps []*Gap) []*FetchRequest {
+	requests := make([]*FetchRequest, 0)
+
+	var last *FetchRequest
+	for _, gap := range gaps {
+		if last != nil && last.CompositeFigi == gap.CompositeFigi && gap.EventDate.Sub(last.End) <= maxGapSpread {
+			if gap.EventDate.After(last.End) {
+				last.End = gap.EventDate
+			}
+			continue
+		}
+
+		last = &FetchRequest{
+			Ticker:        gap.Ticker,
+			CompositeFigi: gap.CompositeFigi,
+			Start:         gap.EventDate,
+			End:           gap.EventDate,
+		}
+		requests = append(requests, last)
+	}
+
+	return requests
+}
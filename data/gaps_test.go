@@ -0,0 +1,69 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/penny-vault/pvdata/data"
+)
+
+var _ = Describe("Gaps", func() {
+	day := func(d int) time.Time {
+		return time.Date(2024, 3, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	It("groups nearby gaps of the same asset into one request", func() {
+		gaps := []*data.Gap{
+			{Ticker: "AAA", CompositeFigi: "BBG000000001", EventDate: day(4)},
+			{Ticker: "AAA", CompositeFigi: "BBG000000001", EventDate: day(5)},
+			{Ticker: "AAA", CompositeFigi: "BBG000000001", EventDate: day(11)},
+			{Ticker: "AAA", CompositeFigi: "BBG000000001", EventDate: day(25)},
+			{Ticker: "BBB", CompositeFigi: "BBG000000002", EventDate: day(25)},
+		}
+
+		requests := data.GapRequests(gaps)
+		Expect(requests).To(HaveLen(3))
+
+		Expect(requests[0].Ticker).To(Equal("AAA"))
+		Expect(requests[0].Start).To(Equal(day(4)))
+		Expect(requests[0].End).To(Equal(day(11)))
+
+		Expect(requests[1].Start).To(Equal(day(25)))
+		Expect(requests[1].End).To(Equal(day(25)))
+
+		Expect(requests[2].CompositeFigi).To(Equal("BBG000000002"))
+	})
+
+	It("requires a market holiday calendar", func() {
+		gaps, err := data.FindGaps(context.Background(), nil, "eod", "asset_master", "", day(1), day(31))
+		Expect(err).To(MatchError(data.ErrNoMarketCalendar))
+		Expect(gaps).To(BeNil())
+	})
+
+	It("carries a fetch scope on the context", func() {
+		_, ok := data.FetchScopeFromContext(context.Background())
+		Expect(ok).To(BeFalse())
+
+		scope := &data.FetchScope{Requests: []*data.FetchRequest{{Ticker: "AAA"}}}
+		found, ok := data.FetchScopeFromContext(data.WithFetchScope(context.Background(), scope))
+		Expect(ok).To(BeTrue())
+		Expect(found).To(Equal(scope))
+	})
+})
@@ -21,7 +21,6 @@ import (
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/log"
 )
 
 type MarketHoliday struct {
@@ -41,6 +40,8 @@ func (holiday *MarketHoliday) MarshalZerologObject(e *zerolog.Event) {
 }
 
 func (holiday *MarketHoliday) SaveDB(ctx context.Context, tbl string, dbConn *pgxpool.Conn) error {
+	logger := zerolog.Ctx(ctx)
+
 	tx, err := dbConn.Begin(ctx)
 	if err != nil {
 		return err
@@ -48,11 +49,11 @@ func (holiday *MarketHoliday) SaveDB(ctx context.Context, tbl string, dbConn *pg
 
 	defer func() {
 		if err := tx.Commit(ctx); err != nil {
-			log.Error().Err(err).Msg("error committing holiday transaction to database")
+			logger.Error().Err(err).Msg("error committing holiday transaction to database")
 		}
 	}()
 
-	log.Debug().Object("MarketHoliday", holiday).Msg("Saving holiday to database")
+	logger.Debug().Object("MarketHoliday", holiday).Msg("Saving holiday to database")
 
 	sql := fmt.Sprintf(`INSERT INTO %[1]s (
 		"holiday",
@@ -70,7 +71,7 @@ func (holiday *MarketHoliday) SaveDB(ctx context.Context, tbl string, dbConn *pg
 	_, err = tx.Exec(ctx, sql, holiday.Name, holiday.EventDate, holiday.Market, holiday.EarlyClose, holiday.CloseTime)
 
 	if err != nil {
-		log.Error().Err(err).Str("SQL", sql).Msg("save market holiday to DB failed")
+		logger.Error().Err(err).Str("SQL", sql).Msg("save market holiday to DB failed")
 		return err
 	}
 
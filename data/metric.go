@@ -21,7 +21,6 @@ import (
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/log"
 )
 
 type Metric struct {
@@ -39,6 +38,8 @@ type Metric struct {
 }
 
 func (metric *Metric) SaveDB(ctx context.Context, tbl string, dbConn *pgxpool.Conn) error {
+	logger := zerolog.Ctx(ctx)
+
 	if metric.Ticker == "" || metric.CompositeFigi == "" {
 		return nil
 	}
@@ -50,7 +51,7 @@ func (metric *Metric) SaveDB(ctx context.Context, tbl string, dbConn *pgxpool.Co
 
 	defer func() {
 		if err := tx.Commit(ctx); err != nil {
-			log.Error().Err(err).Msg("error committing metric transaction to database")
+			logger.Error().Err(err).Msg("error committing metric transaction to database")
 		}
 	}()
 
@@ -94,9 +95,9 @@ func (metric *Metric) SaveDB(ctx context.Context, tbl string, dbConn *pgxpool.Co
 	)
 
 	if err != nil {
-		log.Error().Err(err).Str("SQL", sql).Object("Metric", metric).Msg("save metric to DB failed")
+		logger.Error().Err(err).Str("SQL", sql).Object("Metric", metric).Msg("save metric to DB failed")
 		if err2 := tx.Rollback(ctx); err2 != nil {
-			log.Error().Err(err).Msg("error rollingback tx")
+			logger.Error().Err(err).Msg("error rollingback tx")
 		}
 	}
 
@@ -0,0 +1,166 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+const parquetChunkSize = 10_000
+
+var (
+	ErrParquetColumns = errors.New("parquet file does not have the expected columns")
+)
+
+// ParquetWriter writes rows of any table to a Parquet file
+type ParquetWriter struct {
+	columns []*Column
+	writer  *writer.CSVWriter
+	rows    int64
+}
+
+// parquetSchema returns the Parquet schema of the column
+func (column *Column) parquetSchema() string {
+	var typ string
+	switch column.Kind {
+	case IntColumn:
+		typ = "type=INT64"
+	case FloatColumn:
+		typ = "type=DOUBLE"
+	case BoolColumn:
+		typ = "type=BOOLEAN"
+	case DateColumn:
+		typ = "type=INT32, convertedtype=DATE"
+	case TimestampColumn:
+		typ = "type=INT64, convertedtype=TIMESTAMP_MICROS"
+	default:
+		typ = "type=BYTE_ARRAY, convertedtype=UTF8"
+	}
+
+	return fmt.Sprintf("name=%s, %s, repetitiontype=OPTIONAL", column.Name, typ)
+}
+
+// parquetValue converts a value read with SelectExpr to its Parquet representation
+func (column *Column) parquetValue(val any) any {
+	if tm, ok := val.(time.Time); ok {
+		switch column.Kind {
+		case DateColumn:
+			return int32(tm.Unix() / 86400)
+		case TimestampColumn:
+			return tm.UnixMicro()
+		}
+	}
+	return val
+}
+
+// NewParquetWriter creates a Parquet writer for rows of `columns`
+func NewParquetWriter(w io.Writer, columns []*Column) (*ParquetWriter, error) {
+	schema := make([]string, len(columns))
+	for idx, column := range columns {
+		schema[idx] = column.parquetSchema()
+	}
+
+	pw, err := writer.NewCSVWriterFromWriter(schema, w, 4)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ParquetWriter{
+		columns: columns,
+		writer:  pw,
+	}, nil
+}
+
+// Write adds a row; values are in column order as read with SelectColumns
+func (pw *ParquetWriter) Write(row []any) error {
+	rec := make([]any, len(row))
+	for idx, val := range row {
+		rec[idx] = pw.columns[idx].parquetValue(val)
+	}
+
+	pw.rows++
+	return pw.writer.Write(rec)
+}
+
+// Rows returns the number of rows written
+func (pw *ParquetWriter) Rows() int64 {
+	return pw.rows
+}
+
+// Close finishes the Parquet file; the underlying writer is not closed
+func (pw *ParquetWriter) Close() error {
+	return pw.writer.WriteStop()
+}
+
+// ReadParquet calls `fn` with each row of the Parquet file at `fileName`
+// written by ParquetWriter with `columns`. Rows are read a chunk at a time.
+// Returns the number of rows read.
+func ReadParquet(fileName string, columns []*Column, fn func(row []any) error) (int64, error) {
+	pf, err := local.NewLocalFileReader(fileName)
+	if err != nil {
+		return 0, err
+	}
+	defer pf.Close()
+
+	pr, err := reader.NewParquetColumnReader(pf, 4)
+	if err != nil {
+		return 0, err
+	}
+	defer pr.ReadStop()
+
+	if len(pr.SchemaHandler.SchemaElements)-1 != len(columns) {
+		return 0, ErrParquetColumns
+	}
+
+	numRows := pr.GetNumRows()
+	var read int64
+	for read < numRows {
+		chunk := min(parquetChunkSize, numRows-read)
+
+		values := make([][]any, len(columns))
+		for idx := range columns {
+			vals, _, _, err := pr.ReadColumnByIndex(int64(idx), chunk)
+			if err != nil {
+				return read, err
+			}
+
+			if int64(len(vals)) != chunk {
+				return read, fmt.Errorf("%w: column %s has %d values, expected %d", ErrParquetColumns, columns[idx].Name, len(vals), chunk)
+			}
+			values[idx] = vals
+		}
+
+		for ii := int64(0); ii < chunk; ii++ {
+			row := make([]any, len(columns))
+			for idx := range columns {
+				row[idx] = values[idx][ii]
+			}
+
+			if err := fn(row); err != nil {
+				return read, err
+			}
+			read++
+		}
+	}
+
+	return read, nil
+}
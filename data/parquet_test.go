@@ -0,0 +1,94 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/penny-vault/pvdata/data"
+)
+
+var _ = Describe("Parquet", func() {
+	var columns []*data.Column
+
+	BeforeEach(func() {
+		columns = []*data.Column{
+			{Name: "ticker", SQLType: "character varying(10)", Kind: data.ColumnKindOf("character varying(10)")},
+			{Name: "event_date", SQLType: "date", Kind: data.ColumnKindOf("date")},
+			{Name: "close", SQLType: "numeric(12,4)", Kind: data.ColumnKindOf("numeric(12,4)")},
+			{Name: "volume", SQLType: "bigint", Kind: data.ColumnKindOf("bigint")},
+			{Name: "total_return", SQLType: "double precision", Kind: data.ColumnKindOf("double precision")},
+			{Name: "sp500", SQLType: "boolean", Kind: data.ColumnKindOf("boolean")},
+			{Name: "last_updated", SQLType: "timestamp without time zone", Kind: data.ColumnKindOf("timestamp without time zone")},
+		}
+	})
+
+	It("maps column types to kinds", func() {
+		Expect(columns[0].Kind).To(Equal(data.TextColumn))
+		Expect(columns[1].Kind).To(Equal(data.DateColumn))
+		Expect(columns[2].Kind).To(Equal(data.TextColumn))
+		Expect(columns[3].Kind).To(Equal(data.IntColumn))
+		Expect(columns[4].Kind).To(Equal(data.FloatColumn))
+		Expect(columns[5].Kind).To(Equal(data.BoolColumn))
+		Expect(columns[6].Kind).To(Equal(data.TimestampColumn))
+	})
+
+	It("round-trips rows in their text representation", func() {
+		rows := [][]any{
+			{"SPY", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), "512.8500", int64(76844800), 0.0123,
+				true, time.Date(2024, 3, 1, 16, 30, 15, 250000000, time.UTC)},
+			{"VFIAX", time.Date(1999, 12, 31, 0, 0, 0, 0, time.UTC), nil, nil, nil, nil, nil},
+		}
+
+		fileName := filepath.Join(GinkgoT().TempDir(), "eod.parquet")
+		file, err := os.Create(fileName)
+		Expect(err).ToNot(HaveOccurred())
+		defer file.Close()
+
+		pw, err := data.NewParquetWriter(file, columns)
+		Expect(err).ToNot(HaveOccurred())
+		for _, row := range rows {
+			Expect(pw.Write(row)).To(Succeed())
+		}
+		Expect(pw.Close()).To(Succeed())
+		Expect(pw.Rows()).To(Equal(int64(2)))
+
+		read := make([][]string, 0)
+		count, err := data.ReadParquet(fileName, columns, func(row []any) error {
+			text := make([]string, len(row))
+			for idx, val := range row {
+				if str, ok := columns[idx].Text(val); ok {
+					text[idx] = str
+				} else {
+					text[idx] = "NULL"
+				}
+			}
+			read = append(read, text)
+			return nil
+		})
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(count).To(Equal(int64(2)))
+		Expect(read).To(Equal([][]string{
+			{"SPY", "2024-03-01", "512.8500", "76844800", "0.0123", "t", "2024-03-01 16:30:15.25"},
+			{"VFIAX", "1999-12-31", "NULL", "NULL", "NULL", "NULL", "NULL"},
+		}))
+	})
+})
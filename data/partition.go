@@ -0,0 +1,229 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/rs/zerolog"
+)
+
+// PartitionLayout is the size of the partitions of a partitioned table
+type PartitionLayout string
+
+const (
+	MonthlyPartitions  PartitionLayout = "monthly"
+	YearlyPartitions   PartitionLayout = "yearly"
+	FiveYearPartitions PartitionLayout = "5-year"
+)
+
+const (
+	// PartitionLayoutSetting is the subscription setting that overrides the data type's layout
+	PartitionLayoutSetting = "partitions"
+
+	// DefaultPartitionMonthsAhead is how far into the future partitions are created
+	DefaultPartitionMonthsAhead = 12
+)
+
+var (
+	ErrUnknownPartitionLayout = errors.New("unknown partition layout")
+
+	// data before 2015 is sparse and kept in a few large partitions regardless of layout
+	historicalPartitionsEnd = time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	historicalPartitions    = []int{1900, 2000, 2005, 2010, 2015}
+
+	partitionBoundRegex = regexp.MustCompile(`FROM \('([0-9-]+)[^']*'\) TO \('([0-9-]+)[^']*'\)`)
+)
+
+// Querier is satisfied by both database connections and transactions
+type Querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// Partition is a partition of a table covering the dates from Start up to,
+// but not including, End
+type Partition struct {
+	Name  string
+	Start time.Time
+	End   time.Time
+
+	// Rows is the planner's estimate of the number of rows in the partition
+	Rows int64
+}
+
+// ParsePartitionLayout converts a string to a PartitionLayout
+func ParsePartitionLayout(val string) (PartitionLayout, error) {
+	layout := PartitionLayout(strings.ToLower(strings.TrimSpace(val)))
+	switch layout {
+	case MonthlyPartitions, YearlyPartitions, FiveYearPartitions:
+		return layout, nil
+	default:
+		return FiveYearPartitions, fmt.Errorf("%w: %s", ErrUnknownPartitionLayout, val)
+	}
+}
+
+// partitionName names the partition of `table` covering start to end
+func partitionName(table string, start, end time.Time) string {
+	switch {
+	case start.YearDay() == 1 && end.YearDay() == 1:
+		return fmt.Sprintf("%s_%d_%d", table, start.Year(), end.Year())
+	case start.Day() == 1 && end.Day() == 1:
+		return fmt.Sprintf("%s_%s_%s", table, start.Format("200601"), end.Format("200601"))
+	default:
+		return fmt.Sprintf("%s_%s_%s", table, start.Format("20060102"), end.Format("20060102"))
+	}
+}
+
+// PlanPartitions returns the partitions `table` should have with the given
+// layout to hold data through `through`
+func PlanPartitions(table string, layout PartitionLayout, through time.Time) []*Partition {
+	partitions := make([]*Partition, 0, 20)
+	add := func(start, end time.Time) {
+		partitions = append(partitions, &Partition{
+			Name:  partitionName(table, start, end),
+			Start: start,
+			End:   end,
+		})
+	}
+
+	for idx := 0; idx < len(historicalPartitions)-1; idx++ {
+		add(time.Date(historicalPartitions[idx], 1, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(historicalPartitions[idx+1], 1, 1, 0, 0, 0, 0, time.UTC))
+	}
+
+	for start := historicalPartitionsEnd; !start.After(through); {
+		var end time.Time
+		switch layout {
+		case MonthlyPartitions:
+			end = start.AddDate(0, 1, 0)
+		case YearlyPartitions:
+			end = start.AddDate(1, 0, 0)
+		default:
+			end = start.AddDate(5, 0, 0)
+		}
+
+		add(start, end)
+		start = end
+	}
+
+	return partitions
+}
+
+// MissingPartitions returns the parts of the planned partitions that no
+// existing partition covers. Existing partitions are kept even if they do not
+// match the plan; planned partitions that overlap them are trimmed.
+func MissingPartitions(table string, existing, planned []*Partition) []*Partition {
+	sorted := make([]*Partition, len(existing))
+	copy(sorted, existing)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start.Before(sorted[j].Start) })
+
+	missing := make([]*Partition, 0)
+	for _, plan := range planned {
+		start := plan.Start
+		for _, part := range sorted {
+			if !part.End.After(start) || !part.Start.Before(plan.End) {
+				continue
+			}
+
+			if part.Start.After(start) {
+				missing = append(missing, &Partition{Name: partitionName(table, start, part.Start), Start: start, End: part.Start})
+			}
+
+			start = part.End
+			if !start.Before(plan.End) {
+				break
+			}
+		}
+
+		if start.Before(plan.End) {
+			if start.Equal(plan.Start) {
+				missing = append(missing, plan)
+			} else {
+				missing = append(missing, &Partition{Name: partitionName(table, start, plan.End), Start: start, End: plan.End})
+			}
+		}
+	}
+
+	return missing
+}
+
+// ListPartitions returns the partitions attached to `table`
+func ListPartitions(ctx context.Context, dbConn Querier, table string) ([]*Partition, error) {
+	sql := `SELECT c.relname, pg_get_expr(c.relpartbound, c.oid), greatest(c.reltuples, 0)::bigint
+	FROM pg_inherits i
+	JOIN pg_class c ON c.oid = i.inhrelid
+	WHERE i.inhparent = $1::regclass
+	ORDER BY c.relname`
+
+	rows, err := dbConn.Query(ctx, sql, table)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Str("SQL", sql).Str("Table", table).Msg("could not list partitions")
+		return nil, err
+	}
+	defer rows.Close()
+
+	partitions := make([]*Partition, 0)
+	for rows.Next() {
+		var bound string
+		partition := &Partition{}
+		if err := rows.Scan(&partition.Name, &bound, &partition.Rows); err != nil {
+			return nil, err
+		}
+
+		partition.Start, partition.End = parsePartitionBound(bound)
+		partitions = append(partitions, partition)
+	}
+
+	return partitions, rows.Err()
+}
+
+// parsePartitionBound reads the range of a partition from its bound expression;
+// e.g. FOR VALUES FROM ('2015-01-01') TO ('2020-01-01')
+func parsePartitionBound(bound string) (time.Time, time.Time) {
+	match := partitionBoundRegex.FindStringSubmatch(bound)
+	if match == nil {
+		return time.Time{}, time.Time{}
+	}
+
+	start, _ := time.Parse("2006-01-02", match[1])
+	end, _ := time.Parse("2006-01-02", match[2])
+	return start, end
+}
+
+// CreatePartitions creates the partitions of `table`
+func CreatePartitions(ctx context.Context, dbConn Querier, table string, partitions []*Partition) error {
+	logger := zerolog.Ctx(ctx)
+
+	for _, partition := range partitions {
+		sql := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s');",
+			partition.Name, table, partition.Start.Format("2006-01-02"), partition.End.Format("2006-01-02"))
+		logger.Debug().Str("SQL", sql).Msg("creating partition table")
+		if _, err := dbConn.Exec(ctx, sql); err != nil {
+			logger.Error().Err(err).Str("SQL", sql).Msg("could not create partition")
+			return err
+		}
+	}
+
+	return nil
+}
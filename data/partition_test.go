@@ -0,0 +1,108 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/penny-vault/pvdata/data"
+)
+
+func partitionNames(partitions []*data.Partition) []string {
+	names := make([]string, len(partitions))
+	for idx, partition := range partitions {
+		names[idx] = partition.Name
+	}
+	return names
+}
+
+func yearPartition(name string, start, end int) *data.Partition {
+	return &data.Partition{
+		Name:  name,
+		Start: time.Date(start, 1, 1, 0, 0, 0, 0, time.UTC),
+		End:   time.Date(end, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+var _ = Describe("Partition", func() {
+	through := time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	Context("planning", func() {
+		It("creates 5-year partitions through the requested date", func() {
+			planned := data.PlanPartitions("eod", data.FiveYearPartitions, through)
+			Expect(partitionNames(planned)).To(Equal([]string{
+				"eod_1900_2000", "eod_2000_2005", "eod_2005_2010", "eod_2010_2015",
+				"eod_2015_2020", "eod_2020_2025", "eod_2025_2030",
+			}))
+		})
+
+		It("creates yearly partitions through the requested date", func() {
+			planned := data.PlanPartitions("eod", data.YearlyPartitions, through)
+			Expect(planned).To(HaveLen(4 + 12))
+			Expect(planned[len(planned)-1].Name).To(Equal("eod_2026_2027"))
+		})
+
+		It("creates monthly partitions through the requested date", func() {
+			planned := data.PlanPartitions("eod", data.MonthlyPartitions, through)
+			Expect(planned[4].Name).To(Equal("eod_201501_201502"))
+			Expect(planned[len(planned)-1].Name).To(Equal("eod_202603_202604"))
+		})
+
+		It("parses layouts", func() {
+			layout, err := data.ParsePartitionLayout("Yearly")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(layout).To(Equal(data.YearlyPartitions))
+
+			_, err = data.ParsePartitionLayout("weekly")
+			Expect(err).To(MatchError(data.ErrUnknownPartitionLayout))
+		})
+	})
+
+	Context("missing partitions", func() {
+		It("finds nothing missing when the plan is in place", func() {
+			planned := data.PlanPartitions("eod", data.FiveYearPartitions, through)
+			Expect(data.MissingPartitions("eod", planned, planned)).To(BeEmpty())
+		})
+
+		It("keeps existing partitions that do not match the layout", func() {
+			existing := []*data.Partition{
+				yearPartition("eod_2015_2020", 2015, 2020),
+				yearPartition("eod_2020_2025", 2020, 2025),
+			}
+			planned := []*data.Partition{
+				yearPartition("eod_2019_2020", 2019, 2020),
+				yearPartition("eod_2024_2025", 2024, 2025),
+				yearPartition("eod_2025_2026", 2025, 2026),
+			}
+			Expect(partitionNames(data.MissingPartitions("eod", existing, planned))).To(Equal([]string{"eod_2025_2026"}))
+		})
+
+		It("fills the dates existing partitions leave uncovered", func() {
+			existing := []*data.Partition{
+				yearPartition("eod_2025_2026", 2025, 2026),
+			}
+			planned := []*data.Partition{
+				yearPartition("eod_2020_2025", 2020, 2025),
+				yearPartition("eod_2025_2030", 2025, 2030),
+			}
+			Expect(partitionNames(data.MissingPartitions("eod", existing, planned))).To(Equal([]string{
+				"eod_2020_2025", "eod_2026_2030",
+			}))
+		})
+	})
+})
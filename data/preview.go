@@ -0,0 +1,211 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+var (
+	ErrPreviewNotSupported = errors.New("data type cannot be previewed")
+)
+
+// previewIgnore lists columns that are derived after observations are saved
+// (e.g. by AdjustPrices) and so are not compared by a preview
+var previewIgnore = map[string][]string{
+	EODKey: {"adj_close", "total_return"},
+}
+
+// PreviewRecord is one observation written to a preview's JSONL file
+type PreviewRecord struct {
+	SubscriptionID uuid.UUID `json:"subscription_id"`
+	DataType       string    `json:"data_type"`
+	Rejected       bool      `json:"rejected,omitempty"`
+	Record         any       `json:"record"`
+}
+
+// PreviewDiff counts how the rows of a preview compare to a data type's table
+type PreviewDiff struct {
+	DataType  string `json:"data_type"`
+	New       int64  `json:"new"`
+	Changed   int64  `json:"changed"`
+	Unchanged int64  `json:"unchanged"`
+
+	// Columns counts the changed rows by column
+	Columns map[string]int64 `json:"columns,omitempty"`
+}
+
+// Collector gathers the observations of a dry run instead of saving them. It
+// counts observations by data type, keeps the first SampleSize of each and
+// writes every observation to Out if set.
+type Collector struct {
+	SampleSize int
+	Counts     map[string]int
+	Rejected   map[string]int
+	Samples    map[string][]*Observation
+
+	out *json.Encoder
+}
+
+// NewCollector creates a collector that keeps `sampleSize` observations of each
+// data type and writes all of them to `out` as JSON lines; `out` may be nil
+func NewCollector(sampleSize int, out io.Writer) *Collector {
+	collector := &Collector{
+		SampleSize: sampleSize,
+		Counts:     make(map[string]int),
+		Rejected:   make(map[string]int),
+		Samples:    make(map[string][]*Observation),
+	}
+
+	if out != nil {
+		collector.out = json.NewEncoder(out)
+	}
+
+	return collector
+}
+
+// Add records an observation; rejected observations are those the quality
+// rules would not save
+func (collector *Collector) Add(obs *Observation, rejected bool) error {
+	dataType, payload := obs.Payload()
+	if payload == nil {
+		return nil
+	}
+
+	collector.Counts[dataType]++
+	if rejected {
+		collector.Rejected[dataType]++
+	} else if len(collector.Samples[dataType]) < collector.SampleSize {
+		collector.Samples[dataType] = append(collector.Samples[dataType], obs)
+	}
+
+	if collector.out == nil {
+		return nil
+	}
+
+	return collector.out.Encode(&PreviewRecord{
+		SubscriptionID: obs.SubscriptionID,
+		DataType:       dataType,
+		Rejected:       rejected,
+		Record:         payload,
+	})
+}
+
+// DataTypes returns the data types collected in sorted order
+func (collector *Collector) DataTypes() []string {
+	dataTypes := make([]string, 0, len(collector.Counts))
+	for dataType := range collector.Counts {
+		dataTypes = append(dataTypes, dataType)
+	}
+
+	slices.Sort(dataTypes)
+	return dataTypes
+}
+
+// PreviewDiffSQL returns a query that counts the rows of `previewTable` that are
+// new, changed or unchanged in `table`, followed by the number of changed rows
+// for each of `compared`
+func PreviewDiffSQL(previewTable, table string, primaryKey, compared []string) string {
+	joins := make([]string, len(primaryKey))
+	for idx, key := range primaryKey {
+		joins[idx] = fmt.Sprintf(`p."%[1]s" = t."%[1]s"`, key)
+	}
+
+	differs := make([]string, len(compared))
+	for idx, col := range compared {
+		differs[idx] = fmt.Sprintf(`p."%[1]s" IS DISTINCT FROM t."%[1]s"`, col)
+	}
+
+	changed := "false"
+	if len(differs) > 0 {
+		changed = strings.Join(differs, " OR ")
+	}
+
+	found := fmt.Sprintf(`t."%s" IS NOT NULL`, primaryKey[0])
+	counts := []string{
+		fmt.Sprintf(`count(*) FILTER (WHERE t."%s" IS NULL)`, primaryKey[0]),
+		fmt.Sprintf("count(*) FILTER (WHERE %s AND (%s))", found, changed),
+		fmt.Sprintf("count(*) FILTER (WHERE %s AND NOT (%s))", found, changed),
+	}
+
+	for _, differ := range differs {
+		counts = append(counts, fmt.Sprintf("count(*) FILTER (WHERE %s AND %s)", found, differ))
+	}
+
+	return fmt.Sprintf("SELECT %s FROM %s p LEFT JOIN %s t ON %s", strings.Join(counts, ", "), previewTable, table,
+		strings.Join(joins, " AND "))
+}
+
+// DiffPreview compares the rows saved to `previewTable` with the data type's
+// `table`. Rows match on the data type's primary key.
+func DiffPreview(ctx context.Context, dbConn Querier, dataType, previewTable, table string) (*PreviewDiff, error) {
+	dt, ok := DataTypes[dataType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrPreviewNotSupported, dataType)
+	}
+
+	columns, err := TableColumns(ctx, dbConn, table)
+	if err != nil {
+		return nil, err
+	}
+
+	compared := make([]string, 0, len(columns))
+	for _, column := range columns {
+		if !slices.Contains(dt.PrimaryKey, column.Name) && !slices.Contains(previewIgnore[dataType], column.Name) {
+			compared = append(compared, column.Name)
+		}
+	}
+
+	sql := PreviewDiffSQL(previewTable, table, dt.PrimaryKey, compared)
+	rows, err := dbConn.Query(ctx, sql)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Str("SQL", sql).Msg("could not compare preview to table")
+		return nil, err
+	}
+	defer rows.Close()
+
+	diff := &PreviewDiff{DataType: dataType, Columns: make(map[string]int64)}
+	if !rows.Next() {
+		return diff, rows.Err()
+	}
+
+	counts := make([]int64, 3+len(compared))
+	dest := make([]any, len(counts))
+	for idx := range counts {
+		dest[idx] = &counts[idx]
+	}
+
+	if err := rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	diff.New, diff.Changed, diff.Unchanged = counts[0], counts[1], counts[2]
+	for idx, col := range compared {
+		if counts[3+idx] > 0 {
+			diff.Columns[col] = counts[3+idx]
+		}
+	}
+
+	return diff, rows.Err()
+}
@@ -0,0 +1,84 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/penny-vault/pvdata/data"
+)
+
+var _ = Describe("Preview", func() {
+	subscriptionID := uuid.MustParse("5f2c4e1a-7d0b-4a3e-9c1f-2b8d6e0a4c91")
+	eod := func(ticker string) *data.Observation {
+		return &data.Observation{
+			EodQuote:       &data.Eod{Ticker: ticker, CompositeFigi: "BBG000000001", Close: 10},
+			SubscriptionID: subscriptionID,
+		}
+	}
+
+	It("counts observations and keeps a sample of each data type", func() {
+		collector := data.NewCollector(2, nil)
+		for _, ticker := range []string{"AAA", "BBB", "CCC"} {
+			Expect(collector.Add(eod(ticker), false)).To(Succeed())
+		}
+		Expect(collector.Add(eod("DDD"), true)).To(Succeed())
+		Expect(collector.Add(&data.Observation{EconomicIndicator: &data.EconomicIndicator{Series: "DGS10"}}, false)).To(Succeed())
+
+		Expect(collector.DataTypes()).To(Equal([]string{data.EconomicIndicatorKey, data.EODKey}))
+		Expect(collector.Counts[data.EODKey]).To(Equal(4))
+		Expect(collector.Rejected[data.EODKey]).To(Equal(1))
+		Expect(collector.Samples[data.EODKey]).To(HaveLen(2))
+		Expect(collector.Samples[data.EODKey][0].EodQuote.Ticker).To(Equal("AAA"))
+	})
+
+	It("writes every observation as a JSON line", func() {
+		var out bytes.Buffer
+		collector := data.NewCollector(0, &out)
+		Expect(collector.Add(eod("AAA"), false)).To(Succeed())
+		Expect(collector.Add(eod("BBB"), true)).To(Succeed())
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		Expect(lines).To(HaveLen(2))
+
+		record := map[string]any{}
+		Expect(json.Unmarshal([]byte(lines[1]), &record)).To(Succeed())
+		Expect(record["subscription_id"]).To(Equal(subscriptionID.String()))
+		Expect(record["data_type"]).To(Equal(data.EODKey))
+		Expect(record["rejected"]).To(BeTrue())
+		Expect(record["record"]).To(HaveKeyWithValue("ticker", "BBB"))
+	})
+
+	It("counts new, changed and unchanged rows by primary key", func() {
+		sql := data.PreviewDiffSQL("pvdata_preview_eod", "tiingo_eod", []string{"composite_figi", "event_date"}, []string{"close", "volume"})
+		Expect(sql).To(Equal(`SELECT count(*) FILTER (WHERE t."composite_figi" IS NULL), ` +
+			`count(*) FILTER (WHERE t."composite_figi" IS NOT NULL AND (p."close" IS DISTINCT FROM t."close" OR p."volume" IS DISTINCT FROM t."volume")), ` +
+			`count(*) FILTER (WHERE t."composite_figi" IS NOT NULL AND NOT (p."close" IS DISTINCT FROM t."close" OR p."volume" IS DISTINCT FROM t."volume")), ` +
+			`count(*) FILTER (WHERE t."composite_figi" IS NOT NULL AND p."close" IS DISTINCT FROM t."close"), ` +
+			`count(*) FILTER (WHERE t."composite_figi" IS NOT NULL AND p."volume" IS DISTINCT FROM t."volume") ` +
+			`FROM pvdata_preview_eod p LEFT JOIN tiingo_eod t ON p."composite_figi" = t."composite_figi" AND p."event_date" = t."event_date"`))
+	})
+
+	It("treats every matched row as unchanged when no columns are compared", func() {
+		sql := data.PreviewDiffSQL("p_tbl", "t_tbl", []string{"series", "event_date"}, nil)
+		Expect(sql).To(ContainSubstring(`AND NOT (false)`))
+	})
+})
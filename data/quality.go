@@ -0,0 +1,451 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// QualityAction is what happens to an observation that breaks a quality rule
+type QualityAction string
+
+const (
+	QualityOff        QualityAction = "off"
+	QualityWarn       QualityAction = "warn"
+	QualityQuarantine QualityAction = "quarantine"
+	QualityReject     QualityAction = "reject"
+)
+
+const (
+	// QualitySettingPrefix is the prefix of subscription settings that
+	// override the action of a rule, e.g. quality.eod-outlier = warn
+	QualitySettingPrefix = "quality."
+
+	// OutlierThresholdSetting is the subscription setting holding the
+	// largest close-to-close move that is not considered an outlier
+	OutlierThresholdSetting = "quality.outlier_threshold"
+
+	DefaultOutlierThreshold = 5.0
+)
+
+var (
+	ErrUnknownQualityAction = errors.New("unknown quality action")
+	ErrUnknownQualityRule   = errors.New("unknown quality rule")
+
+	ErrUnknownQualityDataType = errors.New("quarantined observation has an unknown data type")
+)
+
+// ParseQualityAction converts a string to a QualityAction
+func ParseQualityAction(val string) (QualityAction, error) {
+	action := QualityAction(strings.ToLower(strings.TrimSpace(val)))
+	switch action {
+	case QualityOff, QualityWarn, QualityQuarantine, QualityReject:
+		return action, nil
+	default:
+		return QualityOff, fmt.Errorf("%w: %s", ErrUnknownQualityAction, val)
+	}
+}
+
+func (action QualityAction) severity() int {
+	switch action {
+	case QualityWarn:
+		return 1
+	case QualityQuarantine:
+		return 2
+	case QualityReject:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// QualityRule is a check applied to observations of a data type before they are saved
+type QualityRule struct {
+	Name          string
+	Description   string
+	DataTypes     []string
+	DefaultAction QualityAction
+
+	// check returns a description of the problem or an empty string if the
+	// observation passes
+	check func(validator *Validator, obs *Observation) string
+}
+
+// QualityIssue records an observation that broke a quality rule
+type QualityIssue struct {
+	SubscriptionID uuid.UUID
+	TableName      string
+	DataType       string
+	Rule           string
+	Action         QualityAction
+	Ticker         string
+	CompositeFigi  string
+	EventDate      time.Time
+	Message        string
+
+	// Observation is the offending object; only kept for observations that
+	// were not saved
+	Observation any
+}
+
+// QualityRules lists all built-in rules
+var QualityRules = []*QualityRule{
+	{
+		Name:          "required-identifiers",
+		Description:   "observations must have a ticker and a 12 character composite FIGI; assets may omit the FIGI until it is enriched",
+		DataTypes:     []string{AssetKey, CustomKey, EODKey, FundamentalsKey, MetricKey, RatingKey, EconomicIndicatorKey},
+		DefaultAction: QualityReject,
+		check:         checkIdentifiers,
+	},
+	{
+		Name:          "date-sanity",
+		Description:   "event dates must be set, after 1900 and not in the future",
+		DataTypes:     []string{CustomKey, EODKey, FundamentalsKey, MetricKey, RatingKey, EconomicIndicatorKey},
+		DefaultAction: QualityReject,
+		check:         checkDate,
+	},
+	{
+		Name:          "eod-positive-price",
+		Description:   "close must be positive and open, high and low must not be negative",
+		DataTypes:     []string{EODKey},
+		DefaultAction: QualityReject,
+		check:         checkPositivePrice,
+	},
+	{
+		Name:          "eod-ohlc",
+		Description:   "high must be the largest and low the smallest of open, high, low and close",
+		DataTypes:     []string{EODKey},
+		DefaultAction: QualityQuarantine,
+		check:         checkOHLC,
+	},
+	{
+		Name:          "eod-outlier",
+		Description:   "split-adjusted close must be within the outlier threshold of the prior close",
+		DataTypes:     []string{EODKey},
+		DefaultAction: QualityQuarantine,
+		check:         checkOutlier,
+	},
+	{
+		Name:          "eod-volume",
+		Description:   "volume must be a non-negative whole number",
+		DataTypes:     []string{EODKey},
+		DefaultAction: QualityWarn,
+		check:         checkVolume,
+	},
+}
+
+// QualityRuleFromName returns the built-in rule with the given name
+func QualityRuleFromName(name string) (*QualityRule, error) {
+	for _, rule := range QualityRules {
+		if rule.Name == name {
+			return rule, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownQualityRule, name)
+}
+
+// Validator applies quality rules to observations of a single subscription
+type Validator struct {
+	Actions          map[string]QualityAction
+	OutlierThreshold float64
+
+	// PriorClose returns the last close of the asset before date; it is
+	// consulted when the validator has not seen an earlier quote itself
+	PriorClose func(compositeFigi string, date time.Time) (float64, bool)
+
+	lastQuote map[string]*Eod
+}
+
+// NewValidator creates a validator configured from subscription settings
+func NewValidator(settings map[string]string) *Validator {
+	validator := &Validator{
+		Actions:          make(map[string]QualityAction, len(QualityRules)),
+		OutlierThreshold: DefaultOutlierThreshold,
+		lastQuote:        make(map[string]*Eod),
+	}
+
+	for _, rule := range QualityRules {
+		validator.Actions[rule.Name] = rule.DefaultAction
+		if val, ok := settings[QualitySettingPrefix+rule.Name]; ok {
+			action, err := ParseQualityAction(val)
+			if err != nil {
+				log.Warn().Err(err).Str("Rule", rule.Name).Msg("ignoring invalid quality setting")
+				continue
+			}
+			validator.Actions[rule.Name] = action
+		}
+	}
+
+	if val, ok := settings[OutlierThresholdSetting]; ok {
+		if threshold, err := strconv.ParseFloat(val, 64); err == nil && threshold > 1 {
+			validator.OutlierThreshold = threshold
+		} else {
+			log.Warn().Str("Value", val).Msg("ignoring invalid outlier threshold; must be a number greater than 1")
+		}
+	}
+
+	return validator
+}
+
+// Validate checks the observation against all rules of its data type. It
+// returns the most severe action of the broken rules (QualityOff if none)
+// along with an issue for each broken rule.
+func (validator *Validator) Validate(obs *Observation) (QualityAction, []*QualityIssue) {
+	dataType, payload := obs.Payload()
+	ticker, figi, eventDate := obs.Identity()
+
+	result := QualityOff
+	issues := make([]*QualityIssue, 0)
+
+	for _, rule := range QualityRules {
+		action := validator.Actions[rule.Name]
+		if action == QualityOff || !slices.Contains(rule.DataTypes, dataType) {
+			continue
+		}
+
+		msg := rule.check(validator, obs)
+		if msg == "" {
+			continue
+		}
+
+		issue := &QualityIssue{
+			SubscriptionID: obs.SubscriptionID,
+			DataType:       dataType,
+			Rule:           rule.Name,
+			Action:         action,
+			Ticker:         ticker,
+			CompositeFigi:  figi,
+			EventDate:      eventDate,
+			Message:        msg,
+		}
+
+		if action != QualityWarn {
+			issue.Observation = payload
+		}
+
+		issues = append(issues, issue)
+
+		if action.severity() > result.severity() {
+			result = action
+		}
+	}
+
+	// remember the quote so the next one for the asset can be compared to it
+	if obs.EodQuote != nil && result.severity() < QualityQuarantine.severity() {
+		if last, ok := validator.lastQuote[obs.EodQuote.CompositeFigi]; !ok || last.Date.Before(obs.EodQuote.Date) {
+			validator.lastQuote[obs.EodQuote.CompositeFigi] = obs.EodQuote
+		}
+	}
+
+	return result, issues
+}
+
+func (validator *Validator) priorClose(eod *Eod) (float64, bool) {
+	if last, ok := validator.lastQuote[eod.CompositeFigi]; ok && last.Date.Before(eod.Date) {
+		return last.Close, true
+	}
+
+	if validator.PriorClose != nil {
+		return validator.PriorClose(eod.CompositeFigi, eod.Date)
+	}
+
+	return 0, false
+}
+
+// DecodeQuarantined rebuilds the observation of `dataType` saved in a
+// quarantined issue
+func DecodeQuarantined(dataType string, raw []byte) (*Observation, error) {
+	obs := &Observation{}
+	var target any
+	switch dataType {
+	case AssetKey:
+		obs.AssetObject = &Asset{}
+		target = obs.AssetObject
+	case CustomKey:
+		obs.CustomObject = &Custom{}
+		target = obs.CustomObject
+	case EconomicIndicatorKey:
+		obs.EconomicIndicator = &EconomicIndicator{}
+		target = obs.EconomicIndicator
+	case EODKey:
+		obs.EodQuote = &Eod{}
+		target = obs.EodQuote
+	case FundamentalsKey:
+		obs.Fundamental = &Fundamental{}
+		target = obs.Fundamental
+	case MarketHolidaysKey:
+		obs.MarketHoliday = &MarketHoliday{}
+		target = obs.MarketHoliday
+	case MetricKey:
+		obs.Metric = &Metric{}
+		target = obs.Metric
+	case RatingKey:
+		obs.Rating = &AnalystRating{}
+		target = obs.Rating
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownQualityDataType, dataType)
+	}
+
+	if err := json.Unmarshal(raw, target); err != nil {
+		return nil, err
+	}
+
+	return obs, nil
+}
+
+// SaveDB records the issue in the quality_issues table
+func (issue *QualityIssue) SaveDB(ctx context.Context, dbConn *pgxpool.Conn) error {
+	var eventDate *time.Time
+	if !issue.EventDate.IsZero() {
+		eventDate = &issue.EventDate
+	}
+
+	_, err := dbConn.Exec(ctx, `INSERT INTO quality_issues
+	("subscription_id", "table_name", "data_type", "rule", "action", "ticker", "composite_figi",
+	 "event_date", "message", "observation")
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		issue.SubscriptionID, issue.TableName, issue.DataType, issue.Rule, string(issue.Action),
+		issue.Ticker, issue.CompositeFigi, eventDate, issue.Message, issue.Observation)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Str("Rule", issue.Rule).Msg("could not save quality issue")
+	}
+
+	return err
+}
+
+// rules
+
+func checkIdentifiers(_ *Validator, obs *Observation) string {
+	if obs.EconomicIndicator != nil {
+		if obs.EconomicIndicator.Series == "" {
+			return "series is empty"
+		}
+		return ""
+	}
+
+	ticker, figi, _ := obs.Identity()
+	if strings.TrimSpace(ticker) == "" {
+		return "ticker is empty"
+	}
+
+	// asset descriptions are how FIGIs are found; enrichment fills them in later
+	if obs.AssetObject != nil && strings.TrimSpace(figi) == "" {
+		return ""
+	}
+
+	if len(strings.TrimSpace(figi)) != 12 {
+		return fmt.Sprintf("composite figi '%s' is not 12 characters", figi)
+	}
+
+	return ""
+}
+
+func checkDate(_ *Validator, obs *Observation) string {
+	_, _, eventDate := obs.Identity()
+
+	if eventDate.IsZero() {
+		return "event date is not set"
+	}
+
+	if eventDate.Year() < 1900 {
+		return fmt.Sprintf("event date %s is before 1900", eventDate.Format("2006-01-02"))
+	}
+
+	if eventDate.After(time.Now().Add(24 * time.Hour)) {
+		return fmt.Sprintf("event date %s is in the future", eventDate.Format("2006-01-02"))
+	}
+
+	return ""
+}
+
+func checkPositivePrice(_ *Validator, obs *Observation) string {
+	eod := obs.EodQuote
+	if eod.Close <= 0 {
+		return fmt.Sprintf("close %.4f is not positive", eod.Close)
+	}
+
+	if eod.Open < 0 || eod.High < 0 || eod.Low < 0 {
+		return fmt.Sprintf("negative price (open %.4f, high %.4f, low %.4f)", eod.Open, eod.High, eod.Low)
+	}
+
+	return ""
+}
+
+func checkOHLC(_ *Validator, obs *Observation) string {
+	eod := obs.EodQuote
+
+	// some providers leave open, high and low empty; only close is required
+	if eod.High == 0 && eod.Low == 0 {
+		return ""
+	}
+
+	if eod.High < eod.Low {
+		return fmt.Sprintf("high %.4f is less than low %.4f", eod.High, eod.Low)
+	}
+
+	for _, price := range []float64{eod.Open, eod.Close} {
+		if price != 0 && (price > eod.High || price < eod.Low) {
+			return fmt.Sprintf("price %.4f is outside of the range [%.4f, %.4f]", price, eod.Low, eod.High)
+		}
+	}
+
+	return ""
+}
+
+func checkOutlier(validator *Validator, obs *Observation) string {
+	eod := obs.EodQuote
+	prevClose, ok := validator.priorClose(eod)
+	if !ok || prevClose <= 0 || eod.Close <= 0 {
+		return ""
+	}
+
+	split := eod.Split
+	if split <= 0 {
+		split = 1
+	}
+
+	ratio := eod.Close * split / prevClose
+	if ratio > validator.OutlierThreshold || ratio < 1/validator.OutlierThreshold {
+		return fmt.Sprintf("close %.4f moved %.2fx from the prior close of %.4f", eod.Close, ratio, prevClose)
+	}
+
+	return ""
+}
+
+func checkVolume(_ *Validator, obs *Observation) string {
+	volume := obs.EodQuote.Volume
+	if volume < 0 {
+		return fmt.Sprintf("volume %f is negative", volume)
+	}
+
+	if volume != math.Trunc(volume) {
+		return fmt.Sprintf("volume %f is not a whole number", volume)
+	}
+
+	return ""
+}
@@ -0,0 +1,153 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data_test
+
+import (
+	"encoding/json"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/penny-vault/pvdata/data"
+)
+
+var _ = Describe("Quality", func() {
+	var (
+		validator *data.Validator
+		eod       *data.Eod
+	)
+
+	BeforeEach(func() {
+		validator = data.NewValidator(map[string]string{})
+		eod = &data.Eod{
+			Date:          time.Date(2024, 1, 2, 16, 0, 0, 0, time.UTC),
+			Ticker:        "VFIAX",
+			CompositeFigi: "BBG000BHTMY2",
+			Open:          10,
+			High:          12,
+			Low:           9,
+			Close:         11,
+			Volume:        1000,
+			Split:         1,
+		}
+	})
+
+	It("accepts a valid quote", func() {
+		action, issues := validator.Validate(&data.Observation{EodQuote: eod})
+		Expect(action).To(Equal(data.QualityOff))
+		Expect(issues).To(BeEmpty())
+	})
+
+	It("rejects non-positive prices", func() {
+		eod.Close = 0
+		action, issues := validator.Validate(&data.Observation{EodQuote: eod})
+		Expect(action).To(Equal(data.QualityReject))
+		Expect(issues[0].Rule).To(Equal("eod-positive-price"))
+		Expect(issues[0].Observation).To(Equal(eod))
+	})
+
+	It("quarantines quotes where high is less than low", func() {
+		eod.High = 8
+		action, issues := validator.Validate(&data.Observation{EodQuote: eod})
+		Expect(action).To(Equal(data.QualityQuarantine))
+		Expect(issues).To(HaveLen(1))
+		Expect(issues[0].Rule).To(Equal("eod-ohlc"))
+	})
+
+	It("warns about fractional volume and keeps the quote", func() {
+		eod.Volume = 10.5
+		action, issues := validator.Validate(&data.Observation{EodQuote: eod})
+		Expect(action).To(Equal(data.QualityWarn))
+		Expect(issues[0].Rule).To(Equal("eod-volume"))
+		Expect(issues[0].Observation).To(BeNil())
+	})
+
+	It("rejects missing identifiers and future dates", func() {
+		eod.CompositeFigi = ""
+		eod.Date = time.Now().AddDate(0, 1, 0)
+		action, issues := validator.Validate(&data.Observation{EodQuote: eod})
+		Expect(action).To(Equal(data.QualityReject))
+		Expect(issues).To(HaveLen(2))
+	})
+
+	It("accepts assets that have not been enriched with a FIGI", func() {
+		asset := &data.Observation{AssetObject: &data.Asset{Ticker: "AAA"}}
+		action, issues := validator.Validate(asset)
+		Expect(action).To(Equal(data.QualityOff))
+		Expect(issues).To(BeEmpty())
+
+		asset.AssetObject.CompositeFigi = "BBG0001"
+		action, _ = validator.Validate(asset)
+		Expect(action).To(Equal(data.QualityReject))
+	})
+
+	It("rebuilds quarantined observations", func() {
+		eod.High = 8
+		_, issues := validator.Validate(&data.Observation{EodQuote: eod})
+		raw, err := json.Marshal(issues[0].Observation)
+		Expect(err).NotTo(HaveOccurred())
+
+		obs, err := data.DecodeQuarantined(data.EODKey, raw)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(obs.EodQuote).To(Equal(eod))
+
+		_, err = data.DecodeQuarantined("unknown", raw)
+		Expect(err).To(MatchError(data.ErrUnknownQualityDataType))
+	})
+
+	Describe("outliers", func() {
+		It("compares the close to the prior close", func() {
+			validator.PriorClose = func(string, time.Time) (float64, bool) { return 0.01, true }
+			action, issues := validator.Validate(&data.Observation{EodQuote: eod})
+			Expect(action).To(Equal(data.QualityQuarantine))
+			Expect(issues[0].Rule).To(Equal("eod-outlier"))
+		})
+
+		It("accounts for splits", func() {
+			validator.PriorClose = func(string, time.Time) (float64, bool) { return 110, true }
+			eod.Split = 10
+			action, _ := validator.Validate(&data.Observation{EodQuote: eod})
+			Expect(action).To(Equal(data.QualityOff))
+		})
+
+		It("uses previously validated quotes", func() {
+			_, _ = validator.Validate(&data.Observation{EodQuote: eod})
+			next := *eod
+			next.Date = eod.Date.AddDate(0, 0, 1)
+			next.Open, next.High, next.Low, next.Close = 1100, 1200, 900, 1100
+			action, _ := validator.Validate(&data.Observation{EodQuote: &next})
+			Expect(action).To(Equal(data.QualityQuarantine))
+		})
+	})
+
+	It("applies actions from subscription settings", func() {
+		validator = data.NewValidator(map[string]string{
+			"quality.eod-ohlc":           "warn",
+			"quality.eod-positive-price": "off",
+		})
+
+		eod.High = 8
+		action, _ := validator.Validate(&data.Observation{EodQuote: eod})
+		Expect(action).To(Equal(data.QualityWarn))
+
+		eod.Close = -1
+		eod.High = 12
+		eod.Low = -2
+		action, issues := validator.Validate(&data.Observation{EodQuote: eod})
+		Expect(action).To(Equal(data.QualityOff))
+		Expect(issues).To(BeEmpty())
+	})
+})
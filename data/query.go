@@ -0,0 +1,132 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog"
+)
+
+var figiPattern = regexp.MustCompile(`^[B-DF-HJ-NP-TV-Z]{2}G[B-DF-HJ-NP-TV-Z0-9]{8}[0-9]$`)
+
+// IsFigi returns true if `id` is formatted like a FIGI (e.g. BBG000B9XRY4)
+func IsFigi(id string) bool {
+	return figiPattern.MatchString(id)
+}
+
+// TableQuery reads a page of rows from a table
+type TableQuery struct {
+	Table   string
+	OrderBy []string
+	Limit   int
+	Offset  int
+
+	filter exportQuery
+}
+
+// NewTableQuery creates a query of `table` ordered by `orderBy`
+func NewTableQuery(table string, orderBy ...string) *TableQuery {
+	return &TableQuery{
+		Table:   table,
+		OrderBy: orderBy,
+	}
+}
+
+// Where adds a condition; `condition` contains a single %d that is replaced
+// with the placeholder number of `arg`, e.g. "event_date >= $%d"
+func (query *TableQuery) Where(condition string, arg any) *TableQuery {
+	query.filter.add(condition, arg)
+	return query
+}
+
+// Statement returns the SQL selecting `selectList` for the query and its arguments
+func (query *TableQuery) Statement(selectList string) (string, []any) {
+	return query.statement(selectList, query.Table+query.filter.where()), query.filter.args
+}
+
+// statement orders and pages the rows of `from`
+func (query *TableQuery) statement(selectList, from string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "SELECT %s FROM %s", selectList, from)
+
+	if len(query.OrderBy) > 0 {
+		fmt.Fprintf(&sb, " ORDER BY %s", strings.Join(query.OrderBy, ", "))
+	}
+
+	if query.Limit > 0 {
+		fmt.Fprintf(&sb, " LIMIT %d", query.Limit)
+	}
+
+	if query.Offset > 0 {
+		fmt.Fprintf(&sb, " OFFSET %d", query.Offset)
+	}
+
+	return sb.String()
+}
+
+// JSON returns each row as a JSON object with keys in column order. Values
+// keep their PostgreSQL types (numerics are numbers, arrays are arrays, ...).
+func (query *TableQuery) JSON(ctx context.Context, dbConn Querier) ([]json.RawMessage, error) {
+	columns, err := TableColumns(ctx, dbConn, query.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	// rows are ordered outside of the subquery so that the order is kept
+	inner := fmt.Sprintf("(SELECT %s FROM %s%s) t", ColumnNames(columns), query.Table, query.filter.where())
+	sql := query.statement("to_json(t)", inner)
+
+	rows, err := dbConn.Query(ctx, sql, query.filter.args...)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Str("SQL", sql).Msg("could not query table")
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (json.RawMessage, error) {
+		var obj []byte
+		err := row.Scan(&obj)
+		return json.RawMessage(obj), err
+	})
+}
+
+// Rows returns the table's columns and the rows of the query read with SelectColumns
+func (query *TableQuery) Rows(ctx context.Context, dbConn Querier) ([]*Column, [][]any, error) {
+	columns, err := TableColumns(ctx, dbConn, query.Table)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sql, args := query.Statement(SelectColumns(columns))
+	rows, err := dbConn.Query(ctx, sql, args...)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Str("SQL", sql).Msg("could not query table")
+		return nil, nil, err
+	}
+
+	vals, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) ([]any, error) {
+		return row.Values()
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return columns, vals, nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/penny-vault/pvdata/data"
+)
+
+var _ = Describe("TableQuery", func() {
+	It("recognizes FIGIs", func() {
+		Expect(data.IsFigi("BBG000B9XRY4")).To(BeTrue())
+		Expect(data.IsFigi("BBG000BHTMY2")).To(BeTrue())
+		Expect(data.IsFigi("AAPL")).To(BeFalse())
+		Expect(data.IsFigi("bbg000b9xry4")).To(BeFalse())
+		Expect(data.IsFigi("BBG000B9XRY")).To(BeFalse())
+	})
+
+	It("builds a paged statement", func() {
+		start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		query := data.NewTableQuery("eod_a1b2c3", "composite_figi", "event_date").
+			Where("composite_figi = $%d", "BBG000B9XRY4").
+			Where("event_date >= $%d", start)
+		query.Limit = 101
+		query.Offset = 200
+
+		sql, args := query.Statement(`"ticker", "close"`)
+		Expect(sql).To(Equal(`SELECT "ticker", "close" FROM eod_a1b2c3 WHERE composite_figi = $1 AND event_date >= $2 ORDER BY composite_figi, event_date LIMIT 101 OFFSET 200`))
+		Expect(args).To(Equal([]any{"BBG000B9XRY4", start}))
+	})
+
+	It("reuses an argument within a condition", func() {
+		query := data.NewTableQuery("asset_master").
+			Where("(ticker = upper($%[1]d) OR name ILIKE '%%' || $%[1]d || '%%')", "apple")
+
+		sql, args := query.Statement("*")
+		Expect(sql).To(Equal(`SELECT * FROM asset_master WHERE (ticker = upper($1) OR name ILIKE '%' || $1 || '%')`))
+		Expect(args).To(Equal([]any{"apple"}))
+	})
+})
@@ -21,7 +21,7 @@ import (
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/rs/zerolog/log"
+	"github.com/rs/zerolog"
 )
 
 type AnalystRating struct {
@@ -36,6 +36,8 @@ type AnalystRating struct {
 }
 
 func (rating *AnalystRating) SaveDB(ctx context.Context, tbl string, dbConn *pgxpool.Conn) error {
+	logger := zerolog.Ctx(ctx)
+
 	if rating.CompositeFigi == "" {
 		return nil
 	}
@@ -47,7 +49,7 @@ func (rating *AnalystRating) SaveDB(ctx context.Context, tbl string, dbConn *pgx
 
 	defer func() {
 		if err := tx.Commit(ctx); err != nil {
-			log.Error().Err(err).Msg("error committing asset transaction to database")
+			logger.Error().Err(err).Msg("error committing asset transaction to database")
 		}
 	}()
 
@@ -65,9 +67,9 @@ func (rating *AnalystRating) SaveDB(ctx context.Context, tbl string, dbConn *pgx
 	_, err = tx.Exec(ctx, sql, rating.Ticker, rating.CompositeFigi, rating.EventDate, rating.Analyst, rating.Rating)
 
 	if err != nil {
-		log.Error().Err(err).Str("SQL", sql).Msg("save analyst rating to DB failed")
+		logger.Error().Err(err).Str("SQL", sql).Msg("save analyst rating to DB failed")
 		if err2 := tx.Rollback(ctx); err2 != nil {
-			log.Error().Err(err).Msg("error rollingback tx")
+			logger.Error().Err(err).Msg("error rollingback tx")
 		}
 	}
 
@@ -77,7 +79,7 @@ func (rating *AnalystRating) SaveDB(ctx context.Context, tbl string, dbConn *pgx
 func LatestRating(ctx context.Context, tbl string, dbConn *pgxpool.Conn, analyst string) *AnalystRating {
 	rows, err := dbConn.Query(ctx, "SELECT * FROM "+tbl+" WHERE analyst=$1 ORDER BY event_date DESC LIMIT 1", analyst)
 	if err != nil {
-		log.Error().Err(err).Msg("error querying for latest rating")
+		zerolog.Ctx(ctx).Error().Err(err).Msg("error querying for latest rating")
 		return nil
 	}
 
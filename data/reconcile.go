@@ -0,0 +1,353 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
+)
+
+// Kinds of discrepancies found when reconciling two tables
+const (
+	MissingLeft        = "missing-left"
+	MissingRight       = "missing-right"
+	ValueMismatch      = "value"
+	IdentifierMismatch = "identifier"
+)
+
+var (
+	ErrReconcileNotSupported = errors.New("data type does not support reconciliation")
+)
+
+// reconcileSpec describes how records of a data type are matched and compared
+type reconcileSpec struct {
+	// Keys match records across tables; if HasDate the last key is event_date
+	Keys    []string
+	HasDate bool
+
+	// Numeric columns are compared with a relative tolerance
+	Numeric []string
+
+	// Identifiers are SQL expressions compared as text
+	Identifiers map[string]string
+
+	// Filter limits the records compared
+	Filter string
+
+	// KeyExprs replace key columns with SQL expressions; %[1]s is the name of
+	// the table on the other side
+	KeyExprs map[string]string
+}
+
+// tickerKeyPrefix marks assets matched by ticker because neither side knows their FIGI
+const tickerKeyPrefix = "ticker:"
+
+var reconcileSpecs = map[string]*reconcileSpec{
+	EODKey: {
+		Keys:        []string{"composite_figi", "event_date"},
+		HasDate:     true,
+		Numeric:     []string{"close", "volume"},
+		Identifiers: map[string]string{"ticker": "trim(ticker)"},
+	},
+	MetricKey: {
+		Keys:        []string{"composite_figi", "event_date"},
+		HasDate:     true,
+		Numeric:     []string{"market_cap", "ev", "pe", "pb", "ps"},
+		Identifiers: map[string]string{"ticker": "trim(ticker)"},
+	},
+	AssetKey: {
+		Keys:    []string{"composite_figi"},
+		Numeric: []string{},
+		Identifiers: map[string]string{
+			"ticker": "ticker",
+			"cik":    "nullif(ltrim(cik, '0'), '')",
+			"cusips": "array_to_string(array(SELECT unnest(cusips) ORDER BY 1), ',')",
+			"isins":  "array_to_string(array(SELECT unnest(isins) ORDER BY 1), ',')",
+		},
+		Filter: "active = true",
+
+		// assets awaiting FIGI enrichment take the FIGI the other side has for
+		// their ticker, or are matched by ticker when neither side has one
+		KeyExprs: map[string]string{
+			"composite_figi": `coalesce(nullif(trim(t.composite_figi), ''),
+				(SELECT o.composite_figi FROM %[1]s o WHERE o.ticker = t.ticker AND nullif(trim(o.composite_figi), '') IS NOT NULL
+					ORDER BY o.active DESC LIMIT 1),
+				'` + tickerKeyPrefix + `' || t.ticker)`,
+		},
+	},
+}
+
+// ReconcileOptions control which records are compared and how closely they must match
+type ReconcileOptions struct {
+	// Start and End limit the dates compared for dated data types
+	Start time.Time
+	End   time.Time
+
+	// Tolerance is the largest relative difference between numeric values
+	// that is not reported
+	Tolerance float64
+}
+
+// Discrepancy is a difference between two tables
+type Discrepancy struct {
+	Kind          string
+	CompositeFigi string
+	Ticker        string
+	EventDate     time.Time
+	Column        string
+	Left          string
+	Right         string
+	RelativeDiff  float64
+}
+
+// ReconcileReport summarizes the differences between two tables
+type ReconcileReport struct {
+	LeftTable  string
+	RightTable string
+
+	RowsCompared int
+	MissingLeft  int
+	MissingRight int
+
+	// counts and the largest relative difference of mismatches by column
+	Mismatches  map[string]int
+	MaxRelative map[string]float64
+}
+
+// NumDiscrepancies returns the total number of differences found
+func (report *ReconcileReport) NumDiscrepancies() int {
+	total := report.MissingLeft + report.MissingRight
+	for _, count := range report.Mismatches {
+		total += count
+	}
+	return total
+}
+
+// RelativeDiff returns |a - b| relative to the larger magnitude of the two
+func RelativeDiff(a, b float64) float64 {
+	denom := math.Max(math.Abs(a), math.Abs(b))
+	if denom == 0 {
+		return 0
+	}
+	return math.Abs(a-b) / denom
+}
+
+// Reconcile compares two tables of the same data type record by record. Each
+// discrepancy is passed to `found` as it is discovered.
+func Reconcile(ctx context.Context, dbConn *pgxpool.Conn, dataType, leftTable, rightTable string, opts ReconcileOptions, found func(*Discrepancy) error) (*ReconcileReport, error) {
+	spec, ok := reconcileSpecs[dataType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrReconcileNotSupported, dataType)
+	}
+
+	// build the list of columns selected from each side
+	identifierNames := make([]string, 0, len(spec.Identifiers))
+	for name := range spec.Identifiers {
+		identifierNames = append(identifierNames, name)
+	}
+	sort.Strings(identifierNames)
+
+	selectCols := make([]string, 0)
+	for _, key := range spec.Keys {
+		selectCols = append(selectCols, fmt.Sprintf("coalesce(l.%[1]s, r.%[1]s)", key))
+	}
+
+	selectCols = append(selectCols, fmt.Sprintf("l.%[1]s IS NULL, r.%[1]s IS NULL", spec.Keys[0]))
+	for _, col := range spec.Numeric {
+		selectCols = append(selectCols, fmt.Sprintf("l.%[1]s::float8, r.%[1]s::float8", col))
+	}
+
+	for _, name := range identifierNames {
+		selectCols = append(selectCols, fmt.Sprintf("l.id_%[1]s, r.id_%[1]s", name))
+	}
+
+	sideCols := func(otherTable string) string {
+		cols := make([]string, 0, len(spec.Keys)+len(spec.Numeric)+len(identifierNames))
+		for _, key := range spec.Keys {
+			if expr, ok := spec.KeyExprs[key]; ok {
+				cols = append(cols, fmt.Sprintf("(%s) AS %s", fmt.Sprintf(expr, otherTable), key))
+				continue
+			}
+			cols = append(cols, key)
+		}
+
+		cols = append(cols, spec.Numeric...)
+		for _, name := range identifierNames {
+			cols = append(cols, fmt.Sprintf("(%s)::text AS id_%s", spec.Identifiers[name], name))
+		}
+
+		return strings.Join(cols, ", ")
+	}
+
+	conditions := make([]string, 0, 2)
+	args := make([]any, 0, 2)
+	if spec.Filter != "" {
+		conditions = append(conditions, spec.Filter)
+	}
+
+	if spec.HasDate {
+		conditions = append(conditions, "event_date BETWEEN $1 AND $2")
+		args = append(args, opts.Start, opts.End)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	joins := make([]string, len(spec.Keys))
+	for idx, key := range spec.Keys {
+		joins[idx] = fmt.Sprintf("l.%[1]s = r.%[1]s", key)
+	}
+
+	order := make([]string, len(spec.Keys))
+	for idx := range spec.Keys {
+		order[idx] = fmt.Sprintf("%d", idx+1)
+	}
+
+	sql := fmt.Sprintf(`SELECT %[1]s
+	FROM (SELECT %[2]s FROM %[4]s t %[6]s) l
+	FULL OUTER JOIN (SELECT %[3]s FROM %[5]s t %[6]s) r ON %[7]s
+	ORDER BY %[8]s`, strings.Join(selectCols, ", "), sideCols(rightTable), sideCols(leftTable), leftTable, rightTable,
+		where, strings.Join(joins, " AND "), strings.Join(order, ", "))
+
+	rows, err := dbConn.Query(ctx, sql, args...)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Str("SQL", sql).Msg("could not query tables to reconcile")
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := &ReconcileReport{
+		LeftTable:   leftTable,
+		RightTable:  rightTable,
+		Mismatches:  make(map[string]int),
+		MaxRelative: make(map[string]float64),
+	}
+
+	for rows.Next() {
+		vals, err := rows.Values()
+		if err != nil {
+			return nil, err
+		}
+
+		base := &Discrepancy{}
+		base.CompositeFigi = strings.TrimSpace(asString(vals[0]))
+		if ticker, ok := strings.CutPrefix(base.CompositeFigi, tickerKeyPrefix); ok {
+			base.CompositeFigi = ""
+			base.Ticker = ticker
+		}
+		if spec.HasDate {
+			base.EventDate, _ = vals[1].(time.Time)
+		}
+
+		pos := len(spec.Keys)
+		missingLeft, _ := vals[pos].(bool)
+		missingRight, _ := vals[pos+1].(bool)
+		pos += 2
+
+		report.RowsCompared++
+
+		if missingLeft || missingRight {
+			discrepancy := *base
+			if missingLeft {
+				discrepancy.Kind = MissingLeft
+				report.MissingLeft++
+			} else {
+				discrepancy.Kind = MissingRight
+				report.MissingRight++
+			}
+
+			if err := found(&discrepancy); err != nil {
+				return report, err
+			}
+			continue
+		}
+
+		for _, col := range spec.Numeric {
+			left, leftOk := vals[pos].(float64)
+			right, rightOk := vals[pos+1].(float64)
+			pos += 2
+
+			if !leftOk || !rightOk {
+				continue
+			}
+
+			diff := RelativeDiff(left, right)
+			if diff <= opts.Tolerance {
+				continue
+			}
+
+			report.Mismatches[col]++
+			if diff > report.MaxRelative[col] {
+				report.MaxRelative[col] = diff
+			}
+
+			discrepancy := *base
+			discrepancy.Kind = ValueMismatch
+			discrepancy.Column = col
+			discrepancy.Left = fmt.Sprintf("%g", left)
+			discrepancy.Right = fmt.Sprintf("%g", right)
+			discrepancy.RelativeDiff = diff
+			if err := found(&discrepancy); err != nil {
+				return report, err
+			}
+		}
+
+		for _, name := range identifierNames {
+			left := strings.TrimSpace(asString(vals[pos]))
+			right := strings.TrimSpace(asString(vals[pos+1]))
+			pos += 2
+
+			// a missing identifier on one side is not a conflict
+			if left == "" || right == "" || left == right {
+				continue
+			}
+
+			report.Mismatches[name]++
+
+			discrepancy := *base
+			discrepancy.Kind = IdentifierMismatch
+			discrepancy.Column = name
+			discrepancy.Left = left
+			discrepancy.Right = right
+			if err := found(&discrepancy); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	return report, rows.Err()
+}
+
+func asString(val any) string {
+	if val == nil {
+		return ""
+	}
+
+	if str, ok := val.(string); ok {
+		return str
+	}
+
+	return fmt.Sprintf("%v", val)
+}
@@ -0,0 +1,148 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/penny-vault/pvdata/data"
+)
+
+var _ = Describe("Reconcile", func() {
+	Context("relative difference", func() {
+		It("is zero when both values are zero", func() {
+			Expect(data.RelativeDiff(0, 0)).To(Equal(0.0))
+		})
+
+		It("is relative to the larger magnitude", func() {
+			Expect(data.RelativeDiff(100, 99)).To(BeNumerically("~", 0.01, 1e-9))
+			Expect(data.RelativeDiff(99, 100)).To(BeNumerically("~", 0.01, 1e-9))
+		})
+
+		It("is one when a single value is zero", func() {
+			Expect(data.RelativeDiff(0, 42)).To(Equal(1.0))
+		})
+	})
+
+	Context("report", func() {
+		It("counts every discrepancy", func() {
+			report := &data.ReconcileReport{
+				MissingLeft:  2,
+				MissingRight: 1,
+				Mismatches:   map[string]int{"close": 3, "ticker": 1},
+			}
+			Expect(report.NumDiscrepancies()).To(Equal(7))
+		})
+	})
+
+	Context("tables", Ordered, func() {
+		var (
+			ctx  context.Context
+			pool *pgxpool.Pool
+			conn *pgxpool.Conn
+			opts data.ReconcileOptions
+		)
+
+		reconcile := func(dataType string) (*data.ReconcileReport, []*data.Discrepancy) {
+			discrepancies := make([]*data.Discrepancy, 0)
+			report, err := data.Reconcile(ctx, conn, dataType, "reconcile_left", "reconcile_right", opts,
+				func(discrepancy *data.Discrepancy) error {
+					discrepancies = append(discrepancies, discrepancy)
+					return nil
+				})
+			Expect(err).NotTo(HaveOccurred())
+			return report, discrepancies
+		}
+
+		BeforeAll(func() {
+			ctx = context.Background()
+			pool, conn = testDB(ctx)
+			opts = data.ReconcileOptions{
+				Start:     time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+				End:       time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC),
+				Tolerance: 0.001,
+			}
+		})
+
+		AfterAll(func() {
+			if conn == nil {
+				return
+			}
+			conn.Release()
+			pool.Close()
+		})
+
+		AfterEach(func() {
+			_, err := conn.Exec(ctx, "DROP TABLE IF EXISTS reconcile_left; DROP TABLE IF EXISTS reconcile_right;")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("matches quotes on FIGI and date and reports differences beyond the tolerance", func() {
+			_, err := conn.Exec(ctx, `CREATE TEMPORARY TABLE reconcile_left (ticker TEXT, composite_figi TEXT, event_date DATE, close NUMERIC, volume BIGINT);
+CREATE TEMPORARY TABLE reconcile_right (LIKE reconcile_left);
+INSERT INTO reconcile_left VALUES
+	('AAA', 'BBG000000001', '2024-01-02', 100, 1000),
+	('AAA', 'BBG000000001', '2024-01-03', 101, 1000),
+	('BBB', 'BBG000000002', '2024-01-02', 50, 500),
+	('AAA', 'BBG000000001', '2023-12-29', 1, 1);
+INSERT INTO reconcile_right VALUES
+	('AAA', 'BBG000000001', '2024-01-02', 100.05, 1000),
+	('AAA', 'BBG000000001', '2024-01-03', 105, 1000),
+	('BBB', 'BBG000000002', '2024-01-03', 51, 500);`)
+			Expect(err).NotTo(HaveOccurred())
+
+			report, discrepancies := reconcile(data.EODKey)
+			Expect(report.RowsCompared).To(Equal(4))
+			Expect(report.MissingLeft).To(Equal(1))
+			Expect(report.MissingRight).To(Equal(1))
+			Expect(report.Mismatches).To(Equal(map[string]int{"close": 1}))
+			Expect(report.MaxRelative["close"]).To(BeNumerically("~", 4.0/105, 1e-9))
+
+			Expect(discrepancies).To(HaveLen(3))
+			Expect(discrepancies[0].Kind).To(Equal(data.ValueMismatch))
+			Expect(discrepancies[0].EventDate).To(Equal(time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)))
+			Expect(discrepancies[0].Left).To(Equal("101"))
+			Expect(discrepancies[0].Right).To(Equal("105"))
+		})
+
+		It("matches assets without a FIGI by ticker", func() {
+			_, err := conn.Exec(ctx, `CREATE TEMPORARY TABLE reconcile_left (ticker TEXT, composite_figi TEXT, active BOOLEAN, cik TEXT, cusips TEXT[], isins TEXT[]);
+CREATE TEMPORARY TABLE reconcile_right (LIKE reconcile_left);
+INSERT INTO reconcile_left VALUES
+	('AAA', 'BBG000000001', true, '0000320193', NULL, NULL),
+	('NEW', '', true, '1', NULL, NULL),
+	('BOTH', NULL, true, '2', NULL, NULL);
+INSERT INTO reconcile_right VALUES
+	('AAA', '', true, '320193', NULL, NULL),
+	('NEW', 'BBG000000003', true, '1', NULL, NULL),
+	('BOTH', '', true, '3', NULL, NULL);`)
+			Expect(err).NotTo(HaveOccurred())
+
+			report, discrepancies := reconcile(data.AssetKey)
+			Expect(report.RowsCompared).To(Equal(3))
+			Expect(report.MissingLeft + report.MissingRight).To(Equal(0))
+			Expect(report.Mismatches).To(Equal(map[string]int{"cik": 1}))
+
+			Expect(discrepancies).To(HaveLen(1))
+			Expect(discrepancies[0].CompositeFigi).To(BeEmpty())
+			Expect(discrepancies[0].Ticker).To(Equal("BOTH"))
+		})
+	})
+})
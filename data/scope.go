@@ -0,0 +1,67 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data
+
+import (
+	"context"
+	"time"
+)
+
+type fetchScopeKey struct{}
+
+type dryRunKey struct{}
+
+// FetchRequest asks a provider for the data of a single asset between two dates (inclusive)
+type FetchRequest struct {
+	Ticker        string
+	CompositeFigi string
+	Start         time.Time
+	End           time.Time
+}
+
+// FetchScope narrows what a dataset fetches. Datasets that honor a scope fetch
+// exactly the requested assets and dates instead of their usual selection. If
+// no requests are given the dataset fetches its usual assets between Start
+// and End (either may be zero to use the dataset's default).
+type FetchScope struct {
+	Requests []*FetchRequest
+
+	Start time.Time
+	End   time.Time
+}
+
+// WithFetchScope returns a copy of ctx carrying the fetch scope
+func WithFetchScope(ctx context.Context, scope *FetchScope) context.Context {
+	return context.WithValue(ctx, fetchScopeKey{}, scope)
+}
+
+// FetchScopeFromContext returns the fetch scope carried by ctx, if any
+func FetchScopeFromContext(ctx context.Context) (*FetchScope, bool) {
+	scope, ok := ctx.Value(fetchScopeKey{}).(*FetchScope)
+	return scope, ok && scope != nil
+}
+
+// WithDryRun returns a copy of ctx marking the fetch as a dry run. Datasets
+// fetched during a dry run must only publish observations; files, uploads and
+// other side effects are skipped.
+func WithDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, true)
+}
+
+// IsDryRun reports whether ctx belongs to a dry run
+func IsDryRun(ctx context.Context) bool {
+	dryRun, _ := ctx.Value(dryRunKey{}).(bool)
+	return dryRun
+}
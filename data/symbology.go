@@ -0,0 +1,152 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
+)
+
+// Identifier types recorded in the symbology table
+const (
+	TickerID = "ticker"
+	CusipID  = "cusip"
+	IsinID   = "isin"
+)
+
+var (
+	ErrSymbolNotFound = errors.New("symbol not found")
+)
+
+// Identifiers returns the identifiers currently held by the asset keyed by type
+func (asset *Asset) Identifiers() map[string][]string {
+	ids := make(map[string][]string, 3)
+	if ticker := strings.TrimSpace(asset.Ticker); ticker != "" {
+		ids[TickerID] = []string{ticker}
+	}
+
+	if len(asset.CUSIP) > 0 {
+		ids[CusipID] = asset.CUSIP
+	}
+
+	if len(asset.ISIN) > 0 {
+		ids[IsinID] = asset.ISIN
+	}
+
+	return ids
+}
+
+type symbologyKey struct{}
+
+type symbologyTarget struct {
+	table string
+	asOf  time.Time
+}
+
+// WithSymbology returns a context that makes Asset.SaveDB record changes to
+// the asset's identifiers in the symbology table `tbl` as of `asOf`
+func WithSymbology(ctx context.Context, tbl string, asOf time.Time) context.Context {
+	return context.WithValue(ctx, symbologyKey{}, symbologyTarget{table: tbl, asOf: asOf})
+}
+
+func symbologyFromContext(ctx context.Context) (symbologyTarget, bool) {
+	target, ok := ctx.Value(symbologyKey{}).(symbologyTarget)
+	return target, ok && target.table != ""
+}
+
+// updateSymbology records the asset's identifiers in the symbology table
+// `tbl`. New identifiers are opened from `asOf`. CUSIPs and ISINs the asset no
+// longer holds are closed as of `asOf`; since an asset may trade under more
+// than one ticker, only the tickers in `retiredTickers` are closed. Identifier
+// types the asset has no values for are left untouched.
+func (asset *Asset) updateSymbology(ctx context.Context, tx Querier, tbl string, asOf time.Time, retiredTickers []string) error {
+	logger := zerolog.Ctx(ctx)
+
+	closeSQL := fmt.Sprintf(`UPDATE %s SET valid_to = $4
+	WHERE composite_figi = $1 AND id_type = $2 AND valid_to IS NULL AND NOT (value = ANY($3))`, tbl)
+
+	closeTickersSQL := fmt.Sprintf(`UPDATE %s SET valid_to = $3
+	WHERE composite_figi = $1 AND id_type = 'ticker' AND valid_to IS NULL AND value = ANY($2)`, tbl)
+
+	openSQL := fmt.Sprintf(`INSERT INTO %[1]s ("composite_figi", "id_type", "value", "valid_from")
+	SELECT $1, $2, v, $4
+	FROM unnest($3::text[]) AS v
+	WHERE NOT EXISTS (SELECT 1 FROM %[1]s WHERE composite_figi = $1 AND id_type = $2 AND value = v AND valid_to IS NULL)
+	ON CONFLICT DO NOTHING`, tbl)
+
+	for idType, values := range asset.Identifiers() {
+		if idType == TickerID {
+			if len(retiredTickers) > 0 {
+				if _, err := tx.Exec(ctx, closeTickersSQL, asset.CompositeFigi, retiredTickers, asOf); err != nil {
+					logger.Error().Err(err).Str("SQL", closeTickersSQL).Msg("could not close symbology")
+					return err
+				}
+			}
+		} else if _, err := tx.Exec(ctx, closeSQL, asset.CompositeFigi, idType, values, asOf); err != nil {
+			logger.Error().Err(err).Str("SQL", closeSQL).Msg("could not close symbology")
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, openSQL, asset.CompositeFigi, idType, values, asOf); err != nil {
+			logger.Error().Err(err).Str("SQL", openSQL).Msg("could not open symbology")
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ResolveFigi returns the composite FIGI that held the identifier `value` of
+// type `idType` (ticker, cusip or isin) on `date`
+func ResolveFigi(ctx context.Context, dbConn *pgxpool.Conn, tbl, idType, value string, date time.Time) (string, error) {
+	sql := fmt.Sprintf(`SELECT composite_figi FROM %s
+	WHERE id_type = $1 AND value = $2 AND valid_from <= $3 AND (valid_to IS NULL OR valid_to > $3)
+	ORDER BY valid_from DESC LIMIT 1`, tbl)
+
+	var figi string
+	if err := dbConn.QueryRow(ctx, sql, idType, value, date).Scan(&figi); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrSymbolNotFound
+		}
+
+		zerolog.Ctx(ctx).Error().Err(err).Str("SQL", sql).Msg("could not resolve figi")
+		return "", err
+	}
+
+	return figi, nil
+}
+
+// SymbolsOf returns the identifiers of type `idType` held by the composite
+// FIGI on `date`
+func SymbolsOf(ctx context.Context, dbConn *pgxpool.Conn, tbl, compositeFigi, idType string, date time.Time) ([]string, error) {
+	sql := fmt.Sprintf(`SELECT value FROM %s
+	WHERE composite_figi = $1 AND id_type = $2 AND valid_from <= $3 AND (valid_to IS NULL OR valid_to > $3)
+	ORDER BY value`, tbl)
+
+	rows, err := dbConn.Query(ctx, sql, compositeFigi, idType, date)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Str("SQL", sql).Msg("could not lookup symbols")
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
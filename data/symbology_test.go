@@ -0,0 +1,126 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/penny-vault/pvdata/data"
+)
+
+var _ = Describe("Symbology", func() {
+	It("lists the identifiers an asset holds", func() {
+		asset := &data.Asset{Ticker: " META ", CUSIP: []string{"30303M102"}}
+		Expect(asset.Identifiers()).To(Equal(map[string][]string{
+			data.TickerID: {"META"},
+			data.CusipID:  {"30303M102"},
+		}))
+	})
+
+	Describe("saving assets", Ordered, func() {
+		var (
+			ctx       context.Context
+			pool      *pgxpool.Pool
+			conn      *pgxpool.Conn
+			assetTbl  string
+			symbolTbl string
+			date      = func(year int, month time.Month, day int) time.Time {
+				return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+			}
+			save = func(asset *data.Asset, asOf time.Time) {
+				Expect(asset.SaveDB(data.WithSymbology(ctx, symbolTbl, asOf), assetTbl, conn)).To(Succeed())
+			}
+			resolve = func(ticker string, on time.Time) string {
+				figi, err := data.ResolveFigi(ctx, conn, symbolTbl, data.TickerID, ticker, on)
+				if err != nil {
+					Expect(err).To(MatchError(data.ErrSymbolNotFound))
+				}
+				return figi
+			}
+			active = func(ticker string) bool {
+				var isActive bool
+				Expect(conn.QueryRow(ctx, fmt.Sprintf("SELECT active FROM %s WHERE ticker = $1", assetTbl), ticker).Scan(&isActive)).To(Succeed())
+				return isActive
+			}
+		)
+
+		BeforeAll(func() {
+			ctx = context.Background()
+			pool, conn = testDB(ctx)
+
+			suffix := time.Now().UnixNano()
+			assetTbl = fmt.Sprintf("assets_symbology_%d", suffix)
+			symbolTbl = fmt.Sprintf("symbology_%d", suffix)
+
+			_, err := conn.Exec(ctx, data.DataTypes[data.AssetKey].ExpandedSchema(assetTbl))
+			Expect(err).NotTo(HaveOccurred())
+			_, err = conn.Exec(ctx, data.DataTypes[data.SymbologyKey].ExpandedSchema(symbolTbl))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterAll(func() {
+			if conn == nil {
+				return
+			}
+			_, err := conn.Exec(ctx, fmt.Sprintf("DROP TABLE IF EXISTS %s; DROP TABLE IF EXISTS %s;", assetTbl, symbolTbl))
+			Expect(err).NotTo(HaveOccurred())
+			conn.Release()
+			pool.Close()
+		})
+
+		It("follows a ticker rename from the date it was seen", func() {
+			fb := &data.Asset{Ticker: "FB", CompositeFigi: "BBG000MM2P62", ShareClassFigi: "BBG001SQCQB5",
+				PrimaryExchange: data.NasdaqExchange, AssetType: data.CommonStock, Active: true, ListingDate: "2012-05-18"}
+			save(fb, date(2020, 1, 2))
+
+			meta := *fb
+			meta.Ticker = "META"
+			save(&meta, date(2022, 6, 9))
+
+			Expect(resolve("FB", date(2021, 1, 4))).To(Equal("BBG000MM2P62"))
+			Expect(resolve("FB", date(2022, 6, 10))).To(BeEmpty())
+			Expect(resolve("META", date(2021, 1, 4))).To(BeEmpty())
+			Expect(resolve("META", date(2022, 6, 10))).To(Equal("BBG000MM2P62"))
+
+			// identifiers are not backdated to the listing date
+			Expect(resolve("FB", date(2015, 1, 2))).To(BeEmpty())
+
+			Expect(active("FB")).To(BeFalse())
+			Expect(active("META")).To(BeTrue())
+		})
+
+		It("keeps listings on other exchanges active", func() {
+			primary := &data.Asset{Ticker: "AAA", CompositeFigi: "BBG000AAAAA1", ShareClassFigi: "BBG001AAAAA1",
+				PrimaryExchange: data.NYSEExchange, AssetType: data.CommonStock, Active: true}
+			save(primary, date(2023, 1, 3))
+
+			other := *primary
+			other.Ticker = "AAA.X"
+			other.PrimaryExchange = data.OTCExchange
+			save(&other, date(2023, 1, 4))
+
+			Expect(active("AAA")).To(BeTrue())
+			Expect(active("AAA.X")).To(BeTrue())
+			Expect(resolve("AAA", date(2023, 2, 1))).To(Equal("BBG000AAAAA1"))
+			Expect(resolve("AAA.X", date(2023, 2, 1))).To(Equal("BBG000AAAAA1"))
+		})
+	})
+})
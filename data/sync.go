@@ -0,0 +1,143 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog"
+)
+
+// syncTempTable receives rows copied from the source database before they are merged
+const syncTempTable = "pvdata_sync"
+
+// CommonColumns returns the columns of `dst` that also exist in `src`
+func CommonColumns(dst, src []*Column) []*Column {
+	common := make([]*Column, 0, len(dst))
+	for _, column := range dst {
+		if slices.ContainsFunc(src, func(other *Column) bool { return other.Name == column.Name }) {
+			common = append(common, column)
+		}
+	}
+	return common
+}
+
+// UpsertFromSQL returns the SQL that merges the text columns of `source` into
+// `table`, replacing rows with the same primary key
+func UpsertFromSQL(table, source string, columns []*Column, primaryKey []string) string {
+	casts := make([]string, len(columns))
+	updates := make([]string, 0, len(columns))
+	for idx, column := range columns {
+		casts[idx] = fmt.Sprintf(`"%s"::%s`, column.Name, column.SQLType)
+		if !slices.Contains(primaryKey, column.Name) {
+			updates = append(updates, fmt.Sprintf(`"%[1]s" = EXCLUDED."%[1]s"`, column.Name))
+		}
+	}
+
+	sql := fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s", table, ColumnNames(columns), strings.Join(casts, ", "), source)
+	switch {
+	case len(primaryKey) == 0:
+		return sql
+	case len(updates) == 0:
+		return fmt.Sprintf("%s ON CONFLICT (%s) DO NOTHING", sql, strings.Join(primaryKey, ", "))
+	default:
+		return fmt.Sprintf("%s ON CONFLICT (%s) DO UPDATE SET %s", sql, strings.Join(primaryKey, ", "), strings.Join(updates, ", "))
+	}
+}
+
+// SyncTable copies the rows of `table` in `src` to the table of the same name
+// in `dst`. Unless `full` is set only rows on or after the last event date
+// already in `dst` are copied; copied rows replace rows with the same primary
+// key. Rows deleted from `src` are not removed. Returns the number of rows copied.
+func SyncTable(ctx context.Context, src Querier, dst pgx.Tx, table string, primaryKey []string, full bool) (int64, error) {
+	logger := zerolog.Ctx(ctx)
+
+	srcColumns, err := TableColumns(ctx, src, table)
+	if err != nil {
+		return 0, err
+	}
+
+	dstColumns, err := TableColumns(ctx, dst, table)
+	if err != nil {
+		return 0, err
+	}
+
+	columns := CommonColumns(dstColumns, srcColumns)
+	if len(columns) == 0 {
+		return 0, nil
+	}
+
+	names := make([]string, len(columns))
+	defs := make([]string, len(columns))
+	selects := make([]string, len(columns))
+	for idx, column := range columns {
+		names[idx] = column.Name
+		defs[idx] = fmt.Sprintf(`"%s" text`, column.Name)
+		selects[idx] = fmt.Sprintf(`"%s"::text`, column.Name)
+	}
+
+	sql := fmt.Sprintf("SELECT %s FROM %s", strings.Join(selects, ", "), table)
+	args := make([]any, 0, 1)
+	if !full && slices.ContainsFunc(columns, func(column *Column) bool { return column.Name == "event_date" }) {
+		var since *time.Time
+		if err := dst.QueryRow(ctx, fmt.Sprintf("SELECT max(event_date) FROM %s", table)).Scan(&since); err != nil {
+			return 0, err
+		}
+
+		if since != nil {
+			sql = fmt.Sprintf("%s WHERE event_date >= $1", sql)
+			args = append(args, *since)
+		}
+	}
+
+	if _, err := dst.Exec(ctx, fmt.Sprintf("CREATE TEMP TABLE %s (%s) ON COMMIT DROP", syncTempTable, strings.Join(defs, ", "))); err != nil {
+		return 0, err
+	}
+
+	rows, err := src.Query(ctx, sql, args...)
+	if err != nil {
+		logger.Error().Err(err).Str("SQL", sql).Msg("could not read rows to sync")
+		return 0, err
+	}
+	defer rows.Close()
+
+	count, err := dst.CopyFrom(ctx, pgx.Identifier{syncTempTable}, names, pgx.CopyFromFunc(func() ([]any, error) {
+		if !rows.Next() {
+			return nil, rows.Err()
+		}
+		return rows.Values()
+	}))
+	if err != nil {
+		logger.Error().Err(err).Str("Table", table).Msg("could not copy rows to sync")
+		return 0, err
+	}
+
+	sql = UpsertFromSQL(table, syncTempTable, columns, primaryKey)
+	if _, err := dst.Exec(ctx, sql); err != nil {
+		logger.Error().Err(err).Str("SQL", sql).Msg("could not merge synced rows")
+		return 0, err
+	}
+
+	if _, err := dst.Exec(ctx, fmt.Sprintf("DROP TABLE %s", syncTempTable)); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
@@ -0,0 +1,59 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/penny-vault/pvdata/data"
+)
+
+var _ = Describe("Sync", func() {
+	var columns []*data.Column
+
+	BeforeEach(func() {
+		columns = []*data.Column{
+			{Name: "composite_figi", SQLType: "character(12)"},
+			{Name: "event_date", SQLType: "date"},
+			{Name: "close", SQLType: "numeric(12,4)"},
+		}
+	})
+
+	It("keeps the destination's columns that exist in the source", func() {
+		src := []*data.Column{
+			{Name: "close", SQLType: "numeric(12,4)"},
+			{Name: "composite_figi", SQLType: "character(12)"},
+			{Name: "legacy", SQLType: "text"},
+		}
+
+		common := data.CommonColumns(columns, src)
+		Expect(common).To(HaveLen(2))
+		Expect(common[0].Name).To(Equal("composite_figi"))
+		Expect(common[1].Name).To(Equal("close"))
+	})
+
+	It("upserts on the primary key casting text columns to their types", func() {
+		sql := data.UpsertFromSQL("eod", "pvdata_sync", columns, []string{"composite_figi", "event_date"})
+		Expect(sql).To(Equal(`INSERT INTO eod ("composite_figi", "event_date", "close") ` +
+			`SELECT "composite_figi"::character(12), "event_date"::date, "close"::numeric(12,4) FROM pvdata_sync ` +
+			`ON CONFLICT (composite_figi, event_date) DO UPDATE SET "close" = EXCLUDED."close"`))
+	})
+
+	It("ignores duplicates when every column is part of the primary key", func() {
+		sql := data.UpsertFromSQL("eod", "pvdata_sync", columns[:2], []string{"composite_figi", "event_date"})
+		Expect(sql).To(HaveSuffix("ON CONFLICT (composite_figi, event_date) DO NOTHING"))
+	})
+})
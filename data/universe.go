@@ -0,0 +1,154 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+// UniversePolicy decides which assets a price subscription fetches
+type UniversePolicy string
+
+const (
+	// UniverseActive fetches assets that are currently active
+	UniverseActive UniversePolicy = "active"
+
+	// UniverseRecent fetches active assets and assets delisted within the last RecentDays days
+	UniverseRecent UniversePolicy = "recent"
+
+	// UniverseAll fetches every asset that was listed at some point during the requested range
+	UniverseAll UniversePolicy = "all"
+)
+
+const (
+	UniverseSetting           = "universe"
+	UniverseRecentDaysSetting = "universe.recent_days"
+	DefaultUniverseRecentDays = 30
+)
+
+var (
+	ErrUnknownUniversePolicy = errors.New("unknown universe policy")
+)
+
+// Universe selects the assets and dates a price subscription fetches
+type Universe struct {
+	Policy     UniversePolicy
+	RecentDays int
+
+	// Start and End bound the dates that are fetched
+	Start time.Time
+	End   time.Time
+}
+
+// ParseUniversePolicy converts a string to a UniversePolicy
+func ParseUniversePolicy(val string) (UniversePolicy, error) {
+	policy := UniversePolicy(strings.ToLower(strings.TrimSpace(val)))
+	switch policy {
+	case UniverseActive, UniverseRecent, UniverseAll:
+		return policy, nil
+	default:
+		return UniverseActive, fmt.Errorf("%w: %s", ErrUnknownUniversePolicy, val)
+	}
+}
+
+// UniverseFromSettings returns the universe configured in the subscription settings
+// covering the dates from start to end
+func UniverseFromSettings(settings map[string]string, start, end time.Time) *Universe {
+	universe := &Universe{
+		Policy:     UniverseActive,
+		RecentDays: DefaultUniverseRecentDays,
+		Start:      start,
+		End:        end,
+	}
+
+	if val, ok := settings[UniverseSetting]; ok {
+		if policy, err := ParseUniversePolicy(val); err == nil {
+			universe.Policy = policy
+		} else {
+			log.Warn().Err(err).Msg("ignoring invalid universe setting; using active assets")
+		}
+	}
+
+	if val, ok := settings[UniverseRecentDaysSetting]; ok {
+		if days, err := strconv.Atoi(val); err == nil && days >= 0 {
+			universe.RecentDays = days
+		} else {
+			log.Warn().Str("Value", val).Msg("ignoring invalid universe recent days setting")
+		}
+	}
+
+	return universe
+}
+
+// Assets returns the assets in the universe. If no table is given
+// DefaultAssetTable is used.
+func (universe *Universe) Assets(ctx context.Context, dbConn *pgxpool.Conn, tables ...string) []*Asset {
+	assetTable := DefaultAssetTable()
+	if len(tables) > 0 {
+		assetTable = tables[0]
+	}
+
+	switch universe.Policy {
+	case UniverseRecent:
+		return selectAssets(ctx, dbConn, assetTable, "active=true OR delisted >= $1",
+			time.Now().AddDate(0, 0, -universe.RecentDays))
+	case UniverseAll:
+		return selectAssets(ctx, dbConn, assetTable, "(listed IS NULL OR listed <= $2) AND (delisted IS NULL OR delisted >= $1)",
+			universe.Start, universe.End)
+	default:
+		return selectAssets(ctx, dbConn, assetTable, "active=true")
+	}
+}
+
+// FetchRange returns the dates to fetch for the asset: the universe's range
+// limited to when the asset was listed. Under the recent policy an asset
+// delisted before the range is fetched over an equally long window ending on
+// its delisting date. Returns false if the asset was not listed during the
+// range.
+func (universe *Universe) FetchRange(asset *Asset) (time.Time, time.Time, bool) {
+	start := universe.Start
+	end := universe.End
+
+	if delisted, ok := asset.DelistedOn(); ok && universe.Policy == UniverseRecent && delisted.Before(start) {
+		lookback := time.Since(universe.Start)
+		if !universe.End.IsZero() {
+			lookback = universe.End.Sub(universe.Start)
+		}
+
+		start = delisted.Add(-lookback)
+	}
+
+	if listed, ok := asset.ListedOn(); ok && listed.After(start) {
+		start = listed
+	}
+
+	if delisted, ok := asset.DelistedOn(); ok && (end.IsZero() || delisted.Before(end)) {
+		end = delisted
+	}
+
+	if !end.IsZero() && end.Before(start) {
+		return start, end, false
+	}
+
+	return start, end, true
+}
@@ -0,0 +1,86 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/penny-vault/pvdata/data"
+)
+
+var _ = Describe("Universe", func() {
+	var (
+		start    time.Time
+		end      time.Time
+		universe *data.Universe
+	)
+
+	BeforeEach(func() {
+		start = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		end = time.Date(2020, 12, 31, 0, 0, 0, 0, time.UTC)
+		universe = data.UniverseFromSettings(map[string]string{
+			"universe":             "all",
+			"universe.recent_days": "10",
+		}, start, end)
+	})
+
+	It("reads the policy from subscription settings", func() {
+		Expect(universe.Policy).To(Equal(data.UniverseAll))
+		Expect(universe.RecentDays).To(Equal(10))
+
+		Expect(data.UniverseFromSettings(map[string]string{"universe": "bogus"}, start, end).Policy).To(Equal(data.UniverseActive))
+	})
+
+	It("limits the fetched dates to when the asset was listed", func() {
+		from, to, ok := universe.FetchRange(&data.Asset{
+			ListingDate:   "2020-03-01T00:00:00.000000Z",
+			DelistingDate: "2020-06-15",
+		})
+
+		Expect(ok).To(BeTrue())
+		Expect(from).To(Equal(time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)))
+		Expect(to).To(Equal(time.Date(2020, 6, 15, 0, 0, 0, 0, time.UTC)))
+	})
+
+	It("uses the full range when listing dates are unknown", func() {
+		from, to, ok := universe.FetchRange(&data.Asset{})
+		Expect(ok).To(BeTrue())
+		Expect(from).To(Equal(start))
+		Expect(to).To(Equal(end))
+	})
+
+	It("skips assets delisted before the range", func() {
+		_, _, ok := universe.FetchRange(&data.Asset{DelistingDate: "2019-06-15"})
+		Expect(ok).To(BeFalse())
+	})
+
+	It("fetches assets delisted before the range under the recent policy", func() {
+		runEnd := time.Date(2024, 6, 15, 0, 0, 0, 0, time.UTC)
+		universe = data.UniverseFromSettings(map[string]string{
+			"universe":             "recent",
+			"universe.recent_days": "60",
+		}, runEnd.AddDate(0, 0, -14), runEnd)
+
+		// delisted 30 days before the run
+		delisted := runEnd.AddDate(0, 0, -30)
+		from, to, ok := universe.FetchRange(&data.Asset{DelistingDate: delisted.Format("2006-01-02")})
+		Expect(ok).To(BeTrue())
+		Expect(from).To(Equal(delisted.AddDate(0, 0, -14)))
+		Expect(to).To(Equal(delisted))
+	})
+})
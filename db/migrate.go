@@ -16,6 +16,7 @@ package db
 
 import (
 	"embed"
+	"errors"
 
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/pgx/v5"
@@ -37,6 +38,10 @@ func Migrate(databaseURL string) error {
 		return err
 	}
 
-	err = migration.Up()
-	return err
+	// an up-to-date database is not an error
+	if err := migration.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+
+	return nil
 }
@@ -0,0 +1,18 @@
+BEGIN;
+
+-- Corporate actions (splits and dividends) that have been applied to the
+-- adj_close column of an EOD table. The factor is the multiplier applied to
+-- every close before event_date.
+
+CREATE TABLE eod_adjustments (
+    table_name TEXT NOT NULL,
+    composite_figi TEXT NOT NULL,
+    event_date DATE NOT NULL,
+    dividend NUMERIC(12, 4) NOT NULL DEFAULT 0.0,
+    split_factor NUMERIC(9, 6) NOT NULL DEFAULT 1.0,
+    factor DOUBLE PRECISION NOT NULL DEFAULT 1.0,
+    applied_on TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (table_name, composite_figi, event_date)
+);
+
+COMMIT;
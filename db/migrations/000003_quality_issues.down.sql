@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE IF EXISTS quality_issues;
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS settings;
+
+COMMIT;
@@ -0,0 +1,27 @@
+BEGIN;
+
+-- Per-subscription pv-data settings (as opposed to provider config)
+ALTER TABLE subscriptions ADD COLUMN settings JSONB NOT NULL DEFAULT '{}'::jsonb;
+
+-- Problems found by data quality rules. Rejected observations are discarded,
+-- quarantined observations are kept here (see observation) instead of being
+-- saved, and warnings are saved as usual.
+
+CREATE TABLE quality_issues (
+    id BIGSERIAL PRIMARY KEY,
+    subscription_id UUID NOT NULL,
+    table_name TEXT NOT NULL,
+    data_type TEXT NOT NULL,
+    rule TEXT NOT NULL,
+    action TEXT NOT NULL,
+    ticker TEXT,
+    composite_figi TEXT,
+    event_date DATE,
+    message TEXT NOT NULL,
+    observation JSONB,
+    detected_on TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX quality_issues_subscription_idx ON quality_issues(subscription_id, detected_on DESC);
+
+COMMIT;
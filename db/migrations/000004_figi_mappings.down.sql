@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP TABLE IF EXISTS figi_mappings;
+
+COMMIT;
@@ -0,0 +1,26 @@
+BEGIN;
+
+-- Results of OpenFIGI mapping requests. Identifiers that could not be mapped
+-- are kept with not_found set so they are not requested again until the
+-- cache entry expires.
+
+CREATE TABLE figi_mappings (
+    id_type TEXT NOT NULL,
+    id_value TEXT NOT NULL,
+    exchange_code TEXT NOT NULL DEFAULT '',
+    ticker TEXT,
+    figi TEXT,
+    composite_figi TEXT,
+    share_class_figi TEXT,
+    name TEXT,
+    market_sector TEXT,
+    security_type TEXT,
+    security_type2 TEXT,
+    not_found BOOLEAN NOT NULL DEFAULT false,
+    looked_up TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (id_type, id_value, exchange_code)
+);
+
+CREATE INDEX figi_mappings_composite_figi_idx ON figi_mappings(composite_figi);
+
+COMMIT;
@@ -0,0 +1,35 @@
+BEGIN;
+
+-- One record per composite FIGI merged from every asset subscription. The
+-- provenance column records which source each field was taken from.
+
+CREATE TABLE asset_master (
+    composite_figi TEXT PRIMARY KEY,
+    ticker TEXT,
+    share_class_figi TEXT,
+    primary_exchange TEXT,
+    asset_type assettype,
+    active BOOLEAN,
+    name TEXT,
+    description TEXT,
+    corporate_url TEXT,
+    sector TEXT,
+    industry TEXT,
+    sic_code INT,
+    cik TEXT,
+    cusips TEXT[],
+    isins TEXT[],
+    other_identifiers JSONB,
+    similar_tickers TEXT[],
+    tags TEXT[],
+    listed TIMESTAMP,
+    delisted TIMESTAMP,
+    last_updated TIMESTAMP,
+    provenance JSONB NOT NULL DEFAULT '{}'::jsonb,
+    merged_on TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX asset_master_active_idx ON asset_master(active);
+CREATE INDEX asset_master_ticker_idx ON asset_master(ticker);
+
+COMMIT;
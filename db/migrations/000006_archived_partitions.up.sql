@@ -0,0 +1,28 @@
+BEGIN;
+
+-- Partitions that were exported to Parquet and dropped from the database.
+-- row_count and row_checksum are computed by PostgreSQL before the partition
+-- is dropped and checked again when it is restored.
+
+CREATE TABLE archived_partitions (
+    id BIGSERIAL PRIMARY KEY,
+    subscription_id UUID NOT NULL,
+    parent_table TEXT NOT NULL,
+    partition_name TEXT NOT NULL,
+    range_start DATE NOT NULL,
+    range_end DATE NOT NULL,
+    location TEXT NOT NULL,
+    file_name TEXT NOT NULL,
+    file_sha256 TEXT NOT NULL,
+    file_size BIGINT NOT NULL,
+    row_count BIGINT NOT NULL,
+    row_checksum TEXT NOT NULL,
+    columns JSONB NOT NULL,
+    archived_on TIMESTAMP NOT NULL DEFAULT now(),
+    restored_on TIMESTAMP
+);
+
+CREATE UNIQUE INDEX archived_partitions_current_idx ON archived_partitions(partition_name) WHERE restored_on IS NULL;
+CREATE INDEX archived_partitions_subscription_idx ON archived_partitions(subscription_id);
+
+COMMIT;
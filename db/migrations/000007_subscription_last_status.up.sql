@@ -0,0 +1,8 @@
+BEGIN;
+
+-- Outcome of the most recent run (success, failure, no_data or recovered);
+-- monitors use it to detect when a subscription recovers.
+
+ALTER TABLE subscriptions ADD COLUMN last_status TEXT;
+
+COMMIT;
@@ -0,0 +1,18 @@
+BEGIN;
+
+-- Audit log of edits to subscriptions. Values of secret config fields are
+-- masked before they are recorded.
+
+CREATE TABLE subscription_changes (
+    id BIGSERIAL PRIMARY KEY,
+    subscription_id UUID NOT NULL,
+    field TEXT NOT NULL,
+    old_value TEXT NOT NULL DEFAULT '',
+    new_value TEXT NOT NULL DEFAULT '',
+    changed_by TEXT NOT NULL,
+    changed_on TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX subscription_changes_subscription_idx ON subscription_changes(subscription_id, changed_on);
+
+COMMIT;
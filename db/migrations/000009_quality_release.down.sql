@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE quality_issues DROP COLUMN IF EXISTS released_on;
+
+COMMIT;
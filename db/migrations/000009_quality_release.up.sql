@@ -0,0 +1,8 @@
+BEGIN;
+
+-- When a quarantined observation was released into its table with
+-- pvdata quality release; NULL while it is still quarantined.
+
+ALTER TABLE quality_issues ADD COLUMN released_on TIMESTAMP;
+
+COMMIT;
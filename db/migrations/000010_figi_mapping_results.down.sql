@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE figi_mappings DROP COLUMN IF EXISTS results;
+
+COMMIT;
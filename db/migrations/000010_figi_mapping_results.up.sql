@@ -0,0 +1,9 @@
+BEGIN;
+
+-- Every result OpenFIGI returned for an identifier. The other columns hold
+-- the preferred result; keeping all of them lets cached lookups flag
+-- identifiers that map to more than one composite FIGI.
+
+ALTER TABLE figi_mappings ADD COLUMN results JSONB;
+
+COMMIT;
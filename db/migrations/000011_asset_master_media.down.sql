@@ -0,0 +1,10 @@
+BEGIN;
+
+ALTER TABLE asset_master
+    DROP COLUMN IF EXISTS headquarters_location,
+    DROP COLUMN IF EXISTS icon,
+    DROP COLUMN IF EXISTS icon_mime_type,
+    DROP COLUMN IF EXISTS logo,
+    DROP COLUMN IF EXISTS logo_mime_type;
+
+COMMIT;
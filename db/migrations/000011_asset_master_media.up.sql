@@ -0,0 +1,13 @@
+BEGIN;
+
+-- Headquarters, icons and logos merged from the asset subscriptions that
+-- provide them.
+
+ALTER TABLE asset_master
+    ADD COLUMN headquarters_location TEXT,
+    ADD COLUMN icon BYTEA,
+    ADD COLUMN icon_mime_type TEXT,
+    ADD COLUMN logo BYTEA,
+    ADD COLUMN logo_mime_type TEXT;
+
+COMMIT;
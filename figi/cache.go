@@ -0,0 +1,232 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package figi
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+const (
+	DefaultCacheTTL    = 30 * 24 * time.Hour
+	DefaultNotFoundTTL = 7 * 24 * time.Hour
+)
+
+var (
+	dbPool   *pgxpool.Pool
+	readOnly bool
+)
+
+// Mapping is a cached OpenFIGI result for an identifier
+type Mapping struct {
+	IdType         string
+	IdValue        string
+	ExchangeCode   string
+	Ticker         string
+	Figi           string
+	CompositeFigi  string
+	ShareClassFigi string
+	Name           string
+	MarketSector   string
+	SecurityType   string
+	SecurityType2  string
+	NotFound       bool
+	LookedUp       time.Time
+
+	// Results holds every result OpenFIGI returned; the fields above
+	// describe the preferred one
+	Results []*OpenFigiAsset
+}
+
+// UseDatabase persists OpenFIGI results in the figi_mappings table of the
+// database `pool` connects to. Pass nil to disable the cache.
+func UseDatabase(pool *pgxpool.Pool) {
+	dbPool = pool
+	readOnly = false
+}
+
+// UseDatabaseReadOnly answers lookups from the figi_mappings table of the
+// database `pool` connects to without saving new results (e.g. for dry runs)
+func UseDatabaseReadOnly(pool *pgxpool.Pool) {
+	dbPool = pool
+	readOnly = true
+}
+
+// Offline returns true if lookups are answered from the cache only (openfigi.offline)
+func Offline() bool {
+	return viper.GetBool("openfigi.offline")
+}
+
+// cacheTTL returns how long found (openfigi.cache_ttl) and not-found
+// (openfigi.not_found_ttl) mappings are trusted
+func cacheTTL() (time.Duration, time.Duration) {
+	ttl := DefaultCacheTTL
+	if viper.IsSet("openfigi.cache_ttl") {
+		ttl = viper.GetDuration("openfigi.cache_ttl")
+	}
+
+	notFoundTTL := DefaultNotFoundTTL
+	if viper.IsSet("openfigi.not_found_ttl") {
+		notFoundTTL = viper.GetDuration("openfigi.not_found_ttl")
+	}
+
+	return ttl, notFoundTTL
+}
+
+// Expired returns true if the mapping is older than its ttl
+func (mapping *Mapping) Expired(now time.Time, ttl, notFoundTTL time.Duration) bool {
+	if mapping.NotFound {
+		return now.Sub(mapping.LookedUp) > notFoundTTL
+	}
+	return now.Sub(mapping.LookedUp) > ttl
+}
+
+// Asset converts a found mapping back into the OpenFIGI result it was created from
+func (mapping *Mapping) Asset() *OpenFigiAsset {
+	return &OpenFigiAsset{
+		Figi:           mapping.Figi,
+		SecurityType:   mapping.SecurityType,
+		MarketSector:   mapping.MarketSector,
+		Ticker:         mapping.Ticker,
+		Name:           mapping.Name,
+		ExchangeCode:   mapping.ExchangeCode,
+		ShareClassFIGI: mapping.ShareClassFigi,
+		CompositeFIGI:  mapping.CompositeFigi,
+		SecurityType2:  mapping.SecurityType2,
+	}
+}
+
+// Assets returns every OpenFIGI result the mapping was created from. Mappings
+// cached before all results were kept return only the preferred result.
+func (mapping *Mapping) Assets() []*OpenFigiAsset {
+	if len(mapping.Results) > 0 {
+		return mapping.Results
+	}
+	return []*OpenFigiAsset{mapping.Asset()}
+}
+
+// newMapping records the results of `query`; no results records that the
+// identifier was not found
+func newMapping(query *OpenFigiQuery, results []*OpenFigiAsset, now time.Time) *Mapping {
+	mapping := &Mapping{
+		IdType:       query.IdType,
+		IdValue:      query.IdValue,
+		ExchangeCode: query.ExchangeCode,
+		NotFound:     len(results) == 0,
+		LookedUp:     now,
+	}
+
+	if len(results) > 0 {
+		asset := preferred(query, results)
+		mapping.Results = results
+		mapping.Ticker = asset.Ticker
+		mapping.Figi = asset.Figi
+		mapping.CompositeFigi = asset.CompositeFIGI
+		mapping.ShareClassFigi = asset.ShareClassFIGI
+		mapping.Name = asset.Name
+		mapping.MarketSector = asset.MarketSector
+		mapping.SecurityType = asset.SecurityType
+		mapping.SecurityType2 = asset.SecurityType2
+	}
+
+	return mapping
+}
+
+// Key identifies the query in results and the cache
+func (query *OpenFigiQuery) Key() string {
+	return query.IdType + ":" + query.IdValue + ":" + query.ExchangeCode
+}
+
+// loadMappings returns the cached mappings of the queries keyed by cacheKey
+func loadMappings(ctx context.Context, queries []*OpenFigiQuery) map[string]*Mapping {
+	result := make(map[string]*Mapping, len(queries))
+	if dbPool == nil || len(queries) == 0 {
+		return result
+	}
+
+	idTypes := make([]string, len(queries))
+	idValues := make([]string, len(queries))
+	exchanges := make([]string, len(queries))
+	for idx, query := range queries {
+		idTypes[idx] = query.IdType
+		idValues[idx] = query.IdValue
+		exchanges[idx] = query.ExchangeCode
+	}
+
+	sql := `SELECT m.id_type, m.id_value, m.exchange_code, coalesce(m.ticker, ''), coalesce(m.figi, ''),
+	coalesce(m.composite_figi, ''), coalesce(m.share_class_figi, ''), coalesce(m.name, ''),
+	coalesce(m.market_sector, ''), coalesce(m.security_type, ''), coalesce(m.security_type2, ''),
+	m.not_found, m.looked_up, m.results
+	FROM figi_mappings m
+	JOIN unnest($1::text[], $2::text[], $3::text[]) AS q(id_type, id_value, exchange_code)
+	  ON m.id_type = q.id_type AND m.id_value = q.id_value AND m.exchange_code = q.exchange_code`
+
+	rows, err := dbPool.Query(ctx, sql, idTypes, idValues, exchanges)
+	if err != nil {
+		log.Error().Err(err).Str("SQL", sql).Msg("could not load figi mappings")
+		return result
+	}
+
+	mappings, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByPos[Mapping])
+	if err != nil {
+		log.Error().Err(err).Msg("could not scan figi mappings")
+		return result
+	}
+
+	for _, mapping := range mappings {
+		result[mapping.IdType+":"+mapping.IdValue+":"+mapping.ExchangeCode] = mapping
+	}
+
+	return result
+}
+
+// saveMappings stores the mappings in the cache unless it is read-only
+func saveMappings(ctx context.Context, mappings []*Mapping) {
+	if dbPool == nil || readOnly || len(mappings) == 0 {
+		return
+	}
+
+	sql := `INSERT INTO figi_mappings ("id_type", "id_value", "exchange_code", "ticker", "figi",
+	"composite_figi", "share_class_figi", "name", "market_sector", "security_type", "security_type2",
+	"not_found", "looked_up", "results") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+	ON CONFLICT ON CONSTRAINT figi_mappings_pkey DO UPDATE SET
+	ticker = EXCLUDED.ticker,
+	figi = EXCLUDED.figi,
+	composite_figi = EXCLUDED.composite_figi,
+	share_class_figi = EXCLUDED.share_class_figi,
+	name = EXCLUDED.name,
+	market_sector = EXCLUDED.market_sector,
+	security_type = EXCLUDED.security_type,
+	security_type2 = EXCLUDED.security_type2,
+	not_found = EXCLUDED.not_found,
+	looked_up = EXCLUDED.looked_up,
+	results = EXCLUDED.results`
+
+	batch := &pgx.Batch{}
+	for _, mapping := range mappings {
+		batch.Queue(sql, mapping.IdType, mapping.IdValue, mapping.ExchangeCode, mapping.Ticker, mapping.Figi,
+			mapping.CompositeFigi, mapping.ShareClassFigi, mapping.Name, mapping.MarketSector,
+			mapping.SecurityType, mapping.SecurityType2, mapping.NotFound, mapping.LookedUp, mapping.Results)
+	}
+
+	if err := dbPool.SendBatch(ctx, batch).Close(); err != nil {
+		log.Error().Err(err).Str("SQL", sql).Msg("could not save figi mappings")
+	}
+}
@@ -23,7 +23,6 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/penny-vault/pvdata/data"
 	"github.com/rs/zerolog/log"
-	"github.com/spf13/viper"
 )
 
 var (
@@ -39,12 +38,7 @@ func MapInstance() *haxmap.Map[string, string] {
 }
 
 func LoadCacheFromDB(ctx context.Context, dbConn *pgxpool.Conn) {
-	assetTable := viper.GetString("default.asset_table")
-	if assetTable == "" {
-		log.Warn().Msg("default.asset_table not set, local figi lookup is disabled")
-		return
-	}
-
+	assetTable := data.DefaultAssetTable()
 	sql := fmt.Sprintf("SELECT ticker, composite_figi FROM %s WHERE active=true", assetTable)
 
 	rows, err := dbConn.Query(ctx, sql)
@@ -0,0 +1,255 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package figi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/penny-vault/pvdata/data"
+	"github.com/rs/zerolog/log"
+)
+
+// Identifier types
+const (
+	IdIsin   = "ID_ISIN"
+	IdCusip  = "ID_CUSIP"
+	IdTicker = "TICKER"
+	IdFigi   = "ID_BB_GLOBAL"
+	IdCik    = "CIK"
+)
+
+var (
+	ErrNotFound  = errors.New("identifier not found")
+	ErrNoCache   = errors.New("figi database is not configured")
+	isinRegex    = regexp.MustCompile(`^[A-Z]{2}[A-Z0-9]{9}[0-9]$`)
+	cusipRegex   = regexp.MustCompile(`^[0-9]{3}[A-Z0-9]{5}[0-9]$`)
+	cikRegex     = regexp.MustCompile(`^[0-9]{1,10}$`)
+	figiRegex    = regexp.MustCompile(`^BBG[A-Z0-9]{9}$`)
+	usExchange   = "US"
+	equitySector = "Equity"
+)
+
+// IdentifierType guesses the type of identifier `id` is
+func IdentifierType(id string) string {
+	id = strings.ToUpper(strings.TrimSpace(id))
+	switch {
+	case figiRegex.MatchString(id):
+		return IdFigi
+	case isinRegex.MatchString(id):
+		return IdIsin
+	case cusipRegex.MatchString(id):
+		return IdCusip
+	case cikRegex.MatchString(id):
+		return IdCik
+	default:
+		return IdTicker
+	}
+}
+
+// NewQuery creates the OpenFIGI query for an identifier
+func NewQuery(idType, id string) *OpenFigiQuery {
+	query := &OpenFigiQuery{
+		IdType:  idType,
+		IdValue: strings.ToUpper(strings.TrimSpace(id)),
+	}
+
+	switch idType {
+	case IdTicker:
+		query.ExchangeCode = usExchange
+		query.MarketSectorDescription = equitySector
+	case IdCusip:
+		query.ExchangeCode = usExchange
+	}
+
+	return query
+}
+
+// AssetQueries returns the queries that identify the asset, strongest first:
+// ISINs, then CUSIPs, then the ticker. The CIK comes last since it is shared
+// by every security the company issued.
+func AssetQueries(asset *data.Asset) []*OpenFigiQuery {
+	queries := make([]*OpenFigiQuery, 0, len(asset.ISIN)+len(asset.CUSIP)+2)
+	for _, isin := range asset.ISIN {
+		if isin != "" {
+			queries = append(queries, NewQuery(IdIsin, isin))
+		}
+	}
+
+	for _, cusip := range asset.CUSIP {
+		if cusip != "" {
+			queries = append(queries, NewQuery(IdCusip, cusip))
+		}
+	}
+
+	if ticker := strings.TrimSpace(asset.Ticker); ticker != "" {
+		queries = append(queries, NewQuery(IdTicker, ticker))
+	}
+
+	if cik := strings.TrimSpace(asset.CIK); cik != "" {
+		queries = append(queries, NewQuery(IdCik, cik))
+	}
+
+	return queries
+}
+
+// Resolution is the FIGI an identifier resolved to
+type Resolution struct {
+	// Query that resolved the asset
+	Query *OpenFigiQuery
+	Asset *OpenFigiAsset
+
+	// Candidates holds every composite FIGI the identifiers pointed to when
+	// they disagree
+	Candidates []string
+}
+
+// Conflict returns true if the identifiers pointed to more than one composite FIGI
+func (resolution *Resolution) Conflict() bool {
+	return len(resolution.Candidates) > 1
+}
+
+// preferred picks the best of the `results` returned for `query`. Results
+// with the queried ticker or listed on a US exchange are preferred.
+func preferred(query *OpenFigiQuery, results []*OpenFigiAsset) *OpenFigiAsset {
+	for _, result := range results {
+		if query.IdType == IdTicker && result.Ticker == query.IdValue {
+			return result
+		}
+
+		if query.IdType != IdTicker && result.ExchangeCode == usExchange {
+			return result
+		}
+	}
+
+	return results[0]
+}
+
+// newResolution resolves `query` to the preferred of its results. `known` is
+// a composite FIGI the asset already has, if any.
+func newResolution(query *OpenFigiQuery, results []*OpenFigiAsset, known string) *Resolution {
+	resolution := &Resolution{
+		Query: query,
+		Asset: preferred(query, results),
+	}
+
+	candidates := make([]string, 0, len(results)+1)
+	if known != "" {
+		candidates = append(candidates, known)
+	}
+
+	// ISINs are not limited to an exchange; ignore foreign listings of US securities
+	listings := make([]*OpenFigiAsset, 0, len(results))
+	for _, result := range results {
+		if result.ExchangeCode == usExchange {
+			listings = append(listings, result)
+		}
+	}
+
+	if len(listings) == 0 {
+		listings = results
+	}
+
+	for _, result := range listings {
+		candidates = append(candidates, result.CompositeFIGI)
+	}
+
+	seen := make(map[string]bool, len(candidates))
+	for _, candidate := range candidates {
+		if candidate != "" && !seen[candidate] {
+			seen[candidate] = true
+			resolution.Candidates = append(resolution.Candidates, candidate)
+		}
+	}
+
+	if resolution.Conflict() {
+		log.Warn().Str("IdType", query.IdType).Str("IdValue", query.IdValue).Strs("Candidates", resolution.Candidates).
+			Msg("identifier maps to more than one composite figi")
+	}
+
+	return resolution
+}
+
+// Resolve looks up a single identifier of type `idType`. CIKs are resolved
+// from the asset table, everything else with OpenFIGI.
+func Resolve(ctx context.Context, idType, id string) (*Resolution, error) {
+	query := NewQuery(idType, id)
+
+	if idType == IdCik {
+		found, err := cikAssets(ctx, query.IdValue)
+		if err != nil {
+			return nil, err
+		}
+
+		return newResolution(query, found, ""), nil
+	}
+
+	results := MapQueries(ctx, []*OpenFigiQuery{query}, rateLimit())
+	found, ok := results[query.Key()]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return newResolution(query, found, ""), nil
+}
+
+// ResolveCIK returns the composite FIGI of the active asset with the SEC
+// central index key `cik` from data.DefaultAssetTable. OpenFIGI does not map CIKs.
+func ResolveCIK(ctx context.Context, cik string) (string, error) {
+	found, err := cikAssets(ctx, cik)
+	if err != nil {
+		return "", err
+	}
+
+	return found[0].CompositeFIGI, nil
+}
+
+// cikAssets returns the active assets with the SEC central index key `cik` in
+// data.DefaultAssetTable; a company with several share classes has several
+func cikAssets(ctx context.Context, cik string) ([]*OpenFigiAsset, error) {
+	if dbPool == nil {
+		return nil, ErrNoCache
+	}
+
+	sql := fmt.Sprintf(`SELECT ticker, composite_figi, coalesce(share_class_figi, ''), coalesce(name, '') FROM %s
+	WHERE ltrim(cik, '0') = ltrim($1, '0') AND active = true AND coalesce(composite_figi, '') <> ''
+	ORDER BY composite_figi`, data.DefaultAssetTable())
+
+	rows, err := dbPool.Query(ctx, sql, cik)
+	if err != nil {
+		log.Error().Err(err).Str("SQL", sql).Msg("could not resolve cik")
+		return nil, err
+	}
+
+	found, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*OpenFigiAsset, error) {
+		asset := &OpenFigiAsset{ExchangeCode: usExchange}
+		err := row.Scan(&asset.Ticker, &asset.CompositeFIGI, &asset.ShareClassFIGI, &asset.Name)
+		return asset, err
+	})
+	if err != nil {
+		log.Error().Err(err).Str("SQL", sql).Msg("could not resolve cik")
+		return nil, err
+	}
+
+	if len(found) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return found, nil
+}
@@ -16,10 +16,12 @@ package figi
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
-	"github.com/go-resty/resty/v2"
 	"github.com/penny-vault/pvdata/data"
+	"github.com/penny-vault/pvdata/metrics"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
 	"golang.org/x/time/rate"
@@ -29,8 +31,14 @@ const (
 	OPENFIGI_MAPPING_URL string = "https://api.openfigi.com/v3/mapping"
 )
 
+var (
+	ErrOpenFigiStatus = errors.New("openfigi api call returned invalid status code")
+)
+
 type MappingResponse struct {
-	Data []*OpenFigiAsset `json:"data"`
+	Data    []*OpenFigiAsset `json:"data"`
+	Warning string           `json:"warning"`
+	Error   string           `json:"error"`
 }
 
 type OpenFigiAsset struct {
@@ -53,10 +61,21 @@ type OpenFigiQuery struct {
 	MarketSectorDescription string `json:"marketSecDes"`
 }
 
-func rateLimit() *rate.Limiter {
+// openFigiClient counts every request made to OpenFIGI
+var openFigiClient = metrics.NewClient("openfigi")
+
+func rateLimit() *metrics.Limiter {
 	dur := (time.Second * 6) / 25
 	openFigiRate := rate.Every(dur)
-	return rate.NewLimiter(openFigiRate, 10)
+	return metrics.NewLimiter("openfigi", openFigiRate, 10)
+}
+
+// mappingURL returns the OpenFIGI mapping endpoint (openfigi.url)
+func mappingURL() string {
+	if url := viper.GetString("openfigi.url"); url != "" {
+		return url
+	}
+	return OPENFIGI_MAPPING_URL
 }
 
 func mapFigis(query []*OpenFigiQuery) ([]*MappingResponse, error) {
@@ -65,15 +84,15 @@ func mapFigis(query []*OpenFigiQuery) ([]*MappingResponse, error) {
 	}
 
 	apiKey := viper.GetString("openfigi.apikey")
+	url := mappingURL()
 	mappingResponse := make([]*MappingResponse, 0)
-	client := resty.New()
-	resp, err := client.R().
+	resp, err := openFigiClient.R().
 		SetHeader("X-OPENFIGI-APIKEY", apiKey).
 		SetBody(query).
 		SetResult(&mappingResponse).
-		Post(OPENFIGI_MAPPING_URL)
+		Post(url)
 
-	log.Debug().Str("URL", OPENFIGI_MAPPING_URL).Int("NumTickers", len(query)).Msg("map tickers to FIGIs")
+	log.Debug().Str("URL", url).Int("NumTickers", len(query)).Msg("map tickers to FIGIs")
 
 	if err != nil {
 		log.Error().Err(err).Msg("OpenFigi api called errored out")
@@ -82,12 +101,14 @@ func mapFigis(query []*OpenFigiQuery) ([]*MappingResponse, error) {
 
 	if resp.StatusCode() >= 400 {
 		log.Error().Int("StatusCode", resp.StatusCode()).Str("Body", string(resp.Body())).Msg("openfigi api call returned invalid status code")
-		return []*MappingResponse{}, err
+		return []*MappingResponse{}, fmt.Errorf("%w: %d", ErrOpenFigiStatus, resp.StatusCode())
 	}
 
 	return mappingResponse, nil
 }
 
+// Enrich fills in the composite FIGI and asset type of assets that are missing
+// them. Assets whose identifiers point to conflicting FIGIs are left unchanged.
 func Enrich(assets ...*data.Asset) {
 	rateLimiter := rateLimit()
 
@@ -98,9 +119,16 @@ func Enrich(assets ...*data.Asset) {
 		}
 	}
 
-	figiMap := LookupFigi(emptyFigis, rateLimiter)
+	resolutions := LookupFigi(emptyFigis, rateLimiter)
 	for _, asset := range emptyFigis {
-		if assetFigi, ok := figiMap[asset.Ticker]; ok {
+		if resolution, ok := resolutions[asset]; ok {
+			if resolution.Conflict() {
+				log.Warn().Str("Ticker", asset.Ticker).Strs("Candidates", resolution.Candidates).
+					Msg("not enriching asset with conflicting figis")
+				continue
+			}
+
+			assetFigi := resolution.Asset
 			asset.CompositeFigi = assetFigi.CompositeFIGI
 			asset.ShareClassFigi = assetFigi.ShareClassFIGI
 
@@ -143,44 +171,123 @@ func Enrich(assets ...*data.Asset) {
 	}
 }
 
-func LookupFigi(assets []*data.Asset, rateLimiter *rate.Limiter) map[string]*OpenFigiAsset {
-	query := make([]*OpenFigiQuery, 0, 100)
-	result := make(map[string]*OpenFigiAsset)
+// LookupFigi resolves each asset using its strongest identifier first (ISIN,
+// then CUSIP, then ticker, then CIK), falling back to weaker identifiers when
+// there is no match. CIKs are resolved from data.DefaultAssetTable. Assets
+// that could not be resolved are not in the result.
+func LookupFigi(assets []*data.Asset, rateLimiter *metrics.Limiter) map[*data.Asset]*Resolution {
+	ctx := context.Background()
+	resolutions := make(map[*data.Asset]*Resolution, len(assets))
 
-	for _, asset := range assets {
-		query = append(query, &OpenFigiQuery{
-			IdType:                  "TICKER",
-			IdValue:                 asset.Ticker,
-			ExchangeCode:            "US",
-			MarketSectorDescription: "Equity",
-		})
-
-		if len(query) == 100 {
-			if err := rateLimiter.Wait(context.Background()); err != nil {
-				log.Panic().Err(err).Msg("rate limiter failed")
+	pending := assets
+	for round := 0; len(pending) > 0; round++ {
+		queries := make([]*OpenFigiQuery, 0, len(pending))
+		openFigiQueries := make([]*OpenFigiQuery, 0, len(pending))
+		owners := make([]*data.Asset, 0, len(pending))
+		for _, asset := range pending {
+			if assetQueries := AssetQueries(asset); round < len(assetQueries) {
+				query := assetQueries[round]
+				queries = append(queries, query)
+				owners = append(owners, asset)
+				if query.IdType != IdCik {
+					openFigiQueries = append(openFigiQueries, query)
+				}
 			}
+		}
 
-			mappingResponse, _ := mapFigis(query)
-			for _, resp := range mappingResponse {
-				for _, figiAsset := range resp.Data {
-					result[figiAsset.Ticker] = figiAsset
+		results := MapQueries(ctx, openFigiQueries, rateLimiter)
+		for _, query := range queries {
+			if query.IdType == IdCik {
+				if found, err := cikAssets(ctx, query.IdValue); err == nil {
+					results[query.Key()] = found
 				}
 			}
-			query = make([]*OpenFigiQuery, 0, 100)
 		}
+
+		pending = make([]*data.Asset, 0, len(owners))
+		for idx, query := range queries {
+			asset := owners[idx]
+			if found, ok := results[query.Key()]; ok {
+				resolutions[asset] = newResolution(query, found, asset.CompositeFigi)
+			} else {
+				pending = append(pending, asset)
+			}
+		}
+	}
+
+	return resolutions
+}
+
+// MapQueries returns the OpenFIGI results of each query keyed by the query's
+// Key. Cached mappings are used until they expire; in offline mode only the
+// cache is consulted. Queries without a match are not in the result.
+func MapQueries(ctx context.Context, queries []*OpenFigiQuery, rateLimiter *metrics.Limiter) map[string][]*OpenFigiAsset {
+	result := make(map[string][]*OpenFigiAsset)
+
+	// answer what we can from the cache
+	offline := Offline()
+	ttl, notFoundTTL := cacheTTL()
+	now := time.Now()
+	cached := loadMappings(ctx, queries)
+
+	toFetch := make([]*OpenFigiQuery, 0, len(queries))
+	requested := make(map[string]bool, len(queries))
+	for _, query := range queries {
+		key := query.Key()
+		if mapping, ok := cached[key]; ok && (offline || !mapping.Expired(now, ttl, notFoundTTL)) {
+			if !mapping.NotFound {
+				result[key] = mapping.Assets()
+			}
+			continue
+		}
+
+		if !offline && !requested[key] {
+			requested[key] = true
+			toFetch = append(toFetch, query)
+		}
+	}
+
+	if offline && len(cached) < len(queries) {
+		log.Debug().Int("NumUncached", len(queries)-len(cached)).Msg("openfigi offline mode, uncached identifiers are not mapped")
 	}
 
-	if len(query) > 0 {
-		if err := rateLimiter.Wait(context.Background()); err != nil {
+	// request the remainder from OpenFIGI in batches of 100
+	for start := 0; start < len(toFetch); start += 100 {
+		end := min(start+100, len(toFetch))
+		batch := toFetch[start:end]
+
+		if err := rateLimiter.Wait(ctx); err != nil {
 			log.Panic().Err(err).Msg("rate limiter failed")
 		}
 
-		mappingResponse, _ := mapFigis(query)
-		for _, resp := range mappingResponse {
-			for _, figiAsset := range resp.Data {
-				result[figiAsset.Ticker] = figiAsset
+		mappingResponse, err := mapFigis(batch)
+		if err != nil {
+			continue
+		}
+
+		// responses are in the same order as the queries
+		mappings := make([]*Mapping, 0, len(batch))
+		for idx, resp := range mappingResponse {
+			if idx >= len(batch) {
+				break
+			}
+
+			query := batch[idx]
+			if resp.Error != "" {
+				log.Warn().Str("IdType", query.IdType).Str("IdValue", query.IdValue).Str("Error", resp.Error).Msg("openfigi could not map identifier")
+				continue
 			}
+
+			if len(resp.Data) == 0 {
+				mappings = append(mappings, newMapping(query, nil, now))
+				continue
+			}
+
+			result[query.Key()] = resp.Data
+			mappings = append(mappings, newMapping(query, resp.Data, now))
 		}
+
+		saveMappings(ctx, mappings)
 	}
 
 	return result
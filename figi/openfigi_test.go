@@ -0,0 +1,253 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package figi_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/viper"
+	"golang.org/x/time/rate"
+
+	"github.com/penny-vault/pvdata/data"
+	"github.com/penny-vault/pvdata/figi"
+	"github.com/penny-vault/pvdata/metrics"
+)
+
+var _ = Describe("OpenFIGI", func() {
+	var (
+		server   *httptest.Server
+		requests atomic.Int32
+		limiter  *metrics.Limiter
+	)
+
+	BeforeEach(func() {
+		requests.Store(0)
+		limiter = metrics.NewLimiter("openfigi", rate.Inf, 1)
+
+		// stand-in for the OpenFIGI mapping endpoint
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+
+			var queries []*figi.OpenFigiQuery
+			Expect(json.NewDecoder(r.Body).Decode(&queries)).To(Succeed())
+
+			resp := make([]*figi.MappingResponse, len(queries))
+			for idx, query := range queries {
+				switch query.IdValue {
+				case "VFIAX", "US9229087104":
+					resp[idx] = &figi.MappingResponse{Data: []*figi.OpenFigiAsset{{
+						Ticker:        "VFIAX",
+						CompositeFIGI: "BBG000BHTMY2",
+						SecurityType:  "Open-End Fund",
+						SecurityType2: "Mutual Fund",
+					}}}
+				case "US0378331005":
+					resp[idx] = &figi.MappingResponse{Data: []*figi.OpenFigiAsset{
+						{Ticker: "AAPL", ExchangeCode: "GR", CompositeFIGI: "BBG000BCTLF6"},
+						{Ticker: "AAPL", ExchangeCode: "US", CompositeFIGI: "BBG000B9XRY4"},
+					}}
+				case "AMBG":
+					resp[idx] = &figi.MappingResponse{Data: []*figi.OpenFigiAsset{
+						{Ticker: "AMBG", CompositeFIGI: "BBG000000001"},
+						{Ticker: "AMBG", CompositeFIGI: "BBG000000002"},
+					}}
+				default:
+					resp[idx] = &figi.MappingResponse{Warning: "No identifier found."}
+				}
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			Expect(json.NewEncoder(w).Encode(resp)).To(Succeed())
+		}))
+
+		viper.Set("openfigi.url", server.URL)
+		figi.UseDatabase(nil)
+	})
+
+	AfterEach(func() {
+		server.Close()
+		viper.Set("openfigi.url", "")
+		viper.Set("openfigi.offline", false)
+	})
+
+	It("maps tickers with the configured endpoint", func() {
+		vfiax := &data.Asset{Ticker: "VFIAX"}
+		result := figi.LookupFigi([]*data.Asset{vfiax, {Ticker: "NOPE"}}, limiter)
+		Expect(requests.Load()).To(Equal(int32(1)))
+		Expect(result).To(HaveLen(1))
+		Expect(result[vfiax].Asset.CompositeFIGI).To(Equal("BBG000BHTMY2"))
+		Expect(result[vfiax].Query.IdType).To(Equal(figi.IdTicker))
+	})
+
+	It("tries the strongest identifier first", func() {
+		asset := &data.Asset{Ticker: "NOPE", ISIN: []string{"US9229087104"}}
+		result := figi.LookupFigi([]*data.Asset{asset}, limiter)
+		Expect(requests.Load()).To(Equal(int32(1)))
+		Expect(result[asset].Query.IdType).To(Equal(figi.IdIsin))
+		Expect(result[asset].Asset.CompositeFIGI).To(Equal("BBG000BHTMY2"))
+	})
+
+	It("prefers US listings of an ISIN", func() {
+		asset := &data.Asset{Ticker: "AAPL", ISIN: []string{"US0378331005"}}
+		result := figi.LookupFigi([]*data.Asset{asset}, limiter)
+		Expect(result[asset].Conflict()).To(BeFalse())
+		Expect(result[asset].Asset.CompositeFIGI).To(Equal("BBG000B9XRY4"))
+	})
+
+	It("falls back to the ticker", func() {
+		asset := &data.Asset{Ticker: "VFIAX", CUSIP: []string{"000000000"}}
+		result := figi.LookupFigi([]*data.Asset{asset}, limiter)
+		Expect(requests.Load()).To(Equal(int32(2)))
+		Expect(result[asset].Query.IdType).To(Equal(figi.IdTicker))
+	})
+
+	It("flags conflicting results", func() {
+		asset := &data.Asset{Ticker: "AMBG"}
+		result := figi.LookupFigi([]*data.Asset{asset}, limiter)
+		Expect(result[asset].Conflict()).To(BeTrue())
+		Expect(result[asset].Candidates).To(ConsistOf("BBG000000001", "BBG000000002"))
+
+		figi.Enrich(asset)
+		Expect(asset.CompositeFigi).To(BeEmpty())
+	})
+
+	It("flags results that disagree with the asset's figi", func() {
+		asset := &data.Asset{Ticker: "VFIAX", CompositeFigi: "BBG000000003"}
+		result := figi.LookupFigi([]*data.Asset{asset}, limiter)
+		Expect(result[asset].Conflict()).To(BeTrue())
+	})
+
+	It("falls back to the CIK last", func() {
+		queries := figi.AssetQueries(&data.Asset{Ticker: "AAPL", CUSIP: []string{"037833100"}, CIK: "0000320193"})
+		Expect(queries).To(HaveLen(3))
+		Expect(queries[1].IdType).To(Equal(figi.IdTicker))
+		Expect(queries[2].IdType).To(Equal(figi.IdCik))
+	})
+
+	It("sets asset types when enriching", func() {
+		asset := &data.Asset{Ticker: "VFIAX", AssetType: data.UnknownAsset}
+		figi.Enrich(asset)
+		Expect(asset.CompositeFigi).To(Equal("BBG000BHTMY2"))
+		Expect(asset.AssetType).To(Equal(data.MutualFund))
+	})
+
+	It("does not call the api in offline mode", func() {
+		viper.Set("openfigi.offline", true)
+		result := figi.LookupFigi([]*data.Asset{{Ticker: "VFIAX"}}, limiter)
+		Expect(requests.Load()).To(Equal(int32(0)))
+		Expect(result).To(BeEmpty())
+	})
+
+	DescribeTable("identifier types",
+		func(id, idType string) {
+			Expect(figi.IdentifierType(id)).To(Equal(idType))
+		},
+		Entry("ticker", "VFIAX", figi.IdTicker),
+		Entry("isin", "US9229087104", figi.IdIsin),
+		Entry("cusip", "037833100", figi.IdCusip),
+		Entry("cik", "0000320193", figi.IdCik),
+		Entry("figi", "BBG000B9XRY4", figi.IdFigi),
+	)
+
+	Context("cached mappings", func() {
+		now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+		It("expires found mappings after the ttl", func() {
+			mapping := &figi.Mapping{LookedUp: now.Add(-48 * time.Hour)}
+			Expect(mapping.Expired(now, 72*time.Hour, time.Hour)).To(BeFalse())
+			Expect(mapping.Expired(now, 24*time.Hour, time.Hour)).To(BeTrue())
+		})
+
+		It("returns every result of a mapping", func() {
+			results := []*figi.OpenFigiAsset{{CompositeFIGI: "BBG000000001"}, {CompositeFIGI: "BBG000000002"}}
+			Expect((&figi.Mapping{CompositeFigi: "BBG000000001", Results: results}).Assets()).To(Equal(results))
+
+			// mappings cached before every result was kept
+			Expect((&figi.Mapping{CompositeFigi: "BBG000000001"}).Assets()).To(HaveLen(1))
+		})
+
+		It("flags conflicts on cache hits", func() {
+			dbURL := os.Getenv("PVDATA_TEST_DB_URL")
+			if dbURL == "" {
+				Skip("PVDATA_TEST_DB_URL is not set")
+			}
+
+			ctx := context.Background()
+			pool, err := pgxpool.New(ctx, dbURL)
+			Expect(err).NotTo(HaveOccurred())
+			defer pool.Close()
+
+			cleanup := func() {
+				_, err := pool.Exec(ctx, "DELETE FROM figi_mappings WHERE id_value = 'AMBG'")
+				Expect(err).NotTo(HaveOccurred())
+			}
+			cleanup()
+			defer cleanup()
+
+			figi.UseDatabase(pool)
+			defer figi.UseDatabase(nil)
+
+			for range 2 {
+				asset := &data.Asset{Ticker: "AMBG"}
+				result := figi.LookupFigi([]*data.Asset{asset}, limiter)
+				Expect(result[asset].Conflict()).To(BeTrue())
+			}
+			Expect(requests.Load()).To(Equal(int32(1)))
+		})
+
+		It("does not save lookups to a read-only cache", func() {
+			dbURL := os.Getenv("PVDATA_TEST_DB_URL")
+			if dbURL == "" {
+				Skip("PVDATA_TEST_DB_URL is not set")
+			}
+
+			ctx := context.Background()
+			pool, err := pgxpool.New(ctx, dbURL)
+			Expect(err).NotTo(HaveOccurred())
+			defer pool.Close()
+
+			_, err = pool.Exec(ctx, "DELETE FROM figi_mappings WHERE id_value = 'AMBG'")
+			Expect(err).NotTo(HaveOccurred())
+
+			figi.UseDatabaseReadOnly(pool)
+			defer figi.UseDatabase(nil)
+
+			for range 2 {
+				asset := &data.Asset{Ticker: "AMBG"}
+				figi.LookupFigi([]*data.Asset{asset}, limiter)
+			}
+			Expect(requests.Load()).To(Equal(int32(2)))
+
+			var count int
+			Expect(pool.QueryRow(ctx, "SELECT count(*) FROM figi_mappings WHERE id_value = 'AMBG'").Scan(&count)).To(Succeed())
+			Expect(count).To(BeZero())
+		})
+
+		It("expires not found mappings after the not found ttl", func() {
+			mapping := &figi.Mapping{NotFound: true, LookedUp: now.Add(-48 * time.Hour)}
+			Expect(mapping.Expired(now, 72*time.Hour, 24*time.Hour)).To(BeTrue())
+			Expect(mapping.Expired(now, time.Hour, 72*time.Hour)).To(BeFalse())
+		})
+	})
+})
@@ -19,14 +19,50 @@ import (
 	"fmt"
 	"strings"
 
-	"github.com/go-resty/resty/v2"
+	"github.com/penny-vault/pvdata/metrics"
 	"github.com/spf13/viper"
 )
 
+const (
+	// DefaultURL is the healthchecks.io API; set healthchecks.url for self-hosted instances
+	DefaultURL = "https://healthchecks.io"
+
+	// DefaultPingURL receives pings for checks on healthchecks.io; override with healthchecks.ping_url
+	DefaultPingURL = "https://hc-ping.com"
+
+	// DefaultGrace is the number of seconds a check may be late before it is
+	// considered down; override with healthchecks.grace
+	DefaultGrace = 3600
+
+	// DefaultTimezone is the timezone schedules are evaluated in; override with healthchecks.timezone
+	DefaultTimezone = "America/New_York"
+)
+
 var (
 	ErrStatus = errors.New("status code is invalid")
 )
 
+// apiURL returns the base URL of the healthchecks API
+func apiURL() string {
+	if viper.IsSet("healthchecks.url") {
+		return strings.TrimSuffix(viper.GetString("healthchecks.url"), "/")
+	}
+	return DefaultURL
+}
+
+// pingURL returns the base URL pings are sent to. Self-hosted instances
+// serve pings from /ping.
+func pingURL() string {
+	switch {
+	case viper.IsSet("healthchecks.ping_url"):
+		return strings.TrimSuffix(viper.GetString("healthchecks.ping_url"), "/")
+	case viper.IsSet("healthchecks.url"):
+		return apiURL() + "/ping"
+	default:
+		return DefaultPingURL
+	}
+}
+
 type createReq struct {
 	APIKey      string `json:"api_key"`
 	Name        string `json:"name"`
@@ -44,24 +80,34 @@ type createResp struct {
 
 // Create a new healthchecks.io check and return the id
 func Create(name string, slug string, tags []string, schedule string) (string, error) {
+	grace := DefaultGrace
+	if viper.IsSet("healthchecks.grace") {
+		grace = viper.GetInt("healthchecks.grace")
+	}
+
+	timezone := DefaultTimezone
+	if viper.IsSet("healthchecks.timezone") {
+		timezone = viper.GetString("healthchecks.timezone")
+	}
+
 	command := createReq{
 		APIKey:   viper.GetString("healthchecks.apikey"),
 		Name:     name,
 		Slug:     slug,
 		Tags:     strings.Join(tags, " "),
-		Grace:    3600,
+		Grace:    grace,
 		Schedule: schedule,
-		Timezone: "America/New_York",
+		Timezone: timezone,
 	}
 
 	result := createResp{}
 
-	client := resty.New()
+	client := metrics.NewClient("healthchecks")
 	resp, err := client.R().
 		SetHeader("Content-Type", "application/json").
 		SetBody(command).
 		SetResult(&result).
-		Post("https://healthchecks.io/api/v3/checks/")
+		Post(apiURL() + "/api/v3/checks/")
 
 	if err != nil {
 		return "", err
@@ -77,16 +123,46 @@ func Create(name string, slug string, tags []string, schedule string) (string, e
 	return healthCheckID, nil
 }
 
-// Pause monitoring of a health check
+type updateReq struct {
+	Name     string `json:"name,omitempty"`
+	Schedule string `json:"schedule,omitempty"`
+}
+
+// Update the name and schedule of a health check; empty values are left unchanged
+func Update(id, name, schedule string) error {
+	command := updateReq{
+		Name:     name,
+		Schedule: schedule,
+	}
+
+	client := metrics.NewClient("healthchecks")
+	resp, err := client.R().
+		SetHeader("Content-Type", "application/json").
+		SetHeader("X-Api-Key", viper.GetString("healthchecks.apikey")).
+		SetBody(command).
+		Post(fmt.Sprintf("%s/api/v3/checks/%s", apiURL(), id))
+
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode() != 200 {
+		return fmt.Errorf("%w: %d", ErrStatus, resp.StatusCode())
+	}
+
+	return nil
+}
+
+// Delete a health check
 func Delete(id string) error {
 	result := createResp{}
 
-	client := resty.New()
+	client := metrics.NewClient("healthchecks")
 	resp, err := client.R().
 		SetHeader("Content-Type", "application/json").
 		SetHeader("X-Api-Key", viper.GetString("healthchecks.apikey")).
 		SetResult(&result).
-		Delete(fmt.Sprintf("https://healthchecks.io/api/v3/checks/%s", id))
+		Delete(fmt.Sprintf("%s/api/v3/checks/%s", apiURL(), id))
 
 	if err != nil {
 		return err
@@ -103,12 +179,12 @@ func Delete(id string) error {
 func Pause(id string) error {
 	result := createResp{}
 
-	client := resty.New()
+	client := metrics.NewClient("healthchecks")
 	resp, err := client.R().
 		SetHeader("Content-Type", "application/json").
 		SetHeader("X-Api-Key", viper.GetString("healthchecks.apikey")).
 		SetResult(&result).
-		Post(fmt.Sprintf("https://healthchecks.io/api/v3/checks/%s/pause", id))
+		Post(fmt.Sprintf("%s/api/v3/checks/%s/pause", apiURL(), id))
 
 	if err != nil {
 		return err
@@ -125,12 +201,12 @@ func Pause(id string) error {
 func Resume(id string) error {
 	result := createResp{}
 
-	client := resty.New()
+	client := metrics.NewClient("healthchecks")
 	resp, err := client.R().
 		SetHeader("Content-Type", "application/json").
 		SetHeader("X-Api-Key", viper.GetString("healthchecks.apikey")).
 		SetResult(&result).
-		Post(fmt.Sprintf("https://healthchecks.io/api/v3/checks/%s/resume", id))
+		Post(fmt.Sprintf("%s/api/v3/checks/%s/resume", apiURL(), id))
 
 	if err != nil {
 		return err
@@ -142,3 +218,39 @@ func Resume(id string) error {
 
 	return nil
 }
+
+// PingKind selects which ping endpoint is signaled
+type PingKind string
+
+const (
+	PingStart   PingKind = "start"
+	PingSuccess PingKind = ""
+	PingFail    PingKind = "fail"
+)
+
+// Ping signals the health check with the given id. The body (e.g. the tail of
+// the run log) is attached to the ping and shown in the check's event log.
+func Ping(id string, kind PingKind, body []byte) error {
+	url := fmt.Sprintf("%s/%s", pingURL(), id)
+	if kind != PingSuccess {
+		url = fmt.Sprintf("%s/%s", url, kind)
+	}
+
+	client := metrics.NewClient("healthchecks")
+	req := client.R().SetHeader("Content-Type", "text/plain")
+	if len(body) > 0 {
+		req.SetBody(body)
+	}
+
+	resp, err := req.Post(url)
+
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode() >= 300 {
+		return fmt.Errorf("%w: %d", ErrStatus, resp.StatusCode())
+	}
+
+	return nil
+}
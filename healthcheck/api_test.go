@@ -0,0 +1,123 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package healthcheck_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/viper"
+
+	"github.com/penny-vault/pvdata/healthcheck"
+)
+
+type ping struct {
+	Path string
+	Body string
+}
+
+// fakeHealthchecks records pings sent to a self-hosted healthchecks instance
+type fakeHealthchecks struct {
+	pings  []ping
+	status int
+	mu     sync.Mutex
+}
+
+func (hc *fakeHealthchecks) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	body, err := io.ReadAll(r.Body)
+	Expect(err).ToNot(HaveOccurred())
+
+	hc.pings = append(hc.pings, ping{Path: r.URL.Path, Body: string(body)})
+	w.WriteHeader(hc.status)
+}
+
+var _ = Describe("Ping", func() {
+	var (
+		server  *httptest.Server
+		backend *fakeHealthchecks
+	)
+
+	BeforeEach(func() {
+		backend = &fakeHealthchecks{status: http.StatusOK}
+		server = httptest.NewServer(backend)
+		viper.Set("healthchecks.url", server.URL)
+	})
+
+	AfterEach(func() {
+		server.Close()
+		viper.Set("healthchecks.url", nil)
+		viper.Set("healthchecks.ping_url", nil)
+	})
+
+	It("sends start, success and fail pings to the self-hosted ping endpoint", func() {
+		Expect(healthcheck.Ping("2e1d4c0a", healthcheck.PingStart, nil)).To(Succeed())
+		Expect(healthcheck.Ping("2e1d4c0a", healthcheck.PingSuccess, []byte("saved 10 observations"))).To(Succeed())
+		Expect(healthcheck.Ping("2e1d4c0a", healthcheck.PingFail, []byte("API key rejected"))).To(Succeed())
+
+		Expect(backend.pings).To(Equal([]ping{
+			{Path: "/ping/2e1d4c0a/start", Body: ""},
+			{Path: "/ping/2e1d4c0a", Body: "saved 10 observations"},
+			{Path: "/ping/2e1d4c0a/fail", Body: "API key rejected"},
+		}))
+	})
+
+	It("uses healthchecks.ping_url when set", func() {
+		viper.Set("healthchecks.url", nil)
+		viper.Set("healthchecks.ping_url", server.URL+"/custom/")
+
+		Expect(healthcheck.Ping("2e1d4c0a", healthcheck.PingSuccess, nil)).To(Succeed())
+		Expect(backend.pings).To(Equal([]ping{{Path: "/custom/2e1d4c0a", Body: ""}}))
+	})
+
+	It("updates the schedule of a check", func() {
+		Expect(healthcheck.Update("2e1d4c0a", "", "30 18 * * 1-5")).To(Succeed())
+		Expect(backend.pings).To(Equal([]ping{{Path: "/api/v3/checks/2e1d4c0a", Body: `{"schedule":"30 18 * * 1-5"}`}}))
+	})
+
+	It("reports rejected pings", func() {
+		backend.status = http.StatusNotFound
+		Expect(healthcheck.Ping("missing", healthcheck.PingSuccess, nil)).To(MatchError(healthcheck.ErrStatus))
+	})
+})
+
+var _ = Describe("LogTail", func() {
+	It("keeps only the most recent bytes", func() {
+		tail := healthcheck.NewLogTail(10)
+
+		n, err := tail.Write([]byte("first line\n"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(11))
+		Expect(string(tail.Bytes())).To(Equal("irst line\n"))
+
+		_, err = io.WriteString(tail, "last\n")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(tail.Bytes())).To(Equal("line\nlast\n"))
+	})
+
+	It("keeps everything under the limit", func() {
+		tail := healthcheck.NewLogTail(healthcheck.DefaultLogTailSize)
+		_, err := io.WriteString(tail, strings.Repeat("x", 100))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tail.Bytes()).To(HaveLen(100))
+	})
+})
@@ -0,0 +1,59 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package healthcheck
+
+import "sync"
+
+// DefaultLogTailSize is the number of log bytes sent with a ping; healthchecks.io
+// keeps at most 10KB of each ping body
+const DefaultLogTailSize = 10_000
+
+// LogTail is an io.Writer that keeps only the last Size bytes written to it
+type LogTail struct {
+	Size int
+
+	buf []byte
+	mu  sync.Mutex
+}
+
+// NewLogTail creates a log tail that holds at most size bytes
+func NewLogTail(size int) *LogTail {
+	return &LogTail{
+		Size: size,
+		buf:  make([]byte, 0, size),
+	}
+}
+
+func (tail *LogTail) Write(p []byte) (int, error) {
+	tail.mu.Lock()
+	defer tail.mu.Unlock()
+
+	tail.buf = append(tail.buf, p...)
+	if over := len(tail.buf) - tail.Size; over > 0 {
+		tail.buf = append(tail.buf[:0], tail.buf[over:]...)
+	}
+
+	return len(p), nil
+}
+
+// Bytes returns a copy of the retained log
+func (tail *LogTail) Bytes() []byte {
+	tail.mu.Lock()
+	defer tail.mu.Unlock()
+
+	out := make([]byte, len(tail.buf))
+	copy(out, tail.buf)
+	return out
+}
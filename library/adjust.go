@@ -0,0 +1,49 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package library
+
+import (
+	"context"
+
+	"github.com/penny-vault/pvdata/data"
+	"github.com/rs/zerolog"
+)
+
+// AdjustPrices applies outstanding splits and dividends to every EOD table of
+// the subscription. Returns the number of corporate actions applied.
+func (subscription *Subscription) AdjustPrices(ctx context.Context, opts data.AdjustOptions) (int, error) {
+	logger := zerolog.Ctx(ctx)
+
+	tbl, ok := subscription.DataTablesMap[data.EODKey]
+	if !ok {
+		return 0, nil
+	}
+
+	conn, err := subscription.Library.Pool.Acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Release()
+
+	numActions, err := data.AdjustEod(ctx, tbl, conn, opts)
+	if err != nil {
+		logger.Error().Err(err).Str("SubscriptionID", subscription.ID.String()).Str("Table", tbl).Msg("could not adjust prices")
+		return numActions, err
+	}
+
+	logger.Info().Str("SubscriptionID", subscription.ID.String()).Str("Table", tbl).Int("NumActions", numActions).Msg("adjusted prices")
+
+	return numActions, nil
+}
@@ -0,0 +1,423 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package library
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/penny-vault/pvdata/data"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+const (
+	// ArchiveAfterSetting is the number of years after which a partition is archived
+	ArchiveAfterSetting = "archive.after_years"
+
+	// ArchiveFilerSetting overrides archive.filer for the subscription
+	ArchiveFilerSetting = "archive.filer"
+)
+
+var (
+	ErrNoArchiveFiler       = errors.New("no archive location configured; set archive.filer")
+	ErrPartitionNotFound    = errors.New("partition does not belong to subscription")
+	ErrArchiveNotFound      = errors.New("archived partition not found")
+	ErrArchiveVerifyFailed  = errors.New("archive verification failed")
+	ErrNoArchivePolicy      = errors.New("subscription has no archive policy")
+	ErrArchiveCurrentPeriod = errors.New("partition holds current data")
+)
+
+// ArchivedPartition is a catalog entry of a partition moved to Parquet
+type ArchivedPartition struct {
+	ID             int64          `db:"id"`
+	SubscriptionID uuid.UUID      `db:"subscription_id"`
+	ParentTable    string         `db:"parent_table"`
+	PartitionName  string         `db:"partition_name"`
+	RangeStart     time.Time      `db:"range_start"`
+	RangeEnd       time.Time      `db:"range_end"`
+	Location       string         `db:"location"`
+	FileName       string         `db:"file_name"`
+	FileSha256     string         `db:"file_sha256"`
+	FileSize       int64          `db:"file_size"`
+	RowCount       int64          `db:"row_count"`
+	RowChecksum    string         `db:"row_checksum"`
+	Columns        []*data.Column `db:"columns"`
+	ArchivedOn     time.Time      `db:"archived_on"`
+	RestoredOn     *time.Time     `db:"restored_on"`
+}
+
+// archiveLocation returns the filer spec partitions are archived to
+func (subscription *Subscription) archiveLocation() (string, error) {
+	location := viper.GetString("archive.filer")
+	if val, ok := subscription.Settings[ArchiveFilerSetting]; ok {
+		location = val
+	}
+
+	if location == "" {
+		return "", ErrNoArchiveFiler
+	}
+
+	return location, nil
+}
+
+// ArchivedPartitions returns the subscription's partitions that are currently archived
+func (subscription *Subscription) ArchivedPartitions(ctx context.Context) ([]*ArchivedPartition, error) {
+	return subscription.archivedPartitions(ctx, subscription.Library.Pool)
+}
+
+func (subscription *Subscription) archivedPartitions(ctx context.Context, dbConn data.Querier) ([]*ArchivedPartition, error) {
+	rows, err := dbConn.Query(ctx, `SELECT id, subscription_id, parent_table, partition_name, range_start, range_end,
+	location, file_name, file_sha256, file_size, row_count, row_checksum, columns, archived_on, restored_on
+	FROM archived_partitions WHERE subscription_id = $1 AND restored_on IS NULL ORDER BY parent_table, range_start`, subscription.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[ArchivedPartition])
+}
+
+// ArchiveCandidates returns the partitions whose data ends more than `years` years ago
+func (subscription *Subscription) ArchiveCandidates(ctx context.Context, years int) ([]*data.Partition, error) {
+	statuses, err := subscription.PartitionStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().AddDate(-years, 0, 0)
+	candidates := make([]*data.Partition, 0)
+	for _, status := range statuses {
+		for _, partition := range status.Existing {
+			if !partition.End.IsZero() && !partition.End.After(cutoff) {
+				candidates = append(candidates, partition)
+			}
+		}
+	}
+
+	return candidates, nil
+}
+
+// ArchivePolicy returns the number of years after which partitions are archived
+func (subscription *Subscription) ArchivePolicy() (int, bool) {
+	val, ok := subscription.Settings[ArchiveAfterSetting]
+	if !ok {
+		return 0, false
+	}
+
+	years, err := strconv.Atoi(val)
+	if err != nil || years < 1 {
+		log.Warn().Str("Value", val).Msg("ignoring invalid archive policy")
+		return 0, false
+	}
+
+	return years, true
+}
+
+// ApplyArchivePolicy archives every partition older than the subscription's policy
+func (subscription *Subscription) ApplyArchivePolicy(ctx context.Context) (int, error) {
+	years, ok := subscription.ArchivePolicy()
+	if !ok {
+		return 0, ErrNoArchivePolicy
+	}
+
+	candidates, err := subscription.ArchiveCandidates(ctx, years)
+	if err != nil {
+		return 0, err
+	}
+
+	for idx, partition := range candidates {
+		if _, err := subscription.ArchivePartition(ctx, partition.Name); err != nil {
+			return idx, err
+		}
+	}
+
+	return len(candidates), nil
+}
+
+// ArchivePartition exports a partition of one of the subscription's tables to
+// Parquet, verifies the file and then detaches and drops the partition
+func (subscription *Subscription) ArchivePartition(ctx context.Context, partitionName string) (*ArchivedPartition, error) {
+	logger := zerolog.Ctx(ctx)
+
+	location, err := subscription.archiveLocation()
+	if err != nil {
+		return nil, err
+	}
+
+	filer, err := data.NewFilerFromString(location)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := subscription.Library.Pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil {
+			if !errors.Is(err, pgx.ErrTxClosed) {
+				logger.Error().Err(err).Msg("error rollingback tx")
+			}
+		}
+	}()
+
+	// find the partition among the subscription's tables
+	statuses, err := subscription.partitionStatus(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	var archive *ArchivedPartition
+	for _, status := range statuses {
+		for _, partition := range status.Existing {
+			if partition.Name == partitionName {
+				archive = &ArchivedPartition{
+					SubscriptionID: subscription.ID,
+					ParentTable:    status.Table,
+					PartitionName:  partition.Name,
+					RangeStart:     partition.Start,
+					RangeEnd:       partition.End,
+					Location:       location,
+					FileName:       partition.Name + ".parquet",
+				}
+			}
+		}
+	}
+
+	if archive == nil {
+		return nil, fmt.Errorf("%w: %s", ErrPartitionNotFound, partitionName)
+	}
+
+	if archive.RangeEnd.IsZero() || archive.RangeEnd.After(time.Now()) {
+		return nil, fmt.Errorf("%w: %s", ErrArchiveCurrentPeriod, partitionName)
+	}
+
+	// block writes to the partition until it is dropped
+	if _, err := tx.Exec(ctx, fmt.Sprintf("LOCK TABLE %s IN SHARE MODE", partitionName)); err != nil {
+		return nil, err
+	}
+
+	if archive.Columns, err = data.TableColumns(ctx, tx, partitionName); err != nil {
+		return nil, err
+	}
+
+	if archive.RowCount, archive.RowChecksum, err = data.RowChecksum(ctx, tx, partitionName); err != nil {
+		return nil, err
+	}
+
+	// the partition is streamed to a temporary file so that it is never held in memory
+	tmp, err := os.CreateTemp("", partitionName+"-*.parquet")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	numRows, err := data.WriteTableParquet(ctx, tx, partitionName, archive.Columns, io.MultiWriter(tmp, hash), "")
+	if err != nil {
+		return nil, err
+	}
+
+	if numRows != archive.RowCount {
+		return nil, fmt.Errorf("%w: wrote %d of %d rows", ErrArchiveVerifyFailed, numRows, archive.RowCount)
+	}
+
+	archive.FileSha256 = hex.EncodeToString(hash.Sum(nil))
+	if archive.FileSize, err = tmp.Seek(0, io.SeekCurrent); err != nil {
+		return nil, err
+	}
+
+	// make sure every row can be read back before the file is saved
+	readRows, err := data.ReadParquet(tmp.Name(), archive.Columns, func([]any) error { return nil })
+	if err != nil {
+		return nil, err
+	}
+
+	if readRows != archive.RowCount {
+		return nil, fmt.Errorf("%w: archive has %d of %d rows", ErrArchiveVerifyFailed, readRows, archive.RowCount)
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	if _, err := filer.SaveFile(archive.FileName, tmp, archive.FileSize); err != nil {
+		logger.Error().Err(err).Str("Location", location).Str("FileName", archive.FileName).Msg("could not save archive")
+		return nil, err
+	}
+
+	// read the saved file back and make sure it is the file that was verified
+	savedSha256, err := fileSha256(filer, archive.FileName, io.Discard)
+	if err != nil {
+		return nil, err
+	}
+
+	if savedSha256 != archive.FileSha256 {
+		return nil, fmt.Errorf("%w: checksum of saved file does not match", ErrArchiveVerifyFailed)
+	}
+
+	// record the archive and remove the partition
+	if err := tx.QueryRow(ctx, `INSERT INTO archived_partitions ("subscription_id", "parent_table",
+	"partition_name", "range_start", "range_end", "location", "file_name", "file_sha256", "file_size",
+	"row_count", "row_checksum", "columns") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	RETURNING id, archived_on`, archive.SubscriptionID, archive.ParentTable, archive.PartitionName,
+		archive.RangeStart, archive.RangeEnd, archive.Location, archive.FileName, archive.FileSha256,
+		archive.FileSize, archive.RowCount, archive.RowChecksum, archive.Columns).Scan(&archive.ID, &archive.ArchivedOn); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, fmt.Sprintf("ALTER TABLE %s DETACH PARTITION %s", archive.ParentTable, partitionName)); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, fmt.Sprintf("DROP TABLE %s", partitionName)); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	logger.Info().Str("Partition", partitionName).Int64("Rows", archive.RowCount).Str("Location", location).Msg("archived partition")
+	return archive, nil
+}
+
+// RestorePartition brings an archived partition back into the database
+func (subscription *Subscription) RestorePartition(ctx context.Context, partitionName string) error {
+	logger := zerolog.Ctx(ctx)
+
+	conn, err := subscription.Library.Pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	archives, err := subscription.archivedPartitions(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	var archive *ArchivedPartition
+	for _, candidate := range archives {
+		if candidate.PartitionName == partitionName {
+			archive = candidate
+		}
+	}
+
+	if archive == nil {
+		return fmt.Errorf("%w: %s", ErrArchiveNotFound, partitionName)
+	}
+
+	filer, err := data.NewFilerFromString(archive.Location)
+	if err != nil {
+		return err
+	}
+
+	// download the archive to a temporary file so that it is never held in memory
+	tmp, err := os.CreateTemp("", partitionName+"-*.parquet")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	savedSha256, err := fileSha256(filer, archive.FileName, tmp)
+	if err != nil {
+		return err
+	}
+
+	if savedSha256 != archive.FileSha256 {
+		return fmt.Errorf("%w: checksum of %s does not match the catalog", ErrArchiveVerifyFailed, archive.FileName)
+	}
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil {
+			if !errors.Is(err, pgx.ErrTxClosed) {
+				logger.Error().Err(err).Msg("error rollingback tx")
+			}
+		}
+	}()
+
+	sql := fmt.Sprintf("CREATE TABLE %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s')", archive.PartitionName,
+		archive.ParentTable, archive.RangeStart.Format("2006-01-02"), archive.RangeEnd.Format("2006-01-02"))
+	if _, err := tx.Exec(ctx, sql); err != nil {
+		logger.Error().Err(err).Str("SQL", sql).Msg("could not recreate partition")
+		return err
+	}
+
+	if _, err := data.CopyParquet(ctx, tx.Conn().PgConn(), archive.PartitionName, archive.Columns, tmp.Name()); err != nil {
+		return err
+	}
+
+	count, checksum, err := data.RowChecksum(ctx, tx, archive.PartitionName)
+	if err != nil {
+		return err
+	}
+
+	if count != archive.RowCount || checksum != archive.RowChecksum {
+		return fmt.Errorf("%w: restored %d rows (checksum %s), archived %d rows (checksum %s)", ErrArchiveVerifyFailed,
+			count, checksum, archive.RowCount, archive.RowChecksum)
+	}
+
+	if _, err := tx.Exec(ctx, "UPDATE archived_partitions SET restored_on = now() WHERE id = $1", archive.ID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	logger.Info().Str("Partition", partitionName).Int64("Rows", count).Msg("restored partition")
+	return nil
+}
+
+// fileSha256 returns the SHA-256 of a saved file, copying its contents to w
+func fileSha256(filer data.Filer, name string, w io.Writer) (string, error) {
+	reader, err := filer.OpenFile(name)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(w, hash), reader); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
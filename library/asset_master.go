@@ -0,0 +1,110 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package library
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/penny-vault/pvdata/data"
+	"github.com/rs/zerolog"
+)
+
+// AssetSources returns the asset tables of every active subscription; each
+// is named after its subscription, with the subscription's short ID appended
+// when several subscriptions share a name
+func (myLibrary *Library) AssetSources(ctx context.Context) ([]*data.AssetSource, error) {
+	subscriptions, err := myLibrary.Subscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]int, len(subscriptions))
+	for _, sub := range subscriptions {
+		if _, ok := sub.DataTablesMap[data.AssetKey]; ok && sub.Active {
+			names[sub.Name]++
+		}
+	}
+
+	sources := make([]*data.AssetSource, 0, len(subscriptions))
+	for _, sub := range subscriptions {
+		if tbl, ok := sub.DataTablesMap[data.AssetKey]; ok && sub.Active {
+			name := sub.Name
+			if name == "" || names[name] > 1 {
+				name = strings.TrimSpace(fmt.Sprintf("%s %s", sub.Name, sub.ID.String()[:5]))
+			}
+
+			sources = append(sources, &data.AssetSource{
+				Name:     name,
+				Provider: sub.Provider,
+				Table:    tbl,
+			})
+		}
+	}
+
+	return sources, nil
+}
+
+// MergeAssetMaster rebuilds the asset master from every asset subscription
+// using the precedence configured in asset_master.precedence and
+// asset_master.fields
+func (myLibrary *Library) MergeAssetMaster(ctx context.Context) (int, error) {
+	sources, err := myLibrary.AssetSources(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return myLibrary.mergeAssetMaster(ctx, sources)
+}
+
+// mergeAssetMaster rebuilds the asset master from `sources`
+func (myLibrary *Library) mergeAssetMaster(ctx context.Context, sources []*data.AssetSource) (int, error) {
+	conn, err := myLibrary.Pool.Acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Release()
+
+	return data.MergeAssetMaster(ctx, conn, sources, data.AssetPrecedenceFromConfig())
+}
+
+// AssetMasterProvenance counts the asset master fields taken from each source
+// keyed by field then source
+func (myLibrary *Library) AssetMasterProvenance(ctx context.Context) (map[string]map[string]int, error) {
+	sql := `SELECT p.key, p.value, count(*) FROM asset_master, jsonb_each_text(provenance) AS p GROUP BY 1, 2`
+	rows, err := myLibrary.Pool.Query(ctx, sql)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Str("SQL", sql).Msg("could not count asset master provenance")
+		return nil, err
+	}
+	defer rows.Close()
+
+	provenance := make(map[string]map[string]int)
+	for rows.Next() {
+		var field, source string
+		var count int
+		if err := rows.Scan(&field, &source, &count); err != nil {
+			return nil, err
+		}
+
+		if _, ok := provenance[field]; !ok {
+			provenance[field] = make(map[string]int)
+		}
+		provenance[field][source] = count
+	}
+
+	return provenance, rows.Err()
+}
@@ -0,0 +1,142 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package library
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/penny-vault/pvdata/data"
+	"github.com/rs/zerolog"
+)
+
+// BitemporalSetting is the subscription setting that turns on bitemporal storage
+const BitemporalSetting = "bitemporal"
+
+// IsBitemporal returns true if every version of the subscription's records is kept
+func (subscription *Subscription) IsBitemporal() bool {
+	return subscription.Settings[BitemporalSetting] == "true"
+}
+
+// BitemporalTables returns the tables of the subscription that support bitemporal storage
+func (subscription *Subscription) BitemporalTables() []string {
+	tables := make([]string, 0)
+	for idx, dataTypeName := range subscription.DataTypes {
+		if dataType, ok := data.DataTypes[dataTypeName]; ok && dataType.SupportsBitemporal() {
+			tables = append(tables, subscription.DataTables[idx])
+		}
+	}
+	return tables
+}
+
+// EnableBitemporal starts keeping every version of the subscription's records.
+// Records that already exist become the first version.
+func (subscription *Subscription) EnableBitemporal(ctx context.Context) error {
+	if len(subscription.BitemporalTables()) == 0 {
+		return data.ErrNotBitemporal
+	}
+
+	conn, err := subscription.Library.Pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil {
+			if !errors.Is(err, pgx.ErrTxClosed) {
+				zerolog.Ctx(ctx).Error().Err(err).Msg("error rollingback tx")
+			}
+		}
+	}()
+
+	if err := subscription.createHistoryTables(ctx, tx); err != nil {
+		return err
+	}
+
+	if subscription.Settings == nil {
+		subscription.Settings = make(map[string]string)
+	}
+
+	subscription.Settings[BitemporalSetting] = "true"
+	if _, err := tx.Exec(ctx, "UPDATE subscriptions SET settings=$1 WHERE id=$2", subscription.Settings, subscription.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// DisableBitemporal stops recording new versions; history recorded so far is kept
+func (subscription *Subscription) DisableBitemporal(ctx context.Context) error {
+	conn, err := subscription.Library.Pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil {
+			if !errors.Is(err, pgx.ErrTxClosed) {
+				zerolog.Ctx(ctx).Error().Err(err).Msg("error rollingback tx")
+			}
+		}
+	}()
+
+	for _, tbl := range subscription.BitemporalTables() {
+		if _, err := tx.Exec(ctx, data.BitemporalPause(tbl)); err != nil {
+			return err
+		}
+	}
+
+	delete(subscription.Settings, BitemporalSetting)
+	if _, err := tx.Exec(ctx, "UPDATE subscriptions SET settings=$1 WHERE id=$2", subscription.Settings, subscription.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// createHistoryTables creates the history tables and triggers of every bitemporal table
+func (subscription *Subscription) createHistoryTables(ctx context.Context, tx pgx.Tx) error {
+	for idx, dataTypeName := range subscription.DataTypes {
+		dataType := data.DataTypes[dataTypeName]
+		if !dataType.SupportsBitemporal() {
+			continue
+		}
+
+		sql, err := dataType.BitemporalSchema(subscription.DataTables[idx])
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, sql); err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Str("SQL", sql).Msg("could not create history table")
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package library
+
+import (
+	"context"
+	"os"
+	"os/user"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/penny-vault/pvdata/secret"
+)
+
+// SubscriptionChange records an edit to one field of a subscription
+type SubscriptionChange struct {
+	ID             int64     `json:"id"`
+	SubscriptionID uuid.UUID `json:"subscription_id"`
+	Field          string    `json:"field"`
+	OldValue       string    `json:"old_value"`
+	NewValue       string    `json:"new_value"`
+	ChangedBy      string    `json:"changed_by"`
+	ChangedOn      time.Time `json:"changed_on"`
+}
+
+// Changes returns the subscription's edit history, oldest first
+func (subscription *Subscription) Changes(ctx context.Context) ([]*SubscriptionChange, error) {
+	var changes []*SubscriptionChange
+	err := pgxscan.Select(ctx, subscription.Library.Pool, &changes, `SELECT id, subscription_id, field, old_value,
+new_value, changed_by, changed_on FROM subscription_changes WHERE subscription_id=$1 ORDER BY changed_on, id`, subscription.ID)
+	return changes, err
+}
+
+// DiffSubscriptions returns the changes between the `before` and `after` versions of a
+// subscription. Secret config values are masked.
+func DiffSubscriptions(before, after *Subscription) []*SubscriptionChange {
+	var changes []*SubscriptionChange
+	add := func(field, from, to string) {
+		if from != to {
+			changes = append(changes, &SubscriptionChange{SubscriptionID: after.ID, Field: field, OldValue: from, NewValue: to})
+		}
+	}
+
+	add("name", before.Name, after.Name)
+	add("schedule", before.Schedule, after.Schedule)
+	add("health_check_id", before.HealthCheckID, after.HealthCheckID)
+
+	for _, key := range UnionKeys(before.Config, after.Config) {
+		from, to := before.Config[key], after.Config[key]
+		if from == to {
+			continue
+		}
+
+		if slices.Contains(after.SecretFields, key) || secret.IsSealed(from) || secret.IsSealed(to) {
+			// the row records that the secret changed even though both values are masked
+			changes = append(changes, &SubscriptionChange{SubscriptionID: after.ID, Field: "config." + key,
+				OldValue: secret.Mask(from), NewValue: secret.Mask(to)})
+			continue
+		}
+
+		add("config."+key, from, to)
+	}
+
+	for _, key := range UnionKeys(before.Settings, after.Settings) {
+		add("settings."+key, before.Settings[key], after.Settings[key])
+	}
+
+	return changes
+}
+
+// UnionKeys returns the sorted keys of both maps
+func UnionKeys(a, b map[string]string) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for key := range a {
+		keys = append(keys, key)
+	}
+
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+
+	slices.Sort(keys)
+	return keys
+}
+
+// currentUsername returns the name of the user running pvdata. Containers often
+// run under a UID without a passwd entry, so $USER and then the numeric UID are
+// used when the user cannot be looked up.
+func currentUsername() string {
+	if currentUser, err := user.Current(); err == nil && currentUser.Username != "" {
+		return currentUser.Username
+	}
+
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+
+	if uid := os.Getuid(); uid >= 0 {
+		return strconv.Itoa(uid)
+	}
+
+	return "unknown"
+}
+
+// recordChanges saves `changes` to the subscription's edit history as the current user
+func recordChanges(ctx context.Context, tx pgx.Tx, changes []*SubscriptionChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	changedBy := currentUsername()
+	for _, change := range changes {
+		change.ChangedBy = changedBy
+		if _, err := tx.Exec(ctx, `INSERT INTO subscription_changes (subscription_id, field, old_value, new_value, changed_by)
+VALUES ($1, $2, $3, $4, $5)`, change.SubscriptionID, change.Field, change.OldValue, change.NewValue, change.ChangedBy); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package library_test
+
+import (
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/penny-vault/pvdata/library"
+	"github.com/penny-vault/pvdata/secret"
+)
+
+var _ = Describe("Changes", func() {
+	var before, after *library.Subscription
+
+	BeforeEach(func() {
+		before = &library.Subscription{
+			ID:            uuid.New(),
+			Name:          "Tiingo",
+			Schedule:      "0 18 * * 1-5",
+			HealthCheckID: "check-1",
+			Config:        map[string]string{"apiKey": "abc123", "rateLimit": "1000", "token": "env:TIINGO_TOKEN"},
+			Settings:      map[string]string{"universe": "active", "quality.max_jump": "0.5"},
+		}
+
+		after = &library.Subscription{
+			ID:            before.ID,
+			Name:          before.Name,
+			Schedule:      before.Schedule,
+			HealthCheckID: before.HealthCheckID,
+			SecretFields:  []string{"apiKey", "token"},
+			Config:        map[string]string{"apiKey": "abc123", "rateLimit": "1000", "token": "env:TIINGO_TOKEN"},
+			Settings:      map[string]string{"universe": "active", "quality.max_jump": "0.5"},
+		}
+	})
+
+	It("returns nothing when the subscription is unchanged", func() {
+		Expect(library.DiffSubscriptions(before, after)).To(BeEmpty())
+	})
+
+	It("records changed fields in sorted order", func() {
+		after.Schedule = "30 18 * * 1-5"
+		after.HealthCheckID = ""
+		after.Config["rateLimit"] = "500"
+		after.Settings["universe"] = "recent"
+		after.Settings["universe.recent_days"] = "30"
+		delete(after.Settings, "quality.max_jump")
+
+		changes := library.DiffSubscriptions(before, after)
+
+		fields := make([]string, len(changes))
+		for idx, change := range changes {
+			Expect(change.SubscriptionID).To(Equal(after.ID))
+			fields[idx] = change.Field
+		}
+		Expect(fields).To(Equal([]string{"schedule", "health_check_id", "config.rateLimit",
+			"settings.quality.max_jump", "settings.universe", "settings.universe.recent_days"}))
+
+		Expect(changes[2]).To(HaveField("OldValue", "1000"))
+		Expect(changes[2]).To(HaveField("NewValue", "500"))
+		Expect(changes[3]).To(HaveField("NewValue", ""))
+		Expect(changes[5]).To(HaveField("OldValue", ""))
+	})
+
+	It("masks secret config values", func() {
+		after.Config["apiKey"] = "def456"
+		after.Config["token"] = "env:OTHER_TOKEN"
+
+		changes := library.DiffSubscriptions(before, after)
+		Expect(changes).To(HaveLen(2))
+
+		Expect(changes[0].Field).To(Equal("config.apiKey"))
+		Expect(changes[0].OldValue).To(Equal(secret.Masked))
+		Expect(changes[0].NewValue).To(Equal(secret.Masked))
+
+		// references name where the secret is kept rather than the secret itself
+		Expect(changes[1].Field).To(Equal("config.token"))
+		Expect(changes[1].OldValue).To(Equal("env:TIINGO_TOKEN"))
+		Expect(changes[1].NewValue).To(Equal("env:OTHER_TOKEN"))
+	})
+
+	It("masks encrypted values of fields that are not marked secret", func() {
+		after.SecretFields = nil
+		after.Config["rateLimit"] = secret.EncryptedPrefix + "c2VhbGVk"
+
+		changes := library.DiffSubscriptions(before, after)
+		Expect(changes).To(HaveLen(1))
+		Expect(changes[0].OldValue).To(Equal(secret.Masked))
+		Expect(changes[0].NewValue).To(Equal(secret.Masked))
+	})
+
+	It("unions and sorts map keys", func() {
+		Expect(library.UnionKeys(map[string]string{"b": "1", "a": "2"}, map[string]string{"c": "3", "a": "4"})).
+			To(Equal([]string{"a", "b", "c"}))
+		Expect(library.UnionKeys(nil, nil)).To(BeEmpty())
+	})
+})
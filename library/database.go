@@ -16,7 +16,6 @@ package library
 
 import (
 	"context"
-	"fmt"
 	"sync"
 	"time"
 
@@ -24,7 +23,8 @@ import (
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/penny-vault/pvdata/data"
-	"github.com/rs/zerolog/log"
+	"github.com/penny-vault/pvdata/metrics"
+	"github.com/rs/zerolog"
 )
 
 type Library struct {
@@ -92,6 +92,12 @@ func (myLibrary *Library) SaveDB(ctx context.Context) error {
 	return err
 }
 
+// UpdateDB saves changes to the library's name and owner
+func (myLibrary *Library) UpdateDB(ctx context.Context) error {
+	_, err := myLibrary.Pool.Exec(ctx, `UPDATE library SET "name"=$1, "owner"=$2`, myLibrary.Name, myLibrary.Owner)
+	return err
+}
+
 // NumSubscriptions returns the total count of subscriptions configured in the database
 func (myLibrary *Library) NumSubscriptions(ctx context.Context) (int, error) {
 	conn, err := myLibrary.Pool.Acquire(ctx)
@@ -148,21 +154,23 @@ func (myLibrary *Library) TotalSecurities(ctx context.Context) (int, error) {
 	return count, err
 }
 
-// SaveObservations continuously reads from the input queue
-func (myLibrary *Library) SaveObservations(queue <-chan *data.Observation, wg *sync.WaitGroup) {
-	ctx := context.Background()
+// SaveObservations continuously reads from the input queue. Problems are
+// logged to the logger in ctx so they appear in the run's log.
+func (myLibrary *Library) SaveObservations(ctx context.Context, queue <-chan *data.Observation, wg *sync.WaitGroup) {
+	logger := zerolog.Ctx(ctx)
+
 	defer wg.Done()
 
 	conn, err := myLibrary.Pool.Acquire(ctx)
 	if err != nil {
-		log.Panic().Err(err).Msg("cannot acquire database connection")
+		logger.Panic().Err(err).Msg("cannot acquire database connection")
 		return
 	}
 	defer conn.Release()
 
 	subscriptionList, err := myLibrary.Subscriptions(ctx)
 	if err != nil {
-		log.Error().Err(err).Msg("could not get list of subscriptions")
+		logger.Error().Err(err).Msg("could not get list of subscriptions")
 	}
 
 	subscriptions := make(map[uuid.UUID]*Subscription, len(subscriptionList))
@@ -170,86 +178,138 @@ func (myLibrary *Library) SaveObservations(queue <-chan *data.Observation, wg *s
 		subscriptions[sub.ID] = sub
 	}
 
+	validators := make(map[uuid.UUID]*data.Validator, len(subscriptionList))
+	filers := make(map[uuid.UUID]data.Filer, len(subscriptionList))
+
 	for elem := range queue {
+		metrics.SaveQueueLength(len(queue))
+
 		subscription, ok := subscriptions[elem.SubscriptionID]
 		if !ok {
-			log.Error().Str("SubscriptionID", elem.SubscriptionID.String()).Str("SubscriptionName", elem.SubscriptionName).Msg("subscription not found")
+			logger.Error().Str("SubscriptionID", elem.SubscriptionID.String()).Str("SubscriptionName", elem.SubscriptionName).Msg("subscription not found")
 			continue
 		}
 
-		var filer data.Filer
-		if filerPath, ok := subscription.Config["filer"]; ok {
-			filer = data.NewFilerFromString(filerPath)
+		subscriptionID := subscription.ID.String()
+		metrics.ObservationReceived(subscriptionID, subscription.Provider)
+
+		// apply data quality rules before anything is saved
+		validator, ok := validators[subscription.ID]
+		if !ok {
+			validator = subscription.Validator(ctx, conn)
+			validators[subscription.ID] = validator
+		}
+
+		if !subscription.checkQuality(ctx, elem, validator, conn) {
+			continue
+		}
+
+		filer, ok := filers[subscription.ID]
+		if !ok {
+			if filerPath := subscription.Config["filer"]; filerPath != "" {
+				if filer, err = data.NewFilerFromString(filerPath); err != nil {
+					logger.Error().Err(err).Str("SubscriptionID", subscription.ID.String()).Str("Filer", filerPath).Msg("cannot create filer; asset files will not be saved")
+				}
+			}
+			filers[subscription.ID] = filer
 		}
 
 		if elem.AssetObject != nil {
 			if filer != nil {
 				err := elem.AssetObject.SaveFiles(ctx, filer)
 				if err != nil {
-					log.Error().Err(err).Msg("cannot save asset files")
+					logger.Error().Err(err).Msg("cannot save asset files")
 					continue
 				}
 			}
 
-			if err := elem.AssetObject.SaveDB(ctx, subscription.DataTablesMap[data.AssetKey], conn); err != nil {
-				log.Error().Err(err).Msg("cannot save asset to database")
+			assetCtx := ctx
+			if symbologyTable, ok := subscription.DataTablesMap[data.SymbologyKey]; ok {
+				asOf := elem.ObservationDate
+				if asOf.IsZero() {
+					asOf = time.Now()
+				}
+
+				assetCtx = data.WithSymbology(ctx, symbologyTable, asOf)
+			}
+
+			err := elem.AssetObject.SaveDB(assetCtx, subscription.DataTablesMap[data.AssetKey], conn)
+			metrics.RowSaved(subscriptionID, subscription.Provider, data.AssetKey, err)
+			if err != nil {
+				logger.Error().Err(err).Msg("cannot save asset to database")
 			}
 		}
 
 		if elem.CustomObject != nil {
-			if err := elem.CustomObject.SaveDB(ctx, subscription.DataTablesMap[data.CustomKey], conn); err != nil {
-				log.Error().Err(err).Msg("cannot save custom data to database")
+			err := elem.CustomObject.SaveDB(ctx, subscription.DataTablesMap[data.CustomKey], conn)
+			metrics.RowSaved(subscriptionID, subscription.Provider, data.CustomKey, err)
+			if err != nil {
+				logger.Error().Err(err).Msg("cannot save custom data to database")
 			}
 		}
 
 		if elem.EconomicIndicator != nil {
-			if err := elem.EconomicIndicator.SaveDB(ctx, subscription.DataTablesMap[data.EconomicIndicatorKey], conn); err != nil {
-				log.Error().Err(err).Msg("cannot save economic indicator to database")
+			err := elem.EconomicIndicator.SaveDB(ctx, subscription.DataTablesMap[data.EconomicIndicatorKey], conn)
+			metrics.RowSaved(subscriptionID, subscription.Provider, data.EconomicIndicatorKey, err)
+			if err != nil {
+				logger.Error().Err(err).Msg("cannot save economic indicator to database")
 			}
 		}
 
 		if elem.EodQuote != nil {
-			if err := elem.EodQuote.SaveDB(ctx, subscription.DataTablesMap[data.EODKey], conn); err != nil {
-				log.Error().Err(err).Msg("cannot save eod quote to database")
+			err := elem.EodQuote.SaveDB(ctx, subscription.DataTablesMap[data.EODKey], conn)
+			metrics.RowSaved(subscriptionID, subscription.Provider, data.EODKey, err)
+			if err != nil {
+				logger.Error().Err(err).Msg("cannot save eod quote to database")
 			}
 		}
 
 		if elem.Fundamental != nil {
-			if err := elem.Fundamental.SaveDB(ctx, subscription.DataTablesMap[data.FundamentalsKey], conn); err != nil {
-				log.Error().Err(err).Msg("cannot save fundamental to database")
+			err := elem.Fundamental.SaveDB(ctx, subscription.DataTablesMap[data.FundamentalsKey], conn)
+			metrics.RowSaved(subscriptionID, subscription.Provider, data.FundamentalsKey, err)
+			if err != nil {
+				logger.Error().Err(err).Msg("cannot save fundamental to database")
 			}
 		}
 
 		if elem.MarketHoliday != nil {
-			if err := elem.MarketHoliday.SaveDB(ctx, subscription.DataTablesMap[data.MarketHolidaysKey], conn); err != nil {
-				log.Error().Err(err).Msg("cannot save market holiday to database")
+			err := elem.MarketHoliday.SaveDB(ctx, subscription.DataTablesMap[data.MarketHolidaysKey], conn)
+			metrics.RowSaved(subscriptionID, subscription.Provider, data.MarketHolidaysKey, err)
+			if err != nil {
+				logger.Error().Err(err).Msg("cannot save market holiday to database")
 			}
 		}
 
 		if elem.Metric != nil {
-			if err := elem.Metric.SaveDB(ctx, subscription.DataTablesMap[data.MetricKey], conn); err != nil {
-				log.Error().Err(err).Msg("cannot save metric to database")
+			err := elem.Metric.SaveDB(ctx, subscription.DataTablesMap[data.MetricKey], conn)
+			metrics.RowSaved(subscriptionID, subscription.Provider, data.MetricKey, err)
+			if err != nil {
+				logger.Error().Err(err).Msg("cannot save metric to database")
 			}
 		}
 
 		if elem.Rating != nil {
-			if err := elem.Rating.SaveDB(ctx, subscription.DataTablesMap[data.RatingKey], conn); err != nil {
-				log.Error().Err(err).Msg("cannot save rating to database")
+			err := elem.Rating.SaveDB(ctx, subscription.DataTablesMap[data.RatingKey], conn)
+			metrics.RowSaved(subscriptionID, subscription.Provider, data.RatingKey, err)
+			if err != nil {
+				logger.Error().Err(err).Msg("cannot save rating to database")
 			}
 		}
 	}
+
+	metrics.SaveQueueLength(0)
 }
 
 // Subscriptions returns an array of subscription objects
 func (myLibrary *Library) Subscriptions(ctx context.Context) ([]*Subscription, error) {
 	var subscriptions []*Subscription
 	err := pgxscan.Select(ctx, myLibrary.Pool, &subscriptions,
-		`SELECT id, name, provider, dataset, config, data_tables, data_types, total_records,
+		`SELECT id, name, provider, dataset, config, settings, data_tables, data_types, total_records,
 num_records_last_import, total_securities, num_securities_last_import,
 coalesce(first_obs_date, '0001-01-01'::timestamp) as first_obs_date,
 coalesce(last_obs_date, '0001-01-01'::timestamp) as last_obs_date, schedule, health_check_id,
-coalesce(last_run, '0001-01-01'::timestamp) as last_run, active, schema_version, created_on,
-created_by FROM subscriptions`)
+coalesce(last_run, '0001-01-01'::timestamp) as last_run, coalesce(last_status, '') as last_status,
+active, schema_version, created_on, created_by FROM subscriptions`)
 	for _, sub := range subscriptions {
 		sub.Library = myLibrary
 
@@ -273,12 +333,13 @@ func (myLibrary *Library) SubscriptionFromID(ctx context.Context, id string) (*S
 		Library: myLibrary,
 	}
 
-	rows, err := conn.Query(ctx, fmt.Sprintf(`SELECT id, name, provider, dataset, config,
-	data_tables, data_types, total_records, num_records_last_import, total_securities,
+	rows, err := conn.Query(ctx, `SELECT id, name, provider, dataset, config,
+	settings, data_tables, data_types, total_records, num_records_last_import, total_securities,
 	num_securities_last_import, coalesce(first_obs_date, '0001-01-01'::timestamp) as first_obs_date,
 	coalesce(last_obs_date, '0001-01-01'::timestamp) as last_obs_date,
-	schedule, health_check_id, coalesce(last_run, '0001-01-01'::timestamp) as last_run, active,
-	schema_version, created_on, created_by FROM subscriptions WHERE id::text like '%s%%' LIMIT 1`, id))
+	schedule, health_check_id, coalesce(last_run, '0001-01-01'::timestamp) as last_run,
+	coalesce(last_status, '') as last_status, active, schema_version, created_on, created_by
+	FROM subscriptions WHERE starts_with(id::text, $1) LIMIT 1`, id)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,65 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package library
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/penny-vault/pvdata/data"
+)
+
+// Export writes the subscription's `dataType` table to `filer` in a directory
+// named after the table. See data.Export.
+func (subscription *Subscription) Export(ctx context.Context, dataType string, opts data.ExportOptions, filer data.Filer) (*data.ExportManifest, error) {
+	table, ok := subscription.DataTablesMap[dataType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownDataType, dataType)
+	}
+
+	conn, err := subscription.Library.Pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	source := data.ExportSource{
+		SubscriptionID: subscription.ID.String(),
+		Subscription:   subscription.Name,
+		Provider:       subscription.Provider,
+		Dataset:        subscription.Dataset,
+		DataType:       dataType,
+		Table:          table,
+	}
+
+	return data.Export(ctx, conn, table, source, opts, filer, table)
+}
+
+// SubscriptionsWithDataType returns the active subscriptions that provide `dataType`
+func (myLibrary *Library) SubscriptionsWithDataType(ctx context.Context, dataType string) ([]*Subscription, error) {
+	subscriptions, err := myLibrary.Subscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	matching := make([]*Subscription, 0)
+	for _, sub := range subscriptions {
+		if _, ok := sub.DataTablesMap[dataType]; ok && sub.Active {
+			matching = append(matching, sub)
+		}
+	}
+
+	return matching, nil
+}
@@ -0,0 +1,134 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package library
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/penny-vault/pvdata/data"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+// GapRule is the name quality issues for missing trading days are recorded under
+const GapRule = "eod-gap"
+
+var (
+	ErrNoEODTable = errors.New("subscription does not have an EOD table")
+)
+
+// FindGaps lists trading days between start and end that are missing from the
+// subscription's EOD table. Assets are read from the subscription's own asset
+// table if it has one, otherwise from data.DefaultAssetTable. Market holidays are
+// read from MarketHolidaysTable; data.ErrNoMarketCalendar is returned if there
+// is none so that holidays are never recorded as gaps.
+func (subscription *Subscription) FindGaps(ctx context.Context, start, end time.Time) ([]*data.Gap, error) {
+	eodTable, ok := subscription.DataTablesMap[data.EODKey]
+	if !ok {
+		return nil, ErrNoEODTable
+	}
+
+	assetTable, ok := subscription.DataTablesMap[data.AssetKey]
+	if !ok {
+		assetTable = data.DefaultAssetTable()
+	}
+
+	holidayTable, err := subscription.Library.MarketHolidaysTable(ctx)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("set default.market_holidays_table or subscribe to a market holidays dataset")
+		return nil, err
+	}
+
+	conn, err := subscription.Library.Pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	return data.FindGaps(ctx, conn, eodTable, assetTable, holidayTable, start, end)
+}
+
+// MarketHolidaysTable returns the table market holidays are read from:
+// default.market_holidays_table if it is set, otherwise the table of the oldest
+// active market holidays subscription, otherwise the market_holidays table read
+// by the trading_days() SQL function if it exists.
+func (myLibrary *Library) MarketHolidaysTable(ctx context.Context) (string, error) {
+	if holidayTable := viper.GetString("default.market_holidays_table"); holidayTable != "" {
+		return holidayTable, nil
+	}
+
+	subscriptions, err := myLibrary.SubscriptionsWithDataType(ctx, data.MarketHolidaysKey)
+	if err != nil {
+		return "", err
+	}
+
+	if len(subscriptions) > 0 {
+		slices.SortStableFunc(subscriptions, func(a, b *Subscription) int {
+			return a.CreatedOn.Compare(b.CreatedOn)
+		})
+		return subscriptions[0].DataTablesMap[data.MarketHolidaysKey], nil
+	}
+
+	var exists bool
+	if err := myLibrary.Pool.QueryRow(ctx, "SELECT to_regclass('market_holidays') IS NOT NULL").Scan(&exists); err != nil {
+		return "", err
+	}
+
+	if exists {
+		return "market_holidays", nil
+	}
+
+	return "", data.ErrNoMarketCalendar
+}
+
+// RecordGaps replaces the gap issues recorded for the subscription between
+// start and end with `gaps`
+func (subscription *Subscription) RecordGaps(ctx context.Context, gaps []*data.Gap, start, end time.Time) error {
+	conn, err := subscription.Library.Pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, `DELETE FROM quality_issues
+	WHERE subscription_id = $1 AND rule = $2 AND event_date BETWEEN $3 AND $4`,
+		subscription.ID, GapRule, start, end); err != nil {
+		return err
+	}
+
+	for _, gap := range gaps {
+		issue := &data.QualityIssue{
+			SubscriptionID: subscription.ID,
+			TableName:      subscription.DataTablesMap[data.EODKey],
+			DataType:       data.EODKey,
+			Rule:           GapRule,
+			Action:         data.QualityWarn,
+			Ticker:         gap.Ticker,
+			CompositeFigi:  gap.CompositeFigi,
+			EventDate:      gap.EventDate,
+			Message:        fmt.Sprintf("no quote on trading day %s", gap.EventDate.Format("2006-01-02")),
+		}
+
+		if err := issue.SaveDB(ctx, conn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,209 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package library
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/penny-vault/pvdata/data"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// PartitionStatus describes the partitions of one of the subscription's tables
+type PartitionStatus struct {
+	Table    string
+	DataType string
+	Layout   data.PartitionLayout
+
+	// Existing partitions attached to the table
+	Existing []*data.Partition
+
+	// Archived partitions moved out of the database
+	Archived []*data.Partition
+
+	// Missing partitions that ManagePartitions would create
+	Missing []*data.Partition
+}
+
+// PartitionLayout returns the partition layout of the data type; the
+// subscription's partitions setting overrides the data type's default
+func (subscription *Subscription) PartitionLayout(dataType *data.DataType) data.PartitionLayout {
+	if val, ok := subscription.Settings[data.PartitionLayoutSetting]; ok {
+		if layout, err := data.ParsePartitionLayout(val); err == nil {
+			return layout
+		}
+		log.Warn().Str("Value", val).Msg("ignoring invalid partitions setting")
+	}
+
+	if dataType.PartitionLayout != "" {
+		return dataType.PartitionLayout
+	}
+
+	return data.FiveYearPartitions
+}
+
+// partitionsThrough returns the last date partitions are created for;
+// partitions.months_ahead months from now
+func partitionsThrough() time.Time {
+	monthsAhead := data.DefaultPartitionMonthsAhead
+	if viper.IsSet("partitions.months_ahead") {
+		monthsAhead = viper.GetInt("partitions.months_ahead")
+	}
+
+	return time.Now().AddDate(0, monthsAhead, 0)
+}
+
+// PartitionStatus compares the partitions of each partitioned table with
+// the partitions it should have; archived partitions count as present
+func (subscription *Subscription) PartitionStatus(ctx context.Context) ([]*PartitionStatus, error) {
+	conn, err := subscription.Library.Pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	return subscription.partitionStatus(ctx, conn)
+}
+
+func (subscription *Subscription) partitionStatus(ctx context.Context, dbConn data.Querier) ([]*PartitionStatus, error) {
+	through := partitionsThrough()
+	statuses := make([]*PartitionStatus, 0, len(subscription.DataTypes))
+
+	archives, err := subscription.archivedPartitions(ctx, dbConn)
+	if err != nil {
+		return nil, err
+	}
+
+	for idx, dataTypeName := range subscription.DataTypes {
+		dataType := data.DataTypes[dataTypeName]
+
+		// if table is not partitioned skip to next dataType
+		if !dataType.IsPartitioned {
+			continue
+		}
+
+		status := &PartitionStatus{
+			Table:    subscription.DataTables[idx],
+			DataType: dataTypeName,
+			Layout:   subscription.PartitionLayout(dataType),
+		}
+
+		existing, err := data.ListPartitions(ctx, dbConn, status.Table)
+		if err != nil {
+			return nil, err
+		}
+		status.Existing = existing
+
+		for _, archive := range archives {
+			if archive.ParentTable == status.Table {
+				status.Archived = append(status.Archived, &data.Partition{
+					Name:  archive.PartitionName,
+					Start: archive.RangeStart,
+					End:   archive.RangeEnd,
+					Rows:  archive.RowCount,
+				})
+			}
+		}
+
+		// archived ranges are not recreated
+		covered := append(append([]*data.Partition{}, status.Existing...), status.Archived...)
+		planned := data.PlanPartitions(status.Table, status.Layout, through)
+		status.Missing = data.MissingPartitions(status.Table, covered, planned)
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// ManagePartitions creates any new partitions needed for the subscription
+func (subscription *Subscription) ManagePartitions(ctx context.Context) error {
+	logger := zerolog.Ctx(ctx)
+
+	conn, err := subscription.Library.Pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil {
+			if !errors.Is(err, pgx.ErrTxClosed) {
+				logger.Error().Err(err).Msg("error rollingback tx")
+			}
+		}
+	}()
+
+	// manage partitions
+	if err := subscription.managePartitionsWithTransaction(ctx, tx); err != nil {
+		logger.Error().Err(err).Msg("error encountered when creating partitions")
+		return err
+	}
+
+	// commit to database
+	if err := tx.Commit(ctx); err != nil {
+		logger.Error().Err(err).Msg("error committing manage partitions transaction")
+		return err
+	}
+
+	return nil
+}
+
+// managePartitionsWithTransaction uses the specified transaction `tx` to create missing partitions
+func (subscription *Subscription) managePartitionsWithTransaction(ctx context.Context, tx pgx.Tx) error {
+	statuses, err := subscription.partitionStatus(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	for _, status := range statuses {
+		if err := data.CreatePartitions(ctx, tx, status.Table, status.Missing); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// partitionTables returns the names of the partitions attached to the subscription's tables
+func (subscription *Subscription) partitionTables(ctx context.Context, dbConn data.Querier) ([]string, error) {
+	tables := make([]string, 0, 10)
+
+	for idx, dataTypeName := range subscription.DataTypes {
+		if !data.DataTypes[dataTypeName].IsPartitioned {
+			continue
+		}
+
+		partitions, err := data.ListPartitions(ctx, dbConn, subscription.DataTables[idx])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, partition := range partitions {
+			tables = append(tables, partition.Name)
+		}
+	}
+
+	return tables, nil
+}
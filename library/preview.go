@@ -0,0 +1,174 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package library
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/penny-vault/pvdata/data"
+	"github.com/rs/zerolog"
+)
+
+// previewTablePrefix names the temporary tables a preview saves observations to
+const previewTablePrefix = "pvdata_preview_"
+
+// Preview collects the observations of a dry run. Observations that pass the
+// quality rules are saved to temporary copies of the subscription's tables,
+// visible only to the preview's connection, so they can be compared with the
+// rows already saved.
+type Preview struct {
+	Collector *data.Collector
+
+	subscription *Subscription
+	conn         *pgxpool.Conn
+
+	// tables maps data types to temporary tables; data types the
+	// subscription has no table for map to ""
+	tables map[string]string
+}
+
+type dbSaver interface {
+	SaveDB(ctx context.Context, tbl string, dbConn *pgxpool.Conn) error
+}
+
+// NewPreview starts a dry run of the subscription
+func (subscription *Subscription) NewPreview(ctx context.Context, collector *data.Collector) (*Preview, error) {
+	conn, err := subscription.Library.Pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Preview{
+		Collector:    collector,
+		subscription: subscription,
+		conn:         conn,
+		tables:       make(map[string]string),
+	}, nil
+}
+
+// Collect continuously reads from the input queue
+func (preview *Preview) Collect(ctx context.Context, queue <-chan *data.Observation, wg *sync.WaitGroup) {
+	logger := zerolog.Ctx(ctx)
+
+	defer wg.Done()
+
+	validator := preview.subscription.Validator(ctx, preview.conn)
+	for elem := range queue {
+		action, issues := validator.Validate(elem)
+		for _, issue := range issues {
+			logger.Warn().Str("SubscriptionID", preview.subscription.ID.String()).Str("Rule", issue.Rule).Str("Action", string(issue.Action)).
+				Str("Ticker", issue.Ticker).Str("CompositeFigi", issue.CompositeFigi).Time("EventDate", issue.EventDate).
+				Msg(issue.Message)
+		}
+
+		rejected := action == data.QualityReject || action == data.QualityQuarantine
+		if err := preview.Collector.Add(elem, rejected); err != nil {
+			logger.Error().Err(err).Msg("could not write observation to preview")
+		}
+
+		if rejected {
+			continue
+		}
+
+		dataType, payload := elem.Payload()
+		saver, ok := payload.(dbSaver)
+		if !ok {
+			continue
+		}
+
+		tbl, err := preview.table(ctx, dataType)
+		if err != nil {
+			logger.Error().Err(err).Str("DataType", dataType).Msg("could not create preview table")
+			continue
+		}
+
+		if tbl == "" {
+			continue
+		}
+
+		if err := saver.SaveDB(ctx, tbl, preview.conn); err != nil {
+			logger.Error().Err(err).Str("DataType", dataType).Msg("cannot save observation to preview table")
+		}
+	}
+}
+
+// table returns the temporary table observations of `dataType` are saved to,
+// creating it from the subscription's table the first time it is needed
+func (preview *Preview) table(ctx context.Context, dataType string) (string, error) {
+	if tbl, ok := preview.tables[dataType]; ok {
+		return tbl, nil
+	}
+
+	target, ok := preview.subscription.DataTablesMap[dataType]
+	if !ok {
+		preview.tables[dataType] = ""
+		return "", nil
+	}
+
+	tbl := previewTablePrefix + strings.ReplaceAll(dataType, "-", "_")
+	sql := fmt.Sprintf("CREATE TEMPORARY TABLE %s (LIKE %s INCLUDING DEFAULTS INCLUDING GENERATED INCLUDING INDEXES)", tbl, target)
+	if _, err := preview.conn.Exec(ctx, sql); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Str("SQL", sql).Msg("could not create preview table")
+		return "", err
+	}
+
+	preview.tables[dataType] = tbl
+	return tbl, nil
+}
+
+// Diff compares the collected observations with the subscription's tables.
+// Observations of data types the subscription has no table for are all new.
+func (preview *Preview) Diff(ctx context.Context) ([]*data.PreviewDiff, error) {
+	dataTypes := preview.Collector.DataTypes()
+	diffs := make([]*data.PreviewDiff, 0, len(dataTypes))
+	for _, dataType := range dataTypes {
+		tbl := preview.tables[dataType]
+		if tbl == "" {
+			diffs = append(diffs, &data.PreviewDiff{
+				DataType: dataType,
+				New:      int64(preview.Collector.Counts[dataType] - preview.Collector.Rejected[dataType]),
+			})
+			continue
+		}
+
+		diff, err := data.DiffPreview(ctx, preview.conn, dataType, tbl, preview.subscription.DataTablesMap[dataType])
+		if err != nil {
+			return nil, err
+		}
+
+		diffs = append(diffs, diff)
+	}
+
+	return diffs, nil
+}
+
+// Close drops the preview's temporary tables
+func (preview *Preview) Close(ctx context.Context) {
+	for _, tbl := range preview.tables {
+		if tbl == "" {
+			continue
+		}
+
+		if _, err := preview.conn.Exec(ctx, fmt.Sprintf("DROP TABLE IF EXISTS %s", tbl)); err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Str("Table", tbl).Msg("could not drop preview table")
+		}
+	}
+
+	preview.conn.Release()
+}
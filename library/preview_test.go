@@ -0,0 +1,96 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package library_test
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/penny-vault/pvdata/data"
+	"github.com/penny-vault/pvdata/library"
+)
+
+var _ = Describe("Preview", func() {
+	It("marks dry runs in the context", func() {
+		ctx := context.Background()
+		Expect(data.IsDryRun(ctx)).To(BeFalse())
+		Expect(data.IsDryRun(data.WithDryRun(ctx))).To(BeTrue())
+	})
+
+	It("saves observations only to temporary tables", func() {
+		dbURL := os.Getenv("PVDATA_TEST_DB_URL")
+		if dbURL == "" {
+			Skip("PVDATA_TEST_DB_URL is not set")
+		}
+
+		ctx := data.WithDryRun(context.Background())
+		myLibrary, err := library.NewFromDB(ctx, dbURL)
+		Expect(err).NotTo(HaveOccurred())
+		defer myLibrary.Close()
+
+		subscription := &library.Subscription{
+			ID:        uuid.New(),
+			Name:      "preview test",
+			Provider:  "fred",
+			Dataset:   "Economic Indicators",
+			Config:    map[string]string{},
+			DataTypes: []string{data.EconomicIndicatorKey},
+			Library:   myLibrary,
+		}
+		subscription.ComputeTableNames()
+		Expect(subscription.Save(ctx)).To(Succeed())
+		defer func() {
+			Expect(subscription.Delete(ctx)).To(Succeed())
+		}()
+
+		preview, err := subscription.NewPreview(ctx, data.NewCollector(5, nil))
+		Expect(err).NotTo(HaveOccurred())
+
+		queue := make(chan *data.Observation, 1)
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go preview.Collect(ctx, queue, &wg)
+
+		queue <- &data.Observation{
+			EconomicIndicator: &data.EconomicIndicator{Series: "TEST", EventDate: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), Value: 1},
+			ObservationDate:   time.Now(),
+			SubscriptionID:    subscription.ID,
+		}
+		close(queue)
+		wg.Wait()
+
+		diffs, err := preview.Diff(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(diffs).To(HaveLen(1))
+		Expect(diffs[0].New).To(Equal(int64(1)))
+		preview.Close(ctx)
+
+		var count int
+		Expect(myLibrary.Pool.QueryRow(ctx, "SELECT count(*) FROM "+subscription.DataTablesMap[data.EconomicIndicatorKey]).
+			Scan(&count)).To(Succeed())
+		Expect(count).To(Equal(0))
+
+		var numTemp int
+		Expect(myLibrary.Pool.QueryRow(ctx, "SELECT count(*) FROM pg_class WHERE relpersistence = 't' AND relname LIKE 'pvdata_preview_%'").
+			Scan(&numTemp)).To(Succeed())
+		Expect(numTemp).To(Equal(0))
+	})
+})
@@ -0,0 +1,165 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package library
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/penny-vault/pvdata/data"
+	"github.com/rs/zerolog"
+)
+
+// QualityCount is the number of issues a rule found for a subscription
+type QualityCount struct {
+	SubscriptionID string `db:"subscription_id"`
+	Rule           string `db:"rule"`
+	Action         string `db:"action"`
+	Count          int64  `db:"count"`
+}
+
+// SaveSettings stores the subscription's settings in the database
+func (subscription *Subscription) SaveSettings(ctx context.Context) error {
+	if subscription.Settings == nil {
+		subscription.Settings = make(map[string]string)
+	}
+
+	_, err := subscription.Library.Pool.Exec(ctx, "UPDATE subscriptions SET settings=$1 WHERE id=$2", subscription.Settings, subscription.ID)
+	return err
+}
+
+// Validator returns a quality validator configured with the subscription's settings
+func (subscription *Subscription) Validator(ctx context.Context, dbConn *pgxpool.Conn) *data.Validator {
+	validator := data.NewValidator(subscription.Settings)
+
+	if tbl, ok := subscription.DataTablesMap[data.EODKey]; ok {
+		sql := fmt.Sprintf("SELECT close::float8 FROM %s WHERE composite_figi=$1 AND event_date < $2 ORDER BY event_date DESC LIMIT 1", tbl)
+		validator.PriorClose = func(compositeFigi string, date time.Time) (float64, bool) {
+			var prevClose float64
+			if err := dbConn.QueryRow(ctx, sql, compositeFigi, date).Scan(&prevClose); err != nil {
+				if !errors.Is(err, pgx.ErrNoRows) {
+					zerolog.Ctx(ctx).Error().Err(err).Str("SQL", sql).Msg("could not lookup prior close")
+				}
+				return 0, false
+			}
+			return prevClose, true
+		}
+	}
+
+	return validator
+}
+
+// checkQuality validates the observation and records any issues found. Returns
+// true if the observation should be saved.
+func (subscription *Subscription) checkQuality(ctx context.Context, obs *data.Observation, validator *data.Validator, dbConn *pgxpool.Conn) bool {
+	action, issues := validator.Validate(obs)
+	for _, issue := range issues {
+		issue.TableName = subscription.DataTablesMap[issue.DataType]
+
+		zerolog.Ctx(ctx).Warn().Str("SubscriptionID", subscription.ID.String()).Str("Rule", issue.Rule).Str("Action", string(issue.Action)).
+			Str("Ticker", issue.Ticker).Str("CompositeFigi", issue.CompositeFigi).Time("EventDate", issue.EventDate).
+			Msg(issue.Message)
+
+		// errors are logged by SaveDB; a failure to record an issue should not stop the import
+		_ = issue.SaveDB(ctx, dbConn)
+	}
+
+	return action != data.QualityReject && action != data.QualityQuarantine
+}
+
+// QualitySummary counts the quality issues recorded since the given time
+func (myLibrary *Library) QualitySummary(ctx context.Context, since time.Time) ([]*QualityCount, error) {
+	var counts []*QualityCount
+	err := pgxscan.Select(ctx, myLibrary.Pool, &counts, `SELECT subscription_id::text AS subscription_id, rule, action, count(*) AS count
+FROM quality_issues WHERE detected_on >= $1 GROUP BY subscription_id, rule, action ORDER BY subscription_id, rule`, since)
+	return counts, err
+}
+
+// QuarantinedIssue is a quarantined observation that has not been released
+type QuarantinedIssue struct {
+	ID            int64
+	Rule          string
+	DataType      string
+	Ticker        string
+	CompositeFigi string
+	EventDate     time.Time
+	Message       string
+	DetectedOn    time.Time
+	Observation   []byte
+}
+
+// Quarantined returns the subscription's quarantined observations, optionally
+// limited to those found by `rule` or with the given issue IDs
+func (subscription *Subscription) Quarantined(ctx context.Context, rule string, ids []int64) ([]*QuarantinedIssue, error) {
+	if ids == nil {
+		ids = []int64{}
+	}
+
+	var issues []*QuarantinedIssue
+	err := pgxscan.Select(ctx, subscription.Library.Pool, &issues, `SELECT id, rule, data_type, coalesce(ticker, '') AS ticker,
+coalesce(composite_figi, '') AS composite_figi, coalesce(event_date, '0001-01-01'::date) AS event_date, message, detected_on,
+observation FROM quality_issues
+WHERE subscription_id = $1 AND action = 'quarantine' AND released_on IS NULL AND observation IS NOT NULL
+	AND ($2 = '' OR rule = $2) AND (cardinality($3::bigint[]) = 0 OR id = ANY($3))
+ORDER BY id`, subscription.ID, rule, ids)
+	return issues, err
+}
+
+// ReleaseQuarantined saves quarantined observations to the subscription's
+// tables without checking them again and marks the issues released. Returns
+// the number of observations saved.
+func (subscription *Subscription) ReleaseQuarantined(ctx context.Context, issues []*QuarantinedIssue) (int, error) {
+	conn, err := subscription.Library.Pool.Acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Release()
+
+	released := 0
+	for _, issue := range issues {
+		tbl, ok := subscription.DataTablesMap[issue.DataType]
+		if !ok {
+			return released, fmt.Errorf("%w: %s", ErrUnknownDataType, issue.DataType)
+		}
+
+		obs, err := data.DecodeQuarantined(issue.DataType, issue.Observation)
+		if err != nil {
+			return released, fmt.Errorf("issue %d: %w", issue.ID, err)
+		}
+
+		_, payload := obs.Payload()
+		saver, ok := payload.(dbSaver)
+		if !ok {
+			return released, fmt.Errorf("%w: %s", ErrUnknownDataType, issue.DataType)
+		}
+
+		if err := saver.SaveDB(ctx, tbl, conn); err != nil {
+			return released, err
+		}
+
+		if _, err := conn.Exec(ctx, "UPDATE quality_issues SET released_on = now() WHERE id = $1", issue.ID); err != nil {
+			return released, err
+		}
+
+		released++
+	}
+
+	return released, nil
+}
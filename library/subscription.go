@@ -18,16 +18,22 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"os/user"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/go-resty/resty/v2"
 	"github.com/google/uuid"
 	"github.com/gosimple/slug"
 	"github.com/jackc/pgx/v5"
 	"github.com/penny-vault/pvdata/data"
 	"github.com/penny-vault/pvdata/healthcheck"
-	"github.com/rs/zerolog/log"
+	"github.com/penny-vault/pvdata/metrics"
+	"github.com/penny-vault/pvdata/monitor"
+	"github.com/penny-vault/pvdata/secret"
+	"github.com/rs/zerolog"
+	"golang.org/x/time/rate"
 )
 
 type Subscription struct {
@@ -38,6 +44,14 @@ type Subscription struct {
 	Dataset  string
 	Config   map[string]string
 
+	// SecretFields are the Config keys the provider marks as secret. They are
+	// encrypted with the library key when saved and masked in output.
+	SecretFields []string `db:"-"`
+
+	// Settings control how pv-data handles the subscription's data (e.g.
+	// quality rule actions) as opposed to Config which is passed to the provider
+	Settings map[string]string
+
 	DataTables    []string
 	DataTypes     []string
 	DataTablesMap map[string]string
@@ -55,22 +69,58 @@ type Subscription struct {
 	Schedule      string
 	HealthCheckID string
 	LastRun       time.Time
+	LastStatus    string
 	Active        bool
 	SchemaVersion int
 
 	CreatedOn time.Time
 	CreatedBy string
 
+	// Client and Limiter are set by ForFetch; providers use them for every
+	// request so that requests and rate limit waits are recorded in metrics
+	Client  *resty.Client    `db:"-"`
+	Limiter *metrics.Limiter `db:"-"`
+
 	Library *Library
 }
 
-type dateRange struct {
-	Start int
-	End   int
+var (
+	ErrUnknownDataType = errors.New("unknown data type")
+)
+
+// defaultRateLimit is the requests per minute used when a provider's
+// rateLimit is not positive
+const defaultRateLimit = 5000
+
+// ForFetch returns a copy of the subscription that uses `config` and carries
+// the instrumented HTTP client and rate limiter a provider fetches with
+func (subscription *Subscription) ForFetch(config map[string]string) (*Subscription, error) {
+	fetchSubscription := *subscription
+	fetchSubscription.Config = config
+	fetchSubscription.Client = metrics.NewClient(subscription.Provider)
+	fetchSubscription.Limiter = metrics.NewLimiter(subscription.Provider, rate.Inf, 1)
+
+	if val, ok := config["rateLimit"]; ok {
+		rateLimit, err := strconv.Atoi(val)
+		if err != nil {
+			return nil, fmt.Errorf("could not convert rateLimit configuration parameter '%s' to an integer: %w", val, err)
+		}
+
+		if rateLimit <= 0 {
+			rateLimit = defaultRateLimit
+		}
+
+		// rateLimit is per minute; spread it over 61 seconds to stay safely under
+		fetchSubscription.Limiter = metrics.NewLimiter(subscription.Provider, rate.Limit(float64(rateLimit)/float64(61)), 1)
+	}
+
+	return &fetchSubscription, nil
 }
 
 // Delete the subscription from database along with all associated tables
 func (subscription *Subscription) Delete(ctx context.Context) error {
+	logger := zerolog.Ctx(ctx)
+
 	conn, err := subscription.Library.Pool.Acquire(ctx)
 	if err != nil {
 		return err
@@ -85,23 +135,38 @@ func (subscription *Subscription) Delete(ctx context.Context) error {
 	defer func() {
 		if err := tx.Rollback(ctx); err != nil {
 			if !errors.Is(err, pgx.ErrTxClosed) {
-				log.Error().Err(err).Msg("error rollingback tx")
+				logger.Error().Err(err).Msg("error rollingback tx")
 			}
 		}
 	}()
 
-	tables := subscription.PartitionTables()
+	// remove the history of bitemporal tables
+	for _, tblName := range subscription.BitemporalTables() {
+		if _, err := tx.Exec(ctx, data.BitemporalTeardown(tblName)); err != nil {
+			return err
+		}
+	}
+
+	tables, err := subscription.partitionTables(ctx, tx)
+	if err != nil {
+		return err
+	}
 	tables = append(tables, subscription.DataTables...)
 
 	// delete tables
 	for _, tblName := range tables {
-		log.Info().Str("TableName", tblName).Msg("delete table")
+		logger.Info().Str("TableName", tblName).Msg("delete table")
 		_, err := tx.Exec(ctx, fmt.Sprintf("DROP TABLE IF EXISTS %s;", tblName))
 		if err != nil {
 			return err
 		}
 	}
 
+	// forget any corporate actions applied to the subscription's tables
+	if _, err := tx.Exec(ctx, "DELETE FROM eod_adjustments WHERE table_name = ANY($1)", subscription.DataTables); err != nil {
+		return err
+	}
+
 	// delete subscription entry
 	if _, err := tx.Exec(ctx, "DELETE FROM subscriptions WHERE id=$1", subscription.ID); err != nil {
 		return err
@@ -137,16 +202,24 @@ func (subscription *Subscription) Activate(ctx context.Context) error {
 	defer func() {
 		if err := tx.Rollback(ctx); err != nil {
 			if !errors.Is(err, pgx.ErrTxClosed) {
-				log.Error().Err(err).Msg("error rollingback tx")
+				zerolog.Ctx(ctx).Error().Err(err).Msg("error rollingback tx")
 			}
 		}
 	}()
 
 	// activate subscription entry
-	if _, err := tx.Exec(ctx, "UPDATE subscriptions SET active='t' WHERE id=$1", subscription.ID); err != nil {
+	tag, err := tx.Exec(ctx, "UPDATE subscriptions SET active='t' WHERE id=$1 AND active IS DISTINCT FROM 't'", subscription.ID)
+	if err != nil {
 		return err
 	}
 
+	if tag.RowsAffected() > 0 {
+		if err := recordChanges(ctx, tx, []*SubscriptionChange{{SubscriptionID: subscription.ID, Field: "active",
+			OldValue: "false", NewValue: "true"}}); err != nil {
+			return err
+		}
+	}
+
 	if err := tx.Commit(ctx); err != nil {
 		return err
 	}
@@ -178,16 +251,24 @@ func (subscription *Subscription) Deactivate(ctx context.Context) error {
 	defer func() {
 		if err := tx.Rollback(ctx); err != nil {
 			if !errors.Is(err, pgx.ErrTxClosed) {
-				log.Error().Err(err).Msg("error rollingback tx")
+				zerolog.Ctx(ctx).Error().Err(err).Msg("error rollingback tx")
 			}
 		}
 	}()
 
 	// de-activate subscription entry
-	if _, err := tx.Exec(ctx, "UPDATE subscriptions SET active='f' WHERE id=$1", subscription.ID); err != nil {
+	tag, err := tx.Exec(ctx, "UPDATE subscriptions SET active='f' WHERE id=$1 AND active IS DISTINCT FROM 'f'", subscription.ID)
+	if err != nil {
 		return err
 	}
 
+	if tag.RowsAffected() > 0 {
+		if err := recordChanges(ctx, tx, []*SubscriptionChange{{SubscriptionID: subscription.ID, Field: "active",
+			OldValue: "true", NewValue: "false"}}); err != nil {
+			return err
+		}
+	}
+
 	if err := tx.Commit(ctx); err != nil {
 		return err
 	}
@@ -202,8 +283,184 @@ func (subscription *Subscription) Deactivate(ctx context.Context) error {
 	return nil
 }
 
+// HealthCheckName is the name of the subscription's healthchecks.io check
+func (subscription *Subscription) HealthCheckName() string {
+	return fmt.Sprintf("%s %s (%s)", subscription.Name, subscription.Dataset, subscription.ID.String()[:5])
+}
+
+// RecordRun saves when the subscription last ran and the outcome of the run
+func (subscription *Subscription) RecordRun(ctx context.Context, runTime time.Time, status string) error {
+	if _, err := subscription.Library.Pool.Exec(ctx, "UPDATE subscriptions SET last_run=$1, last_status=$2 WHERE id=$3",
+		runTime, status, subscription.ID); err != nil {
+		return err
+	}
+
+	subscription.LastRun = runTime
+	subscription.LastStatus = status
+	return nil
+}
+
+// SealConfig encrypts the plaintext values of the subscription's secret fields
+// with the library key. Encrypted values and env:/file: references are left as-is.
+func (subscription *Subscription) SealConfig() error {
+	var key []byte
+	for _, field := range subscription.SecretFields {
+		val := subscription.Config[field]
+		if val == "" || secret.IsSealed(val) {
+			continue
+		}
+
+		if key == nil {
+			var err error
+			if key, err = secret.LoadKey(); err != nil {
+				return fmt.Errorf("cannot encrypt %s: %w", field, err)
+			}
+		}
+
+		sealed, err := secret.Encrypt(key, val)
+		if err != nil {
+			return err
+		}
+		subscription.Config[field] = sealed
+	}
+
+	return nil
+}
+
+// Update saves changes to the subscription's name, schedule, config, settings
+// and health check, records them in the subscription's edit history and
+// updates the health check's name and schedule to match
+func (subscription *Subscription) Update(ctx context.Context) error {
+	if err := subscription.Validate(); err != nil {
+		return err
+	}
+
+	if err := subscription.SealConfig(); err != nil {
+		return err
+	}
+
+	if subscription.Settings == nil {
+		subscription.Settings = make(map[string]string)
+	}
+
+	conn, err := subscription.Library.Pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil {
+			if !errors.Is(err, pgx.ErrTxClosed) {
+				zerolog.Ctx(ctx).Error().Err(err).Msg("error rollingback tx")
+			}
+		}
+	}()
+
+	before := &Subscription{}
+	if err := tx.QueryRow(ctx, `SELECT name, schedule, config, settings, coalesce(health_check_id, '')
+FROM subscriptions WHERE id=$1 FOR UPDATE`, subscription.ID).Scan(&before.Name, &before.Schedule, &before.Config,
+		&before.Settings, &before.HealthCheckID); err != nil {
+		return err
+	}
+
+	changes := DiffSubscriptions(before, subscription)
+	if err := recordChanges(ctx, tx, changes); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE subscriptions SET name=$1, schedule=$2, config=$3, settings=$4,
+health_check_id=$5 WHERE id=$6`, subscription.Name, subscription.Schedule, subscription.Config, subscription.Settings,
+		subscription.HealthCheckID, subscription.ID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	// now that all database related modification has succeeded keep the health check in sync; new
+	// health checks are created with the subscription's current name and schedule
+	renamed := before.Name != subscription.Name || before.Schedule != subscription.Schedule
+	if renamed && subscription.HealthCheckID != "" && subscription.HealthCheckID == before.HealthCheckID {
+		if err := healthcheck.Update(subscription.HealthCheckID, subscription.HealthCheckName(), subscription.Schedule); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SaveConfig seals the subscription's config and stores it in the database
+func (subscription *Subscription) SaveConfig(ctx context.Context) error {
+	if err := subscription.SealConfig(); err != nil {
+		return err
+	}
+
+	_, err := subscription.Library.Pool.Exec(ctx, "UPDATE subscriptions SET config=$1 WHERE id=$2", subscription.Config, subscription.ID)
+	return err
+}
+
+// ResolvedConfig returns a copy of the subscription's config with encrypted
+// values decrypted and references read from the environment or file system
+func (subscription *Subscription) ResolvedConfig() (map[string]string, error) {
+	var key []byte
+	resolved := make(map[string]string, len(subscription.Config))
+	for field, val := range subscription.Config {
+		if key == nil && strings.HasPrefix(val, secret.EncryptedPrefix) {
+			var err error
+			if key, err = secret.LoadKey(); err != nil {
+				return nil, fmt.Errorf("cannot decrypt %s: %w", field, err)
+			}
+		}
+
+		plaintext, err := secret.Resolve(val, key)
+		if err != nil {
+			return nil, fmt.Errorf("cannot resolve %s: %w", field, err)
+		}
+		resolved[field] = plaintext
+	}
+
+	return resolved, nil
+}
+
+// MaskedConfig returns a copy of the subscription's config that is safe to display
+func (subscription *Subscription) MaskedConfig() map[string]string {
+	return secret.MaskConfig(subscription.Config, subscription.SecretFields)
+}
+
+// Validate checks the subscription's filer locations and monitor
+func (subscription *Subscription) Validate() error {
+	if filerPath := subscription.Config["filer"]; filerPath != "" {
+		if err := data.ValidateFilerSpec(filerPath); err != nil {
+			return err
+		}
+	}
+
+	if filerPath := subscription.Settings[ArchiveFilerSetting]; filerPath != "" {
+		if err := data.ValidateFilerSpec(filerPath); err != nil {
+			return err
+		}
+	}
+
+	return monitor.Validate(subscription.Settings[monitor.KindSetting], subscription.Settings[monitor.TargetSetting])
+}
+
 // Save the subscription to the database
 func (subscription *Subscription) Save(ctx context.Context) error {
+	if err := subscription.Validate(); err != nil {
+		return err
+	}
+
+	if err := subscription.SealConfig(); err != nil {
+		return err
+	}
+
 	conn, err := subscription.Library.Pool.Acquire(ctx)
 	if err != nil {
 		return err
@@ -218,7 +475,7 @@ func (subscription *Subscription) Save(ctx context.Context) error {
 	defer func() {
 		if err := tx.Rollback(ctx); err != nil {
 			if !errors.Is(err, pgx.ErrTxClosed) {
-				log.Error().Err(err).Msg("error rollingback tx")
+				zerolog.Ctx(ctx).Error().Err(err).Msg("error rollingback tx")
 			}
 		}
 	}()
@@ -228,19 +485,28 @@ func (subscription *Subscription) Save(ctx context.Context) error {
 		return err
 	}
 
-	// make sure current user is set on subscription
-	if user, err := user.Current(); err != nil {
-		return err
-	} else {
-		subscription.CreatedBy = user.Username
+	if subscription.IsBitemporal() {
+		if err := subscription.createHistoryTables(ctx, tx); err != nil {
+			return err
+		}
 	}
 
+	// tables were created with the latest schema so no migrations are needed
+	subscription.SchemaVersion = subscription.TargetSchemaVersion()
+
+	if subscription.Settings == nil {
+		subscription.Settings = make(map[string]string)
+	}
+
+	// make sure current user is set on subscription
+	subscription.CreatedBy = currentUsername()
+
 	// create an entry in the subscription table
 	if _, err := tx.Exec(ctx, `INSERT INTO subscriptions
-("id", "name", "provider", "dataset", "config", "data_tables", "data_types",
+("id", "name", "provider", "dataset", "config", "settings", "data_tables", "data_types",
  "schedule", "health_check_id", "schema_version", "created_by")
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11);`, subscription.ID.String(),
-		subscription.Name, subscription.Provider, subscription.Dataset, subscription.Config,
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12);`, subscription.ID.String(),
+		subscription.Name, subscription.Provider, subscription.Dataset, subscription.Config, subscription.Settings,
 		subscription.DataTables, subscription.DataTypes, subscription.Schedule,
 		subscription.HealthCheckID, subscription.SchemaVersion, subscription.CreatedBy); err != nil {
 		return err
@@ -259,23 +525,27 @@ VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11);`, subscription.ID.String(
 	return nil
 }
 
-// Compute table names based on subscription data types
-func (subscription *Subscription) ComputeTableNames() {
-	ret := make([]string, len(subscription.DataTypes))
-	subscription.DataTablesMap = make(map[string]string, len(subscription.DataTypes))
-	for idx, dataType := range subscription.DataTypes {
-		tbl := slug.Make(fmt.Sprintf("%s %s %s %s", subscription.Provider, subscription.Dataset, dataType, subscription.ID.String()[:5]))
-		tbl = strings.ReplaceAll(tbl, "-", "_")
-		ret[idx] = tbl
-
-		subscription.DataTablesMap[dataType] = tbl
+// TargetSchemaVersion returns the schema version of a subscription whose tables are
+// fully up-to-date
+func (subscription *Subscription) TargetSchemaVersion() int {
+	version := 0
+	for _, dataTypeName := range subscription.DataTypes {
+		if dataType, ok := data.DataTypes[dataTypeName]; ok {
+			version += dataType.Version
+		}
 	}
-
-	subscription.DataTables = ret
+	return version
 }
 
-// ManagePartitions creates any new partitions needed for the subscription
-func (subscription *Subscription) ManagePartitions(ctx context.Context) error {
+// MigrateTables brings the subscription's tables up-to-date with the current schema
+func (subscription *Subscription) MigrateTables(ctx context.Context) error {
+	logger := zerolog.Ctx(ctx)
+
+	target := subscription.TargetSchemaVersion()
+	if subscription.SchemaVersion >= target {
+		return nil
+	}
+
 	conn, err := subscription.Library.Pool.Acquire(ctx)
 	if err != nil {
 		return err
@@ -290,126 +560,132 @@ func (subscription *Subscription) ManagePartitions(ctx context.Context) error {
 	defer func() {
 		if err := tx.Rollback(ctx); err != nil {
 			if !errors.Is(err, pgx.ErrTxClosed) {
-				log.Error().Err(err).Msg("error rollingback tx")
+				logger.Error().Err(err).Msg("error rollingback tx")
 			}
 		}
 	}()
 
-	// manage partitions
-	if err := subscription.managePartitionsWithTransaction(ctx, tx); err != nil {
-		log.Error().Err(err).Msg("error encountered when creating partitions")
+	// migrations are idempotent so every migration is applied regardless of the current version
+	for idx, dataTypeName := range subscription.DataTypes {
+		dataType := data.DataTypes[dataTypeName]
+		for _, sql := range dataType.ExpandedMigrations(subscription.DataTables[idx]) {
+			logger.Info().Str("SubscriptionID", subscription.ID.String()).Str("DataType", dataTypeName).Msg("migrating table")
+			if _, err := tx.Exec(ctx, sql); err != nil {
+				logger.Error().Err(err).Str("SQL", sql).Msg("table migration failed")
+				return err
+			}
+		}
+	}
+
+	// history tables keep the same columns as the tables they record
+	for _, tblName := range subscription.BitemporalTables() {
+		if _, err := tx.Exec(ctx, data.BitemporalSyncColumns(tblName)); err != nil {
+			logger.Error().Err(err).Str("Table", tblName).Msg("history table migration failed")
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(ctx, "UPDATE subscriptions SET schema_version=$1 WHERE id=$2", target, subscription.ID); err != nil {
 		return err
 	}
 
-	// commit to database
 	if err := tx.Commit(ctx); err != nil {
-		log.Error().Err(err).Msg("error committing manage partitions transaction")
 		return err
 	}
 
+	subscription.SchemaVersion = target
+
 	return nil
 }
 
-// managePartitionsWithTransaction uses the specified transaction `tx` to create missing partitions
-func (subscription *Subscription) managePartitionsWithTransaction(ctx context.Context, tx pgx.Tx) error {
-	for idx, dataTypeName := range subscription.DataTypes {
-		dataType := data.DataTypes[dataTypeName]
-		dataTable := subscription.DataTables[idx]
+// AddDataTypes adds data types to an existing subscription and creates their tables.
+// Data types the subscription already has are ignored.
+func (subscription *Subscription) AddDataTypes(ctx context.Context, dataTypes ...string) error {
+	logger := zerolog.Ctx(ctx)
 
-		// if table is not partitioned skip to next dataType
-		if !dataType.IsPartitioned {
-			continue
+	added := make([]string, 0, len(dataTypes))
+	for _, dataTypeName := range dataTypes {
+		if _, ok := data.DataTypes[dataTypeName]; !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownDataType, dataTypeName)
 		}
 
-		// construct a list of date ranges
-		dates := []dateRange{
-			{
-				Start: 1900,
-				End:   2000,
-			},
-			{
-				Start: 2000,
-				End:   2005,
-			},
-			{
-				Start: 2005,
-				End:   2010,
-			},
-			{
-				Start: 2010,
-				End:   2015,
-			},
-		}
-
-		today := time.Now()
-		year := today.Year() + 1
-
-		for ii := 2015; ii < year; ii += 5 {
-			dates = append(dates, dateRange{Start: ii, End: ii + 5})
-		}
-
-		// create tables for expected date ranges
-		for _, dt := range dates {
-			tableName := fmt.Sprintf("%s_%d_%d", dataTable, dt.Start, dt.End)
-			sql := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM ('%d-01-01') TO ('%d-01-01');",
-				tableName, dataTable, dt.Start, dt.End)
-			log.Debug().Str("SQL", sql).Msg("creating partition table")
-			if _, err := tx.Exec(ctx, sql); err != nil {
-				return err
-			}
+		if _, ok := subscription.DataTablesMap[dataTypeName]; ok || slices.Contains(added, dataTypeName) {
+			continue
 		}
+
+		added = append(added, dataTypeName)
 	}
-	return nil
-}
 
-// PartitionTables returns the table names for all paritions in the set
-func (subscription *Subscription) PartitionTables() []string {
-	tables := make([]string, 0, 10)
+	if len(added) == 0 {
+		return nil
+	}
 
-	for idx, dataTypeName := range subscription.DataTypes {
-		dataType := data.DataTypes[dataTypeName]
-		dataTable := subscription.DataTables[idx]
+	conn, err := subscription.Library.Pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
 
-		// if table is not partitioned skip to next dataType
-		if !dataType.IsPartitioned {
-			continue
-		}
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
 
-		// construct a list of date ranges
-		dates := []dateRange{
-			{
-				Start: 1900,
-				End:   2000,
-			},
-			{
-				Start: 2000,
-				End:   2005,
-			},
-			{
-				Start: 2005,
-				End:   2010,
-			},
-			{
-				Start: 2010,
-				End:   2015,
-			},
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil {
+			if !errors.Is(err, pgx.ErrTxClosed) {
+				logger.Error().Err(err).Msg("error rollingback tx")
+			}
 		}
+	}()
 
-		today := time.Now()
-		year := today.Year() + 1
+	// new tables are created with the current schema so their migrations are not needed
+	for _, dataTypeName := range added {
+		dataType := data.DataTypes[dataTypeName]
+		tbl := subscription.tableName(dataTypeName)
 
-		for ii := 2015; ii < year; ii++ {
-			dates = append(dates, dateRange{Start: ii, End: ii + 1})
-		}
+		subscription.DataTypes = append(subscription.DataTypes, dataTypeName)
+		subscription.DataTables = append(subscription.DataTables, tbl)
+		subscription.DataTablesMap[dataTypeName] = tbl
 
-		// create tables for expected date ranges
-		for _, dt := range dates {
-			tableName := fmt.Sprintf("%s_%d_%d", dataTable, dt.Start, dt.End)
-			tables = append(tables, tableName)
+		logger.Info().Str("SubscriptionID", subscription.ID.String()).Str("DataType", dataTypeName).Str("Table", tbl).Msg("adding data type to subscription")
+		if _, err := tx.Exec(ctx, dataType.ExpandedSchema(tbl)); err != nil {
+			return err
 		}
+
+		subscription.SchemaVersion += dataType.Version
+	}
+
+	if _, err := tx.Exec(ctx, "UPDATE subscriptions SET data_types=$1, data_tables=$2, schema_version=$3 WHERE id=$4",
+		subscription.DataTypes, subscription.DataTables, subscription.SchemaVersion, subscription.ID); err != nil {
+		return err
+	}
+
+	if err := subscription.managePartitionsWithTransaction(ctx, tx); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Compute table names based on subscription data types
+func (subscription *Subscription) ComputeTableNames() {
+	ret := make([]string, len(subscription.DataTypes))
+	subscription.DataTablesMap = make(map[string]string, len(subscription.DataTypes))
+	for idx, dataType := range subscription.DataTypes {
+		tbl := subscription.tableName(dataType)
+		ret[idx] = tbl
+
+		subscription.DataTablesMap[dataType] = tbl
 	}
 
-	return tables
+	subscription.DataTables = ret
+}
+
+// tableName returns the name of the table holding the subscription's data of the given type
+func (subscription *Subscription) tableName(dataType string) string {
+	tbl := slug.Make(fmt.Sprintf("%s %s %s %s", subscription.Provider, subscription.Dataset, dataType, subscription.ID.String()[:5]))
+	return strings.ReplaceAll(tbl, "-", "_")
 }
 
 func (subscription *Subscription) createTables(ctx context.Context, tx pgx.Tx) error {
@@ -138,5 +138,40 @@ func (myLibrary *Library) Summary(ctx context.Context) (string, error) {
 		}
 	}
 
+	// Data quality issues found during the last 30 days
+	if _, err := builder.WriteString("\n## Data Quality (last 30 days)\n\n"); err != nil {
+		return "", err
+	}
+
+	qualityCounts, err := myLibrary.QualitySummary(ctx, time.Now().AddDate(0, 0, -30))
+	if err != nil {
+		return "", err
+	}
+
+	if len(qualityCounts) == 0 {
+		if _, err := builder.WriteString("No issues found\n"); err != nil {
+			return "", err
+		}
+	}
+
+	subscriptionNames := make(map[string]string, len(subscriptions))
+	for _, subscription := range subscriptions {
+		subscriptionNames[subscription.ID.String()] = fmt.Sprintf("%s %s", subscription.Provider, subscription.Dataset)
+	}
+
+	lastSubscriptionID := ""
+	for _, count := range qualityCounts {
+		if count.SubscriptionID != lastSubscriptionID {
+			lastSubscriptionID = count.SubscriptionID
+			if _, err := builder.WriteString(p.Sprintf("  * %s [%s]\n", subscriptionNames[count.SubscriptionID], count.SubscriptionID[:6])); err != nil {
+				return "", err
+			}
+		}
+
+		if _, err := builder.WriteString(p.Sprintf("    * %s (%s): %d\n", count.Rule, count.Action, count.Count)); err != nil {
+			return "", err
+		}
+	}
+
 	return builder.String(), nil
 }
@@ -0,0 +1,61 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package library
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/penny-vault/pvdata/data"
+)
+
+var (
+	ErrNoSymbologyTable = errors.New("subscription does not have a symbology table")
+)
+
+// ResolveFigi returns the composite FIGI that held the identifier on the given date
+// according to the subscription's symbology history
+func (subscription *Subscription) ResolveFigi(ctx context.Context, idType, value string, date time.Time) (string, error) {
+	tbl, ok := subscription.DataTablesMap[data.SymbologyKey]
+	if !ok {
+		return "", ErrNoSymbologyTable
+	}
+
+	conn, err := subscription.Library.Pool.Acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Release()
+
+	return data.ResolveFigi(ctx, conn, tbl, idType, value, date)
+}
+
+// SymbolsOf returns the identifiers of type `idType` held by the composite FIGI
+// on the given date according to the subscription's symbology history
+func (subscription *Subscription) SymbolsOf(ctx context.Context, compositeFigi, idType string, date time.Time) ([]string, error) {
+	tbl, ok := subscription.DataTablesMap[data.SymbologyKey]
+	if !ok {
+		return nil, ErrNoSymbologyTable
+	}
+
+	conn, err := subscription.Library.Pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	return data.SymbolsOf(ctx, conn, tbl, compositeFigi, idType, date)
+}
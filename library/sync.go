@@ -0,0 +1,300 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package library
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+	"github.com/penny-vault/pvdata/data"
+	"github.com/penny-vault/pvdata/monitor"
+	"github.com/rs/zerolog"
+)
+
+// RedactedValue replaces configuration values that are not copied to another library
+const RedactedValue = "REDACTED"
+
+// SyncOptions select what is copied by SyncTo
+type SyncOptions struct {
+	// Subscriptions are IDs (or prefixes of IDs) to sync; empty syncs every subscription
+	Subscriptions []string
+
+	// DataTypes limit the tables that are synced; empty syncs every data type
+	DataTypes []string
+
+	// Full copies every row instead of only rows newer than the target's
+	Full bool
+}
+
+// SyncResult reports the rows copied to one table
+type SyncResult struct {
+	SubscriptionID string
+	DataType       string
+	Table          string
+	Created        bool
+	Rows           int64
+}
+
+// RedactConfig returns a copy of `config` with every value redacted
+func RedactConfig(config map[string]string) map[string]string {
+	redacted := make(map[string]string, len(config))
+	for key := range config {
+		redacted[key] = RedactedValue
+	}
+	return redacted
+}
+
+// ImportSettings returns a copy of subscription `settings` without the
+// monitor settings, which belong to the source library
+func ImportSettings(settings map[string]string) map[string]string {
+	imported := make(map[string]string, len(settings))
+	for key, val := range settings {
+		if key == monitor.KindSetting || strings.HasPrefix(key, monitor.KindSetting+".") {
+			continue
+		}
+		imported[key] = val
+	}
+	return imported
+}
+
+// SyncTo copies the library's subscriptions and their data to `target`.
+// Subscriptions missing from `target` are created inactive, with redacted
+// config and without their monitor, so the target never fetches with dead
+// credentials or reports to the source's health checks.
+func (myLibrary *Library) SyncTo(ctx context.Context, target *Library, opts SyncOptions) ([]*SyncResult, error) {
+	var numLibraries int
+	if err := target.Pool.QueryRow(ctx, "SELECT count(*) FROM library").Scan(&numLibraries); err != nil {
+		return nil, err
+	}
+
+	if numLibraries == 0 {
+		target.Name = myLibrary.Name
+		target.Owner = myLibrary.Owner
+		if err := target.SaveDB(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	subscriptions, err := myLibrary.Subscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*SyncResult, 0)
+	syncedAssets := false
+	for _, sub := range subscriptions {
+		if len(opts.Subscriptions) > 0 && !slices.ContainsFunc(opts.Subscriptions, func(id string) bool {
+			return strings.HasPrefix(sub.ID.String(), id)
+		}) {
+			continue
+		}
+
+		dataTypes := make([]string, 0, len(sub.DataTypes))
+		for _, dataType := range sub.DataTypes {
+			if len(opts.DataTypes) == 0 || slices.Contains(opts.DataTypes, dataType) {
+				dataTypes = append(dataTypes, dataType)
+			}
+		}
+
+		if len(dataTypes) == 0 {
+			continue
+		}
+
+		created, err := target.importSubscription(ctx, sub)
+		if err != nil {
+			return results, err
+		}
+
+		for _, dataType := range dataTypes {
+			result := &SyncResult{
+				SubscriptionID: sub.ID.String(),
+				DataType:       dataType,
+				Table:          sub.DataTablesMap[dataType],
+				Created:        created,
+			}
+
+			if result.Rows, err = sub.syncTable(ctx, target, result.Table, dataType, opts.Full); err != nil {
+				return results, err
+			}
+
+			zerolog.Ctx(ctx).Info().Str("SubscriptionID", result.SubscriptionID).Str("Table", result.Table).Int64("Rows", result.Rows).Msg("synced table")
+			results = append(results, result)
+
+			if dataType == data.AssetKey && result.Rows > 0 {
+				syncedAssets = true
+			}
+		}
+	}
+
+	// imported subscriptions are inactive; merge the target's asset master
+	// from the subscriptions that are active in this library
+	if syncedAssets {
+		sources, err := myLibrary.AssetSources(ctx)
+		if err != nil {
+			return results, err
+		}
+
+		synced := make([]*data.AssetSource, 0, len(sources))
+		for _, source := range sources {
+			if slices.ContainsFunc(results, func(result *SyncResult) bool { return result.Table == source.Table }) {
+				synced = append(synced, source)
+			}
+		}
+
+		if _, err := target.mergeAssetMaster(ctx, synced); err != nil {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
+
+// importSubscription creates `sub` in the library, with its tables and
+// partitions, or brings the existing copy's data types and statistics
+// up-to-date. Created subscriptions are inactive and have no monitor; an
+// existing copy keeps its own active flag. Returns true if the subscription
+// was created.
+func (myLibrary *Library) importSubscription(ctx context.Context, sub *Subscription) (bool, error) {
+	logger := zerolog.Ctx(ctx)
+
+	existing, err := myLibrary.SubscriptionFromID(ctx, sub.ID.String())
+	if err == nil {
+		if err := existing.AddDataTypes(ctx, sub.DataTypes...); err != nil {
+			return false, err
+		}
+
+		if _, err := myLibrary.Pool.Exec(ctx, `UPDATE subscriptions SET name=$1, schedule=$2,
+total_records=$3, num_records_last_import=$4, total_securities=$5, num_securities_last_import=$6,
+first_obs_date=$7, last_obs_date=$8, last_run=$9 WHERE id=$10`, sub.Name, sub.Schedule,
+			sub.TotalRecords, sub.NumRecordsLastImport, sub.TotalSecurities, sub.NumSecuritiesLastImport,
+			sub.FirstObsDate, sub.LastObsDate, sub.LastRun, sub.ID); err != nil {
+			return false, err
+		}
+
+		return false, nil
+	}
+
+	if !pgxscan.NotFound(err) {
+		return false, err
+	}
+
+	imported := *sub
+	imported.Library = myLibrary
+	imported.Config = RedactConfig(sub.Config)
+	imported.Active = false
+	imported.HealthCheckID = ""
+	imported.Settings = ImportSettings(sub.Settings)
+
+	imported.DataTypes = slices.Clone(sub.DataTypes)
+	imported.DataTables = slices.Clone(sub.DataTables)
+	imported.DataTablesMap = make(map[string]string, len(sub.DataTablesMap))
+	for dataType, table := range sub.DataTablesMap {
+		imported.DataTablesMap[dataType] = table
+	}
+	imported.SchemaVersion = imported.TargetSchemaVersion()
+
+	conn, err := myLibrary.Pool.Acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil {
+			if !errors.Is(err, pgx.ErrTxClosed) {
+				logger.Error().Err(err).Msg("error rollingback tx")
+			}
+		}
+	}()
+
+	if err := imported.createTables(ctx, tx); err != nil {
+		return false, err
+	}
+
+	if imported.IsBitemporal() {
+		if err := imported.createHistoryTables(ctx, tx); err != nil {
+			return false, err
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `INSERT INTO subscriptions
+("id", "name", "provider", "dataset", "config", "settings", "data_tables", "data_types",
+ "total_records", "num_records_last_import", "total_securities", "num_securities_last_import",
+ "first_obs_date", "last_obs_date", "schedule", "health_check_id", "last_run", "active",
+ "schema_version", "created_on", "created_by")
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21);`,
+		imported.ID, imported.Name, imported.Provider, imported.Dataset, imported.Config, imported.Settings,
+		imported.DataTables, imported.DataTypes, imported.TotalRecords, imported.NumRecordsLastImport,
+		imported.TotalSecurities, imported.NumSecuritiesLastImport, imported.FirstObsDate, imported.LastObsDate,
+		imported.Schedule, imported.HealthCheckID, imported.LastRun, imported.Active, imported.SchemaVersion,
+		imported.CreatedOn, imported.CreatedBy); err != nil {
+		return false, err
+	}
+
+	if err := imported.managePartitionsWithTransaction(ctx, tx); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, err
+	}
+
+	logger.Info().Str("SubscriptionID", imported.ID.String()).Msg("created subscription in target library")
+	return true, nil
+}
+
+// syncTable copies the rows of one of the subscription's tables to the same table in `target`
+func (subscription *Subscription) syncTable(ctx context.Context, target *Library, table, dataType string, full bool) (int64, error) {
+	srcConn, err := subscription.Library.Pool.Acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer srcConn.Release()
+
+	dstConn, err := target.Pool.Acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer dstConn.Release()
+
+	tx, err := dstConn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil {
+			if !errors.Is(err, pgx.ErrTxClosed) {
+				zerolog.Ctx(ctx).Error().Err(err).Msg("error rollingback tx")
+			}
+		}
+	}()
+
+	count, err := data.SyncTable(ctx, srcConn, tx, table, data.DataTypes[dataType].PrimaryKey, full)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, tx.Commit(ctx)
+}
@@ -0,0 +1,42 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package library_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/penny-vault/pvdata/library"
+)
+
+var _ = Describe("Sync", func() {
+	It("redacts every config value", func() {
+		Expect(library.RedactConfig(map[string]string{"apiKey": "secret", "rateLimit": "5"})).To(Equal(map[string]string{
+			"apiKey":    library.RedactedValue,
+			"rateLimit": library.RedactedValue,
+		}))
+	})
+
+	It("leaves the source's monitor behind", func() {
+		settings := map[string]string{
+			"monitor":        "webhook",
+			"monitor.target": "https://example.com/hook",
+			"universe":       "recent",
+		}
+
+		Expect(library.ImportSettings(settings)).To(Equal(map[string]string{"universe": "recent"}))
+		Expect(settings).To(HaveLen(3))
+	})
+})
@@ -0,0 +1,123 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/time/rate"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "provider_http_requests_total",
+		Help:      "HTTP requests made to data providers and other services by status code.",
+	}, []string{"provider", "code"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "provider_http_request_duration_seconds",
+		Help:      "Time taken by HTTP requests to data providers and other services.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"provider"})
+
+	rateLimitWait = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "rate_limiter_wait_seconds",
+		Help:      "Time spent waiting on provider rate limits.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 10),
+	}, []string{"provider"})
+)
+
+// NewClient returns a resty client whose requests to `provider` are counted
+func NewClient(provider string) *resty.Client {
+	return InstrumentClient(resty.New(), provider)
+}
+
+// InstrumentClient counts the requests `client` makes to `provider`. Requests
+// that fail before a response is received are counted with code "error".
+func InstrumentClient(client *resty.Client, provider string) *resty.Client {
+	return client.
+		OnAfterResponse(func(_ *resty.Client, resp *resty.Response) error {
+			ObserveRequest(provider, strconv.Itoa(resp.StatusCode()), resp.Time())
+			return nil
+		}).
+		OnError(func(_ *resty.Request, err error) {
+			var respErr *resty.ResponseError
+			if errors.As(err, &respErr) && respErr.Response.RawResponse != nil {
+				// a response was received and counted by OnAfterResponse
+				return
+			}
+			httpRequests.WithLabelValues(provider, "error").Inc()
+		})
+}
+
+// ObserveRequest records a request to `provider` that finished with status
+// `code` after `elapsed`. It is used for clients that are not built on resty
+// (e.g. a headless browser).
+func ObserveRequest(provider, code string, elapsed time.Duration) {
+	httpRequests.WithLabelValues(provider, code).Inc()
+	if code != "error" {
+		httpDuration.WithLabelValues(provider).Observe(elapsed.Seconds())
+	}
+}
+
+// Limiter is a rate.Limiter that records how long callers wait on it
+type Limiter struct {
+	*rate.Limiter
+	provider string
+}
+
+// NewLimiter returns a limiter for `provider` that allows `limit` events per
+// second with bursts of at most `burst` events
+func NewLimiter(provider string, limit rate.Limit, burst int) *Limiter {
+	return &Limiter{
+		Limiter:  rate.NewLimiter(limit, burst),
+		provider: provider,
+	}
+}
+
+// Wait blocks until the limiter permits an event and records how long it took
+func (limiter *Limiter) Wait(ctx context.Context) error {
+	start := time.Now()
+	err := limiter.Limiter.Wait(ctx)
+	rateLimitWait.WithLabelValues(limiter.provider).Observe(time.Since(start).Seconds())
+	return err
+}
+
+type providerKey struct{}
+
+// WithProvider returns a copy of ctx that labels requests made on its behalf
+// with `provider`
+func WithProvider(ctx context.Context, provider string) context.Context {
+	return context.WithValue(ctx, providerKey{}, provider)
+}
+
+// ProviderFromContext returns the provider label stored by WithProvider or
+// "unknown" if there is none
+func ProviderFromContext(ctx context.Context) string {
+	if provider, ok := ctx.Value(providerKey{}).(string); ok {
+		return provider
+	}
+
+	return "unknown"
+}
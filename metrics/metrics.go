@@ -0,0 +1,101 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metrics
+
+import (
+	"github.com/penny-vault/pvdata/data"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "pvdata"
+
+var (
+	observations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "observations_total",
+		Help:      "Observations produced by subscription runs.",
+	}, []string{"subscription", "provider"})
+
+	rowsWritten = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rows_written_total",
+		Help:      "Rows saved to the library by data type.",
+	}, []string{"subscription", "provider", "data_type"})
+
+	saveErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "save_errors_total",
+		Help:      "Observations that could not be saved to the library.",
+	}, []string{"subscription", "provider", "data_type"})
+
+	runs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "runs_total",
+		Help:      "Subscription runs by outcome.",
+	}, []string{"subscription", "provider", "outcome"})
+
+	runDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "run_duration_seconds",
+		Help:      "Time taken to run a subscription.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 16),
+	}, []string{"subscription", "provider"})
+
+	lastSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_success_timestamp_seconds",
+		Help:      "Unix time the subscription last ran successfully.",
+	}, []string{"subscription", "provider"})
+
+	saveQueue = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "save_queue_length",
+		Help:      "Observations waiting to be saved by SaveObservations.",
+	})
+)
+
+// ObservationReceived counts an observation produced by a subscription
+func ObservationReceived(subscriptionID, provider string) {
+	observations.WithLabelValues(subscriptionID, provider).Inc()
+}
+
+// RowSaved counts an attempt to save a row of `dataType`
+func RowSaved(subscriptionID, provider, dataType string, err error) {
+	if err != nil {
+		saveErrors.WithLabelValues(subscriptionID, provider, dataType).Inc()
+		return
+	}
+	rowsWritten.WithLabelValues(subscriptionID, provider, dataType).Inc()
+}
+
+// SaveQueueLength records the backlog of the SaveObservations queue
+func SaveQueueLength(length int) {
+	saveQueue.Set(float64(length))
+}
+
+// RunFinished records the duration and outcome of a subscription run
+func RunFinished(provider string, summary data.RunSummary, outcome string) {
+	subscriptionID := summary.SubscriptionID.String()
+	runs.WithLabelValues(subscriptionID, provider, outcome).Inc()
+
+	if !summary.StartTime.IsZero() && !summary.EndTime.IsZero() {
+		runDuration.WithLabelValues(subscriptionID, provider).Observe(summary.EndTime.Sub(summary.StartTime).Seconds())
+	}
+
+	if summary.Status == data.RunSuccess {
+		lastSuccess.WithLabelValues(subscriptionID, provider).Set(float64(summary.EndTime.Unix()))
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metrics_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+
+	"github.com/penny-vault/pvdata/data"
+	"github.com/penny-vault/pvdata/metrics"
+)
+
+// gather returns the current value of the series matching `labels` in metric `name`
+func gather(name string, labels map[string]string) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	Expect(err).ToNot(HaveOccurred())
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+
+	series:
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if val, ok := labels[label.GetName()]; ok && val != label.GetValue() {
+					continue series
+				}
+			}
+
+			switch {
+			case metric.GetCounter() != nil:
+				return metric.GetCounter().GetValue()
+			case metric.GetGauge() != nil:
+				return metric.GetGauge().GetValue()
+			case metric.GetHistogram() != nil:
+				return float64(metric.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+
+	return 0
+}
+
+var _ = Describe("Metrics", func() {
+	It("counts rows written and save errors by data type", func() {
+		subscriptionID := uuid.New().String()
+		labels := map[string]string{"subscription": subscriptionID, "provider": "tiingo", "data_type": data.EODKey}
+
+		metrics.ObservationReceived(subscriptionID, "tiingo")
+		metrics.ObservationReceived(subscriptionID, "tiingo")
+		metrics.RowSaved(subscriptionID, "tiingo", data.EODKey, nil)
+		metrics.RowSaved(subscriptionID, "tiingo", data.EODKey, errors.New("duplicate key"))
+
+		Expect(gather("pvdata_observations_total", labels)).To(Equal(2.0))
+		Expect(gather("pvdata_rows_written_total", labels)).To(Equal(1.0))
+		Expect(gather("pvdata_save_errors_total", labels)).To(Equal(1.0))
+	})
+
+	It("records run duration, outcome and last success", func() {
+		summary := data.RunSummary{
+			StartTime:      time.Date(2024, 6, 3, 6, 0, 0, 0, time.UTC),
+			EndTime:        time.Date(2024, 6, 3, 6, 2, 30, 0, time.UTC),
+			Status:         data.RunSuccess,
+			SubscriptionID: uuid.New(),
+		}
+		labels := map[string]string{"subscription": summary.SubscriptionID.String(), "provider": "fred"}
+
+		metrics.RunFinished("fred", summary, "success")
+		Expect(gather("pvdata_last_success_timestamp_seconds", labels)).To(Equal(float64(summary.EndTime.Unix())))
+		Expect(gather("pvdata_run_duration_seconds", labels)).To(Equal(1.0))
+
+		summary.Status = data.RunFailed
+		summary.EndTime = summary.EndTime.Add(24 * time.Hour)
+		metrics.RunFinished("fred", summary, "failure")
+
+		Expect(gather("pvdata_last_success_timestamp_seconds", labels)).To(Equal(float64(summary.EndTime.Add(-24 * time.Hour).Unix())))
+		labels["outcome"] = "failure"
+		Expect(gather("pvdata_runs_total", labels)).To(Equal(1.0))
+	})
+
+	It("counts provider requests by status code", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/limited" {
+				w.WriteHeader(http.StatusTooManyRequests)
+			}
+		}))
+
+		client := metrics.InstrumentClient(resty.New(), "polygon-test")
+		_, err := client.R().Get(server.URL + "/tickers")
+		Expect(err).ToNot(HaveOccurred())
+		_, err = client.R().Get(server.URL + "/limited")
+		Expect(err).ToNot(HaveOccurred())
+
+		server.Close()
+		_, err = client.R().Get(server.URL + "/tickers")
+		Expect(err).To(HaveOccurred())
+
+		Expect(gather("pvdata_provider_http_requests_total", map[string]string{"provider": "polygon-test", "code": "200"})).To(Equal(1.0))
+		Expect(gather("pvdata_provider_http_requests_total", map[string]string{"provider": "polygon-test", "code": "429"})).To(Equal(1.0))
+		Expect(gather("pvdata_provider_http_requests_total", map[string]string{"provider": "polygon-test", "code": "error"})).To(Equal(1.0))
+		Expect(gather("pvdata_provider_http_request_duration_seconds", map[string]string{"provider": "polygon-test"})).To(Equal(2.0))
+	})
+
+	It("records time spent waiting on rate limits", func() {
+		limiter := metrics.NewLimiter("tiingo-test", rate.Inf, 1)
+		Expect(limiter.Wait(context.Background())).To(Succeed())
+		Expect(limiter.Wait(context.Background())).To(Succeed())
+
+		Expect(gather("pvdata_rate_limiter_wait_seconds", map[string]string{"provider": "tiingo-test"})).To(Equal(2.0))
+	})
+
+	It("labels requests with the provider stored on the context", func() {
+		ctx := metrics.WithProvider(context.Background(), "fred-test")
+		Expect(metrics.ProviderFromContext(ctx)).To(Equal("fred-test"))
+		Expect(metrics.ProviderFromContext(context.Background())).To(Equal("unknown"))
+
+		metrics.ObserveRequest(metrics.ProviderFromContext(ctx), "200", time.Second)
+		metrics.ObserveRequest(metrics.ProviderFromContext(ctx), "error", 0)
+
+		Expect(gather("pvdata_provider_http_requests_total", map[string]string{"provider": "fred-test", "code": "200"})).To(Equal(1.0))
+		Expect(gather("pvdata_provider_http_requests_total", map[string]string{"provider": "fred-test", "code": "error"})).To(Equal(1.0))
+		Expect(gather("pvdata_provider_http_request_duration_seconds", map[string]string{"provider": "fred-test"})).To(Equal(1.0))
+	})
+
+	It("serves metrics for scraping", func() {
+		metrics.SaveQueueLength(17)
+
+		server := httptest.NewServer(metrics.NewServer(":0").Handler)
+		defer server.Close()
+
+		resp, err := http.Get(server.URL + "/metrics")
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(strings.Split(string(body), "\n")).To(ContainElement("pvdata_save_queue_length 17"))
+	})
+})
@@ -0,0 +1,98 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// DefaultSMTPPort is used when smtp.port is not set
+const DefaultSMTPPort = "587"
+
+var (
+	ErrNoSMTPServer = errors.New("smtp server is not configured; set smtp.host and smtp.from")
+)
+
+// Email sends alerts through the SMTP server configured by the smtp.* settings
+type Email struct {
+	To []string
+}
+
+func (email *Email) Name() string {
+	return KindEmail
+}
+
+func (email *Email) Notify(ctx context.Context, event *Event) error {
+	if !event.Kind.IsAlert() {
+		return nil
+	}
+
+	host := viper.GetString("smtp.host")
+	from := viper.GetString("smtp.from")
+	if host == "" || from == "" {
+		return ErrNoSMTPServer
+	}
+
+	port := DefaultSMTPPort
+	if viper.IsSet("smtp.port") {
+		port = viper.GetString("smtp.port")
+	}
+
+	var auth smtp.Auth
+	if viper.IsSet("smtp.username") {
+		auth = smtp.PlainAuth("", viper.GetString("smtp.username"), viper.GetString("smtp.password"), host)
+	}
+
+	return smtp.SendMail(net.JoinHostPort(host, port), auth, from, email.To, email.message(from, event))
+}
+
+// message formats the event as a plain-text email
+func (email *Email) message(from string, event *Event) []byte {
+	summary := event.Summary
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "From: %s\r\n", from)
+	fmt.Fprintf(&sb, "To: %s\r\n", strings.Join(email.To, ", "))
+	fmt.Fprintf(&sb, "Subject: [pvdata] %s: %s\r\n", summary.SubscriptionName, event.Kind)
+	fmt.Fprintf(&sb, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprint(&sb, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+
+	fmt.Fprintf(&sb, "Subscription: %s (%s)\r\n", summary.SubscriptionName, summary.SubscriptionID)
+	fmt.Fprintf(&sb, "Event: %s\r\n", event.Kind)
+	fmt.Fprintf(&sb, "Status: %s\r\n", summary.Status)
+	fmt.Fprintf(&sb, "Observations: %d\r\n", summary.NumObservations)
+	if !summary.StartTime.IsZero() {
+		fmt.Fprintf(&sb, "Started: %s\r\n", summary.StartTime.Format(time.RFC3339))
+		fmt.Fprintf(&sb, "Finished: %s\r\n", summary.EndTime.Format(time.RFC3339))
+	}
+
+	if event.Error != "" {
+		fmt.Fprintf(&sb, "\r\nError: %s\r\n", event.Error)
+	}
+
+	if event.Log != "" {
+		fmt.Fprintf(&sb, "\r\nLog:\r\n%s\r\n", strings.ReplaceAll(event.Log, "\n", "\r\n"))
+	}
+
+	return []byte(sb.String())
+}
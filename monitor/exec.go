@@ -0,0 +1,75 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// Exec runs a local command for each alert. The event is written to the
+// command's stdin as JSON and summarized in PVDATA_* environment variables.
+// The command only inherits PATH and HOME so the library key and database or
+// provider credentials in pvdata's environment are not exposed to it.
+type Exec struct {
+	Command string
+}
+
+func (hook *Exec) Name() string {
+	return KindExec
+}
+
+func (hook *Exec) Notify(ctx context.Context, event *Event) error {
+	if !event.Kind.IsAlert() {
+		return nil
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", hook.Command)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Env = append(hookEnv(),
+		"PVDATA_EVENT="+string(event.Kind),
+		"PVDATA_SUBSCRIPTION_ID="+event.Summary.SubscriptionID.String(),
+		"PVDATA_SUBSCRIPTION_NAME="+event.Summary.SubscriptionName,
+		"PVDATA_NUM_OBSERVATIONS="+strconv.Itoa(event.Summary.NumObservations),
+		"PVDATA_ERROR="+event.Error,
+	)
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %w: %s", hook.Command, err, bytes.TrimSpace(output))
+	}
+
+	return nil
+}
+
+// hookEnv returns the variables of pvdata's environment passed on to hooks
+func hookEnv() []string {
+	env := make([]string, 0, 2)
+	for _, name := range []string{"PATH", "HOME"} {
+		if val, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+val)
+		}
+	}
+	return env
+}
@@ -0,0 +1,46 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package monitor
+
+import (
+	"context"
+
+	"github.com/penny-vault/pvdata/healthcheck"
+)
+
+// Healthchecks pings a healthchecks.io check on every run so that missed runs
+// are detected too
+type Healthchecks struct {
+	CheckID string
+}
+
+func (hc *Healthchecks) Name() string {
+	return KindHealthchecks
+}
+
+func (hc *Healthchecks) Notify(ctx context.Context, event *Event) error {
+	switch event.Kind {
+	case EventStart:
+		return healthcheck.Ping(hc.CheckID, healthcheck.PingStart, nil)
+	case EventSuccess, EventRecovered:
+		return healthcheck.Ping(hc.CheckID, healthcheck.PingSuccess, []byte(event.Log))
+	default:
+		body := event.Log
+		if event.Error != "" {
+			body += event.Error
+		}
+		return healthcheck.Ping(hc.CheckID, healthcheck.PingFail, []byte(body))
+	}
+}
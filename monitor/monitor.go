@@ -0,0 +1,167 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+
+	"github.com/penny-vault/pvdata/data"
+)
+
+const (
+	// KindSetting is the subscription setting that selects the monitor
+	KindSetting = "monitor"
+
+	// TargetSetting is the webhook URL, email recipients or command the monitor notifies
+	TargetSetting = "monitor.target"
+)
+
+const (
+	KindNone         = ""
+	KindHealthchecks = "healthchecks"
+	KindWebhook      = "webhook"
+	KindEmail        = "email"
+	KindExec         = "exec"
+)
+
+var (
+	ErrUnknownMonitor  = errors.New("unknown monitor")
+	ErrInvalidTarget   = errors.New("invalid monitor target")
+	ErrNoHealthCheckID = errors.New("subscription does not have a health check")
+	ErrStatus          = errors.New("status code is invalid")
+)
+
+// EventKind describes the outcome of a subscription run
+type EventKind string
+
+const (
+	EventStart     EventKind = "start"
+	EventSuccess   EventKind = "success"
+	EventFailure   EventKind = "failure"
+	EventNoData    EventKind = "no_data"
+	EventRecovered EventKind = "recovered"
+)
+
+// IsAlert returns true for the events that warrant notifying someone
+func (kind EventKind) IsAlert() bool {
+	return kind == EventFailure || kind == EventNoData || kind == EventRecovered
+}
+
+// Healthy returns true if the run completed and imported data
+func (kind EventKind) Healthy() bool {
+	return kind == EventSuccess || kind == EventRecovered
+}
+
+// Event is sent to a monitor when a subscription run starts and when it ends
+type Event struct {
+	Kind    EventKind       `json:"event"`
+	Summary data.RunSummary `json:"summary"`
+	Error   string          `json:"error,omitempty"`
+	Log     string          `json:"log,omitempty"`
+}
+
+// Monitor is notified of subscription runs
+type Monitor interface {
+	// Name returns the kind of monitor
+	Name() string
+
+	// Notify sends the event; monitors that only deliver alerts ignore other events
+	Notify(ctx context.Context, event *Event) error
+}
+
+// Kinds returns the available monitors
+func Kinds() []string {
+	return []string{KindHealthchecks, KindWebhook, KindEmail, KindExec}
+}
+
+// Classify the outcome of a run. `previous` is the outcome of the prior run and
+// is used to detect recovery.
+func Classify(summary data.RunSummary, err error, previous EventKind) EventKind {
+	switch {
+	case err != nil || summary.Status != data.RunSuccess:
+		return EventFailure
+	case summary.NumObservations == 0:
+		return EventNoData
+	case previous == EventFailure || previous == EventNoData:
+		return EventRecovered
+	default:
+		return EventSuccess
+	}
+}
+
+// Validate checks the monitor kind and its target without contacting it
+func Validate(kind, target string) error {
+	switch kind {
+	case KindNone, KindHealthchecks:
+		return nil
+	case KindWebhook:
+		location, err := url.Parse(target)
+		if err != nil || (location.Scheme != "http" && location.Scheme != "https") || location.Host == "" {
+			return fmt.Errorf("%w: webhook must be an http(s) URL: %q", ErrInvalidTarget, target)
+		}
+		return nil
+	case KindEmail:
+		if _, err := mail.ParseAddressList(target); err != nil {
+			return fmt.Errorf("%w: %q: %w", ErrInvalidTarget, target, err)
+		}
+		return nil
+	case KindExec:
+		if strings.TrimSpace(target) == "" {
+			return fmt.Errorf("%w: command is empty", ErrInvalidTarget)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownMonitor, kind)
+	}
+}
+
+// New creates the monitor selected by `kind`. Subscriptions that predate the
+// monitor setting but have a health check use healthchecks. Returns nil if the
+// subscription is not monitored.
+func New(kind, target, healthCheckID string) (Monitor, error) {
+	if err := Validate(kind, target); err != nil {
+		return nil, err
+	}
+
+	if kind == KindNone && healthCheckID != "" {
+		kind = KindHealthchecks
+	}
+
+	switch kind {
+	case KindHealthchecks:
+		if healthCheckID == "" {
+			return nil, ErrNoHealthCheckID
+		}
+		return &Healthchecks{CheckID: healthCheckID}, nil
+	case KindWebhook:
+		return &Webhook{URL: target}, nil
+	case KindEmail:
+		recipients, _ := mail.ParseAddressList(target)
+		to := make([]string, len(recipients))
+		for idx, addr := range recipients {
+			to[idx] = addr.Address
+		}
+		return &Email{To: to}, nil
+	case KindExec:
+		return &Exec{Command: target}, nil
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package monitor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/penny-vault/pvdata/metrics"
+)
+
+// Webhook posts alerts as JSON to a URL
+type Webhook struct {
+	URL string
+}
+
+func (webhook *Webhook) Name() string {
+	return KindWebhook
+}
+
+func (webhook *Webhook) Notify(ctx context.Context, event *Event) error {
+	if !event.Kind.IsAlert() {
+		return nil
+	}
+
+	client := metrics.NewClient("webhook")
+	resp, err := client.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetBody(event).
+		Post(webhook.URL)
+
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode() >= 300 {
+		return fmt.Errorf("%w: %d", ErrStatus, resp.StatusCode())
+	}
+
+	return nil
+}
@@ -16,9 +16,13 @@ limitations under the License.
 package playwright_helpers
 
 import (
+	"context"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-rod/stealth"
+	"github.com/penny-vault/pvdata/metrics"
 	"github.com/playwright-community/playwright-go"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
@@ -70,8 +74,9 @@ func BuildUserAgent(browser *playwright.Browser) string {
 	return userAgent
 }
 
-// StartPlaywright starts the playwright server and browser, it then creates a new context and page with the stealth extensions loaded
-func StartPlaywright(headless bool) (page playwright.Page, context playwright.BrowserContext, browser playwright.Browser, pw *playwright.Playwright) {
+// StartPlaywright starts the playwright server and browser, it then creates a new context and page with the stealth extensions loaded.
+// Requests made by the page are counted against the provider stored on ctx.
+func StartPlaywright(ctx context.Context, headless bool) (page playwright.Page, context playwright.BrowserContext, browser playwright.Browser, pw *playwright.Playwright) {
 	pw, err := playwright.Run()
 	if err != nil {
 		log.Error().Err(err).Msg("could not launch playwright")
@@ -106,39 +111,72 @@ func StartPlaywright(headless bool) (page playwright.Page, context playwright.Br
 
 	// block trackers
 	BlockTrackers(page)
+	InstrumentPage(page, metrics.ProviderFromContext(ctx))
 
 	return
 }
 
+// blocked reports if `url` belongs to one of the tracker and ad domains that
+// BlockTrackers aborts
+func blocked(url string) bool {
+	return strings.Contains(url, "google.com") ||
+		strings.Contains(url, "googletagservices.com") ||
+		strings.Contains(url, "googlesyndication.com") ||
+		strings.Contains(url, "facebook.com") ||
+		strings.Contains(url, "moatpixel.com") ||
+		strings.Contains(url, "moatads.com") ||
+		strings.Contains(url, "adsystem.com") ||
+		strings.Contains(url, "connatix.com") ||
+		strings.Contains(url, "prebid") ||
+		strings.Contains(url, "sodar") ||
+		strings.Contains(url, "auction") ||
+		strings.Contains(url, "rubiconproject.com") ||
+		strings.Contains(url, "pubmatic.com") ||
+		strings.Contains(url, "amazon-adsystem.com") ||
+		strings.Contains(url, "adnxs.com") ||
+		strings.Contains(url, "lijit.com") ||
+		strings.Contains(url, "3lift.com") ||
+		strings.Contains(url, "doubleclick.net") ||
+		strings.Contains(url, "bidswitch.net") ||
+		strings.Contains(url, "casalemedia.com") ||
+		strings.Contains(url, "yahoo.com") ||
+		strings.Contains(url, "sitescout.com") ||
+		strings.Contains(url, "ipredictive.com") ||
+		strings.Contains(url, "uat5-b.investingchannel.com") ||
+		strings.Contains(url, "eyeota.net")
+}
+
+// InstrumentPage counts the requests `page` makes on behalf of `provider`.
+// Requests to blocked trackers are not counted.
+func InstrumentPage(page playwright.Page, provider string) {
+	page.OnRequestFinished(func(request playwright.Request) {
+		if blocked(request.URL()) {
+			return
+		}
+
+		code := "error"
+		if response, err := request.Response(); err == nil && response != nil {
+			code = strconv.Itoa(response.Status())
+		}
+
+		elapsed := time.Duration(request.Timing().ResponseEnd * float64(time.Millisecond))
+		metrics.ObserveRequest(provider, code, elapsed)
+	})
+
+	page.OnRequestFailed(func(request playwright.Request) {
+		if blocked(request.URL()) {
+			return
+		}
+
+		metrics.ObserveRequest(provider, "error", 0)
+	})
+}
+
 func BlockTrackers(page playwright.Page) {
 	// block a variety of domains that contain trackers and ads
 	err := page.Route("**/*", func(route playwright.Route) {
 		request := route.Request()
-		if strings.Contains(request.URL(), "google.com") ||
-			strings.Contains(request.URL(), "googletagservices.com") ||
-			strings.Contains(request.URL(), "googlesyndication.com") ||
-			strings.Contains(request.URL(), "facebook.com") ||
-			strings.Contains(request.URL(), "moatpixel.com") ||
-			strings.Contains(request.URL(), "moatads.com") ||
-			strings.Contains(request.URL(), "adsystem.com") ||
-			strings.Contains(request.URL(), "connatix.com") ||
-			strings.Contains(request.URL(), "prebid") ||
-			strings.Contains(request.URL(), "sodar") ||
-			strings.Contains(request.URL(), "auction") ||
-			strings.Contains(request.URL(), "rubiconproject.com") ||
-			strings.Contains(request.URL(), "pubmatic.com") ||
-			strings.Contains(request.URL(), "amazon-adsystem.com") ||
-			strings.Contains(request.URL(), "adnxs.com") ||
-			strings.Contains(request.URL(), "lijit.com") ||
-			strings.Contains(request.URL(), "3lift.com") ||
-			strings.Contains(request.URL(), "doubleclick.net") ||
-			strings.Contains(request.URL(), "bidswitch.net") ||
-			strings.Contains(request.URL(), "casalemedia.com") ||
-			strings.Contains(request.URL(), "yahoo.com") ||
-			strings.Contains(request.URL(), "sitescout.com") ||
-			strings.Contains(request.URL(), "ipredictive.com") ||
-			strings.Contains(request.URL(), "uat5-b.investingchannel.com") ||
-			strings.Contains(request.URL(), "eyeota.net") {
+		if blocked(request.URL()) {
 			err := route.Abort("failed")
 			if err != nil {
 				log.Error().Err(err).Msg("failed blocking route")
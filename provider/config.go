@@ -0,0 +1,175 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/penny-vault/pvdata/metrics"
+	"github.com/penny-vault/pvdata/secret"
+)
+
+// ConfigType is the type of value a config field holds; all values are stored as strings
+type ConfigType string
+
+const (
+	ConfigString ConfigType = "string"
+	ConfigInt    ConfigType = "int"
+	ConfigBool   ConfigType = "bool"
+)
+
+var (
+	ErrConfigRequired   = errors.New("value is required")
+	ErrConfigType       = errors.New("value has the wrong type")
+	ErrConfigOption     = errors.New("value is not an allowed option")
+	ErrConnectionFailed = errors.New("connection test failed")
+)
+
+// ConfigField describes one value the user provides when subscribing
+type ConfigField struct {
+	Key         string
+	Title       string
+	Description string
+	Type        ConfigType
+	Default     string
+	Required    bool
+
+	// Secret fields are encrypted in the library and masked in output
+	Secret bool
+
+	// Options, if set, are the only allowed values
+	Options []string
+
+	// Validate performs additional checks after the type is checked
+	Validate func(string) error
+}
+
+// ConfigSchema lists a provider's config fields in the order they are asked for
+type ConfigSchema []*ConfigField
+
+// ConnectionTester is implemented by providers that can check a config, e.g.
+// that API keys are accepted, before a subscription is saved. The config
+// passed has secrets resolved.
+type ConnectionTester interface {
+	TestConnection(ctx context.Context, config map[string]string) error
+}
+
+// Check returns an error if `val` is not valid for the field. Encrypted values
+// and env:/file: references of secret fields are not checked.
+func (field *ConfigField) Check(val string) error {
+	if val == "" {
+		if field.Required {
+			return ErrConfigRequired
+		}
+		return nil
+	}
+
+	if field.Secret && secret.IsSealed(val) {
+		return nil
+	}
+
+	switch field.Type {
+	case ConfigInt:
+		if _, err := strconv.Atoi(val); err != nil {
+			return fmt.Errorf("%w: expected an integer", ErrConfigType)
+		}
+	case ConfigBool:
+		if _, err := strconv.ParseBool(val); err != nil {
+			return fmt.Errorf("%w: expected true or false", ErrConfigType)
+		}
+	}
+
+	if len(field.Options) > 0 && !slices.Contains(field.Options, val) {
+		return fmt.Errorf("%w: expected one of %s", ErrConfigOption, strings.Join(field.Options, ", "))
+	}
+
+	if field.Validate != nil {
+		return field.Validate(val)
+	}
+
+	return nil
+}
+
+// SecretFields returns the keys of the schema's secret fields
+func (schema ConfigSchema) SecretFields() []string {
+	fields := make([]string, 0)
+	for _, field := range schema {
+		if field.Secret {
+			fields = append(fields, field.Key)
+		}
+	}
+	return fields
+}
+
+// WithDefaults returns a copy of `config` with defaults filled in for empty fields
+func (schema ConfigSchema) WithDefaults(config map[string]string) map[string]string {
+	merged := make(map[string]string, len(config))
+	for key, val := range config {
+		merged[key] = val
+	}
+
+	for _, field := range schema {
+		if merged[field.Key] == "" && field.Default != "" {
+			merged[field.Key] = field.Default
+		}
+	}
+
+	return merged
+}
+
+// Validate checks every field of `config`; errors are prefixed with the field's key
+func (schema ConfigSchema) Validate(config map[string]string) error {
+	var errs []error
+	for _, field := range schema {
+		if err := field.Check(config[field.Key]); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field.Key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// positive validates that an integer config value is greater than zero
+func positive(val string) error {
+	if num, err := strconv.Atoi(val); err != nil || num <= 0 {
+		return fmt.Errorf("%w: expected a number greater than zero", ErrConfigType)
+	}
+	return nil
+}
+
+// testGet requests `rawURL` and returns ErrConnectionFailed if the request
+// could not be made or the response is not successful. Transport errors are
+// unwrapped so the query string, which may hold API keys, is not reported.
+func testGet(ctx context.Context, rawURL string, params map[string]string) error {
+	resp, err := metrics.NewClient(metrics.ProviderFromContext(ctx)).R().SetContext(ctx).SetQueryParams(params).Get(rawURL)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("%w: %w", ErrConnectionFailed, err)
+	}
+
+	if resp.StatusCode() >= 300 {
+		return fmt.Errorf("%w: %s returned %s", ErrConnectionFailed, rawURL, resp.Status())
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package provider_test
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/penny-vault/pvdata/provider"
+)
+
+var _ = Describe("ConfigSchema", func() {
+	errBadSeries := errors.New("bad series")
+
+	schema := provider.ConfigSchema{
+		{Key: "apiKey", Type: provider.ConfigString, Required: true, Secret: true},
+		{Key: "rateLimit", Type: provider.ConfigInt, Default: "5000"},
+		{Key: "adjusted", Type: provider.ConfigBool},
+		{Key: "frequency", Type: provider.ConfigString, Options: []string{"daily", "weekly"}},
+		{Key: "series", Type: provider.ConfigString, Validate: func(val string) error {
+			if val == "BAD" {
+				return errBadSeries
+			}
+			return nil
+		}},
+	}
+
+	It("checks required fields, types, options and validators", func() {
+		Expect(schema.Validate(map[string]string{"apiKey": "abc"})).To(Succeed())
+
+		err := schema.Validate(map[string]string{
+			"rateLimit": "fast",
+			"adjusted":  "maybe",
+			"frequency": "hourly",
+			"series":    "BAD",
+		})
+		Expect(err).To(MatchError(provider.ErrConfigRequired))
+		Expect(err).To(MatchError(provider.ErrConfigType))
+		Expect(err).To(MatchError(provider.ErrConfigOption))
+		Expect(err).To(MatchError(errBadSeries))
+		Expect(err.Error()).To(ContainSubstring("rateLimit: "))
+	})
+
+	It("does not check sealed secrets", func() {
+		Expect(schema[0].Check("env:TIINGO_API_KEY")).To(Succeed())
+	})
+
+	It("fills in defaults for empty fields", func() {
+		config := schema.WithDefaults(map[string]string{"apiKey": "abc", "rateLimit": ""})
+		Expect(config).To(Equal(map[string]string{"apiKey": "abc", "rateLimit": "5000"}))
+	})
+
+	It("lists secret fields", func() {
+		Expect(schema.SecretFields()).To(Equal([]string{"apiKey"}))
+	})
+
+	It("orders every provider's schema and marks credentials secret", func() {
+		for name, dataProvider := range provider.Map {
+			keys := make(map[string]bool)
+			for _, field := range dataProvider.ConfigSchema() {
+				Expect(keys).ToNot(HaveKey(field.Key), name)
+				keys[field.Key] = true
+			}
+			Expect(provider.SecretFields(name)).ToNot(BeEmpty(), name)
+		}
+	})
+})
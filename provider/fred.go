@@ -16,11 +16,11 @@ package provider
 
 import (
 	"context"
+	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/go-resty/resty/v2"
 	"github.com/penny-vault/pvdata/data"
 	"github.com/penny-vault/pvdata/library"
 	"github.com/rs/zerolog"
@@ -34,13 +34,27 @@ func (fred *Fred) Name() string {
 	return "FRED"
 }
 
-func (fred *Fred) ConfigDescription() map[string]string {
-	return map[string]string{
-		"seriesIds": "Enter all series to retrieve from FRED (e.g. UNRATE, DTB3):",
-		"apiKey":    "What is your FRED api key?",
+func (fred *Fred) ConfigSchema() ConfigSchema {
+	return ConfigSchema{
+		{Key: "apiKey", Title: "What is your FRED api key?", Type: ConfigString, Required: true, Secret: true},
+		{Key: "seriesIds", Title: "Enter all series to retrieve from FRED (e.g. UNRATE, DTB3):", Type: ConfigString, Required: true},
 	}
 }
 
+// TestConnection looks up each of the configured series
+func (fred *Fred) TestConnection(ctx context.Context, config map[string]string) error {
+	for _, seriesID := range strings.Split(config["seriesIds"], ",") {
+		if err := testGet(ctx, "https://api.stlouisfed.org/fred/series", map[string]string{
+			"api_key":   config["apiKey"],
+			"series_id": strings.TrimSpace(seriesID),
+			"file_type": "json",
+		}); err != nil {
+			return fmt.Errorf("series %s: %w", strings.TrimSpace(seriesID), err)
+		}
+	}
+	return nil
+}
+
 func (fred *Fred) Description() string {
 	return `The Financial Reserve Economic Data (FRED) provides access over 800,000 economic indicators`
 }
@@ -79,6 +93,8 @@ func downloadAllFredIndicators(ctx context.Context, subscription *library.Subscr
 		seriesId = strings.TrimSpace(seriesId)
 		downloadIndicator(ctx, subscription, out, seriesId)
 	}
+
+	runSummary.Status = data.RunSuccess
 }
 
 func downloadIndicator(ctx context.Context, subscription *library.Subscription, out chan<- *data.Observation, seriesId string) {
@@ -93,7 +109,7 @@ func downloadIndicator(ctx context.Context, subscription *library.Subscription,
 
 	var resp fredResponse
 
-	client := resty.New().SetQueryParam("api_key", subscription.Config["apiKey"])
+	client := subscription.Client.SetQueryParam("api_key", subscription.Config["apiKey"])
 	req, err := client.R().
 		SetQueryParam("file_type", "json").
 		SetQueryParam("series_id", seriesId).
@@ -31,8 +31,8 @@ import (
 	"github.com/penny-vault/pvdata/data"
 	"github.com/penny-vault/pvdata/figi"
 	"github.com/penny-vault/pvdata/library"
+	"github.com/penny-vault/pvdata/metrics"
 	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/log"
 	"golang.org/x/time/rate"
 )
 
@@ -53,14 +53,20 @@ func (polygon *Polygon) Name() string {
 	return "polygon"
 }
 
-func (polygon *Polygon) ConfigDescription() map[string]string {
-	return map[string]string{
-		"apiKey":    "Enter your polygon.io API key:",
-		"rateLimit": "What is the maximum number of requests per minute?",
-		"filer":     "Where should logos and icons be saved? (e.g. file:///path/)",
+func (polygon *Polygon) ConfigSchema() ConfigSchema {
+	return ConfigSchema{
+		{Key: "apiKey", Title: "Enter your polygon.io API key:", Type: ConfigString, Required: true, Secret: true},
+		{Key: "rateLimit", Title: "What is the maximum number of requests per minute?", Type: ConfigInt, Default: "5000", Validate: positive},
+		{Key: "filer", Title: "Where should logos and icons be saved? (e.g. file:///path/ or s3://bucket/prefix)", Type: ConfigString,
+			Description: "Leave blank to skip downloading logos", Validate: data.ValidateFilerSpec},
 	}
 }
 
+// TestConnection requests the current market status
+func (polygon *Polygon) TestConnection(ctx context.Context, config map[string]string) error {
+	return testGet(ctx, "https://api.polygon.io/v1/marketstatus/now", map[string]string{"apiKey": config["apiKey"]})
+}
+
 func (polygon *Polygon) Description() string {
 	return `The Polygon.io Stocks API provides REST endpoints that let you query the latest market data from all US stock exchanges. You can also find data on company financials, stock market holidays, corporate actions, and more.`
 }
@@ -80,7 +86,7 @@ func (polygon *Polygon) Datasets() map[string]Dataset {
 		"Stock Tickers": {
 			Name:        "Stock Tickers",
 			Description: "Details about tradeable stocks and ETFs.",
-			DataTypes:   []*data.DataType{data.DataTypes[data.AssetKey]},
+			DataTypes:   []*data.DataType{data.DataTypes[data.AssetKey], data.DataTypes[data.SymbologyKey]},
 			DateRange: func() (time.Time, time.Time) {
 				return time.Date(1949, 4, 19, 0, 0, 0, 0, time.UTC), time.Now().UTC()
 			},
@@ -103,7 +109,7 @@ type polygonHoliday struct {
 type polygonAssetFetcher struct {
 	subscription *library.Subscription
 	client       *resty.Client
-	limiter      *rate.Limiter
+	limiter      *metrics.Limiter
 	publishChan  chan<- *data.Observation
 }
 
@@ -151,6 +157,7 @@ func downloadPolygonAssets(ctx context.Context, subscription *library.Subscripti
 
 	runSummary := data.RunSummary{
 		StartTime:        time.Now(),
+		Status:           data.RunFailed,
 		SubscriptionID:   subscription.ID,
 		SubscriptionName: subscription.Name,
 	}
@@ -165,20 +172,10 @@ func downloadPolygonAssets(ctx context.Context, subscription *library.Subscripti
 		exitNotification <- runSummary
 	}()
 
-	rateLimit, err := strconv.Atoi(subscription.Config["rateLimit"])
-	if err != nil {
-		logger.Error().Err(err).Str("configRateLimit", subscription.Config["rateLimit"]).Msg("could not convert rateLimit configuration parameter to an integer")
-		return
-	}
-
-	if rateLimit <= 0 {
-		rateLimit = 5000
-	}
-
 	api := &polygonAssetFetcher{
 		subscription: subscription,
-		client:       resty.New().SetQueryParam("apiKey", subscription.Config["apiKey"]),
-		limiter:      rate.NewLimiter(rate.Limit(float64(rateLimit)/float64(61)), 1),
+		client:       subscription.Client.SetQueryParam("apiKey", subscription.Config["apiKey"]),
+		limiter:      subscription.Limiter,
 		publishChan:  out,
 	}
 
@@ -195,7 +192,7 @@ func downloadPolygonAssets(ctx context.Context, subscription *library.Subscripti
 
 	// remove any assets that haven't been updated since our last
 	// look
-	assetDetail, err = api.filterAssetsByLastUpdated(ctx, assets)
+	assetDetail, err := api.filterAssetsByLastUpdated(ctx, assets)
 	if err != nil {
 		// logged by caller
 		return
@@ -212,6 +209,8 @@ func downloadPolygonAssets(ctx context.Context, subscription *library.Subscripti
 		// logged by caller
 		return
 	}
+
+	runSummary.Status = data.RunSuccess
 }
 
 func downloadPolygonMarketHolidays(ctx context.Context, subscription *library.Subscription, out chan<- *data.Observation, exitNotification chan<- data.RunSummary) {
@@ -219,6 +218,7 @@ func downloadPolygonMarketHolidays(ctx context.Context, subscription *library.Su
 
 	runSummary := data.RunSummary{
 		StartTime:        time.Now(),
+		Status:           data.RunFailed,
 		SubscriptionID:   subscription.ID,
 		SubscriptionName: subscription.Name,
 	}
@@ -232,18 +232,7 @@ func downloadPolygonMarketHolidays(ctx context.Context, subscription *library.Su
 		exitNotification <- runSummary
 	}()
 
-	rateLimit, err := strconv.Atoi(subscription.Config["rateLimit"])
-	if err != nil {
-		logger.Error().Err(err).Str("configRateLimit", subscription.Config["rateLimit"]).Msg("could not convert rateLimit configuration parameter to an integer")
-		return
-	}
-
-	if rateLimit <= 0 {
-		rateLimit = 5000
-	}
-
-	client := resty.New().SetQueryParam("apiKey", subscription.Config["apiKey"])
-	limiter := rate.NewLimiter(rate.Limit(float64(rateLimit)/float64(61)), 1)
+	client := subscription.Client.SetQueryParam("apiKey", subscription.Config["apiKey"])
 
 	// get nyc timezone
 	nyc, err := time.LoadLocation("America/New_York")
@@ -253,8 +242,8 @@ func downloadPolygonMarketHolidays(ctx context.Context, subscription *library.Su
 	}
 
 	// fetch upcoming market holidays
-	if err := limiter.Wait(ctx); err != nil {
-		log.Panic().Err(err).Msg("rate limit wait failed")
+	if err := subscription.Limiter.Wait(ctx); err != nil {
+		logger.Panic().Err(err).Msg("rate limit wait failed")
 	}
 
 	respContent := make([]*polygonHoliday, 0)
@@ -306,6 +295,8 @@ func downloadPolygonMarketHolidays(ctx context.Context, subscription *library.Su
 			SubscriptionName: subscription.Name,
 		}
 	}
+
+	runSummary.Status = data.RunSuccess
 }
 
 func (api *polygonAssetFetcher) publish(asset *data.Asset) {
@@ -351,7 +342,7 @@ func (api *polygonAssetFetcher) assets(ctx context.Context, assetType string) ([
 	}
 
 	if err := api.limiter.Wait(ctx); err != nil {
-		log.Panic().Err(err).Msg("rate limit wait failed")
+		logger.Panic().Err(err).Msg("rate limit wait failed")
 	}
 
 	resp, err := api.client.R().
@@ -377,7 +368,7 @@ func (api *polygonAssetFetcher) assets(ctx context.Context, assetType string) ([
 		// de-serealize stock content
 		polygonTickers := make([]*polygonStock, 0, 1000)
 		if err := json.Unmarshal(*respContent.Results, &polygonTickers); err != nil {
-			log.Error().Err(err).Msg("could not unmarshal response of polygon tickers")
+			logger.Error().Err(err).Msg("could not unmarshal response of polygon tickers")
 			return nil, err
 		}
 
@@ -418,7 +409,7 @@ func (api *polygonAssetFetcher) assets(ctx context.Context, assetType string) ([
 		logger.Debug().Str("Next", next).Str("AssetType", assetType).Int("ii", ii).Msg("making next query")
 
 		if err := api.limiter.Wait(ctx); err != nil {
-			log.Panic().Err(err).Msg("rate limit wait failed")
+			logger.Panic().Err(err).Msg("rate limit wait failed")
 		}
 
 		resp, err = api.client.R().
@@ -454,7 +445,7 @@ func (api *polygonAssetFetcher) filterAssetsByLastUpdated(ctx context.Context, a
 		}
 	}
 
-	log.Debug().Int("NumAssetsToEnrich", len(toEnrich)).Msg("Enriching assets with FIGI")
+	logger.Debug().Int("NumAssetsToEnrich", len(toEnrich)).Msg("Enriching assets with FIGI")
 	figi.Enrich(toEnrich...)
 
 	// for each asset determine if details need to be queried
@@ -462,7 +453,7 @@ func (api *polygonAssetFetcher) filterAssetsByLastUpdated(ctx context.Context, a
 		var lastUpdated time.Time
 
 		if asset.CompositeFigi == "" {
-			log.Warn().Str("Ticker", asset.Ticker).Str("Name", asset.Name).Msg("skipping ticker due to unknown figi")
+			logger.Warn().Str("Ticker", asset.Ticker).Str("Name", asset.Name).Msg("skipping ticker due to unknown figi")
 			continue
 		}
 
@@ -584,7 +575,7 @@ func (api *polygonAssetFetcher) delistedAssets(ctx context.Context, assets []*da
 	// build a lookup map of potential inactive assets
 	inactiveMap := make(map[string]*data.Asset, len(inactive))
 	for _, asset := range inactive {
-		log.Info().Str("InactivePossible", asset.ID()).Send()
+		logger.Info().Str("InactivePossible", asset.ID()).Send()
 		inactiveMap[asset.ID()] = asset
 	}
 
@@ -595,7 +586,7 @@ func (api *polygonAssetFetcher) delistedAssets(ctx context.Context, assets []*da
 		var respContent polygonResponse
 
 		if err := api.limiter.Wait(ctx); err != nil {
-			log.Panic().Err(err).Msg("rate limit failed")
+			logger.Panic().Err(err).Msg("rate limit failed")
 		}
 
 		resp, err := api.client.R().
@@ -626,7 +617,7 @@ func (api *polygonAssetFetcher) delistedAssets(ctx context.Context, assets []*da
 			// de-serealize stock content
 			polygonAssets := make([]*polygonStock, 0, 1000)
 			if err := json.Unmarshal(*respContent.Results, &polygonAssets); err != nil {
-				log.Error().Err(err).Msg("json unmarshal of polygon assets failed")
+				logger.Error().Err(err).Msg("json unmarshal of polygon assets failed")
 				return err
 			}
 
@@ -669,7 +660,7 @@ func (api *polygonAssetFetcher) delistedAssets(ctx context.Context, assets []*da
 			logger.Debug().Str("Next", next).Int("ii", ii).Msg("making next query")
 
 			if err := api.limiter.Wait(ctx); err != nil {
-				log.Panic().Err(err).Msg("rate limit failed")
+				logger.Panic().Err(err).Msg("rate limit failed")
 			}
 
 			resp, err = api.client.R().
@@ -732,7 +723,7 @@ func (api *polygonAssetFetcher) assetDetail(ctx context.Context, asset *data.Ass
 	detailsURL := fmt.Sprintf("https://api.polygon.io/v3/reference/tickers/%s", asset.Ticker)
 
 	if err := api.limiter.Wait(ctx); err != nil {
-		log.Panic().Err(err).Msg("rate limit failed")
+		logger.Panic().Err(err).Msg("rate limit failed")
 	}
 
 	resp, err := api.client.R().
@@ -773,7 +764,7 @@ func (api *polygonAssetFetcher) assetDetail(ctx context.Context, asset *data.Ass
 	var iconMimeType string
 	if polygonAsset.Branding.IconURL != "" {
 		if err := api.limiter.Wait(ctx); err != nil {
-			log.Panic().Err(err).Msg("rate limit failed")
+			logger.Panic().Err(err).Msg("rate limit failed")
 		}
 
 		resp, err := api.client.R().Get(polygonAsset.Branding.IconURL)
@@ -790,7 +781,7 @@ func (api *polygonAssetFetcher) assetDetail(ctx context.Context, asset *data.Ass
 	var logoMimeType string
 	if polygonAsset.Branding.LogoURL != "" {
 		if err := api.limiter.Wait(ctx); err != nil {
-			log.Panic().Err(err).Msg("rate limit failed")
+			logger.Panic().Err(err).Msg("rate limit failed")
 		}
 
 		resp, err := api.client.R().Get(polygonAsset.Branding.LogoURL)
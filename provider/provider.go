@@ -24,7 +24,9 @@ import (
 
 type Provider interface {
 	Name() string
-	ConfigDescription() map[string]string
+
+	// ConfigSchema describes, in order, the config values the user provides when subscribing
+	ConfigSchema() ConfigSchema
 	Description() string
 	Datasets() map[string]Dataset
 }
@@ -35,6 +37,9 @@ type Dataset struct {
 	DataTypes   []*data.DataType
 	DateRange   func() (time.Time, time.Time)
 
+	// Scoped datasets honor a data.FetchScope carried by the context passed to Fetch
+	Scoped bool
+
 	// Fetch is called when pvdata wants to retrieve measurements from the dataset. It
 	// passes a config with the provider configuration, a channel to write results to,
 	// a logger to write log messages to, and a channel to write progress.
@@ -15,6 +15,7 @@
 package provider
 
 import (
+	"context"
 	"time"
 
 	"github.com/penny-vault/pvdata/data"
@@ -26,13 +27,21 @@ func (sharadar *Sharadar) Name() string {
 	return "Sharadar"
 }
 
-func (sharadar *Sharadar) ConfigDescription() map[string]string {
-	return map[string]string{
-		"apiKey":    "Enter your Nasdaq Data Link API key:",
-		"rateLimit": "What is the maximum number of requests per minute?",
+func (sharadar *Sharadar) ConfigSchema() ConfigSchema {
+	return ConfigSchema{
+		{Key: "apiKey", Title: "Enter your Nasdaq Data Link API key:", Type: ConfigString, Required: true, Secret: true},
+		{Key: "rateLimit", Title: "What is the maximum number of requests per minute?", Type: ConfigInt, Validate: positive},
 	}
 }
 
+// TestConnection requests a single row of the tickers table
+func (sharadar *Sharadar) TestConnection(ctx context.Context, config map[string]string) error {
+	return testGet(ctx, "https://data.nasdaq.com/api/v3/datatables/SHARADAR/TICKERS", map[string]string{
+		"api_key":        config["apiKey"],
+		"qopts.per_page": "1",
+	})
+}
+
 func (sharadar *Sharadar) Description() string {
 	return `Sharadar publishes fundamentals, daily metrics, and other investment data via the Nasdaq Data Link API`
 }
@@ -62,7 +71,7 @@ func (sharadar *Sharadar) Datasets() map[string]Dataset {
 		"Stock Tickers": {
 			Name:        "Stock Tickers",
 			Description: "Details about tradeable stocks.",
-			DataTypes:   []*data.DataType{data.DataTypes[data.AssetKey]},
+			DataTypes:   []*data.DataType{data.DataTypes[data.AssetKey], data.DataTypes[data.SymbologyKey]},
 			DateRange: func() (time.Time, time.Time) {
 				return time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC), time.Now().UTC()
 			},
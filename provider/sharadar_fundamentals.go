@@ -18,11 +18,9 @@ import (
 	"context"
 	"time"
 
-	"github.com/go-resty/resty/v2"
 	"github.com/penny-vault/pvdata/data"
 	"github.com/penny-vault/pvdata/library"
 	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/log"
 	"github.com/tidwall/gjson"
 )
 
@@ -158,7 +156,7 @@ func downloadAllSharadarFundamentals(ctx context.Context, subscription *library.
 
 	cursor := ""
 	for {
-		log.Info().Str("cursor", cursor).Msg("Fetching next page sharadar fundamentals")
+		zerolog.Ctx(ctx).Info().Str("cursor", cursor).Msg("Fetching next page sharadar fundamentals")
 		cursor = downloadSharadarFundamentals(ctx, subscription, cursor, out)
 		if cursor == "" {
 			break
@@ -172,7 +170,7 @@ func downloadSharadarFundamentals(ctx context.Context, subscription *library.Sub
 	// Get a list of active assets
 	conn, err := subscription.Library.Pool.Acquire(ctx)
 	if err != nil {
-		log.Panic().Msg("could not acquire database connection")
+		logger.Panic().Msg("could not acquire database connection")
 	}
 
 	defer conn.Release()
@@ -184,7 +182,7 @@ func downloadSharadarFundamentals(ctx context.Context, subscription *library.Sub
 	}
 
 	url := "https://data.nasdaq.com/api/v3/datatables/SHARADAR/SF1"
-	client := resty.New().SetQueryParam("api_key", subscription.Config["apiKey"])
+	client := subscription.Client.SetQueryParam("api_key", subscription.Config["apiKey"])
 
 	if cursor != "" {
 		client.SetQueryParam("qopts.cursor_id", cursor)
@@ -318,7 +316,7 @@ func downloadSharadarFundamentals(ctx context.Context, subscription *library.Sub
 		}
 
 		// convert to pv asset type
-		pvFundamental := fundamental.ToPv(figiMap)
+		pvFundamental := fundamental.ToPv(ctx, figiMap)
 
 		out <- &data.Observation{
 			Fundamental:      pvFundamental,
@@ -332,13 +330,15 @@ func downloadSharadarFundamentals(ctx context.Context, subscription *library.Sub
 }
 
 // ToPv converts the sharadar
-func (fundamental *sharadarFundamental) ToPv(figiMap map[string]string) *data.Fundamental {
+func (fundamental *sharadarFundamental) ToPv(ctx context.Context, figiMap map[string]string) *data.Fundamental {
+	logger := zerolog.Ctx(ctx)
+
 	var err error
 
 	// get nyc timezone
 	nyc, err := time.LoadLocation("America/New_York")
 	if err != nil {
-		log.Panic().Err(err).Msg("could not load timezone")
+		logger.Panic().Err(err).Msg("could not load timezone")
 		return nil
 	}
 
@@ -447,7 +447,7 @@ func (fundamental *sharadarFundamental) ToPv(figiMap map[string]string) *data.Fu
 	if fundamental.CalendarDate != "" {
 		ff.EventDate, err = time.Parse("2006-01-02", fundamental.CalendarDate)
 		if err != nil {
-			log.Error().Err(err).Str("CalendarDate", fundamental.CalendarDate).Msg("could not parse date")
+			logger.Error().Err(err).Str("CalendarDate", fundamental.CalendarDate).Msg("could not parse date")
 			return nil
 		}
 
@@ -457,7 +457,7 @@ func (fundamental *sharadarFundamental) ToPv(figiMap map[string]string) *data.Fu
 	if fundamental.DateKey != "" {
 		ff.DateKey, err = time.Parse("2006-01-02", fundamental.DateKey)
 		if err != nil {
-			log.Error().Err(err).Str("DateKey", fundamental.CalendarDate).Msg("could not parse date")
+			logger.Error().Err(err).Str("DateKey", fundamental.CalendarDate).Msg("could not parse date")
 			return nil
 		}
 
@@ -467,7 +467,7 @@ func (fundamental *sharadarFundamental) ToPv(figiMap map[string]string) *data.Fu
 	if fundamental.ReportPeriod != "" {
 		ff.ReportPeriod, err = time.Parse("2006-01-02", fundamental.ReportPeriod)
 		if err != nil {
-			log.Error().Err(err).Str("ReportPeriod", fundamental.CalendarDate).Msg("could not parse date")
+			logger.Error().Err(err).Str("ReportPeriod", fundamental.CalendarDate).Msg("could not parse date")
 			return nil
 		}
 
@@ -477,7 +477,7 @@ func (fundamental *sharadarFundamental) ToPv(figiMap map[string]string) *data.Fu
 	if fundamental.LastUpdated != "" {
 		ff.LastUpdated, err = time.Parse("2006-01-02", fundamental.LastUpdated)
 		if err != nil {
-			log.Error().Err(err).Str("LastUpdated", fundamental.CalendarDate).Msg("could not parse date")
+			logger.Error().Err(err).Str("LastUpdated", fundamental.CalendarDate).Msg("could not parse date")
 			ff.LastUpdated = time.Now().In(nyc)
 		}
 
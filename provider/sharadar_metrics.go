@@ -18,11 +18,9 @@ import (
 	"context"
 	"time"
 
-	"github.com/go-resty/resty/v2"
 	"github.com/penny-vault/pvdata/data"
 	"github.com/penny-vault/pvdata/library"
 	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/log"
 	"github.com/tidwall/gjson"
 )
 
@@ -50,6 +48,7 @@ func downloadAllSharadarMetrics(ctx context.Context, subscription *library.Subsc
 
 	runSummary := data.RunSummary{
 		StartTime:        time.Now(),
+		Status:           data.RunFailed,
 		SubscriptionID:   subscription.ID,
 		SubscriptionName: subscription.Name,
 	}
@@ -59,14 +58,13 @@ func downloadAllSharadarMetrics(ctx context.Context, subscription *library.Subsc
 	defer func() {
 		runSummary.EndTime = time.Now()
 		runSummary.NumObservations = numObs
-		runSummary.Status = data.RunSuccess
 		exitNotification <- runSummary
 	}()
 
 	// Get a list of active assets
 	conn, err := subscription.Library.Pool.Acquire(ctx)
 	if err != nil {
-		log.Panic().Msg("could not acquire database connection")
+		logger.Panic().Msg("could not acquire database connection")
 	}
 
 	defer conn.Release()
@@ -78,7 +76,7 @@ func downloadAllSharadarMetrics(ctx context.Context, subscription *library.Subsc
 	}
 
 	// get a map of sp500 constituents
-	client := resty.New().SetQueryParam("api_key", subscription.Config["apiKey"])
+	client := subscription.Client.SetQueryParam("api_key", subscription.Config["apiKey"])
 	sp500Url := "https://data.nasdaq.com/api/v3/datatables/SHARADAR/SP500"
 	resp, err := client.R().SetQueryParam("action", "current").Get(sp500Url)
 	if err != nil {
@@ -108,12 +106,14 @@ func downloadAllSharadarMetrics(ctx context.Context, subscription *library.Subsc
 
 	cursor := ""
 	for {
-		log.Info().Str("cursor", cursor).Msg("Fetching next page sharadar tickers")
+		logger.Info().Str("cursor", cursor).Msg("Fetching next page sharadar tickers")
 		cursor = downloadSharadarMetrics(ctx, subscription, cursor, out, currDate, sp500Map, figiMap)
 		if cursor == "" {
 			break
 		}
 	}
+
+	runSummary.Status = data.RunSuccess
 }
 
 func downloadSharadarMetrics(ctx context.Context, subscription *library.Subscription, cursor string, out chan<- *data.Observation, forDate string, sp500Map map[string]bool, figiMap map[string]string) string {
@@ -126,7 +126,7 @@ func downloadSharadarMetrics(ctx context.Context, subscription *library.Subscrip
 		return ""
 	}
 
-	client := resty.New().SetQueryParam("api_key", subscription.Config["apiKey"])
+	client := subscription.Client.SetQueryParam("api_key", subscription.Config["apiKey"])
 
 	// download daily metrics
 	tickerUrl := "https://data.nasdaq.com/api/v3/datatables/SHARADAR/DAILY"
@@ -165,7 +165,7 @@ func downloadSharadarMetrics(ctx context.Context, subscription *library.Subscrip
 		}
 
 		// convert to pv metric type
-		pvMetric := metric.PvMetric(sp500Map, figiMap, nyc)
+		pvMetric := metric.PvMetric(ctx, sp500Map, figiMap, nyc)
 
 		out <- &data.Observation{
 			Metric:           pvMetric,
@@ -178,7 +178,7 @@ func downloadSharadarMetrics(ctx context.Context, subscription *library.Subscrip
 	return gjson.Get(responseBody, "meta.next_cursor_id").String()
 }
 
-func (metric *sharadarMetric) PvMetric(sp500Map map[string]bool, figiMap map[string]string, loc *time.Location) *data.Metric {
+func (metric *sharadarMetric) PvMetric(ctx context.Context, sp500Map map[string]bool, figiMap map[string]string, loc *time.Location) *data.Metric {
 	pvMetric := &data.Metric{
 		Ticker:     metric.Ticker,
 		MarketCap:  int64(metric.MarketCap * 1e6),
@@ -197,7 +197,7 @@ func (metric *sharadarMetric) PvMetric(sp500Map map[string]bool, figiMap map[str
 	if date, err := time.Parse("2006-01-02", metric.Date); err == nil {
 		pvMetric.EventDate = time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, loc)
 	} else {
-		log.Error().Err(err).Msg("error parsing metric date")
+		zerolog.Ctx(ctx).Error().Err(err).Msg("error parsing metric date")
 	}
 
 	if _, ok := sp500Map[pvMetric.Ticker]; ok {
@@ -21,12 +21,10 @@ import (
 	"strings"
 	"time"
 
-	"github.com/go-resty/resty/v2"
 	"github.com/penny-vault/pvdata/data"
 	"github.com/penny-vault/pvdata/figi"
 	"github.com/penny-vault/pvdata/library"
 	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/log"
 	"github.com/tidwall/gjson"
 )
 
@@ -78,7 +76,7 @@ func downloadAllSharadarTickers(ctx context.Context, subscription *library.Subsc
 
 	cursor := ""
 	for {
-		log.Info().Str("cursor", cursor).Msg("Fetching next page sharadar tickers")
+		zerolog.Ctx(ctx).Info().Str("cursor", cursor).Msg("Fetching next page sharadar tickers")
 		cursor = downloadSharadarTickers(ctx, subscription, cursor, out)
 		if cursor == "" {
 			break
@@ -100,7 +98,7 @@ func downloadSharadarTickers(ctx context.Context, subscription *library.Subscrip
 	}
 
 	tickerUrl := "https://data.nasdaq.com/api/v3/datatables/SHARADAR/TICKERS"
-	client := resty.New().SetQueryParam("api_key", subscription.Config["apiKey"])
+	client := subscription.Client.SetQueryParam("api_key", subscription.Config["apiKey"])
 
 	if cursor != "" {
 		client.SetQueryParam("qopts.cursor_id", cursor)
@@ -149,7 +147,7 @@ func downloadSharadarTickers(ctx context.Context, subscription *library.Subscrip
 		if lastUpdatedStr != "" {
 			ticker.LastUpdated, err = time.Parse("2006-01-02", lastUpdatedStr)
 			if err != nil {
-				log.Error().Err(err).Str("InputStr", lastUpdatedStr).Msg("could not parse last updated date")
+				logger.Error().Err(err).Str("InputStr", lastUpdatedStr).Msg("could not parse last updated date")
 				ticker.LastUpdated = time.Now().In(nyc)
 			}
 		}
@@ -158,7 +156,7 @@ func downloadSharadarTickers(ctx context.Context, subscription *library.Subscrip
 		if firstAddedStr != "" {
 			ticker.FirstAdded, err = time.Parse("2006-01-02", firstAddedStr)
 			if err != nil {
-				log.Error().Err(err).Str("InputStr", firstAddedStr).Msg("could not parse first added date")
+				logger.Error().Err(err).Str("InputStr", firstAddedStr).Msg("could not parse first added date")
 				ticker.FirstAdded = time.Time{}
 			}
 		}
@@ -167,7 +165,7 @@ func downloadSharadarTickers(ctx context.Context, subscription *library.Subscrip
 		if firstPriceStr != "" {
 			ticker.FirstPriceDate, err = time.Parse("2006-01-02", firstPriceStr)
 			if err != nil {
-				log.Error().Err(err).Str("InputStr", firstPriceStr).Msg("could not parse first price date")
+				logger.Error().Err(err).Str("InputStr", firstPriceStr).Msg("could not parse first price date")
 				ticker.FirstPriceDate = time.Time{}
 			}
 		}
@@ -176,7 +174,7 @@ func downloadSharadarTickers(ctx context.Context, subscription *library.Subscrip
 		if lastPriceStr != "" {
 			ticker.LastPriceDate, err = time.Parse("2006-01-02", lastPriceStr)
 			if err != nil {
-				log.Error().Err(err).Str("InputStr", lastPriceStr).Msg("could not parse last price date")
+				logger.Error().Err(err).Str("InputStr", lastPriceStr).Msg("could not parse last price date")
 				ticker.LastPriceDate = time.Time{}
 			}
 		}
@@ -186,7 +184,7 @@ func downloadSharadarTickers(ctx context.Context, subscription *library.Subscrip
 		}
 
 		// convert to pv asset type
-		pvAsset := ticker.ToAsset()
+		pvAsset := ticker.ToAsset(ctx)
 
 		// ignore unknown assets or exchanges
 		if pvAsset.PrimaryExchange == data.OTCExchange ||
@@ -219,12 +217,12 @@ func downloadSharadarTickers(ctx context.Context, subscription *library.Subscrip
 	return gjson.Get(responseBody, "meta.next_cursor_id").String()
 }
 
-func (ticker *sharadarTicker) ToAsset() *data.Asset {
+func (ticker *sharadarTicker) ToAsset(ctx context.Context) *data.Asset {
 	asset := &data.Asset{
 		Ticker:               ticker.Ticker,
 		Name:                 ticker.Name,
-		PrimaryExchange:      ticker.NormalizedExchange(),
-		AssetType:            ticker.NormalizedCategory(),
+		PrimaryExchange:      ticker.NormalizedExchange(ctx),
+		AssetType:            ticker.NormalizedCategory(ctx),
 		Active:               ticker.IsDelisted == "N",
 		CorporateUrl:         ticker.CompanySite,
 		SIC:                  int(ticker.SICCode),
@@ -269,7 +267,7 @@ func (ticker *sharadarTicker) ToAsset() *data.Asset {
 	return asset
 }
 
-func (ticker *sharadarTicker) NormalizedExchange() data.Exchange {
+func (ticker *sharadarTicker) NormalizedExchange(ctx context.Context) data.Exchange {
 	switch ticker.Exchange {
 	case "BATS":
 		return data.BATSExchange
@@ -290,12 +288,12 @@ func (ticker *sharadarTicker) NormalizedExchange() data.Exchange {
 	case "AMEX":
 		return data.NYSEMktExchange
 	default:
-		log.Panic().Str("Exchange", ticker.Exchange).Msg("Sharadar exchange is unknown")
+		zerolog.Ctx(ctx).Panic().Str("Exchange", ticker.Exchange).Msg("Sharadar exchange is unknown")
 		return data.UnknownExchange
 	}
 }
 
-func (ticker *sharadarTicker) NormalizedCategory() data.AssetType {
+func (ticker *sharadarTicker) NormalizedCategory(ctx context.Context) data.AssetType {
 	switch ticker.Category {
 	case "ETF":
 		return data.ETF
@@ -348,7 +346,7 @@ func (ticker *sharadarTicker) NormalizedCategory() data.AssetType {
 	case "Domestic Preferred Stock":
 		return data.UnknownAsset
 	default:
-		log.Panic().Object("Sharadar", ticker).Str("Category", ticker.Category).Msg("unknown Sharadar category")
+		zerolog.Ctx(ctx).Panic().Object("Sharadar", ticker).Str("Category", ticker.Category).Msg("unknown Sharadar category")
 		return data.UnknownAsset
 	}
 }
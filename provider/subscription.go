@@ -39,16 +39,24 @@ func NewSubscription(providerName, datasetName string, config map[string]string,
 		return nil, ErrDatasetNotFound
 	}
 
+	// fill in defaults and catch bad values before anything is saved
+	schema := providerObj.ConfigSchema()
+	config = schema.WithDefaults(config)
+	if err := schema.Validate(config); err != nil {
+		return nil, err
+	}
+
 	dataTypes := datasetObj.DataTypes
 
 	subscription := &library.Subscription{
-		ID:        uuid.New(),
-		Name:      providerObj.Name(),
-		Provider:  providerName,
-		DataTypes: make([]string, len(dataTypes)),
-		Config:    config,
-		Schedule:  "0 0 * * 1-5",
-		Library:   myLibrary,
+		ID:           uuid.New(),
+		Name:         providerObj.Name(),
+		Provider:     providerName,
+		DataTypes:    make([]string, len(dataTypes)),
+		Config:       config,
+		SecretFields: schema.SecretFields(),
+		Schedule:     "0 0 * * 1-5",
+		Library:      myLibrary,
 	}
 
 	// make sure that the dataset types and tables are populated
@@ -61,3 +69,11 @@ func NewSubscription(providerName, datasetName string, config map[string]string,
 
 	return subscription, nil
 }
+
+// SecretFields returns the config keys the named provider marks as secret
+func SecretFields(providerName string) []string {
+	if providerObj, ok := Map[providerName]; ok {
+		return providerObj.ConfigSchema().SecretFields()
+	}
+	return nil
+}
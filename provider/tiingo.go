@@ -21,18 +21,14 @@ import (
 	"fmt"
 	"io"
 	"regexp"
-	"strconv"
 	"strings"
 	"time"
 
-	"github.com/go-resty/resty/v2"
 	"github.com/gocarina/gocsv"
 	"github.com/penny-vault/pvdata/data"
 	"github.com/penny-vault/pvdata/figi"
 	"github.com/penny-vault/pvdata/library"
 	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/log"
-	"golang.org/x/time/rate"
 )
 
 type Tiingo struct {
@@ -51,13 +47,18 @@ func (tiingo *Tiingo) Name() string {
 	return "tiingo"
 }
 
-func (tiingo *Tiingo) ConfigDescription() map[string]string {
-	return map[string]string{
-		"apiKey":    "Enter your tiingo API key:",
-		"rateLimit": "What is the maximum number of requests per minute?",
+func (tiingo *Tiingo) ConfigSchema() ConfigSchema {
+	return ConfigSchema{
+		{Key: "apiKey", Title: "Enter your tiingo API key:", Type: ConfigString, Required: true, Secret: true},
+		{Key: "rateLimit", Title: "What is the maximum number of requests per minute?", Type: ConfigInt, Default: "5000", Validate: positive},
 	}
 }
 
+// TestConnection requests the metadata of a well-known ticker
+func (tiingo *Tiingo) TestConnection(ctx context.Context, config map[string]string) error {
+	return testGet(ctx, "https://api.tiingo.com/tiingo/daily/SPY", map[string]string{"token": config["apiKey"]})
+}
+
 func (tiingo *Tiingo) Description() string {
 	return `Tiingo provides EOD, Realtime, News and Fundamental data for stocks. Tiingo built a custom data processing engine that prioritizes performance, cleanliness, and completeness.`
 }
@@ -71,13 +72,14 @@ func (tiingo *Tiingo) Datasets() map[string]Dataset {
 			DateRange: func() (time.Time, time.Time) {
 				return time.Date(1960, 1, 1, 0, 0, 0, 0, time.UTC), time.Now().UTC()
 			},
-			Fetch: downloadTiingoEODQuotes,
+			Scoped: true,
+			Fetch:  downloadTiingoEODQuotes,
 		},
 
 		"Stock Tickers": {
 			Name:        "Stock Tickers",
 			Description: "Details about tradeable stocks, ADRs, Mutual Funds and ETFs.",
-			DataTypes:   []*data.DataType{data.DataTypes[data.AssetKey]},
+			DataTypes:   []*data.DataType{data.DataTypes[data.AssetKey], data.DataTypes[data.SymbologyKey]},
 			DateRange: func() (time.Time, time.Time) {
 				return time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC), time.Now().UTC()
 			},
@@ -115,6 +117,7 @@ func downloadTiingoEODQuotes(ctx context.Context, subscription *library.Subscrip
 
 	runSummary := data.RunSummary{
 		StartTime:        time.Now(),
+		Status:           data.RunFailed,
 		SubscriptionID:   subscription.ID,
 		SubscriptionName: subscription.Name,
 	}
@@ -127,18 +130,7 @@ func downloadTiingoEODQuotes(ctx context.Context, subscription *library.Subscrip
 		exitNotification <- runSummary
 	}()
 
-	rateLimit, err := strconv.Atoi(subscription.Config["rateLimit"])
-	if err != nil {
-		logger.Error().Err(err).Str("configRateLimit", subscription.Config["rateLimit"]).Msg("could not convert rateLimit configuration parameter to an integer")
-		return
-	}
-
-	if rateLimit <= 0 {
-		rateLimit = 5000
-	}
-
-	client := resty.New().SetQueryParam("token", subscription.Config["apiKey"])
-	limiter := rate.NewLimiter(rate.Limit(float64(rateLimit)/float64(61)), 1)
+	client := subscription.Client.SetQueryParam("token", subscription.Config["apiKey"])
 
 	// get nyc timezone
 	nyc, err := time.LoadLocation("America/New_York")
@@ -147,37 +139,69 @@ func downloadTiingoEODQuotes(ctx context.Context, subscription *library.Subscrip
 		return
 	}
 
-	// fetch ticker EOD prices
-	if err := limiter.Wait(ctx); err != nil {
-		log.Panic().Err(err).Msg("rate limit wait failed")
-	}
-
 	// Get a list of active assets
 	conn, err := subscription.Library.Pool.Acquire(ctx)
 	if err != nil {
-		log.Panic().Msg("could not acquire database connection")
+		logger.Panic().Msg("could not acquire database connection")
 	}
 
 	defer conn.Release()
 
-	assets := data.ActiveAssets(ctx, conn)
+	// fetch the requested assets and dates if a scope was provided, otherwise
+	// fetch the subscription's universe of assets; by default the last 14 days
+	startDate := time.Now().Add(-14 * 24 * time.Hour)
+	endDate := time.Now()
 
-	log.Debug().Int("NumAssets", len(assets)).Msg("downloading EOD quotes from Tiingo")
+	scope, scoped := data.FetchScopeFromContext(ctx)
+	if scoped && !scope.Start.IsZero() {
+		startDate = scope.Start
+	}
 
-	// lookback 14 days in the past
-	startDate := time.Now().Add(-14 * 24 * time.Hour)
-	startDateStr := startDate.Format("2006-01-02")
+	if scoped && !scope.End.IsZero() {
+		endDate = scope.End
+	}
 
-	for _, asset := range assets {
+	var requests []*data.FetchRequest
+	if scoped && len(scope.Requests) > 0 {
+		requests = scope.Requests
+	} else {
+		universe := data.UniverseFromSettings(subscription.Settings, startDate, endDate)
+		assets := universe.Assets(ctx, conn)
+		requests = make([]*data.FetchRequest, 0, len(assets))
+		for _, asset := range assets {
+			start, end, ok := universe.FetchRange(asset)
+			if !ok {
+				continue
+			}
+
+			requests = append(requests, &data.FetchRequest{
+				Ticker:        asset.Ticker,
+				CompositeFigi: asset.CompositeFigi,
+				Start:         start,
+				End:           end,
+			})
+		}
+	}
+
+	logger.Debug().Int("NumAssets", len(requests)).Msg("downloading EOD quotes from Tiingo")
+
+	for _, request := range requests {
 		// reformat ticker for tiingo
-		ticker := strings.ReplaceAll(asset.Ticker, "/", "-")
+		ticker := strings.ReplaceAll(request.Ticker, "/", "-")
 		url := fmt.Sprintf("https://api.tiingo.com/tiingo/daily/%s/prices", ticker)
 
+		// every ticker is a separate request
+		if err := subscription.Limiter.Wait(ctx); err != nil {
+			logger.Panic().Err(err).Msg("rate limit wait failed")
+		}
+
+		req := client.R().SetQueryParam("startDate", request.Start.Format("2006-01-02"))
+		if !request.End.IsZero() {
+			req.SetQueryParam("endDate", request.End.Format("2006-01-02"))
+		}
+
 		respContent := make([]*tiingoEod, 0)
-		resp, err := client.R().
-			SetQueryParam("startDate", startDateStr).
-			SetResult(&respContent).
-			Get(url)
+		resp, err := req.SetResult(&respContent).Get(url)
 		if err != nil {
 			logger.Error().Err(err).Msg("resty returned an error when querying eod prices")
 			return
@@ -200,8 +224,8 @@ func downloadTiingoEODQuotes(ctx context.Context, subscription *library.Subscrip
 
 			eodQuote := &data.Eod{
 				Date:          quoteDate,
-				Ticker:        asset.Ticker,
-				CompositeFigi: asset.CompositeFigi,
+				Ticker:        request.Ticker,
+				CompositeFigi: request.CompositeFigi,
 				Open:          quote.Open,
 				High:          quote.High,
 				Low:           quote.Low,
@@ -217,8 +241,11 @@ func downloadTiingoEODQuotes(ctx context.Context, subscription *library.Subscrip
 				SubscriptionID:   subscription.ID,
 				SubscriptionName: subscription.Name,
 			}
+			numObs++
 		}
 	}
+
+	runSummary.Status = data.RunSuccess
 }
 
 func downloadTiingoAssets(ctx context.Context, subscription *library.Subscription, out chan<- *data.Observation, exitNotification chan<- data.RunSummary) {
@@ -226,6 +253,7 @@ func downloadTiingoAssets(ctx context.Context, subscription *library.Subscriptio
 
 	runSummary := data.RunSummary{
 		StartTime:        time.Now(),
+		Status:           data.RunFailed,
 		SubscriptionID:   subscription.ID,
 		SubscriptionName: subscription.Name,
 	}
@@ -246,7 +274,7 @@ func downloadTiingoAssets(ctx context.Context, subscription *library.Subscriptio
 	}
 
 	tickerUrl := "https://apimedia.tiingo.com/docs/tiingo/daily/supported_tickers.zip"
-	client := resty.New()
+	client := subscription.Client
 	assets := []*tiingoAsset{}
 
 	resp, err := client.R().Get(tickerUrl)
@@ -336,7 +364,7 @@ func downloadTiingoAssets(ctx context.Context, subscription *library.Subscriptio
 		if tiingoAsset.EndDate != "" {
 			endDate, err := time.Parse("2006-01-02", tiingoAsset.EndDate)
 			if err != nil {
-				log.Warn().Str("EndDate", tiingoAsset.EndDate).Err(err).Msg("could not parse end date")
+				logger.Warn().Str("EndDate", tiingoAsset.EndDate).Err(err).Msg("could not parse end date")
 			}
 
 			endDate = endDate.In(nyc)
@@ -356,7 +384,7 @@ func downloadTiingoAssets(ctx context.Context, subscription *library.Subscriptio
 		}
 	}
 
-	log.Debug().Int("NumAssetsToEnrich", len(commonAssets)).Msg("number of assets to enrich with Composite FIGI")
+	logger.Debug().Int("NumAssetsToEnrich", len(commonAssets)).Msg("number of assets to enrich with Composite FIGI")
 	figi.Enrich(commonAssets...)
 
 	pvAssetMap := make(map[string]*data.Asset, len(commonAssets))
@@ -369,7 +397,7 @@ func downloadTiingoAssets(ctx context.Context, subscription *library.Subscriptio
 	// get a list of assets already in the database
 	conn, err := subscription.Library.Pool.Acquire(ctx)
 	if err != nil {
-		log.Panic().Msg("could not acquire database connection")
+		logger.Panic().Msg("could not acquire database connection")
 	}
 
 	defer conn.Release()
@@ -403,6 +431,8 @@ func downloadTiingoAssets(ctx context.Context, subscription *library.Subscriptio
 			SubscriptionName: subscription.Name,
 		}
 	}
+
+	runSummary.Status = data.RunSuccess
 }
 
 // tiingoIgnoreTicker interprets the structure of the ticker to identify
@@ -0,0 +1,54 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package secret
+
+import (
+	"bytes"
+	"io"
+)
+
+// Redactor is an io.Writer that masks secret values before passing writes on
+// to the underlying writer. Each zerolog event is written with a single call
+// so secrets are never split across writes.
+type Redactor struct {
+	w       io.Writer
+	secrets [][]byte
+}
+
+// NewRedactor returns a writer that replaces each of `secrets` written to it
+// with Masked
+func NewRedactor(w io.Writer, secrets ...string) *Redactor {
+	redactor := &Redactor{w: w}
+	for _, val := range secrets {
+		if val != "" {
+			redactor.secrets = append(redactor.secrets, []byte(val))
+		}
+	}
+	return redactor
+}
+
+// Write masks secrets in `p` and writes it to the underlying writer
+func (redactor *Redactor) Write(p []byte) (int, error) {
+	out := p
+	for _, val := range redactor.secrets {
+		out = bytes.ReplaceAll(out, val, []byte(Masked))
+	}
+
+	if _, err := redactor.w.Write(out); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,221 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package secret
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	// EncryptedPrefix marks values encrypted with the library key
+	EncryptedPrefix = "enc:v1:"
+
+	// EnvPrefix marks values read from the named environment variable
+	EnvPrefix = "env:"
+
+	// FilePrefix marks values read from the named file
+	FilePrefix = "file:"
+
+	// Masked replaces secret values in output
+	Masked = "********"
+
+	// KeySize is the length in bytes of the library key (AES-256)
+	KeySize = 32
+
+	// KeyEnvVar is the environment variable that may hold the library key
+	KeyEnvVar = "PVDATA_SECRETS_KEY"
+)
+
+var (
+	ErrNoKey       = errors.New("no library key configured; set PVDATA_SECRETS_KEY, secrets.key or secrets.key_file")
+	ErrInvalidKey  = errors.New("library key must be 32 base64 encoded bytes")
+	ErrCiphertext  = errors.New("could not decrypt secret; is the library key correct?")
+	ErrUnsetEnvVar = errors.New("environment variable referenced by secret is not set")
+)
+
+// GenerateKey returns a new random library key encoded as base64
+func GenerateKey() (string, error) {
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// ParseKey decodes a base64 encoded library key
+func ParseKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(key) != KeySize {
+		return nil, ErrInvalidKey
+	}
+	return key, nil
+}
+
+// LoadKey returns the library key from PVDATA_SECRETS_KEY, the secrets.key
+// setting or the file named by secrets.key_file
+func LoadKey() ([]byte, error) {
+	if encoded := os.Getenv(KeyEnvVar); encoded != "" {
+		return ParseKey(encoded)
+	}
+
+	if viper.GetString("secrets.key") != "" {
+		return ParseKey(viper.GetString("secrets.key"))
+	}
+
+	if fn := viper.GetString("secrets.key_file"); fn != "" {
+		contents, err := os.ReadFile(fn)
+		if err != nil {
+			return nil, err
+		}
+		return ParseKey(string(contents))
+	}
+
+	return nil, ErrNoKey
+}
+
+// IsSealed returns true if `value` is encrypted or a reference to an
+// environment variable or file, i.e. safe to store in the library
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, EncryptedPrefix) ||
+		strings.HasPrefix(value, EnvPrefix) ||
+		strings.HasPrefix(value, FilePrefix)
+}
+
+// Encrypt seals `plaintext` with AES-GCM. Values that are already sealed are
+// returned unchanged.
+func Encrypt(key []byte, plaintext string) (string, error) {
+	if plaintext == "" || IsSealed(plaintext) {
+		return plaintext, nil
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return EncryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value created by Encrypt
+func Decrypt(key []byte, value string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, EncryptedPrefix))
+	if err != nil {
+		return "", ErrCiphertext
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return "", ErrCiphertext
+	}
+
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", ErrCiphertext
+	}
+
+	return string(plaintext), nil
+}
+
+// Resolve returns the plaintext of a stored value: encrypted values are
+// decrypted with the library key, references are read from the environment
+// or file system and anything else is returned as-is. `key` may be nil if the
+// value is not encrypted.
+func Resolve(value string, key []byte) (string, error) {
+	switch {
+	case strings.HasPrefix(value, EncryptedPrefix):
+		if key == nil {
+			return "", ErrNoKey
+		}
+		return Decrypt(key, value)
+	case strings.HasPrefix(value, EnvPrefix):
+		name := strings.TrimPrefix(value, EnvPrefix)
+		val, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("%w: %s", ErrUnsetEnvVar, name)
+		}
+		return val, nil
+	case strings.HasPrefix(value, FilePrefix):
+		contents, err := os.ReadFile(strings.TrimPrefix(value, FilePrefix))
+		if err != nil {
+			return "", err
+		}
+		return string(bytes.TrimSpace(contents)), nil
+	default:
+		return value, nil
+	}
+}
+
+// Mask hides a secret for display. References are shown since they do not
+// contain the secret itself.
+func Mask(value string) string {
+	if value == "" || strings.HasPrefix(value, EnvPrefix) || strings.HasPrefix(value, FilePrefix) {
+		return value
+	}
+	return Masked
+}
+
+// MaskConfig returns a copy of `config` with the listed fields, and any
+// encrypted values, masked
+func MaskConfig(config map[string]string, fields []string) map[string]string {
+	masked := make(map[string]string, len(config))
+	for key, val := range config {
+		masked[key] = val
+		if strings.HasPrefix(val, EncryptedPrefix) {
+			masked[key] = Masked
+		}
+	}
+
+	for _, field := range fields {
+		if val, ok := config[field]; ok {
+			masked[field] = Mask(val)
+		}
+	}
+
+	return masked
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, ErrInvalidKey
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,137 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package secret_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/viper"
+
+	"github.com/penny-vault/pvdata/secret"
+)
+
+var _ = Describe("Secret", func() {
+	var key []byte
+
+	BeforeEach(func() {
+		encoded, err := secret.GenerateKey()
+		Expect(err).ToNot(HaveOccurred())
+
+		key, err = secret.ParseKey(encoded)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("round trips encrypted values", func() {
+		sealed, err := secret.Encrypt(key, "my-api-key")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sealed).To(HavePrefix(secret.EncryptedPrefix))
+		Expect(sealed).ToNot(ContainSubstring("my-api-key"))
+		Expect(secret.IsSealed(sealed)).To(BeTrue())
+
+		plaintext, err := secret.Resolve(sealed, key)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(plaintext).To(Equal("my-api-key"))
+	})
+
+	It("leaves sealed and empty values as-is", func() {
+		Expect(secret.Encrypt(key, "env:TIINGO_API_KEY")).To(Equal("env:TIINGO_API_KEY"))
+		Expect(secret.Encrypt(key, "")).To(Equal(""))
+	})
+
+	It("rejects the wrong key", func() {
+		sealed, err := secret.Encrypt(key, "my-api-key")
+		Expect(err).ToNot(HaveOccurred())
+
+		other, err := secret.ParseKey(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, secret.KeySize)))
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = secret.Decrypt(other, sealed)
+		Expect(err).To(MatchError(secret.ErrCiphertext))
+
+		_, err = secret.Resolve(sealed, nil)
+		Expect(err).To(MatchError(secret.ErrNoKey))
+	})
+
+	It("rejects short keys", func() {
+		_, err := secret.ParseKey(base64.StdEncoding.EncodeToString([]byte("short")))
+		Expect(err).To(MatchError(secret.ErrInvalidKey))
+	})
+
+	It("resolves environment and file references", func() {
+		GinkgoT().Setenv("PVDATA_TEST_SECRET", "from-env")
+		Expect(secret.Resolve("env:PVDATA_TEST_SECRET", nil)).To(Equal("from-env"))
+
+		_, err := secret.Resolve("env:PVDATA_TEST_UNSET", nil)
+		Expect(err).To(MatchError(secret.ErrUnsetEnvVar))
+
+		fn := filepath.Join(GinkgoT().TempDir(), "key")
+		Expect(os.WriteFile(fn, []byte("from-file\n"), 0600)).To(Succeed())
+		Expect(secret.Resolve("file:"+fn, nil)).To(Equal("from-file"))
+
+		Expect(secret.Resolve("plain", nil)).To(Equal("plain"))
+	})
+
+	It("loads the key from settings", func() {
+		GinkgoT().Setenv(secret.KeyEnvVar, "")
+		encoded := base64.StdEncoding.EncodeToString(key)
+
+		viper.Set("secrets.key", encoded)
+		DeferCleanup(viper.Set, "secrets.key", "")
+		Expect(secret.LoadKey()).To(Equal(key))
+
+		viper.Set("secrets.key", "")
+		_, err := secret.LoadKey()
+		Expect(err).To(MatchError(secret.ErrNoKey))
+
+		GinkgoT().Setenv(secret.KeyEnvVar, encoded)
+		Expect(secret.LoadKey()).To(Equal(key))
+	})
+
+	It("masks secret fields and encrypted values", func() {
+		sealed, err := secret.Encrypt(key, "password")
+		Expect(err).ToNot(HaveOccurred())
+
+		masked := secret.MaskConfig(map[string]string{
+			"apiKey":    "abc123",
+			"rateLimit": "60",
+			"password":  sealed,
+			"token":     "env:TOKEN",
+		}, []string{"apiKey", "token"})
+
+		Expect(masked).To(Equal(map[string]string{
+			"apiKey":    secret.Masked,
+			"rateLimit": "60",
+			"password":  secret.Masked,
+			"token":     "env:TOKEN",
+		}))
+	})
+
+	It("redacts secrets from log output", func() {
+		buf := &bytes.Buffer{}
+		redactor := secret.NewRedactor(buf, "abc123", "")
+
+		line := `{"level":"error","error":"Get \"https://api.tiingo.com/?token=abc123\": EOF"}`
+		n, err := redactor.Write([]byte(line))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(len(line)))
+		Expect(buf.String()).To(Equal(strings.ReplaceAll(line, "abc123", secret.Masked)))
+	})
+})
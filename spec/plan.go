@@ -0,0 +1,358 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package spec
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/penny-vault/pvdata/library"
+	"github.com/penny-vault/pvdata/monitor"
+	"github.com/penny-vault/pvdata/provider"
+	"github.com/penny-vault/pvdata/secret"
+)
+
+// ActionKind is what apply does to a subscription
+type ActionKind string
+
+const (
+	ActionCreate    ActionKind = "create"
+	ActionUpdate    ActionKind = "update"
+	ActionUnchanged ActionKind = "unchanged"
+)
+
+// ActiveField is the Change.Field used when a subscription is activated or deactivated
+const ActiveField = "active"
+
+// HealthCheckField is the Change.Field used when a subscription's
+// healthchecks.io check is removed
+const HealthCheckField = "health_check_id"
+
+var (
+	ErrNoMatchingID = errors.New("no subscription matches id")
+	ErrIDMismatch   = errors.New("subscription with id has a different provider or dataset")
+)
+
+// Change is a difference between a subscription and its spec
+type Change struct {
+	Field  string
+	From   string
+	To     string
+	Secret bool
+}
+
+// Action converges one subscription on its spec
+type Action struct {
+	Kind ActionKind
+
+	// Desired is nil when a subscription missing from the spec is deactivated
+	Desired *Subscription
+
+	// Target is the subscription as it should be saved: a new subscription for
+	// ActionCreate, otherwise a copy of the library's subscription with the
+	// changes applied
+	Target  *library.Subscription
+	Changes []*Change
+}
+
+// Plan compares the spec to the library's `current` subscriptions and returns
+// the actions needed to converge them. Subscriptions missing from the spec are
+// left alone unless `prune` is set, in which case they are deactivated.
+func Plan(myLibrary *library.Library, spec *Spec, current []*library.Subscription, prune bool) ([]*Action, error) {
+	matched := make(map[uuid.UUID]bool, len(current))
+	actions := make([]*Action, 0, len(spec.Subscriptions))
+	sealed := &secretComparer{}
+
+	for _, desired := range spec.Subscriptions {
+		existing, err := desired.match(current, matched)
+		if err != nil {
+			return nil, err
+		}
+
+		if existing == nil {
+			target, err := desired.newSubscription(myLibrary)
+			if err != nil {
+				return nil, err
+			}
+			actions = append(actions, &Action{Kind: ActionCreate, Desired: desired, Target: target})
+			continue
+		}
+
+		matched[existing.ID] = true
+		actions = append(actions, desired.diff(existing, sealed))
+	}
+
+	if prune {
+		for _, existing := range current {
+			if matched[existing.ID] || !existing.Active {
+				continue
+			}
+
+			target := *existing
+			target.Active = false
+			actions = append(actions, &Action{
+				Kind:    ActionUpdate,
+				Target:  &target,
+				Changes: []*Change{{Field: ActiveField, From: "true", To: "false"}},
+			})
+		}
+	}
+
+	return actions, nil
+}
+
+// NeedsUpdate returns true if fields other than the subscription's active
+// flag change
+func (action *Action) NeedsUpdate() bool {
+	return slices.ContainsFunc(action.Changes, func(change *Change) bool {
+		return change.Field != ActiveField
+	})
+}
+
+// ActiveChanged returns true if the subscription is activated or deactivated
+func (action *Action) ActiveChanged() bool {
+	return slices.ContainsFunc(action.Changes, func(change *Change) bool {
+		return change.Field == ActiveField
+	})
+}
+
+// String describes the action for a plan
+func (action *Action) String() string {
+	var sb strings.Builder
+	switch action.Kind {
+	case ActionCreate:
+		fmt.Fprintf(&sb, "+ create     %s (%s/%s)\n", action.Target.Name, action.Target.Provider, action.Target.Dataset)
+		if !action.Target.Active {
+			sb.WriteString("      active: false\n")
+		}
+		return sb.String()
+	case ActionUnchanged:
+		return fmt.Sprintf("= unchanged  %s [%s]\n", action.Target.Name, action.Target.ID.String()[:6])
+	}
+
+	label := "~ update    "
+	if !action.NeedsUpdate() {
+		label = "> activate  "
+		if !action.Target.Active {
+			label = "- deactivate"
+		}
+	}
+
+	fmt.Fprintf(&sb, "%s %s [%s]\n", label, action.Target.Name, action.Target.ID.String()[:6])
+	for _, change := range action.Changes {
+		sb.WriteString("      ")
+		sb.WriteString(change.String())
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
+
+// String describes the change without revealing secrets
+func (change *Change) String() string {
+	switch {
+	case change.Secret && change.To == "":
+		return fmt.Sprintf("%s: removed", change.Field)
+	case change.Secret:
+		return fmt.Sprintf("%s: changed", change.Field)
+	case change.From == "":
+		return fmt.Sprintf("%s: %q", change.Field, change.To)
+	case change.To == "":
+		return fmt.Sprintf("%s: %q removed", change.Field, change.From)
+	default:
+		return fmt.Sprintf("%s: %q -> %q", change.Field, change.From, change.To)
+	}
+}
+
+// match returns the first subscription in `current` that hasn't been matched
+// and has the spec's ID, or its name, provider and dataset if no ID is set. A
+// subscription matched by ID must have the spec's provider and dataset.
+func (sub *Subscription) match(current []*library.Subscription, matched map[uuid.UUID]bool) (*library.Subscription, error) {
+	for _, existing := range current {
+		if matched[existing.ID] {
+			continue
+		}
+
+		if sub.ID != "" {
+			if !strings.HasPrefix(existing.ID.String(), sub.ID) {
+				continue
+			}
+
+			if existing.Provider != sub.Provider || existing.Dataset != sub.Dataset {
+				return nil, fmt.Errorf("%w: %s is %s/%s but %s is %s/%s", ErrIDMismatch, sub.ID,
+					existing.Provider, existing.Dataset, sub.Name, sub.Provider, sub.Dataset)
+			}
+
+			return existing, nil
+		}
+
+		if existing.Name == sub.Name && existing.Provider == sub.Provider && existing.Dataset == sub.Dataset {
+			return existing, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// newSubscription returns the subscription the spec describes. Specs with a
+// full ID that is not in the library create the subscription with that ID.
+func (sub *Subscription) newSubscription(myLibrary *library.Library) (*library.Subscription, error) {
+	config := make(map[string]string, len(sub.Config))
+	for key, val := range sub.Config {
+		config[key] = val
+	}
+
+	target, err := provider.NewSubscription(sub.Provider, sub.Dataset, config, myLibrary)
+	if err != nil {
+		return nil, fmt.Errorf("%w %s: %w", ErrInvalidSubscription, sub.Name, err)
+	}
+
+	if sub.ID != "" {
+		id, err := uuid.Parse(sub.ID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrNoMatchingID, sub.ID)
+		}
+		target.ID = id
+	}
+
+	target.Name = sub.Name
+	target.Dataset = sub.Dataset
+	target.Schedule = sub.schedule()
+	target.Active = sub.IsActive()
+	target.Settings = sub.mergeSettings(nil)
+
+	return target, nil
+}
+
+// diff returns the action that converges `existing` on the spec. The target
+// keeps the existing encrypted value of secrets that have not changed.
+func (sub *Subscription) diff(existing *library.Subscription, sealed *secretComparer) *Action {
+	target := *existing
+	target.SecretFields = provider.SecretFields(existing.Provider)
+	target.Settings = sub.mergeSettings(existing.Settings)
+	target.Active = sub.IsActive()
+	target.Name = sub.Name
+	if sub.Schedule != "" {
+		target.Schedule = sub.Schedule
+	}
+
+	action := &Action{Kind: ActionUpdate, Desired: sub, Target: &target}
+	addChange := func(field, from, to string, isSecret bool) {
+		if from != to {
+			action.Changes = append(action.Changes, &Change{Field: field, From: from, To: to, Secret: isSecret})
+		}
+	}
+
+	addChange("name", existing.Name, target.Name, false)
+	addChange("schedule", existing.Schedule, target.Schedule, false)
+
+	// config is replaced by the spec's
+	desired := provider.Map[existing.Provider].ConfigSchema().WithDefaults(sub.Config)
+	target.Config = make(map[string]string, len(desired))
+	for _, key := range library.UnionKeys(existing.Config, desired) {
+		current, ok := existing.Config[key]
+		want, wantOK := desired[key]
+		isSecret := slices.Contains(target.SecretFields, key) || strings.HasPrefix(current, secret.EncryptedPrefix)
+
+		switch {
+		case ok && wantOK && sealed.equal(current, want):
+			target.Config[key] = current
+		case wantOK:
+			target.Config[key] = want
+			action.Changes = append(action.Changes, &Change{Field: "config." + key, From: current, To: want, Secret: isSecret})
+		default:
+			action.Changes = append(action.Changes, &Change{Field: "config." + key, From: current, Secret: isSecret})
+		}
+	}
+
+	for _, key := range library.UnionKeys(existing.Settings, target.Settings) {
+		addChange("settings."+key, existing.Settings[key], target.Settings[key], false)
+	}
+
+	// the health check is deleted when the spec monitors the subscription another way
+	if sub.Monitor != nil && sub.Monitor.Kind != monitor.KindHealthchecks {
+		target.HealthCheckID = ""
+	}
+	addChange(HealthCheckField, existing.HealthCheckID, target.HealthCheckID, false)
+
+	addChange(ActiveField, strconv.FormatBool(existing.Active), strconv.FormatBool(target.Active), false)
+
+	if len(action.Changes) == 0 {
+		action.Kind = ActionUnchanged
+	}
+
+	return action
+}
+
+// mergeSettings returns a copy of `current` with the spec's settings and monitor applied
+func (sub *Subscription) mergeSettings(current map[string]string) map[string]string {
+	merged := make(map[string]string, len(current)+len(sub.Settings)+2)
+	for key, val := range current {
+		merged[key] = val
+	}
+
+	for key, val := range sub.Settings {
+		merged[key] = val
+	}
+
+	if sub.Monitor != nil {
+		delete(merged, monitor.KindSetting)
+		delete(merged, monitor.TargetSetting)
+
+		if sub.Monitor.Kind != monitor.KindNone {
+			merged[monitor.KindSetting] = sub.Monitor.Kind
+		}
+
+		if sub.Monitor.Target != "" {
+			merged[monitor.TargetSetting] = sub.Monitor.Target
+		}
+	}
+
+	return merged
+}
+
+// secretComparer compares stored config values, which may be encrypted, to
+// the spec's plaintext. The library key is loaded the first time it is needed.
+type secretComparer struct {
+	key    []byte
+	loaded bool
+}
+
+// equal returns true if `stored` is `plaintext` or decrypts to it
+func (comparer *secretComparer) equal(stored, plaintext string) bool {
+	if stored == plaintext {
+		return true
+	}
+
+	if !strings.HasPrefix(stored, secret.EncryptedPrefix) {
+		return false
+	}
+
+	if !comparer.loaded {
+		comparer.loaded = true
+		comparer.key, _ = secret.LoadKey()
+	}
+
+	if comparer.key == nil {
+		return false
+	}
+
+	decrypted, err := secret.Decrypt(comparer.key, stored)
+	return err == nil && decrypted == plaintext
+}
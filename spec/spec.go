@@ -0,0 +1,193 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package spec
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/penny-vault/pvdata/monitor"
+	"github.com/penny-vault/pvdata/provider"
+	"github.com/robfig/cron/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultSchedule is used for subscriptions that do not set a schedule
+const DefaultSchedule = "0 0 * * 1-5"
+
+var (
+	ErrUnknownFormat       = errors.New("spec must be a .yaml, .yml or .toml file")
+	ErrDuplicateName       = errors.New("subscription name is used more than once")
+	ErrMissingName         = errors.New("subscription must have a name")
+	ErrUnknownProvider     = errors.New("unknown provider")
+	ErrUnknownDataset      = errors.New("unknown dataset")
+	ErrInvalidSchedule     = errors.New("invalid schedule")
+	ErrInvalidSubscription = errors.New("invalid subscription")
+)
+
+// Spec is the desired state of a library
+type Spec struct {
+	Library       Library         `mapstructure:"library"`
+	Subscriptions []*Subscription `mapstructure:"subscriptions"`
+}
+
+// Library names the library and who owns it
+type Library struct {
+	Name  string `mapstructure:"name"`
+	Owner string `mapstructure:"owner"`
+}
+
+// Subscription is the desired state of one subscription. Subscriptions are
+// matched to the library by ID (or ID prefix) if set, otherwise by name,
+// provider and dataset.
+type Subscription struct {
+	ID       string `mapstructure:"id"`
+	Name     string `mapstructure:"name"`
+	Provider string `mapstructure:"provider"`
+	Dataset  string `mapstructure:"dataset"`
+
+	// Schedule defaults to DefaultSchedule for new subscriptions; existing
+	// subscriptions keep their schedule if it is not set
+	Schedule string            `mapstructure:"schedule"`
+	Active   *bool             `mapstructure:"active"`
+	Config   map[string]string `mapstructure:"config"`
+
+	// Settings listed are set on the subscription; others are left as-is
+	Settings map[string]string `mapstructure:"settings"`
+	Monitor  *Monitor          `mapstructure:"monitor"`
+}
+
+// Monitor selects how the subscription's runs are monitored
+type Monitor struct {
+	Kind   string `mapstructure:"kind"`
+	Target string `mapstructure:"target"`
+}
+
+// Load reads a YAML or TOML spec from `fn`
+func Load(fn string) (*Spec, error) {
+	contents, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(contents, strings.TrimPrefix(filepath.Ext(fn), "."))
+}
+
+// Parse decodes a spec in `format` (yaml, yml or toml). Numbers and booleans
+// in config and settings are converted to strings.
+func Parse(contents []byte, format string) (*Spec, error) {
+	var raw map[string]any
+	switch strings.ToLower(format) {
+	case "yaml", "yml":
+		if err := yaml.Unmarshal(contents, &raw); err != nil {
+			return nil, err
+		}
+	case "toml":
+		if err := toml.Unmarshal(contents, &raw); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrUnknownFormat
+	}
+
+	spec := &Spec{}
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		WeaklyTypedInput: true,
+		ErrorUnused:      true,
+		Result:           spec,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := decoder.Decode(raw); err != nil {
+		return nil, err
+	}
+
+	return spec, nil
+}
+
+// Validate checks every subscription in the spec and that their names are unique
+func (spec *Spec) Validate() error {
+	var errs []error
+	names := make(map[string]bool, len(spec.Subscriptions))
+	for _, sub := range spec.Subscriptions {
+		if err := sub.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+
+		if names[sub.Name] {
+			errs = append(errs, fmt.Errorf("%w: %s", ErrDuplicateName, sub.Name))
+		}
+		names[sub.Name] = true
+	}
+
+	return errors.Join(errs...)
+}
+
+// Validate checks the subscription's provider, dataset, schedule, config and monitor
+func (sub *Subscription) Validate() error {
+	if sub.Name == "" {
+		return ErrMissingName
+	}
+
+	wrap := func(err error) error {
+		return fmt.Errorf("%w %s: %w", ErrInvalidSubscription, sub.Name, err)
+	}
+
+	subProvider, ok := provider.Map[sub.Provider]
+	if !ok {
+		return wrap(fmt.Errorf("%w: %s", ErrUnknownProvider, sub.Provider))
+	}
+
+	if _, ok := subProvider.Datasets()[sub.Dataset]; !ok {
+		return wrap(fmt.Errorf("%w: %s", ErrUnknownDataset, sub.Dataset))
+	}
+
+	if _, err := cron.ParseStandard(sub.schedule()); err != nil {
+		return wrap(fmt.Errorf("%w: %w", ErrInvalidSchedule, err))
+	}
+
+	schema := subProvider.ConfigSchema()
+	if err := schema.Validate(schema.WithDefaults(sub.Config)); err != nil {
+		return wrap(err)
+	}
+
+	if sub.Monitor != nil {
+		if err := monitor.Validate(sub.Monitor.Kind, sub.Monitor.Target); err != nil {
+			return wrap(err)
+		}
+	}
+
+	return nil
+}
+
+// IsActive returns true unless the spec deactivates the subscription
+func (sub *Subscription) IsActive() bool {
+	return sub.Active == nil || *sub.Active
+}
+
+// schedule returns the subscription's schedule or DefaultSchedule
+func (sub *Subscription) schedule() string {
+	if sub.Schedule == "" {
+		return DefaultSchedule
+	}
+	return sub.Schedule
+}
@@ -0,0 +1,231 @@
+// Copyright 2024
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package spec_test
+
+import (
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/viper"
+
+	"github.com/penny-vault/pvdata/library"
+	"github.com/penny-vault/pvdata/monitor"
+	"github.com/penny-vault/pvdata/secret"
+	"github.com/penny-vault/pvdata/spec"
+)
+
+const yamlSpec = `
+library:
+  name: The Jeffersonian
+  owner: Thomas Jefferson
+subscriptions:
+  - name: Tiingo EOD
+    provider: tiingo
+    dataset: EOD
+    schedule: "30 18 * * 1-5"
+    config:
+      apiKey: abc123
+      rateLimit: 1000
+    settings:
+      universe: recent
+    monitor:
+      kind: webhook
+      target: https://hooks.example.com/pvdata
+`
+
+const tomlSpec = `
+[library]
+name = "The Jeffersonian"
+owner = "Thomas Jefferson"
+
+[[subscriptions]]
+name = "Tiingo EOD"
+provider = "tiingo"
+dataset = "EOD"
+schedule = "30 18 * * 1-5"
+active = false
+
+[subscriptions.config]
+apiKey = "abc123"
+rateLimit = 1000
+`
+
+var _ = Describe("Spec", func() {
+	It("parses YAML and TOML", func() {
+		parsed, err := spec.Parse([]byte(yamlSpec), "yaml")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(parsed.Library.Name).To(Equal("The Jeffersonian"))
+		Expect(parsed.Subscriptions).To(HaveLen(1))
+		Expect(parsed.Subscriptions[0].Config).To(Equal(map[string]string{"apiKey": "abc123", "rateLimit": "1000"}))
+		Expect(parsed.Subscriptions[0].Monitor.Kind).To(Equal(monitor.KindWebhook))
+		Expect(parsed.Subscriptions[0].IsActive()).To(BeTrue())
+		Expect(parsed.Validate()).To(Succeed())
+
+		parsed, err = spec.Parse([]byte(tomlSpec), "toml")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(parsed.Subscriptions[0].Config["rateLimit"]).To(Equal("1000"))
+		Expect(parsed.Subscriptions[0].IsActive()).To(BeFalse())
+		Expect(parsed.Validate()).To(Succeed())
+
+		_, err = spec.Parse([]byte(yamlSpec), "json")
+		Expect(err).To(MatchError(spec.ErrUnknownFormat))
+
+		_, err = spec.Parse([]byte("subscriptions:\n  - name: x\n    colour: blue\n"), "yaml")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("rejects invalid subscriptions", func() {
+		parsed := &spec.Spec{Subscriptions: []*spec.Subscription{
+			{Name: "a", Provider: "nope", Dataset: "EOD"},
+			{Name: "b", Provider: "tiingo", Dataset: "EOD", Schedule: "every day", Config: map[string]string{"apiKey": "x"}},
+			{Name: "c", Provider: "tiingo", Dataset: "EOD", Config: map[string]string{"rateLimit": "fast"}},
+			{Name: "c", Provider: "tiingo", Dataset: "EOD", Config: map[string]string{"apiKey": "x"}},
+		}}
+
+		err := parsed.Validate()
+		Expect(err).To(MatchError(spec.ErrUnknownProvider))
+		Expect(err).To(MatchError(spec.ErrInvalidSchedule))
+		Expect(err).To(MatchError(ContainSubstring("rateLimit")))
+		Expect(err).To(MatchError(spec.ErrDuplicateName))
+	})
+
+	Describe("Plan", func() {
+		var (
+			myLibrary *library.Library
+			existing  *library.Subscription
+			desired   *spec.Spec
+			key       string
+		)
+
+		BeforeEach(func() {
+			var err error
+			key, err = secret.GenerateKey()
+			Expect(err).ToNot(HaveOccurred())
+			viper.Set("secrets.key", key)
+			DeferCleanup(viper.Set, "secrets.key", "")
+
+			decoded, err := secret.ParseKey(key)
+			Expect(err).ToNot(HaveOccurred())
+			sealed, err := secret.Encrypt(decoded, "abc123")
+			Expect(err).ToNot(HaveOccurred())
+
+			myLibrary = &library.Library{}
+			existing = &library.Subscription{
+				ID:       uuid.MustParse("1a2b3c4d-0000-0000-0000-000000000000"),
+				Name:     "Tiingo EOD",
+				Provider: "tiingo",
+				Dataset:  "EOD",
+				Schedule: "30 18 * * 1-5",
+				Config:   map[string]string{"apiKey": sealed, "rateLimit": "1000"},
+				Settings: map[string]string{"universe": "recent", "quality.max_jump": "0.5"},
+				Active:   true,
+			}
+
+			desired, err = spec.Parse([]byte(yamlSpec), "yaml")
+			Expect(err).ToNot(HaveOccurred())
+			desired.Subscriptions[0].Monitor = nil
+		})
+
+		It("leaves matching subscriptions unchanged", func() {
+			actions, err := spec.Plan(myLibrary, desired, []*library.Subscription{existing}, false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(actions).To(HaveLen(1))
+			Expect(actions[0].Kind).To(Equal(spec.ActionUnchanged))
+			Expect(actions[0].Target.Config["apiKey"]).To(Equal(existing.Config["apiKey"]))
+		})
+
+		It("updates changed fields and masks secrets", func() {
+			desired.Subscriptions[0].Schedule = "0 19 * * 1-5"
+			desired.Subscriptions[0].Config["apiKey"] = "def456"
+			desired.Subscriptions[0].Monitor = &spec.Monitor{Kind: monitor.KindWebhook, Target: "https://hooks.example.com"}
+
+			actions, err := spec.Plan(myLibrary, desired, []*library.Subscription{existing}, false)
+			Expect(err).ToNot(HaveOccurred())
+
+			action := actions[0]
+			Expect(action.Kind).To(Equal(spec.ActionUpdate))
+			Expect(action.NeedsUpdate()).To(BeTrue())
+			Expect(action.ActiveChanged()).To(BeFalse())
+			Expect(action.Target.Schedule).To(Equal("0 19 * * 1-5"))
+			Expect(action.Target.Settings).To(HaveKeyWithValue("quality.max_jump", "0.5"))
+			Expect(action.Target.Settings).To(HaveKeyWithValue(monitor.KindSetting, monitor.KindWebhook))
+
+			plan := action.String()
+			Expect(plan).To(ContainSubstring(`schedule: "30 18 * * 1-5" -> "0 19 * * 1-5"`))
+			Expect(plan).To(ContainSubstring("config.apiKey: changed"))
+			Expect(plan).ToNot(ContainSubstring("def456"))
+
+			// the original subscription is not modified
+			Expect(existing.Schedule).To(Equal("30 18 * * 1-5"))
+		})
+
+		It("creates missing subscriptions and prunes unlisted ones", func() {
+			other := *existing
+			other.ID = uuid.MustParse("5e6f7a8b-0000-0000-0000-000000000000")
+			other.Name = "Old"
+
+			desired.Subscriptions[0].Name = "Tiingo Prices"
+			actions, err := spec.Plan(myLibrary, desired, []*library.Subscription{&other}, true)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(actions).To(HaveLen(2))
+
+			Expect(actions[0].Kind).To(Equal(spec.ActionCreate))
+			Expect(actions[0].Target.Name).To(Equal("Tiingo Prices"))
+			Expect(actions[0].Target.Schedule).To(Equal("30 18 * * 1-5"))
+			Expect(actions[0].Target.Settings).To(HaveKeyWithValue("universe", "recent"))
+
+			Expect(actions[1].Kind).To(Equal(spec.ActionUpdate))
+			Expect(actions[1].NeedsUpdate()).To(BeFalse())
+			Expect(actions[1].Target.Active).To(BeFalse())
+			Expect(actions[1].String()).To(HavePrefix("- deactivate Old [5e6f7a]"))
+		})
+
+		It("matches by ID prefix", func() {
+			desired.Subscriptions[0].ID = "1a2b3c"
+			desired.Subscriptions[0].Name = "Renamed"
+			actions, err := spec.Plan(myLibrary, desired, []*library.Subscription{existing}, false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(actions[0].Kind).To(Equal(spec.ActionUpdate))
+			Expect(actions[0].String()).To(ContainSubstring(`name: "Tiingo EOD" -> "Renamed"`))
+		})
+
+		It("removes the health check when the monitor moves away from healthchecks", func() {
+			existing.HealthCheckID = "check-1"
+			existing.Settings[monitor.KindSetting] = monitor.KindHealthchecks
+
+			desired.Subscriptions[0].Monitor = &spec.Monitor{Kind: monitor.KindWebhook, Target: "https://hooks.example.com"}
+			actions, err := spec.Plan(myLibrary, desired, []*library.Subscription{existing}, false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(actions[0].Target.HealthCheckID).To(BeEmpty())
+			Expect(actions[0].Changes).To(ContainElement(&spec.Change{Field: spec.HealthCheckField, From: "check-1"}))
+
+			// specs without a monitor leave the health check alone
+			desired.Subscriptions[0].Monitor = nil
+			actions, err = spec.Plan(myLibrary, desired, []*library.Subscription{existing}, false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(actions[0].Target.HealthCheckID).To(Equal("check-1"))
+		})
+
+		It("rejects an ID whose subscription has a different provider or dataset", func() {
+			desired.Subscriptions[0].ID = "1a2b3c"
+			existing.Provider = "polygon"
+			existing.Dataset = "Stock Tickers"
+
+			_, err := spec.Plan(myLibrary, desired, []*library.Subscription{existing}, false)
+			Expect(err).To(MatchError(spec.ErrIDMismatch))
+			Expect(err).To(MatchError(ContainSubstring("polygon/Stock Tickers")))
+		})
+	})
+})